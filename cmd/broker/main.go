@@ -16,32 +16,103 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"go.uber.org/multierr"
 
+	"github.com/baibikov/jellyfish/internal/admin"
 	"github.com/baibikov/jellyfish/internal/broker"
 	"github.com/baibikov/jellyfish/internal/config"
+	"github.com/baibikov/jellyfish/internal/reload"
+	"github.com/baibikov/jellyfish/internal/tracing"
 )
 
-func init() {
-	logrus.SetLevel(logrus.DebugLevel)
-}
-
-const configPath = "./configs/broker.yaml"
+const (
+	defaultConfigPath      = "./configs/broker.yaml"
+	adminShutdownTimeout   = time.Second * 5
+	tracingShutdownTimeout = time.Second * 5
+)
 
 func main() {
-	if err := run(); err != nil {
+	if err := run(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
 		logrus.Error(err)
 		os.Exit(1)
 	}
 }
 
-func run() (err error) {
+type options struct {
+	configPath  string
+	explicit    bool
+	printConfig bool
+	flags       map[string]string
+}
+
+func parseFlags(args []string) (*options, error) {
+	o := &options{}
+	fs := flag.NewFlagSet("broker", flag.ContinueOnError)
+	fs.StringVar(&o.configPath, "config", defaultConfigPath, "config file path, env JELLYFISH_CONFIG")
+	fs.BoolVar(&o.printConfig, "print-config", false, "print the effective config and exit")
+	o.flags = config.Flags(fs)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "Usage: broker [flags]\n\n"+
+			"Config precedence: defaults < config file < JELLYFISH_* environment < flags.\n\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "config" {
+			o.explicit = true
+		}
+	})
+	if path, ok := os.LookupEnv(configEnv); ok && !o.explicit {
+		o.configPath, o.explicit = path, true
+	}
+
+	return o, nil
+}
+
+const configEnv = config.EnvPrefix + "CONFIG"
+
+func run(args []string) (err error) {
+	o, err := parseFlags(args)
+	if err != nil {
+		return err
+	}
+
+	cnf, err := config.Load(o.configPath, o.explicit, config.Environ(os.LookupEnv), o.flags)
+	if err != nil {
+		return errors.Wrap(err, "jellyfish: load config")
+	}
+
+	if o.printConfig {
+		bb, err := cnf.Marshal()
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(bb)
+		return err
+	}
+
+	level, err := logrus.ParseLevel(cnf.LogLevel)
+	if err != nil {
+		return errors.Wrap(err, "jellyfish: parse log level")
+	}
+	logrus.SetLevel(level)
+
 	logrus.Info("init jellyfish ctx")
 	ctx, cancel := signal.NotifyContext(
 		context.Background(),
@@ -51,11 +122,20 @@ func run() (err error) {
 	)
 	defer cancel()
 
-	logrus.Info("init and parse jellyfish config")
-	cnf, err := config.New(configPath)
+	logrus.Infof("jellyfish config loaded from %s", o.configPath)
+
+	logrus.Info("init jellyfish tracing")
+	shutdownTracing, err := tracing.Init(ctx, cnf.Tracing)
 	if err != nil {
-		return errors.Wrapf(err, "jellyfish: parse config by path %s", configPath)
+		return errors.Wrap(err, "jellyfish: init tracing")
 	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logrus.Error(err)
+		}
+	}()
 
 	logrus.Infof("init jellyfish broker at addr %s", cnf.Addr)
 	listener, err := broker.New(cnf)
@@ -68,7 +148,52 @@ func run() (err error) {
 		multierr.AppendInto(&err, errors.Wrap(listener.Broadcast(ctx), "jellyfish"))
 	}()
 
+	reloader := reload.New(cnf, func() (*config.Config, error) {
+		return config.Load(o.configPath, o.explicit, config.Environ(os.LookupEnv), o.flags)
+	}, listener)
+	go reloadOnSignal(ctx, reloader)
+
+	if cnf.AdminAddr != "" {
+		logrus.Infof("init jellyfish admin at addr %s", cnf.AdminAddr)
+		server, err := admin.New(cnf.AdminAddr, listener, admin.WithReloader(reloader))
+		if err != nil {
+			return errors.Wrapf(err, "jellyfish: run admin on host %s", cnf.AdminAddr)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), adminShutdownTimeout)
+			defer cancel()
+			logrus.Info("stop jellyfish admin")
+			if err := server.Shutdown(ctx); err != nil {
+				logrus.Error(err)
+			}
+		}()
+		go func() {
+			if err := server.Serve(); err != nil {
+				logrus.Error(errors.Wrap(err, "jellyfish"))
+			}
+		}()
+	}
+
 	<-ctx.Done()
 	logrus.Info("stop jellyfish broker app")
 	return nil
 }
+
+// reloadOnSignal reloads the config on every SIGHUP until the ctx is done.
+func reloadOnSignal(ctx context.Context, reloader *reload.Reloader) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			logrus.Info("jellyfish: SIGHUP received, reload config")
+			if _, err := reloader.Reload(); err != nil {
+				logrus.Error(errors.Wrap(err, "jellyfish"))
+			}
+		}
+	}
+}
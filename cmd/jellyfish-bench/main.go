@@ -0,0 +1,358 @@
+/*
+Copyright 2022 Jellyfish message broker
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/baibikov/jellyfish/internal/broker"
+	"github.com/baibikov/jellyfish/internal/config"
+	"github.com/baibikov/jellyfish/pkg/brokererr"
+	"github.com/baibikov/jellyfish/pkg/consumer"
+	"github.com/baibikov/jellyfish/pkg/producer"
+)
+
+type options struct {
+	addr      string
+	topic     string
+	topics    int
+	producers int
+	consumers int
+	size      int
+	rate      int
+	batch     int
+	acks      string
+	duration  time.Duration
+	drain     time.Duration
+	json      bool
+}
+
+// timestampSize is the prefix of every message with its unix nano send time.
+const timestampSize = 8
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "jellyfish-bench:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	o := &options{}
+	flag.StringVar(&o.addr, "addr", "", "broker address, empty starts an embedded in-process broker")
+	flag.StringVar(&o.topic, "topic", "", "topic, empty generates a unique one")
+	flag.IntVar(&o.topics, "topics", 1, "number of topics the producers and consumers are spread over in turn")
+	flag.IntVar(&o.producers, "producers", 1, "number of producers")
+	flag.IntVar(&o.consumers, "consumers", 1, "number of consumers sharing one group")
+	flag.IntVar(&o.size, "size", 128, "message size in bytes, at least 8")
+	flag.IntVar(&o.rate, "rate", 0, "messages per second by producer, zero is unlimited")
+	flag.IntVar(&o.batch, "batch", 1, "messages sent before waiting for acknowledgements")
+	flag.StringVar(&o.acks, "acks", "all", "acknowledgement level: all, leader or none")
+	flag.DurationVar(&o.duration, "duration", time.Second*10, "producing duration")
+	flag.DurationVar(&o.drain, "drain", time.Second*5, "time consumers get to read the rest after producing")
+	flag.BoolVar(&o.json, "json", false, "print the report as json")
+	flag.Parse()
+
+	if err := o.validate(); err != nil {
+		return err
+	}
+
+	logrus.SetLevel(logrus.WarnLevel)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if o.addr == "" {
+		listener, err := broker.New(&config.Config{Addr: "127.0.0.1:0"})
+		if err != nil {
+			return errors.Wrap(err, "start embedded broker")
+		}
+		defer listener.Close()
+		go func() {
+			if err := listener.Broadcast(ctx); err != nil {
+				logrus.Error(err)
+			}
+		}()
+		o.addr = listener.Addr().String()
+	}
+	if o.topic == "" {
+		o.topic = fmt.Sprintf("bench-%d", time.Now().UnixNano())
+	}
+
+	r, err := bench(ctx, o)
+	if err != nil {
+		return err
+	}
+
+	if o.json {
+		return r.printJSON(os.Stdout)
+	}
+	return r.print(os.Stdout)
+}
+
+func (o *options) validate() error {
+	switch {
+	case o.producers < 0, o.consumers < 0:
+		return errors.New("producers and consumers have not be negative")
+	case o.producers == 0 && o.consumers == 0:
+		return errors.New("at least one producer or consumer is required")
+	case o.size < timestampSize:
+		return errors.Errorf("size has not be less than %d", timestampSize)
+	case o.topics < 1:
+		return errors.New("topics has not be less than 1")
+	case o.batch < 1:
+		return errors.New("batch has not be less than 1")
+	case o.rate < 0:
+		return errors.New("rate has not be negative")
+	case o.duration <= 0:
+		return errors.New("duration has be positive")
+	}
+
+	_, err := parseAcks(o.acks)
+	return err
+}
+
+// topicName is the topic of the i-th producer or consumer.
+func (o *options) topicName(i int) string {
+	if o.topics == 1 {
+		return o.topic
+	}
+
+	return fmt.Sprintf("%s-%d", o.topic, i%o.topics)
+}
+
+func parseAcks(acks string) (producer.Acks, error) {
+	switch acks {
+	case "all":
+		return producer.AcksAll, nil
+	case "leader":
+		return producer.AcksLeader, nil
+	case "none":
+		return producer.AcksNone, nil
+	default:
+		return 0, errors.Errorf("undefined acks %q, want all, leader or none", acks)
+	}
+}
+
+// counters are shared by the producers and consumers of a run.
+type counters struct {
+	produced      atomic.Int64
+	produceErrors atomic.Int64
+	consumed      atomic.Int64
+	producing     atomic.Bool
+
+	mutex        sync.Mutex
+	produceLat   []time.Duration
+	endToEnd     []time.Duration
+	produceError string
+}
+
+func (c *counters) addProduceLatency(d time.Duration, n int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for i := 0; i < n; i++ {
+		c.produceLat = append(c.produceLat, d)
+	}
+}
+
+// addProduceErrors counts the messages of a failed push,
+// the first error is kept for the report.
+func (c *counters) addProduceErrors(err error, n int) {
+	c.produceErrors.Add(int64(n))
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.produceError == "" {
+		c.produceError = err.Error()
+	}
+}
+
+func (c *counters) addEndToEnd(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.endToEnd = append(c.endToEnd, d)
+}
+
+func bench(ctx context.Context, o *options) (*report, error) {
+	acks, _ := parseAcks(o.acks)
+	c := &counters{}
+	c.producing.Store(o.producers > 0)
+
+	consumeCtx, stopConsume := context.WithCancel(ctx)
+	defer stopConsume()
+
+	var consumers sync.WaitGroup
+	errs := make(chan error, o.consumers)
+	for i := 0; i < o.consumers; i++ {
+		topic := o.topicName(i)
+		cc, err := consumer.New(&consumer.Config{Addr: o.addr, ClientID: "jellyfish-bench", Group: "jellyfish-bench"})
+		if err != nil {
+			return nil, err
+		}
+		defer cc.Close()
+
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			errs <- consume(consumeCtx, cc, topic, c)
+		}()
+	}
+
+	produceCtx, stopProduce := context.WithTimeout(ctx, o.duration)
+	defer stopProduce()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	start := time.Now()
+	var producers sync.WaitGroup
+	for i := 0; i < o.producers; i++ {
+		topic := o.topicName(i)
+		p, err := producer.New(&producer.Config{Addr: o.addr, ClientID: "jellyfish-bench", Acks: acks})
+		if err != nil {
+			return nil, err
+		}
+		defer p.Close()
+
+		producers.Add(1)
+		go func() {
+			defer producers.Done()
+			produce(produceCtx, p, topic, o, c)
+		}()
+	}
+
+	producers.Wait()
+	produceElapsed := time.Since(start)
+	c.producing.Store(false)
+
+	if o.consumers > 0 {
+		drained := time.After(o.drain)
+		if o.producers == 0 {
+			drained = time.After(o.duration)
+		}
+	wait:
+		for o.producers == 0 || c.consumed.Load() < c.produced.Load() {
+			select {
+			case <-drained:
+				break wait
+			case <-ctx.Done():
+				break wait
+			case <-time.After(time.Millisecond * 10):
+			}
+		}
+	}
+	consumeElapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	stopConsume()
+	consumers.Wait()
+
+	close(errs)
+	for err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+	}
+
+	r := newReport(o, c, produceElapsed, consumeElapsed)
+	r.setAllocs(&before, &after)
+	return r, nil
+}
+
+// produce pushes the batches until ctx is done. A failed push is counted and
+// the run goes on, the producer stops only once its connection is broken.
+func produce(ctx context.Context, p *producer.Producer, topic string, o *options, c *counters) {
+	var interval time.Duration
+	if o.rate > 0 {
+		interval = time.Second * time.Duration(o.batch) / time.Duration(o.rate)
+	}
+
+	batch := make([]*producer.Params, o.batch)
+	next := time.Now()
+	for ctx.Err() == nil {
+		if interval > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Until(next)):
+			}
+			next = next.Add(interval)
+		}
+
+		now := time.Now()
+		for i := range batch {
+			message := make([]byte, o.size)
+			binary.BigEndian.PutUint64(message, uint64(now.UnixNano()))
+			batch[i] = &producer.Params{
+				Topic:   topic,
+				Message: message,
+			}
+		}
+
+		if err := p.PushBatch(context.Background(), batch); err != nil {
+			c.addProduceErrors(errors.Wrap(err, "push batch"), len(batch))
+			// a message refused by the broker leaves the connection usable
+			if !errors.As(err, new(*brokererr.Error)) || errors.Is(err, brokererr.ErrGoingAway) {
+				return
+			}
+			continue
+		}
+
+		c.addProduceLatency(time.Since(now), len(batch))
+		c.produced.Add(int64(len(batch)))
+	}
+}
+
+func consume(ctx context.Context, cc *consumer.Consumer, topic string, c *counters) error {
+	payloads := cc.Consume(ctx, topic)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case p, ok := <-payloads:
+			if !ok {
+				return nil
+			}
+			if err := p.Err(); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return errors.Wrap(err, "consume")
+			}
+			if len(p.Message) < timestampSize {
+				continue
+			}
+
+			sent := time.Unix(0, int64(binary.BigEndian.Uint64(p.Message)))
+			c.addEndToEnd(time.Since(sent))
+			c.consumed.Add(1)
+		}
+	}
+}
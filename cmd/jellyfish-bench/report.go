@@ -0,0 +1,172 @@
+/*
+Copyright 2022 Jellyfish message broker
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+type latency struct {
+	P50  float64 `json:"p50_ms"`
+	P99  float64 `json:"p99_ms"`
+	P999 float64 `json:"p999_ms"`
+	Max  float64 `json:"max_ms"`
+}
+
+func newLatency(dd []time.Duration) latency {
+	if len(dd) == 0 {
+		return latency{}
+	}
+
+	sort.Slice(dd, func(i, j int) bool { return dd[i] < dd[j] })
+	return latency{
+		P50:  percentile(dd, 0.5),
+		P99:  percentile(dd, 0.99),
+		P999: percentile(dd, 0.999),
+		Max:  milliseconds(dd[len(dd)-1]),
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted durations.
+func percentile(sorted []time.Duration, p float64) float64 {
+	i := int(math.Ceil(float64(len(sorted))*p)) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+
+	return milliseconds(sorted[i])
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+type report struct {
+	Addr        string `json:"addr"`
+	Topic       string `json:"topic"`
+	Topics      int    `json:"topics"`
+	Producers   int    `json:"producers"`
+	Consumers   int    `json:"consumers"`
+	MessageSize int    `json:"message_size"`
+	Batch       int    `json:"batch"`
+	Acks        string `json:"acks"`
+
+	Produced        int64   `json:"produced"`
+	ProduceErrors   int64   `json:"produce_errors"`
+	ProduceError    string  `json:"produce_error,omitempty"`
+	ProduceSeconds  float64 `json:"produce_seconds"`
+	ProduceRate     float64 `json:"produce_msg_per_sec"`
+	ProduceMBPerSec float64 `json:"produce_mb_per_sec"`
+	ProduceLatency  latency `json:"produce_latency"`
+
+	Consumed        int64   `json:"consumed"`
+	ConsumeSeconds  float64 `json:"consume_seconds"`
+	ConsumeRate     float64 `json:"consume_msg_per_sec"`
+	ConsumeMBPerSec float64 `json:"consume_mb_per_sec"`
+	EndToEnd        latency `json:"end_to_end_latency"`
+
+	// Allocs and AllocBytes are by produced message in the bench process,
+	// with the embedded broker they include the broker allocations.
+	Allocs     float64 `json:"allocs_per_msg"`
+	AllocBytes float64 `json:"alloc_bytes_per_msg"`
+}
+
+func newReport(o *options, c *counters, produceElapsed, consumeElapsed time.Duration) *report {
+	r := &report{
+		Addr:           o.addr,
+		Topic:          o.topic,
+		Topics:         o.topics,
+		Producers:      o.producers,
+		Consumers:      o.consumers,
+		MessageSize:    o.size,
+		Batch:          o.batch,
+		Acks:           o.acks,
+		Produced:       c.produced.Load(),
+		ProduceErrors:  c.produceErrors.Load(),
+		ProduceError:   c.produceError,
+		ProduceSeconds: produceElapsed.Seconds(),
+		ProduceLatency: newLatency(c.produceLat),
+		Consumed:       c.consumed.Load(),
+		ConsumeSeconds: consumeElapsed.Seconds(),
+		EndToEnd:       newLatency(c.endToEnd),
+	}
+
+	const mb = 1 << 20
+	if r.ProduceSeconds > 0 {
+		r.ProduceRate = float64(r.Produced) / r.ProduceSeconds
+		r.ProduceMBPerSec = r.ProduceRate * float64(o.size) / mb
+	}
+	if r.ConsumeSeconds > 0 {
+		r.ConsumeRate = float64(r.Consumed) / r.ConsumeSeconds
+		r.ConsumeMBPerSec = r.ConsumeRate * float64(o.size) / mb
+	}
+
+	return r
+}
+
+func (r *report) setAllocs(before, after *runtime.MemStats) {
+	if r.Produced == 0 {
+		return
+	}
+
+	r.Allocs = float64(after.Mallocs-before.Mallocs) / float64(r.Produced)
+	r.AllocBytes = float64(after.TotalAlloc-before.TotalAlloc) / float64(r.Produced)
+}
+
+func (r *report) printJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+func (r *report) print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Broker:\t%s\n", r.Addr)
+	fmt.Fprintf(tw, "Topic:\t%s\n", r.Topic)
+	if r.Topics > 1 {
+		fmt.Fprintf(tw, "Topics:\t%d (%s-0 .. %s-%d)\n", r.Topics, r.Topic, r.Topic, r.Topics-1)
+	}
+	fmt.Fprintf(tw, "Producers / consumers:\t%d / %d\n", r.Producers, r.Consumers)
+	fmt.Fprintf(tw, "Message size / batch / acks:\t%d B / %d / %s\n\n", r.MessageSize, r.Batch, r.Acks)
+
+	fmt.Fprintf(tw, "Produced:\t%d msg in %.2fs (%d errors)\n", r.Produced, r.ProduceSeconds, r.ProduceErrors)
+	if r.ProduceError != "" {
+		fmt.Fprintf(tw, "First produce error:\t%s\n", r.ProduceError)
+	}
+	fmt.Fprintf(tw, "Produce throughput:\t%.0f msg/s, %.2f MB/s\n", r.ProduceRate, r.ProduceMBPerSec)
+	fmt.Fprintf(tw, "Produce latency:\t%s\n\n", r.ProduceLatency)
+
+	fmt.Fprintf(tw, "Consumed:\t%d msg in %.2fs\n", r.Consumed, r.ConsumeSeconds)
+	fmt.Fprintf(tw, "Consume throughput:\t%.0f msg/s, %.2f MB/s\n", r.ConsumeRate, r.ConsumeMBPerSec)
+	fmt.Fprintf(tw, "End-to-end latency:\t%s\n\n", r.EndToEnd)
+
+	fmt.Fprintf(tw, "Allocations:\t%.1f allocs/msg, %.0f B/msg\n", r.Allocs, r.AllocBytes)
+
+	return tw.Flush()
+}
+
+func (l latency) String() string {
+	return fmt.Sprintf("p50 %.3fms, p99 %.3fms, p999 %.3fms, max %.3fms", l.P50, l.P99, l.P999, l.Max)
+}
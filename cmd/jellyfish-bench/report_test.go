@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/baibikov/jellyfish/pkg/producer"
+)
+
+func TestNewLatency(t *testing.T) {
+	dd := make([]time.Duration, 0, 1000)
+	for i := 1000; i > 0; i-- {
+		dd = append(dd, time.Duration(i)*time.Millisecond)
+	}
+
+	l := newLatency(dd)
+	if l.P50 != 500 || l.P99 != 990 || l.P999 != 999 || l.Max != 1000 {
+		t.Fatalf("latency = %+v, want p50 500 p99 990 p999 999 max 1000", l)
+	}
+
+	// nearest rank: the p99 of 60 samples is the 60th
+	dd = dd[:0]
+	for i := 1; i <= 60; i++ {
+		dd = append(dd, time.Duration(i)*time.Millisecond)
+	}
+	if l := newLatency(dd); l.P50 != 30 || l.P99 != 60 {
+		t.Fatalf("latency of 60 = %+v, want p50 30 p99 60", l)
+	}
+
+	if l := newLatency([]time.Duration{time.Millisecond * 3}); l.P50 != 3 || l.P999 != 3 || l.Max != 3 {
+		t.Fatalf("latency of one = %+v, want 3", l)
+	}
+	if l := newLatency(nil); l != (latency{}) {
+		t.Fatalf("latency of none = %+v, want zero", l)
+	}
+}
+
+func TestNewReport(t *testing.T) {
+	o := &options{topic: "bench", topics: 1, producers: 1, consumers: 1, size: 1 << 10, batch: 1, acks: "all"}
+
+	c := &counters{}
+	c.produced.Store(2048)
+	c.consumed.Store(1024)
+	c.addProduceLatency(time.Millisecond, 2)
+
+	r := newReport(o, c, time.Second*2, time.Second)
+	if r.ProduceRate != 1024 || r.ProduceMBPerSec != 1 {
+		t.Fatalf("produce rate = %v msg/s %v MB/s, want 1024 and 1", r.ProduceRate, r.ProduceMBPerSec)
+	}
+	if r.ConsumeRate != 1024 || r.ConsumeMBPerSec != 1 {
+		t.Fatalf("consume rate = %v msg/s %v MB/s, want 1024 and 1", r.ConsumeRate, r.ConsumeMBPerSec)
+	}
+	if r.ProduceLatency.Max != 1 {
+		t.Fatalf("produce latency = %+v", r.ProduceLatency)
+	}
+
+	c.addProduceErrors(errors.New("first"), 3)
+	c.addProduceErrors(errors.New("second"), 1)
+	if r := newReport(o, c, time.Second, time.Second); r.ProduceErrors != 4 || r.ProduceError != "first" {
+		t.Fatalf("produce errors = %d %q, want 4 first", r.ProduceErrors, r.ProduceError)
+	}
+
+	r.setAllocs(&runtime.MemStats{Mallocs: 100, TotalAlloc: 1000}, &runtime.MemStats{Mallocs: 4196, TotalAlloc: 205800})
+	if r.Allocs != 2 || r.AllocBytes != 100 {
+		t.Fatalf("allocs = %v %v bytes by message, want 2 and 100", r.Allocs, r.AllocBytes)
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	valid := func() *options {
+		return &options{topics: 1, producers: 1, size: timestampSize, batch: 1, acks: "all", duration: time.Second}
+	}
+	if err := valid().validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, change := range map[string]func(o *options){
+		"negative producers": func(o *options) { o.producers = -1 },
+		"no clients":         func(o *options) { o.producers = 0 },
+		"small size":         func(o *options) { o.size = timestampSize - 1 },
+		"no topics":          func(o *options) { o.topics = 0 },
+		"no batch":           func(o *options) { o.batch = 0 },
+		"negative rate":      func(o *options) { o.rate = -1 },
+		"no duration":        func(o *options) { o.duration = 0 },
+		"undefined acks":     func(o *options) { o.acks = "some" },
+	} {
+		o := valid()
+		change(o)
+		if err := o.validate(); err == nil {
+			t.Fatalf("%s is accepted", name)
+		}
+	}
+}
+
+func TestParseAcks(t *testing.T) {
+	for acks, want := range map[string]producer.Acks{
+		"all":    producer.AcksAll,
+		"leader": producer.AcksLeader,
+		"none":   producer.AcksNone,
+	} {
+		if got, err := parseAcks(acks); err != nil || got != want {
+			t.Fatalf("parseAcks(%s) = %v, %v, want %v", acks, got, err, want)
+		}
+	}
+}
+
+func TestTopicName(t *testing.T) {
+	o := &options{topic: "bench", topics: 1}
+	if o.topicName(5) != "bench" {
+		t.Fatalf("single topic = %s", o.topicName(5))
+	}
+
+	o.topics = 4
+	if o.topicName(5) != "bench-1" {
+		t.Fatalf("topic of the 5th client = %s, want bench-1", o.topicName(5))
+	}
+}
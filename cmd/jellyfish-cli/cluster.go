@@ -0,0 +1,67 @@
+/*
+Copyright 2022 Jellyfish message broker
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func cluster(ctx context.Context, g *globals, args []string) error {
+	if len(args) != 1 || args[0] != "status" {
+		return errors.New("usage: jellyfish-cli cluster status")
+	}
+
+	a, err := newAdmin(g)
+	if err != nil {
+		return err
+	}
+
+	status, err := a.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := newTable()
+	fmt.Fprintf(w, "Broker:\t%s\n", g.addr)
+	fmt.Fprintf(w, "Ready:\t%t\n", status.Ready)
+	fmt.Fprintf(w, "Topics:\t%d\n", status.Topics)
+	fmt.Fprintf(w, "Clients:\t%d\n\n", len(status.Clients))
+
+	fmt.Fprintln(w, "PEER\tINITIALIZED\tFAILED")
+	for _, p := range status.Peers {
+		fmt.Fprintf(w, "%s\t%t\t%t\n", p.Addr, p.Initialized, p.Failed)
+	}
+
+	fmt.Fprintln(w, "\nCLIENT\tROLE\tID\tVERSION\tPROTOCOL\tCONNECTED")
+	for _, c := range status.Clients {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", c.RemoteAddr, c.Role, dash(c.ClientID), dash(c.ClientVersion),
+			c.ProtocolVersion, c.ConnectedAt.Format(time.RFC3339))
+	}
+
+	return w.Flush()
+}
+
+// dash shows an empty value as "-".
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
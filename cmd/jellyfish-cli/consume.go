@@ -0,0 +1,180 @@
+/*
+Copyright 2022 Jellyfish message broker
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/pkg/consumer"
+)
+
+const (
+	formatRaw  = "raw"
+	formatJSON = "json"
+	formatHex  = "hex"
+)
+
+func consume(ctx context.Context, g *globals, args []string) error {
+	var (
+		group     string
+		offset    int64
+		since     string
+		follow    bool
+		format    string
+		idle      time.Duration
+		max       int
+		filter    string
+		snapshot  bool
+		committed bool
+	)
+
+	fs := flag.NewFlagSet("consume", flag.ContinueOnError)
+	fs.StringVar(&group, "group", "", "consumer group, empty is the broker default group")
+	fs.Int64Var(&offset, "from-offset", -1, "start from the offset")
+	fs.StringVar(&since, "from-time", "", "start from the first message written at or after the RFC3339 time")
+	fs.BoolVar(&follow, "follow", false, "wait for new messages instead of exiting when the topic is drained")
+	fs.StringVar(&format, "format", formatRaw, "output format: raw, json or hex")
+	fs.DurationVar(&idle, "idle-timeout", time.Second, "without -follow exit after no messages for the duration")
+	fs.StringVar(&filter, "filter", "", `skip the messages not matching the expression, e.g. headers.type == "order"`)
+	fs.BoolVar(&snapshot, "snapshot", false, "read from the earliest offset and report the snapshot end on stderr")
+	fs.BoolVar(&committed, "read-committed", false, "read only the messages of the committed transactions")
+	fs.IntVar(&max, "max", 0, "exit after the number of messages, zero is unlimited")
+	fs.Usage = func() {
+		fs.Output().Write([]byte("Usage: jellyfish-cli consume [flags] TOPIC [TOPIC...]\n\n" +
+			"A topic may be a pattern: orders.* matches one dot-separated token,\n" +
+			"events.> one or more trailing tokens and re:<regexp> a regular expression.\n\n"))
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("topic is required")
+	}
+
+	print, err := printer(os.Stdout, format)
+	if err != nil {
+		return err
+	}
+
+	config := &consumer.Config{
+		Addr:          g.addr,
+		ClientID:      clientID,
+		Group:         group,
+		Filter:        filter,
+		Snapshot:      snapshot,
+		ReadCommitted: committed,
+	}
+	if offset >= 0 {
+		config.Offset = &offset
+	}
+	if since != "" {
+		config.Since, err = time.Parse(time.RFC3339, since)
+		if err != nil {
+			return errors.Wrap(err, "parse -from-time")
+		}
+	}
+
+	c, err := consumer.New(config)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	payloads := c.ConsumeTopics(ctx, fs.Args()...)
+	for n := 0; max == 0 || n < max; n++ {
+		var drained <-chan time.Time
+		if !follow {
+			drained = time.After(idle)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-drained:
+			return nil
+		case p, ok := <-payloads:
+			if !ok {
+				return nil
+			}
+			if err := p.Err(); err != nil {
+				return err
+			}
+			if p.SnapshotEnd {
+				fmt.Fprintln(os.Stderr, "snapshot end")
+				n--
+				continue
+			}
+			if err := print(p); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+type jsonMessage struct {
+	Topic     string            `json:"topic"`
+	Offset    int64             `json:"offset"`
+	Timestamp time.Time         `json:"timestamp"`
+	Priority  int               `json:"priority,omitempty"`
+	Key       string            `json:"key,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Message   string            `json:"message"`
+}
+
+func printer(w io.Writer, format string) (func(p consumer.Payload) error, error) {
+	switch format {
+	case formatRaw:
+		return func(p consumer.Payload) error {
+			_, err := fmt.Fprintf(w, "%s\n", p.Message)
+			return err
+		}, nil
+	case formatHex:
+		return func(p consumer.Payload) error {
+			_, err := fmt.Fprintln(w, hex.EncodeToString(p.Message))
+			return err
+		}, nil
+	case formatJSON:
+		encoder := json.NewEncoder(w)
+		return func(p consumer.Payload) error {
+			return encoder.Encode(jsonMessage{
+				Topic:     p.Topic,
+				Offset:    p.Offset,
+				Timestamp: p.Timestamp,
+				Priority:  p.Priority,
+				Key:       p.Key,
+				Headers:   p.Headers,
+				Message:   string(p.Message),
+			})
+		}, nil
+	default:
+		return nil, errors.Errorf("undefined format %q, want raw, json or hex", format)
+	}
+}
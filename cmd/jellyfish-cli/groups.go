@@ -0,0 +1,104 @@
+/*
+Copyright 2022 Jellyfish message broker
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/pkg/admin"
+)
+
+// parseGroup maps "-" to the broker default group.
+func parseGroup(group string) string {
+	if group == "-" {
+		return ""
+	}
+
+	return group
+}
+
+func groups(ctx context.Context, g *globals, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: jellyfish-cli groups list|describe|reset-offsets [GROUP], - is the default group")
+	}
+
+	a, err := newAdmin(g)
+	if err != nil {
+		return err
+	}
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "list":
+		offsets, err := a.Groups(ctx)
+		if err != nil {
+			return err
+		}
+		return printOffsets(offsets)
+	case "describe":
+		if len(args) != 1 {
+			return errors.New("usage: jellyfish-cli groups describe GROUP")
+		}
+
+		offsets, err := a.Group(ctx, parseGroup(args[0]))
+		if err != nil {
+			return err
+		}
+		return printOffsets(offsets)
+	case "reset-offsets":
+		var topic, to string
+		fs := flag.NewFlagSet("groups reset-offsets", flag.ContinueOnError)
+		fs.StringVar(&topic, "topic", "", "topic to reset, empty resets every topic of the group")
+		fs.StringVar(&to, "to", admin.ResetEarliest, "position: earliest, latest, an offset or a RFC3339 time")
+		fs.Usage = func() {
+			fs.Output().Write([]byte("Usage: jellyfish-cli groups reset-offsets [flags] GROUP\n\n"))
+			fs.PrintDefaults()
+		}
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return errors.New("group is required")
+		}
+
+		offsets, err := a.ResetOffsets(ctx, parseGroup(fs.Arg(0)), topic, to)
+		if err != nil {
+			return err
+		}
+		return printOffsets(offsets)
+	default:
+		return errors.Errorf("undefined groups command %q", command)
+	}
+}
+
+func printOffsets(offsets []admin.GroupOffset) error {
+	w := newTable()
+	fmt.Fprintln(w, "GROUP\tTOPIC\tOFFSET\tLAG\tCOMMITTED")
+	for _, o := range offsets {
+		committed := "-"
+		if o.Committed != nil {
+			committed = strconv.FormatInt(*o.Committed, 10)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", displayGroup(o.Group), o.Topic, o.Offset, o.Lag, committed)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2022 Jellyfish message broker
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+const usage = `jellyfish-cli is a command-line client of the jellyfish broker.
+
+Usage:
+
+	jellyfish-cli [global flags] <command> [flags] [args]
+
+Commands:
+
+	produce         TOPIC [MESSAGE...]   produce messages from args, stdin lines or a file
+	consume         TOPIC [TOPIC...]     consume messages of topics or topic patterns
+	topics          list|create|configure|describe|delete [TOPIC]
+	groups          list|describe|reset-offsets [GROUP]
+	schemas         list|describe|register|compatibility|get [TOPIC|ID]
+	cluster         status
+
+Global flags:
+`
+
+// clientID names the command-line client to the broker.
+const clientID = "jellyfish-cli"
+
+// globals are the flags shared by every command.
+type globals struct {
+	addr  string
+	admin string
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "jellyfish-cli:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	g := &globals{}
+	fs := flag.NewFlagSet("jellyfish-cli", flag.ContinueOnError)
+	fs.StringVar(&g.addr, "addr", "localhost:7654", "broker address")
+	fs.StringVar(&g.admin, "admin", "localhost:7655", "broker admin http address")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("command is required")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	command, args := fs.Arg(0), fs.Args()[1:]
+	switch command {
+	case "produce":
+		return produce(ctx, g, args)
+	case "consume":
+		return consume(ctx, g, args)
+	case "topics":
+		return topics(ctx, g, args)
+	case "groups":
+		return groups(ctx, g, args)
+	case "schemas":
+		return schemas(ctx, g, args)
+	case "cluster":
+		return cluster(ctx, g, args)
+	default:
+		fs.Usage()
+		return errors.Errorf("undefined command %q", command)
+	}
+}
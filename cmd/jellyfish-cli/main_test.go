@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/baibikov/jellyfish/pkg/consumer"
+)
+
+func TestHeadersFlag(t *testing.T) {
+	h := headers{}
+	fs := flag.NewFlagSet("produce", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Var(h, "header", "")
+
+	err := fs.Parse([]string{"-header", "type=order", "-header", "query=a=b", "-header", "empty="})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := headers{"type": "order", "query": "a=b", "empty": ""}
+	if len(h) != len(want) {
+		t.Fatalf("headers = %v, want %v", h, want)
+	}
+	for k, v := range want {
+		if h[k] != v {
+			t.Fatalf("header %s = %q, want %q", k, h[k], v)
+		}
+	}
+
+	for _, bad := range []string{"type", "=order"} {
+		if err := h.Set(bad); err == nil {
+			t.Fatalf("header %q is accepted", bad)
+		}
+	}
+}
+
+func TestPrinter(t *testing.T) {
+	p := consumer.Payload{
+		Topic:     "orders",
+		Key:       "eu-1",
+		Message:   []byte("created"),
+		Headers:   map[string]string{"type": "order"},
+		Offset:    3,
+		Timestamp: time.Unix(1, 0).UTC(),
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{format: formatRaw, want: "created\n"},
+		{format: formatHex, want: "63726561746564\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		print, err := printer(&buf, tt.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := print(p); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Fatalf("%s printed %q, want %q", tt.format, buf.String(), tt.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	print, err := printer(&buf, formatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := print(p); err != nil {
+		t.Fatal(err)
+	}
+
+	var got jsonMessage
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Topic != "orders" || got.Key != "eu-1" || got.Offset != 3 ||
+		got.Message != "created" || got.Headers["type"] != "order" || !got.Timestamp.Equal(p.Timestamp) {
+		t.Fatalf("json printed %+v", got)
+	}
+
+	if _, err := printer(&buf, "xml"); err == nil {
+		t.Fatal("undefined format is accepted")
+	}
+}
+
+func TestDefaultGroup(t *testing.T) {
+	if parseGroup("-") != "" || parseGroup("billing") != "billing" {
+		t.Fatal("parseGroup does not map - to the default group")
+	}
+	if displayGroup("") != "-" || displayGroup("billing") != "billing" {
+		t.Fatal("displayGroup does not show the default group as -")
+	}
+	if dash("") != "-" || dash("up") != "up" {
+		t.Fatal("dash does not show the empty value as -")
+	}
+}
+
+func TestRunRequiresCommand(t *testing.T) {
+	for _, args := range [][]string{nil, {"publish"}} {
+		err := run(args)
+		if err == nil {
+			t.Fatalf("run %v succeeded", args)
+		}
+		if len(args) != 0 && !strings.Contains(err.Error(), `undefined command "publish"`) {
+			t.Fatalf("run %v = %v", args, err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2022 Jellyfish message broker
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/pkg/producer"
+)
+
+// headers is a repeatable key=value flag.
+type headers map[string]string
+
+func (h headers) String() string {
+	pairs := make([]string, 0, len(h))
+	for k, v := range h {
+		pairs = append(pairs, k+"="+v)
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (h headers) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return errors.Errorf("header %q is not key=value", s)
+	}
+
+	h[k] = v
+	return nil
+}
+
+func produce(ctx context.Context, g *globals, args []string) error {
+	var (
+		key       string
+		keySep    string
+		file      string
+		delay     time.Duration
+		ttl       time.Duration
+		priority  int
+		schemaID  int
+		deliverAt string
+		hh        = headers{}
+	)
+
+	fs := flag.NewFlagSet("produce", flag.ContinueOnError)
+	fs.StringVar(&key, "key", "", "message key")
+	fs.StringVar(&keySep, "key-separator", "", "split every line into key and message by the separator")
+	fs.StringVar(&file, "file", "", "produce lines of the file, - is stdin")
+	fs.Var(hh, "header", "message header key=value, repeatable")
+	fs.DurationVar(&delay, "delay", 0, "hold the messages on the broker for the duration")
+	fs.IntVar(&priority, "priority", 0, "message priority from 0 to 9 of a priority topic")
+	fs.DurationVar(&ttl, "ttl", 0, "drop the messages not consumed within the duration")
+	fs.IntVar(&schemaID, "schema-id", 0, "id of the registered schema the messages are encoded with")
+	fs.StringVar(&deliverAt, "deliver-at", "", "hold the messages on the broker until the RFC3339 time")
+	fs.Usage = func() {
+		fs.Output().Write([]byte("Usage: jellyfish-cli produce [flags] TOPIC [MESSAGE...]\n\n" +
+			"Messages are taken from args, the file or stdin lines.\n\n"))
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("topic is required")
+	}
+	topic := fs.Arg(0)
+
+	var at time.Time
+	if deliverAt != "" {
+		t, err := time.Parse(time.RFC3339, deliverAt)
+		if err != nil {
+			return errors.Wrap(err, "parse deliver-at")
+		}
+		at = t
+	}
+
+	p, err := producer.New(&producer.Config{Addr: g.addr, ClientID: clientID})
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	push := func(line string) error {
+		k, message := key, line
+		if keySep != "" {
+			if kk, mm, ok := strings.Cut(line, keySep); ok {
+				k, message = kk, mm
+			}
+		}
+
+		return p.Push(ctx, &producer.Params{
+			Topic:     topic,
+			Key:       k,
+			Message:   []byte(message),
+			Headers:   hh,
+			DeliverAt: at,
+			Delay:     delay,
+			TTL:       ttl,
+			Priority:  priority,
+			SchemaID:  schemaID,
+		})
+	}
+
+	if messages := fs.Args()[1:]; len(messages) != 0 && file == "" {
+		for _, m := range messages {
+			if err := push(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var r io.Reader = os.Stdin
+	if file != "" && file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return errors.Wrap(err, "open messages file")
+		}
+		defer f.Close()
+		r = f
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if err := push(scanner.Text()); err != nil {
+			return err
+		}
+	}
+
+	return errors.Wrap(scanner.Err(), "read messages")
+}
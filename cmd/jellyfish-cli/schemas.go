@@ -0,0 +1,128 @@
+/*
+Copyright 2022 Jellyfish message broker
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/pkg/admin"
+)
+
+func schemas(ctx context.Context, g *globals, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: jellyfish-cli schemas list|describe|register|compatibility|get [TOPIC|ID]")
+	}
+
+	a, err := newAdmin(g)
+	if err != nil {
+		return err
+	}
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "list":
+		subjects, err := a.SchemaSubjects(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := newTable()
+		fmt.Fprintln(w, "TOPIC\tCOMPATIBILITY\tVERSIONS\tLATEST ID")
+		for _, s := range subjects {
+			latest := 0
+			if len(s.Versions) != 0 {
+				latest = s.Versions[len(s.Versions)-1].ID
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", s.Topic, s.Compatibility, len(s.Versions), latest)
+		}
+		return w.Flush()
+	case "describe":
+		if len(args) != 1 {
+			return errors.New("usage: jellyfish-cli schemas describe TOPIC")
+		}
+
+		s, err := a.SchemaSubject(ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		w := newTable()
+		fmt.Fprintf(w, "Topic:\t%s\n", s.Topic)
+		fmt.Fprintf(w, "Compatibility:\t%s\n\n", s.Compatibility)
+		fmt.Fprintln(w, "VERSION\tID\tTYPE\tMESSAGE")
+		for _, v := range s.Versions {
+			fmt.Fprintf(w, "%d\t%d\t%s\t%s\n", v.Version, v.ID, v.Type, v.Message)
+		}
+		return w.Flush()
+	case "register":
+		var typ, file, message string
+		fs := flag.NewFlagSet("schemas register", flag.ContinueOnError)
+		fs.StringVar(&typ, "type", admin.SchemaJSON, "schema type, json or protobuf")
+		fs.StringVar(&file, "file", "", "JSON Schema document or base64 encoded protobuf FileDescriptorSet")
+		fs.StringVar(&message, "message", "", "full name of the protobuf message of the set")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 || file == "" {
+			return errors.New("usage: jellyfish-cli schemas register -file FILE [flags] TOPIC")
+		}
+
+		schema, err := os.ReadFile(file)
+		if err != nil {
+			return errors.Wrap(err, "read schema file")
+		}
+
+		s, err := a.RegisterSchema(ctx, fs.Arg(0), typ, string(schema), message)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("schema %d registered as version %d of topic %s\n", s.ID, s.Version, s.Topic)
+		return nil
+	case "compatibility":
+		if len(args) != 2 {
+			return errors.New("usage: jellyfish-cli schemas compatibility TOPIC backward|forward|full[_transitive]|none")
+		}
+
+		if err := a.SetSchemaCompatibility(ctx, args[0], args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("topic %s compatibility set to %s\n", args[0], args[1])
+		return nil
+	case "get":
+		if len(args) != 1 {
+			return errors.New("usage: jellyfish-cli schemas get ID")
+		}
+
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return errors.Wrap(err, "parse schema id")
+		}
+
+		s, err := a.Schema(ctx, id)
+		if err != nil {
+			return err
+		}
+		fmt.Println(s.Schema)
+		return nil
+	default:
+		return errors.Errorf("undefined schemas command %q", command)
+	}
+}
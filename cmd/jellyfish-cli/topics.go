@@ -0,0 +1,139 @@
+/*
+Copyright 2022 Jellyfish message broker
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/pkg/admin"
+)
+
+func newAdmin(g *globals) (*admin.Admin, error) {
+	return admin.New(&admin.Config{Addr: g.admin})
+}
+
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+}
+
+func topics(ctx context.Context, g *globals, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: jellyfish-cli topics list|create|configure|describe|delete [TOPIC]")
+	}
+
+	a, err := newAdmin(g)
+	if err != nil {
+		return err
+	}
+
+	command, args := args[0], args[1:]
+	if command == "list" {
+		tt, err := a.Topics(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := newTable()
+		fmt.Fprintln(w, "TOPIC\tWRITE OFFSET\tREAD OFFSET\tLAG\tGROUPS")
+		for _, t := range tt {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", t.Name, t.WriteOffset, t.ReadOffset, t.Lag, len(t.Groups))
+		}
+		return w.Flush()
+	}
+
+	var config admin.TopicConfig
+	if command == "create" || command == "configure" {
+		fs := flag.NewFlagSet("topics "+command, flag.ContinueOnError)
+		fs.DurationVar(&config.TTL, "ttl", 0, "default time to live of the topic messages")
+		fs.StringVar(&config.ExpiryTopic, "expiry-topic", "", "topic receiving the expired messages")
+		fs.BoolVar(&config.Priority, "priority", false, "deliver the highest priority messages first")
+		fs.DurationVar(&config.PriorityAging, "priority-aging", 0, "raise the priority of a waiting message by one every interval")
+		fs.StringVar(&config.CleanupPolicy, "cleanup-policy", "", "delete keeps every message, compact keeps the latest message by key")
+		fs.DurationVar(&config.TombstoneRetention, "tombstone-retention", 0, "how long a compacted topic keeps a message with an empty payload")
+		fs.BoolVar(&config.RequireSchema, "require-schema", false, "reject the messages without the id of a schema registered for the topic")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		args = fs.Args()
+	}
+
+	if len(args) != 1 {
+		return errors.Errorf("usage: jellyfish-cli topics %s TOPIC", command)
+	}
+	topic := args[0]
+
+	switch command {
+	case "create":
+		if err := a.CreateTopic(ctx, topic, config); err != nil {
+			return err
+		}
+		fmt.Printf("topic %s created\n", topic)
+		return nil
+	case "configure":
+		if err := a.ConfigureTopic(ctx, topic, config); err != nil {
+			return err
+		}
+		fmt.Printf("topic %s configured\n", topic)
+		return nil
+	case "delete":
+		if err := a.DeleteTopic(ctx, topic); err != nil {
+			return err
+		}
+		fmt.Printf("topic %s deleted\n", topic)
+		return nil
+	case "describe":
+		t, err := a.Topic(ctx, topic)
+		if err != nil {
+			return err
+		}
+
+		w := newTable()
+		fmt.Fprintf(w, "Topic:\t%s\n", t.Name)
+		fmt.Fprintf(w, "Write offset:\t%d\n", t.WriteOffset)
+		fmt.Fprintf(w, "Read offset:\t%d\n", t.ReadOffset)
+		fmt.Fprintf(w, "Lag:\t%d\n", t.Lag)
+		fmt.Fprintf(w, "Scheduled:\t%d\n", t.Scheduled)
+		fmt.Fprintf(w, "Expired:\t%d\n", t.Expired)
+		fmt.Fprintf(w, "TTL:\t%s\n", t.Config.TTL)
+		fmt.Fprintf(w, "Expiry topic:\t%s\n", t.Config.ExpiryTopic)
+		fmt.Fprintf(w, "Priority:\t%t\n", t.Config.Priority)
+		fmt.Fprintf(w, "Cleanup policy:\t%s\n", t.Config.CleanupPolicy)
+		fmt.Fprintf(w, "Require schema:\t%t\n", t.Config.RequireSchema)
+		fmt.Fprintf(w, "Messages:\t%d\n", t.Messages)
+		fmt.Fprintf(w, "Compacted:\t%d\n\n", t.Compacted)
+		fmt.Fprintln(w, "GROUP\tOFFSET\tLAG")
+		for _, o := range t.Groups {
+			fmt.Fprintf(w, "%s\t%d\t%d\n", displayGroup(o.Group), o.Offset, o.Lag)
+		}
+		return w.Flush()
+	default:
+		return errors.Errorf("undefined topics command %q", command)
+	}
+}
+
+// displayGroup names the broker default group.
+func displayGroup(group string) string {
+	if group == "" {
+		return "-"
+	}
+
+	return group
+}
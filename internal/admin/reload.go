@@ -0,0 +1,55 @@
+// Package admin
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package admin
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/internal/reload"
+)
+
+// Reloader re-reads the broker config and applies it.
+type Reloader interface {
+	Reload() (*reload.Result, error)
+}
+
+// WithReloader enables the POST /reload endpoint.
+func WithReloader(r Reloader) Option {
+	return func(s *Server) {
+		s.reloader = r
+	}
+}
+
+// reload applies the config like SIGHUP does and reports the applied
+// and rejected changes.
+func (s *Server) reload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	if s.reloader == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("config reload is not enabled"))
+		return
+	}
+
+	result, err := s.reloader.Reload()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
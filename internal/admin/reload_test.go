@@ -0,0 +1,70 @@
+// Package admin
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/internal/broker"
+	"github.com/baibikov/jellyfish/internal/reload"
+)
+
+type fakeReloader struct {
+	result *reload.Result
+	err    error
+}
+
+func (r *fakeReloader) Reload() (*reload.Result, error) {
+	return r.result, r.err
+}
+
+func TestReloadEndpoint(t *testing.T) {
+	b := &fakeBroker{storage: broker.NewBroker()}
+
+	if w := serve(newTestServer(t, b), http.MethodPost, "/reload"); w.Code != http.StatusNotImplemented {
+		t.Fatalf("reload without a reloader: status %d, want 501", w.Code)
+	}
+
+	r := &fakeReloader{result: &reload.Result{Applied: []string{"slaves"}, Rejected: []string{"addr"}}}
+	s, err := New("127.0.0.1:0", b, WithReloader(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.listener.Close()
+
+	if w := serve(s, http.MethodGet, "/reload"); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET reload: status %d, want 405", w.Code)
+	}
+
+	w := serve(s, http.MethodPost, "/reload")
+	if w.Code != http.StatusOK {
+		t.Fatalf("reload: status %d, want 200", w.Code)
+	}
+	var result reload.Result
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Applied) != 1 || result.Applied[0] != "slaves" || len(result.Rejected) != 1 || result.Rejected[0] != "addr" {
+		t.Fatalf("reload result = %+v", result)
+	}
+
+	r.err = errors.New("invalid config")
+	if w := serve(s, http.MethodPost, "/reload"); w.Code != http.StatusBadRequest {
+		t.Fatalf("failed reload: status %d, want 400", w.Code)
+	}
+}
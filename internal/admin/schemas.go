@@ -0,0 +1,103 @@
+// Package admin
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/internal/broker"
+)
+
+// maxSchemaSize limits the body of a schema registration.
+const maxSchemaSize = 1 << 20
+
+// schemaRequest is the body of a schema registration.
+type schemaRequest struct {
+	Type    broker.SchemaType `json:"type"`
+	Schema  string            `json:"schema"`
+	Message string            `json:"message,omitempty"`
+}
+
+func (s *Server) schemaSubjects(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.broker.Storage().SchemaSubjects())
+}
+
+// schemaSubject serves /schemas/{topic}: GET lists the schema versions, POST
+// registers a version from the json body and PUT sets the compatibility
+// of the compatibility query parameter.
+func (s *Server) schemaSubject(w http.ResponseWriter, r *http.Request) {
+	topic := broker.TopicName(strings.TrimPrefix(r.URL.Path, "/schemas/"))
+	if topic == "" {
+		writeError(w, http.StatusBadRequest, errors.New("topic name is empty"))
+		return
+	}
+
+	storage := s.broker.Storage()
+	switch r.Method {
+	case http.MethodGet:
+		subject, err := storage.SchemaSubject(topic)
+		if err != nil {
+			writeError(w, statusByError(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, subject)
+	case http.MethodPost:
+		req := schemaRequest{}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSchemaSize)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, errors.Wrap(err, "decode schema"))
+			return
+		}
+		schema, err := storage.RegisterSchema(topic, req.Type, req.Schema, req.Message)
+		if err != nil {
+			writeError(w, statusByError(err), err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, schema)
+	case http.MethodPut:
+		compatibility := broker.Compatibility(r.URL.Query().Get("compatibility"))
+		if err := storage.SetSchemaCompatibility(topic, compatibility); err != nil {
+			writeError(w, statusByError(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, status{Status: "configured"})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// schema serves GET /schema-ids/{id}.
+func (s *Server) schema(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/schema-ids/"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err, "parse schema id"))
+		return
+	}
+
+	schema, err := s.broker.Storage().Schema(id)
+	if err != nil {
+		writeError(w, statusByError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, schema)
+}
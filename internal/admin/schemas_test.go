@@ -0,0 +1,58 @@
+// Package admin
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/baibikov/jellyfish/internal/broker"
+)
+
+func TestSchemaEndpoints(t *testing.T) {
+	s := newTestServer(t, &fakeBroker{storage: broker.NewBroker()})
+
+	register := func(schema string) int {
+		body := `{"type":"json","schema":` + schema + `}`
+		w := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/schemas/orders", strings.NewReader(body)))
+		return w.Code
+	}
+
+	if code := register(`"{\"type\":\"object\",\"properties\":{\"id\":{\"type\":\"string\"}}}"`); code != http.StatusCreated {
+		t.Fatalf("register: status %d, want 201", code)
+	}
+	if code := register(`"{\"type\":\"object\",\"required\":[\"id\"]}"`); code != http.StatusConflict {
+		t.Fatalf("register of an incompatible schema: status %d, want 409", code)
+	}
+
+	tests := []struct {
+		method, target string
+		code           int
+	}{
+		{http.MethodGet, "/schemas/orders", http.StatusOK},
+		{http.MethodGet, "/schema-ids/1", http.StatusOK},
+		{http.MethodPut, "/schemas/orders?compatibility=full_transitive", http.StatusOK},
+		{http.MethodPut, "/schemas/orders?compatibility=sideways", http.StatusBadRequest},
+		{http.MethodGet, "/schemas/missing", http.StatusNotFound},
+		{http.MethodGet, "/schema-ids/100", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := serve(s, tt.method, tt.target); w.Code != tt.code {
+			t.Errorf("%s %s: status %d, want %d: %s", tt.method, tt.target, w.Code, tt.code, w.Body)
+		}
+	}
+}
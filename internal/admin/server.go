@@ -0,0 +1,195 @@
+// Package admin
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/baibikov/jellyfish/internal/broker"
+)
+
+// Broker is the part of the broker listener exposed over the admin api.
+type Broker interface {
+	Ready() bool
+	Topics() []broker.TopicStats
+	Clients() []broker.ClientInfo
+	Peers() []broker.PeerStatus
+	Storage() *broker.Broker
+}
+
+// Server is an http server with health probes and introspection endpoints.
+type Server struct {
+	server   *http.Server
+	listener net.Listener
+	broker   Broker
+	reloader Reloader
+}
+
+// Option configures the optional admin endpoints.
+type Option func(s *Server)
+
+const readHeaderTimeout = time.Second * 5
+
+// New listens on addr, an addr without a host is bound to the loopback
+// interface: the api deletes topics and moves offsets without authentication.
+func New(addr string, b Broker, opts ...Option) (*Server, error) {
+	if b == nil {
+		return nil, errors.New("admin broker has not be empty")
+	}
+
+	addr, err := loopback(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "run listen admin")
+	}
+
+	s := &Server{
+		listener: l,
+		broker:   b,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+	mux.HandleFunc("/topics", s.topics)
+	mux.HandleFunc("/topics/", s.topic)
+	mux.HandleFunc("/groups", s.groups)
+	mux.HandleFunc("/groups/", s.group)
+	mux.HandleFunc("/clients", s.clients)
+	mux.HandleFunc("/peers", s.peers)
+	mux.HandleFunc("/status", s.status)
+	mux.HandleFunc("/reload", s.reload)
+	mux.HandleFunc("/schemas", s.schemaSubjects)
+	mux.HandleFunc("/schemas/", s.schemaSubject)
+	mux.HandleFunc("/schema-ids/", s.schema)
+
+	s.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	return s, nil
+}
+
+// loopback binds the addr without a host to the loopback interface,
+// an explicit not loopback host is warned about.
+func loopback(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", errors.Wrapf(err, "admin addr %s", addr)
+	}
+	if host == "" {
+		return net.JoinHostPort("127.0.0.1", port), nil
+	}
+
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		logrus.Warnf("admin api at %s is not authenticated, keep it on a trusted network", addr)
+	}
+
+	return addr, nil
+}
+
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+func (s *Server) Serve() error {
+	err := s.server.Serve(s.listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return errors.Wrap(err, "admin serve")
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	return errors.Wrap(s.server.Shutdown(ctx), "admin shutdown")
+}
+
+func (s *Server) healthz(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, status{Status: "ok"})
+}
+
+func (s *Server) readyz(w http.ResponseWriter, _ *http.Request) {
+	if !s.broker.Ready() {
+		writeJSON(w, http.StatusServiceUnavailable, status{Status: "not ready"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status{Status: "ready"})
+}
+
+func (s *Server) topics(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.broker.Topics())
+}
+
+func (s *Server) clients(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.broker.Clients())
+}
+
+func (s *Server) peers(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.broker.Peers())
+}
+
+// clusterStatus is the broker state with its replication peers.
+type clusterStatus struct {
+	Ready   bool                `json:"ready"`
+	Topics  int                 `json:"topics"`
+	Clients []broker.ClientInfo `json:"clients"`
+	Peers   []broker.PeerStatus `json:"peers"`
+}
+
+func (s *Server) status(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, clusterStatus{
+		Ready:   s.broker.Ready(),
+		Topics:  len(s.broker.Topics()),
+		Clients: s.broker.Clients(),
+		Peers:   s.broker.Peers(),
+	})
+}
+
+type status struct {
+	Status string `json:"status"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.Error("admin: write response ", err)
+	}
+}
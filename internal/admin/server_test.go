@@ -0,0 +1,113 @@
+// Package admin
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package admin
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/baibikov/jellyfish/internal/broker"
+)
+
+type fakeBroker struct {
+	ready   bool
+	storage *broker.Broker
+}
+
+func (b *fakeBroker) Ready() bool                  { return b.ready }
+func (b *fakeBroker) Topics() []broker.TopicStats  { return b.storage.Topics() }
+func (b *fakeBroker) Clients() []broker.ClientInfo { return nil }
+func (b *fakeBroker) Peers() []broker.PeerStatus   { return nil }
+func (b *fakeBroker) Storage() *broker.Broker      { return b.storage }
+
+func newTestServer(t *testing.T, b *fakeBroker) *Server {
+	t.Helper()
+
+	s, err := New("127.0.0.1:0", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.listener.Close() })
+
+	return s
+}
+
+func serve(s *Server, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+func TestProbes(t *testing.T) {
+	b := &fakeBroker{storage: broker.NewBroker()}
+	s := newTestServer(t, b)
+
+	if w := serve(s, http.MethodGet, "/healthz"); w.Code != http.StatusOK {
+		t.Errorf("healthz: status %d, want 200", w.Code)
+	}
+	if w := serve(s, http.MethodGet, "/readyz"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyz of a not ready broker: status %d, want 503", w.Code)
+	}
+
+	b.ready = true
+	if w := serve(s, http.MethodGet, "/readyz"); w.Code != http.StatusOK {
+		t.Errorf("readyz of a ready broker: status %d, want 200", w.Code)
+	}
+}
+
+func TestTopicEndpoints(t *testing.T) {
+	s := newTestServer(t, &fakeBroker{storage: broker.NewBroker()})
+
+	tests := []struct {
+		method, target string
+		code           int
+	}{
+		{http.MethodPost, "/topics/orders?ttl=1m", http.StatusCreated},
+		{http.MethodPost, "/topics/orders", http.StatusConflict},
+		{http.MethodPost, "/topics/bad?ttl=-1s", http.StatusBadRequest},
+		{http.MethodGet, "/topics/orders", http.StatusOK},
+		{http.MethodGet, "/topics/missing", http.StatusNotFound},
+		{http.MethodDelete, "/topics/orders", http.StatusOK},
+		{http.MethodDelete, "/topics/orders", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := serve(s, tt.method, tt.target); w.Code != tt.code {
+			t.Errorf("%s %s: status %d, want %d: %s", tt.method, tt.target, w.Code, tt.code, w.Body)
+		}
+	}
+
+	var topics []broker.TopicStats
+	if err := json.NewDecoder(serve(s, http.MethodGet, "/topics").Body).Decode(&topics); err != nil {
+		t.Fatal(err)
+	}
+	if len(topics) != 0 {
+		t.Errorf("topics %v, want none after delete", topics)
+	}
+}
+
+func TestLoopbackByDefault(t *testing.T) {
+	s, err := New(":0", &fakeBroker{storage: broker.NewBroker()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.listener.Close()
+
+	addr, ok := s.Addr().(*net.TCPAddr)
+	if !ok || !addr.IP.IsLoopback() {
+		t.Errorf("admin addr without a host listens on %s, want the loopback interface", s.Addr())
+	}
+}
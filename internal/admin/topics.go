@@ -0,0 +1,258 @@
+// Package admin
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package admin
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/internal/broker"
+)
+
+// topic serves /topics/{name}: GET describes, POST creates, PUT configures
+// and DELETE deletes a topic. POST and PUT take the ttl, expiry_topic, priority,
+// priority_aging, cleanup_policy, tombstone_retention and require_schema settings from the query.
+func (s *Server) topic(w http.ResponseWriter, r *http.Request) {
+	name := broker.TopicName(strings.TrimPrefix(r.URL.Path, "/topics/"))
+	if name == "" {
+		writeError(w, http.StatusBadRequest, errors.New("topic name is empty"))
+		return
+	}
+
+	storage := s.broker.Storage()
+	switch r.Method {
+	case http.MethodGet:
+		stats, err := storage.Topic(name)
+		if err != nil {
+			writeError(w, statusByError(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, stats)
+	case http.MethodPost:
+		config, err := topicConfig(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := storage.CreateTopic(name, config); err != nil {
+			writeError(w, statusByError(err), err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, status{Status: "created"})
+	case http.MethodPut:
+		config, err := topicConfig(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := storage.ConfigureTopic(name, config); err != nil {
+			writeError(w, statusByError(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, status{Status: "configured"})
+	case http.MethodDelete:
+		if err := storage.DeleteTopic(name); err != nil {
+			writeError(w, statusByError(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, status{Status: "deleted"})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// topicConfig parses the topic settings of the request query.
+func topicConfig(r *http.Request) (broker.TopicConfig, error) {
+	query := r.URL.Query()
+	config := broker.TopicConfig{
+		ExpiryTopic:   broker.TopicName(query.Get("expiry_topic")),
+		CleanupPolicy: query.Get("cleanup_policy"),
+	}
+
+	if ttl := query.Get("ttl"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return config, errors.Wrapf(err, "parse ttl %q", ttl)
+		}
+		config.TTL = d
+	}
+
+	if priority := query.Get("priority"); priority != "" {
+		b, err := strconv.ParseBool(priority)
+		if err != nil {
+			return config, errors.Wrapf(err, "parse priority %q", priority)
+		}
+		config.Priority = b
+	}
+
+	if aging := query.Get("priority_aging"); aging != "" {
+		d, err := time.ParseDuration(aging)
+		if err != nil {
+			return config, errors.Wrapf(err, "parse priority aging %q", aging)
+		}
+		config.PriorityAging = d
+	}
+
+	if require := query.Get("require_schema"); require != "" {
+		b, err := strconv.ParseBool(require)
+		if err != nil {
+			return config, errors.Wrapf(err, "parse require schema %q", require)
+		}
+		config.RequireSchema = b
+	}
+
+	if retention := query.Get("tombstone_retention"); retention != "" {
+		d, err := time.ParseDuration(retention)
+		if err != nil {
+			return config, errors.Wrapf(err, "parse tombstone retention %q", retention)
+		}
+		config.TombstoneRetention = d
+	}
+
+	return config, nil
+}
+
+func (s *Server) groups(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.broker.Storage().Groups())
+}
+
+// group serves /groups/{name} describing a group
+// and /groups/{name}/reset-offsets moving it.
+func (s *Server) group(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/groups/")
+	if strings.HasSuffix(path, resetOffsetsPath) {
+		s.resetOffsets(w, r, strings.TrimSuffix(path, resetOffsetsPath))
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	offsets, err := s.broker.Storage().Group(groupName(path))
+	if err != nil {
+		writeError(w, statusByError(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, offsets)
+}
+
+const resetOffsetsPath = "/reset-offsets"
+
+// resetOffsets moves the group offsets of the topic query parameter,
+// or of every topic the group consumes, to the position of the to parameter:
+// earliest, latest, an offset number or a RFC3339 time.
+func (s *Server) resetOffsets(w http.ResponseWriter, r *http.Request, path string) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	group := groupName(path)
+	storage := s.broker.Storage()
+
+	topics := make([]broker.TopicName, 0, 1)
+	if topic := r.URL.Query().Get("topic"); topic != "" {
+		topics = append(topics, broker.TopicName(topic))
+	} else {
+		offsets, err := storage.Group(group)
+		if err != nil {
+			writeError(w, statusByError(err), err)
+			return
+		}
+		for _, o := range offsets {
+			topics = append(topics, o.Topic)
+		}
+	}
+
+	seek, err := parseResetTo(storage, group, r.URL.Query().Get("to"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	for _, topic := range topics {
+		if err := seek(topic); err != nil {
+			writeError(w, statusByError(err), err)
+			return
+		}
+	}
+
+	offsets, err := storage.Group(group)
+	if err != nil {
+		writeError(w, statusByError(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, offsets)
+}
+
+func parseResetTo(storage *broker.Broker, group, to string) (func(broker.TopicName) error, error) {
+	switch to {
+	case "earliest":
+		return func(topic broker.TopicName) error {
+			return storage.Seek(topic, group, 0)
+		}, nil
+	case "latest":
+		return func(topic broker.TopicName) error {
+			return storage.Seek(topic, group, math.MaxInt)
+		}, nil
+	}
+
+	if offset, err := strconv.Atoi(to); err == nil {
+		return func(topic broker.TopicName) error {
+			return storage.Seek(topic, group, offset)
+		}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, to); err == nil {
+		return func(topic broker.TopicName) error {
+			return storage.SeekTime(topic, group, t)
+		}, nil
+	}
+
+	return nil, errors.Errorf("undefined reset position %q, want earliest, latest, offset or RFC3339 time", to)
+}
+
+// groupName maps the path segment to a group, "-" is the default group.
+func groupName(segment string) string {
+	if segment == defaultGroupSegment {
+		return broker.DefaultGroup
+	}
+
+	return segment
+}
+
+const defaultGroupSegment = "-"
+
+func statusByError(err error) int {
+	switch {
+	case errors.Is(err, broker.ErrTopicNotFound),
+		errors.Is(err, broker.ErrGroupNotFound),
+		errors.Is(err, broker.ErrSchemaNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, broker.ErrTopicExists), errors.Is(err, broker.ErrIncompatibleSchema):
+		return http.StatusConflict
+	case errors.Is(err, broker.ErrInvalidTopicConfig), errors.Is(err, broker.ErrInvalidSchema):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
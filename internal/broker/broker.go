@@ -14,14 +14,41 @@
 package broker
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
+// Broker stores the topics. Every topic has its own lock, so the topics are
+// read and written concurrently and a slow reader blocks only its topic.
+// The locks are taken in the order: promoting, txnMutex, the topic registry,
+// a topic, the schedule, and at most one topic is locked at a time.
+// The schema registry is locked alone.
 type Broker struct {
-	mutex sync.RWMutex
 	topic *Topic
+	// schedule holds the delayed messages until they are due.
+	schedule *schedule
+	// promoting keeps the due order of the delayed messages promoted
+	// by concurrent calls.
+	promoting sync.Mutex
+
+	txnMutex sync.Mutex
+	// txns are the open transactions by id.
+	txns   map[uint64]*txn
+	txnSeq uint64
+	// txnDeadline is the unix nano deadline of the earliest open transaction,
+	// zero is none. It is read without the lock on every call.
+	txnDeadline atomic.Int64
+
+	schemas *schemas
 }
 
 func NewBroker() *Broker {
@@ -29,93 +56,922 @@ func NewBroker() *Broker {
 		topic: &Topic{
 			mp: make(map[TopicName]*pack),
 		},
+		schedule: newSchedule(),
+		txns:     make(map[uint64]*txn),
+		schemas:  newSchemas(),
 	}
 }
 
-func (b *Broker) Write(name TopicName, payload []byte) error {
-	b.mutex.Lock()
-	defer b.mutex.Unlock()
+// Message is a payload stored by the broker with its metadata.
+type Message struct {
+	Key       string
+	Payload   []byte
+	Headers   map[string]string
+	Offset    int
+	Timestamp time.Time
+	// TTL is how long the message lives after it becomes visible,
+	// zero is the topic default.
+	TTL time.Duration
+	// Priority orders the delivery of a priority topic, higher first.
+	Priority int
+	// Txn is the transaction the message was written in, zero is none.
+	Txn uint64
 
-	if !b.topic.exists(name) {
-		if err := b.topic.create(name); err != nil {
-			return err
-		}
+	// control is set for the transaction markers never delivered to consumers.
+	control bool
+
+	// expired is set once the message was found expired and routed.
+	expired bool
+}
+
+// TopicConfig is the per-topic settings.
+type TopicConfig struct {
+	// TTL is the default time to live of the topic messages, zero never expires.
+	TTL time.Duration `json:"ttl"`
+	// ExpiryTopic receives the expired messages, empty drops them.
+	ExpiryTopic TopicName `json:"expiry_topic,omitempty"`
+	// Priority delivers the highest priority message first instead of in the write order.
+	Priority bool `json:"priority"`
+	// PriorityAging raises the priority of a waiting message by one every
+	// interval so the low priorities are not starved, DefaultPriorityAging when zero.
+	PriorityAging time.Duration `json:"priority_aging,omitempty"`
+	// CleanupPolicy is CleanupDelete, when empty, or CleanupCompact.
+	CleanupPolicy string `json:"cleanup_policy,omitempty"`
+	// TombstoneRetention is how long a compacted topic keeps a message with
+	// an empty payload, DefaultTombstoneRetention when zero.
+	TombstoneRetention time.Duration `json:"tombstone_retention,omitempty"`
+	// RequireSchema rejects the messages without the id of a schema
+	// registered for the topic in HeaderSchemaID.
+	RequireSchema bool `json:"require_schema,omitempty"`
+}
+
+// MaxPriority is the highest message priority, priorities are clamped to [0, MaxPriority].
+const MaxPriority = 9
+
+// DefaultPriorityAging is the aging interval of a priority topic without one.
+const DefaultPriorityAging = time.Second
+
+// Headers of a message routed to the expiry topic.
+const (
+	HeaderExpiredTopic  = "jellyfish-expired-topic"
+	HeaderExpiredOffset = "jellyfish-expired-offset"
+)
+
+// DefaultGroup is the consumer group of consumers without a group.
+const DefaultGroup = ""
+
+var (
+	ErrTopicExists   = errors.New("topic already exists")
+	ErrTopicNotFound = errors.New("topic not found")
+	ErrGroupNotFound = errors.New("group not found")
+)
+
+func (b *Broker) Write(name TopicName, message *Message) error {
+	return b.WriteAt(name, message, time.Time{})
+}
+
+// WriteAt holds the message until at and only then makes it visible
+// to the consumers of the topic, messages due at the same time keep
+// their write order. A zero or past at writes the message at once.
+func (b *Broker) WriteAt(name TopicName, message *Message, at time.Time) error {
+	now := time.Now()
+	b.advance(now)
+
+	p := b.topic.writable(name)
+	if p == nil {
+		logrus.Debugf("drop message to the closed reply topic %s", name)
 		return nil
 	}
+	if err := b.checkSchema(name, p, message); err != nil {
+		return err
+	}
 
-	b.topic.pack(name).append(payload)
+	if at.After(now) {
+		b.schedule.add(name, message, at)
+		return nil
+	}
+
+	p.mutex.Lock()
+	p.append(message)
+	p.mutex.Unlock()
 	return nil
 }
 
-func (b *Broker) Read(name TopicName) ([]byte, error) {
-	b.mutex.RLock()
-	defer b.mutex.RUnlock()
+// advance applies the changes due by now: the delayed messages become
+// visible and the timed out transactions are aborted. It is called without
+// any lock held and returns at once when nothing is due.
+func (b *Broker) advance(now time.Time) {
+	b.promote(now)
+	b.abortTimedOut(now)
+}
+
+// promote appends the held messages due at or before now in the due order,
+// the message timestamp is the due time so the topic stays ordered by time.
+func (b *Broker) promote(now time.Time) {
+	if !b.schedule.pending(now) {
+		return
+	}
+
+	b.promoting.Lock()
+	defer b.promoting.Unlock()
+
+	for item := b.schedule.due(now); item != nil; item = b.schedule.due(now) {
+		item.message.Timestamp = item.at
+
+		p := b.topic.ensure(item.topic)
+		p.mutex.Lock()
+		p.append(item.message)
+		p.mutex.Unlock()
+	}
+}
+
+// Read returns the next message of the topic for the group
+// and moves the group offset forward.
+func (b *Broker) Read(name TopicName, group string) (*Message, error) {
+	now := time.Now()
+	b.advance(now)
+
+	return b.read(name, b.topic.ensure(name), group, now, readOptions{}), nil
+}
 
-	if !b.topic.exists(name) {
-		if err := b.topic.create(name); err != nil {
-			return nil, err
+// read returns the next message of the topic pack for the group and routes
+// the messages found expired once the pack is unlocked.
+func (b *Broker) read(name TopicName, p *pack, group string, now time.Time, opts readOptions) *Message {
+	p.mutex.Lock()
+	message, expired := p.message(group, now, opts)
+	expiryTopic := p.config.ExpiryTopic
+	p.mutex.Unlock()
+
+	b.expire(name, expiryTopic, expired)
+	return message
+}
+
+// ReadSubscription returns the next message of the subscription topics for
+// the group with the topic it was read from, the topics are read in turn.
+// Literal topics are created when missing, topics created later are
+// attached when they match a pattern.
+func (b *Broker) ReadSubscription(s *Subscription, group string) (TopicName, *Message, error) {
+	now := time.Now()
+	b.advance(now)
+
+	names := b.match(s)
+	for i := range names {
+		turn := (s.next + i) % len(names)
+		name := names[turn]
+
+		p := b.topic.get(name)
+		if p == nil {
+			// deleted after the match
+			continue
+		}
+
+		message := b.read(name, p, group, now, readOptions{
+			match: func(m *Message) bool {
+				return s.filter.Match(name, m)
+			},
+			committed: s.committed,
+		})
+		if message != nil {
+			s.next = turn + 1
+			return name, message, nil
 		}
 	}
 
-	return b.topic.pack(name).message(), nil
+	return "", nil, nil
 }
 
-type Topic struct {
-	mp map[TopicName]*pack
+// written returns a channel closed once a message is written to one of the
+// topics the subscription matches by now, stop releases the channel.
+func (b *Broker) written(s *Subscription) (written <-chan struct{}, stop func()) {
+	chs := make([]chan struct{}, 0, 1)
+	for _, name := range b.match(s) {
+		p := b.topic.get(name)
+		if p == nil {
+			continue
+		}
+
+		p.mutex.Lock()
+		if p.written == nil {
+			p.written = make(chan struct{})
+		}
+		chs = append(chs, p.written)
+		p.mutex.Unlock()
+	}
+
+	switch len(chs) {
+	case 0:
+		// never closed, the wait ends by its timeout
+		return nil, func() {}
+	case 1:
+		return chs[0], func() {}
+	}
+
+	merged, done := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	for _, ch := range chs {
+		go func(ch chan struct{}) {
+			select {
+			case <-ch:
+				once.Do(func() { close(merged) })
+			case <-done:
+			}
+		}(ch)
+	}
+
+	return merged, func() { close(done) }
 }
 
-func (t Topic) exists(name TopicName) bool {
-	if t.mp == nil {
-		return false
+// Match returns the topics read by the subscription, the literal topics
+// are created when missing.
+func (b *Broker) Match(s *Subscription) ([]TopicName, error) {
+	return b.match(s), nil
+}
+
+// match returns the topics matched by the subscription when the registry was
+// last changed, the topics are matched again only after a topic is created or
+// deleted, so a poll does not walk the whole registry.
+func (b *Broker) match(s *Subscription) []TopicName {
+	if s.matched != nil && s.generation == b.topic.generation.Load() {
+		return s.matched
+	}
+
+	for _, name := range s.literals {
+		b.topic.ensure(name)
+	}
+
+	// loaded before the names, a topic created meanwhile matches by the next poll
+	generation := b.topic.generation.Load()
+	names := make([]TopicName, 0, len(s.literals))
+	for _, name := range b.topic.names() {
+		if s.matches(name) {
+			names = append(names, name)
+		}
+	}
+
+	s.matched, s.generation = names, generation
+	return names
+}
+
+// Offsets returns the group read offset and the write offset of the topic.
+func (b *Broker) Offsets(name TopicName, group string) (read, write int, err error) {
+	p := b.topic.get(name)
+	if p == nil {
+		return 0, 0, errors.Wrapf(ErrTopicNotFound, "topic %s", name)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.readOffsets[group], p.writeOffset, nil
+}
+
+// Seek moves the group offset of the topic to offset,
+// it is clamped by the topic bounds.
+func (b *Broker) Seek(name TopicName, group string, offset int) error {
+	b.advance(time.Now())
+
+	p := b.topic.ensure(name)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.seek(group, offset)
+	return nil
+}
+
+// SeekTime moves the group offset of the topic to the first message
+// written at or after t.
+func (b *Broker) SeekTime(name TopicName, group string, t time.Time) error {
+	b.advance(time.Now())
+
+	p := b.topic.ensure(name)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.seek(group, p.offsetByTime(t))
+	return nil
+}
+
+// expire routes the expired messages of the topic to the expiry topic.
+func (b *Broker) expire(name, expiryTopic TopicName, expired []*Message) {
+	if expiryTopic == "" || len(expired) == 0 {
+		return
+	}
+
+	p := b.topic.ensure(expiryTopic)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, m := range expired {
+		headers := make(map[string]string, len(m.Headers)+2)
+		for k, v := range m.Headers {
+			headers[k] = v
+		}
+		headers[HeaderExpiredTopic] = string(name)
+		headers[HeaderExpiredOffset] = strconv.Itoa(m.Offset)
+
+		p.append(&Message{
+			Key:     m.Key,
+			Payload: m.Payload,
+			Headers: headers,
+		})
+	}
+}
+
+func (b *Broker) CreateTopic(name TopicName, config TopicConfig) error {
+	if err := config.validate(name); err != nil {
+		return err
 	}
 
-	_, ok := t.mp[name]
-	return ok
+	p := newPack()
+	p.config = config
+	if !b.topic.add(name, p) {
+		return errors.Wrapf(ErrTopicExists, "topic %s", name)
+	}
+
+	return nil
 }
 
-func (t *Topic) create(name TopicName) error {
-	if t.mp == nil {
-		return errors.New("topic storage not initialized")
+// ReplyTopicPrefix names the ephemeral reply topics, writes to a deleted
+// reply topic are dropped instead of creating it again.
+const ReplyTopicPrefix = "_reply."
+
+func (n TopicName) isReply() bool {
+	return strings.HasPrefix(string(n), ReplyTopicPrefix)
+}
+
+// CreateReplyTopic creates an ephemeral reply topic with a random name,
+// the owner deletes it when the requesting connection closes.
+func (b *Broker) CreateReplyTopic() (TopicName, error) {
+	bb := make([]byte, 16)
+	if _, err := rand.Read(bb); err != nil {
+		return "", errors.Wrap(err, "generate reply topic name")
 	}
+	name := TopicName(ReplyTopicPrefix + hex.EncodeToString(bb))
+
+	p := newPack()
+	p.ephemeral = true
+	if !b.topic.add(name, p) {
+		return "", errors.Wrapf(ErrTopicExists, "topic %s", name)
+	}
+
+	return name, nil
+}
+
+// ConfigureTopic replaces the settings of the topic.
+func (b *Broker) ConfigureTopic(name TopicName, config TopicConfig) error {
+	if err := config.validate(name); err != nil {
+		return err
+	}
+
+	p := b.topic.get(name)
+	if p == nil {
+		return errors.Wrapf(ErrTopicNotFound, "topic %s", name)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
 
-	t.mp[name] = &pack{}
+	p.config = config
 	return nil
 }
 
-func (t *Topic) pack(name TopicName) *pack {
-	vv, _ := t.mp[name]
-	if vv == nil {
-		p := &pack{}
+// ErrInvalidTopicConfig is returned for the settings the topic can not have.
+var ErrInvalidTopicConfig = errors.New("invalid topic config")
+
+func (c TopicConfig) validate(name TopicName) error {
+	if c.TTL < 0 {
+		return errors.Wrapf(ErrInvalidTopicConfig, "topic %s ttl %s is negative", name, c.TTL)
+	}
+	if c.PriorityAging < 0 {
+		return errors.Wrapf(ErrInvalidTopicConfig, "topic %s priority aging %s is negative", name, c.PriorityAging)
+	}
+	if c.CleanupPolicy != "" && c.CleanupPolicy != CleanupDelete && c.CleanupPolicy != CleanupCompact {
+		return errors.Wrapf(
+			ErrInvalidTopicConfig,
+			"topic %s cleanup policy %q, want %s or %s", name, c.CleanupPolicy, CleanupDelete, CleanupCompact,
+		)
+	}
+	if c.TombstoneRetention < 0 {
+		return errors.Wrapf(ErrInvalidTopicConfig, "topic %s tombstone retention %s is negative", name, c.TombstoneRetention)
+	}
+	if c.ExpiryTopic == name {
+		return errors.Wrapf(ErrInvalidTopicConfig, "topic %s can not be its own expiry topic", name)
+	}
+
+	return nil
+}
+
+func (b *Broker) DeleteTopic(name TopicName) error {
+	if !b.topic.remove(name) {
+		return errors.Wrapf(ErrTopicNotFound, "topic %s", name)
+	}
+
+	b.schedule.drop(name)
+	b.dropSchemas(name)
+	return nil
+}
+
+// GroupOffset is a snapshot of a consumer group position in a topic.
+type GroupOffset struct {
+	Group  string    `json:"group"`
+	Topic  TopicName `json:"topic"`
+	Offset int       `json:"offset"`
+	Lag    int       `json:"lag"`
+	// Committed is the offset committed by a transaction, nil is none.
+	Committed *int `json:"committed,omitempty"`
+}
+
+// TopicStats is a snapshot of a topic state used by introspection.
+type TopicStats struct {
+	Name        TopicName `json:"name"`
+	WriteOffset int       `json:"write_offset"`
+	ReadOffset  int       `json:"read_offset"`
+	Lag         int       `json:"lag"`
+	// Scheduled is the count of the delayed messages not yet due.
+	Scheduled int `json:"scheduled"`
+	// Expired is the count of the messages skipped by the consumers as expired.
+	Expired int `json:"expired"`
+	// Ephemeral is set for the reply topics deleted with their connection.
+	Ephemeral bool `json:"ephemeral"`
+	// Messages is the count of the stored messages, less than the write
+	// offset once the topic is compacted.
+	Messages int `json:"messages"`
+	// Compacted is the count of the messages removed by the compaction.
+	Compacted int           `json:"compacted"`
+	Config    TopicConfig   `json:"config"`
+	Groups    []GroupOffset `json:"groups"`
+}
+
+func (b *Broker) Topics() []TopicStats {
+	b.advance(time.Now())
+
+	packs := b.topic.packs()
+	stats := make([]TopicStats, 0, len(packs))
+	for name, p := range packs {
+		stats = append(stats, b.stats(name, p))
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+func (b *Broker) Topic(name TopicName) (TopicStats, error) {
+	b.advance(time.Now())
+
+	p := b.topic.get(name)
+	if p == nil {
+		return TopicStats{}, errors.Wrapf(ErrTopicNotFound, "topic %s", name)
+	}
+
+	return b.stats(name, p), nil
+}
+
+func (b *Broker) stats(name TopicName, p *pack) TopicStats {
+	p.mutex.Lock()
+	stats := p.stats(name)
+	p.mutex.Unlock()
+
+	stats.Scheduled = b.schedule.count(name)
+	return stats
+}
+
+// Groups returns the offsets of every consumer group by topic.
+func (b *Broker) Groups() []GroupOffset {
+	b.advance(time.Now())
+
+	groups := make([]GroupOffset, 0)
+	for name, p := range b.topic.packs() {
+		p.mutex.Lock()
+		groups = append(groups, p.stats(name).Groups...)
+		p.mutex.Unlock()
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Group != groups[j].Group {
+			return groups[i].Group < groups[j].Group
+		}
+		return groups[i].Topic < groups[j].Topic
+	})
+	return groups
+}
+
+func (b *Broker) Group(group string) ([]GroupOffset, error) {
+	offsets := make([]GroupOffset, 0)
+	for _, o := range b.Groups() {
+		if o.Group == group {
+			offsets = append(offsets, o)
+		}
+	}
+	if len(offsets) == 0 {
+		return nil, errors.Wrapf(ErrGroupNotFound, "group %q", group)
+	}
+
+	return offsets, nil
+}
+
+// Topic is the registry of the topic packs, its lock guards only the map.
+type Topic struct {
+	mutex sync.RWMutex
+	mp    map[TopicName]*pack
+	// generation is changed under the lock by every created or deleted topic.
+	generation atomic.Uint64
+}
+
+// get returns the pack of the topic, nil when the topic does not exist.
+func (t *Topic) get(name TopicName) *pack {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	return t.mp[name]
+}
+
+// ensure returns the pack of the topic, the missing topic is created.
+func (t *Topic) ensure(name TopicName) *pack {
+	if p := t.get(name); p != nil {
+		return p
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	p, ok := t.mp[name]
+	if !ok {
+		p = newPack()
 		t.mp[name] = p
-		vv = p
+		t.generation.Add(1)
+	}
+	return p
+}
+
+// writable is ensure except for the missing reply topic, the requester is
+// gone and nobody would read the reply, nil is returned.
+func (t *Topic) writable(name TopicName) *pack {
+	if p := t.get(name); p != nil || name.isReply() {
+		return p
 	}
 
-	return vv
+	return t.ensure(name)
 }
 
+// add registers the pack of a new topic, false when the topic exists.
+func (t *Topic) add(name TopicName, p *pack) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if _, ok := t.mp[name]; ok {
+		return false
+	}
+
+	t.mp[name] = p
+	t.generation.Add(1)
+	return true
+}
+
+// remove deletes the topic, false when it does not exist.
+func (t *Topic) remove(name TopicName) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if _, ok := t.mp[name]; !ok {
+		return false
+	}
+
+	delete(t.mp, name)
+	t.generation.Add(1)
+	return true
+}
+
+// names returns the sorted topic names.
+func (t *Topic) names() []TopicName {
+	t.mutex.RLock()
+	names := make([]TopicName, 0, len(t.mp))
+	for name := range t.mp {
+		names = append(names, name)
+	}
+	t.mutex.RUnlock()
+
+	sort.Slice(names, func(i, j int) bool {
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// packs returns a copy of the registry, the packs are locked one by one
+// by the callers walking every topic.
+func (t *Topic) packs() map[TopicName]*pack {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	packs := make(map[TopicName]*pack, len(t.mp))
+	for name, p := range t.mp {
+		packs[name] = p
+	}
+	return packs
+}
+
+// pack is a topic, its lock guards all of its fields.
 type pack struct {
-	messages    [][]byte
+	mutex sync.Mutex
+
+	messages    []*Message
 	writeOffset int
-	readOffset  int
+	// readOffsets is the next offset to read by consumer group.
+	readOffsets map[string]int
+	// delivered is the offsets above the group read offset already
+	// delivered out of the write order by priority.
+	delivered map[string]map[int]struct{}
+	// open and aborted are the transactions of the topic messages
+	// not ended yet and ended by abort.
+	open      map[uint64]struct{}
+	aborted   map[uint64]struct{}
+	config    TopicConfig
+	expired   int
+	compacted int
+	ephemeral bool
+
+	// committedOffsets are the group offsets committed by the transactions.
+	committedOffsets map[string]int
+
+	// written is closed by the next append, nil while no poll waits.
+	written chan struct{}
 }
 
-func (m *pack) message() []byte {
-	if len(m.messages) == 0 {
-		return nil
+func newPack() *pack {
+	return &pack{
+		readOffsets: make(map[string]int),
+		delivered:   make(map[string]map[int]struct{}),
+		open:        make(map[uint64]struct{}),
+		aborted:     make(map[uint64]struct{}),
+
+		committedOffsets: make(map[string]int),
 	}
+}
 
-	if m.readOffset > len(m.messages)-1 {
-		return nil
+// readOptions select the messages a consumer reads.
+type readOptions struct {
+	// match skips the not matching messages, nil passes all.
+	match func(*Message) bool
+	// committed reads only the committed transaction messages and stops
+	// at the first message of an open transaction.
+	committed bool
+}
+
+// visibility is what a consumer does with a transaction message.
+type visibility int
+
+const (
+	visible visibility = iota
+	skipped
+	blocked
+)
+
+func (m *pack) visibility(p *Message, opts readOptions) visibility {
+	if p.control {
+		return skipped
+	}
+	if !opts.committed || p.Txn == 0 {
+		return visible
+	}
+	if _, ok := m.open[p.Txn]; ok {
+		return blocked
+	}
+	if _, ok := m.aborted[p.Txn]; ok {
+		return skipped
 	}
 
-	p := m.messages[m.readOffset]
-	m.readOffset++
-	return p
+	return visible
+}
+
+// message returns the next not expired message for the group selected by opts.
+// The messages skipped as expired for the first time are returned to be routed,
+// the not matching ones are skipped by the group.
+func (m *pack) message(group string, now time.Time, opts readOptions) (message *Message, expired []*Message) {
+	if m.config.Priority {
+		return m.priorityMessage(group, now, opts)
+	}
+
+	start := m.readOffsets[group]
+	readOffset := m.writeOffset
+	for i := m.index(start); i < len(m.messages); i++ {
+		p := m.messages[i]
+
+		// delivered by priority before the topic mode was changed
+		if _, ok := m.delivered[group][p.Offset]; ok {
+			delete(m.delivered[group], p.Offset)
+			continue
+		}
+
+		v := m.visibility(p, opts)
+		if v == blocked {
+			// the group waits for the transaction end at the last stable offset
+			readOffset = p.Offset
+			break
+		}
+		if v == skipped {
+			continue
+		}
+
+		if m.isExpired(p, now) {
+			if !p.expired {
+				p.expired = true
+				m.expired++
+				expired = append(expired, p)
+			}
+			continue
+		}
+
+		if opts.match == nil || opts.match(p) {
+			message = p
+			readOffset = p.Offset + 1
+			break
+		}
+	}
+
+	if readOffset > start {
+		m.readOffsets[group] = readOffset
+	}
+	return message, expired
+}
+
+// priorityMessage returns the not delivered message of the group with the highest
+// aged priority, the earliest one among equal priorities.
+func (m *pack) priorityMessage(group string, now time.Time, opts readOptions) (message *Message, expired []*Message) {
+	var best *Message
+	bestPriority := 0
+	for i := m.index(m.readOffsets[group]); i < len(m.messages); i++ {
+		p := m.messages[i]
+		if _, ok := m.delivered[group][p.Offset]; ok {
+			continue
+		}
+
+		v := m.visibility(p, opts)
+		if v == blocked {
+			break
+		}
+		if v == skipped {
+			m.deliver(group, p.Offset)
+			continue
+		}
+
+		if m.isExpired(p, now) {
+			if !p.expired {
+				p.expired = true
+				m.expired++
+				expired = append(expired, p)
+			}
+			m.deliver(group, p.Offset)
+			continue
+		}
+
+		if opts.match != nil && !opts.match(p) {
+			m.deliver(group, p.Offset)
+			continue
+		}
+
+		if priority := m.agedPriority(p, now); best == nil || priority > bestPriority {
+			best, bestPriority = p, priority
+		}
+	}
+
+	if best == nil {
+		return nil, expired
+	}
+
+	m.deliver(group, best.Offset)
+	return best, expired
 }
 
-func (m *pack) append(payload []byte) {
-	m.messages = append(m.messages, payload)
+// agedPriority raises the message priority by one for every aging interval it waits.
+func (m *pack) agedPriority(message *Message, now time.Time) int {
+	aging := m.config.PriorityAging
+	if aging == 0 {
+		aging = DefaultPriorityAging
+	}
+
+	return message.Priority + int(now.Sub(message.Timestamp)/aging)
+}
+
+// deliver marks the offset delivered to the group and moves the group
+// read offset over the delivered offsets.
+func (m *pack) deliver(group string, offset int) {
+	delivered := m.delivered[group]
+	if delivered == nil {
+		delivered = make(map[int]struct{})
+		m.delivered[group] = delivered
+	}
+	delivered[offset] = struct{}{}
+
+	readOffset := m.writeOffset
+	for i := m.index(m.readOffsets[group]); i < len(m.messages); i++ {
+		o := m.messages[i].Offset
+		if _, ok := delivered[o]; !ok {
+			readOffset = o
+			break
+		}
+		delete(delivered, o)
+	}
+	m.readOffsets[group] = readOffset
+}
+
+// index is the position of the first message at or after the offset,
+// the offsets have gaps once the topic is compacted.
+func (m *pack) index(offset int) int {
+	return sort.Search(len(m.messages), func(i int) bool {
+		return m.messages[i].Offset >= offset
+	})
+}
+
+func (m *pack) isExpired(message *Message, now time.Time) bool {
+	if message.expired {
+		return true
+	}
+
+	ttl := message.TTL
+	if ttl == 0 {
+		ttl = m.config.TTL
+	}
+
+	return ttl > 0 && now.After(message.Timestamp.Add(ttl))
+}
+
+func (m *pack) append(message *Message) {
+	message.Offset = m.writeOffset
+	if message.Priority < 0 {
+		message.Priority = 0
+	}
+	if message.Priority > MaxPriority {
+		message.Priority = MaxPriority
+	}
+	if message.Timestamp.IsZero() {
+		message.Timestamp = time.Now()
+	}
+
+	m.messages = append(m.messages, message)
 	m.writeOffset++
+
+	if m.written != nil {
+		close(m.written)
+		m.written = nil
+	}
+}
+
+func (m *pack) seek(group string, offset int) {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > m.writeOffset {
+		offset = m.writeOffset
+	}
+
+	m.readOffsets[group] = offset
+	delete(m.delivered, group)
+}
+
+func (m *pack) offsetByTime(t time.Time) int {
+	i := sort.Search(len(m.messages), func(i int) bool {
+		return !m.messages[i].Timestamp.Before(t)
+	})
+	if i == len(m.messages) {
+		return m.writeOffset
+	}
+
+	return m.messages[i].Offset
+}
+
+func (m *pack) stats(name TopicName) TopicStats {
+	groups := make([]GroupOffset, 0, len(m.readOffsets))
+	for group, offset := range m.readOffsets {
+		g := GroupOffset{
+			Group:  group,
+			Topic:  name,
+			Offset: offset,
+			Lag:    m.writeOffset - offset,
+		}
+		if committed, ok := m.committedOffsets[group]; ok {
+			g.Committed = &committed
+		}
+		groups = append(groups, g)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Group < groups[j].Group
+	})
+
+	readOffset := m.readOffsets[DefaultGroup]
+	return TopicStats{
+		Name:        name,
+		WriteOffset: m.writeOffset,
+		ReadOffset:  readOffset,
+		Lag:         m.writeOffset - readOffset,
+		Expired:     m.expired,
+		Ephemeral:   m.ephemeral,
+		Messages:    len(m.messages),
+		Compacted:   m.compacted,
+		Config:      m.config,
+		Groups:      groups,
+	}
 }
 
 type TopicName string
@@ -0,0 +1,265 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/protogenerated/messages"
+)
+
+func TestBrokerConcurrentTopics(t *testing.T) {
+	const (
+		topics   = 8
+		messages = 200
+	)
+
+	b := NewBroker()
+
+	var wg sync.WaitGroup
+	for i := 0; i < topics; i++ {
+		name := TopicName("orders." + strconv.Itoa(i))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < messages; j++ {
+				if err := b.Write(name, &Message{Payload: []byte(strconv.Itoa(j))}); err != nil {
+					t.Errorf("write %s: %v", name, err)
+					return
+				}
+			}
+		}()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for next := 0; next < messages; {
+				m, err := b.Read(name, DefaultGroup)
+				if err != nil {
+					t.Errorf("read %s: %v", name, err)
+					return
+				}
+				if m == nil {
+					continue
+				}
+				if got := string(m.Payload); got != strconv.Itoa(next) {
+					t.Errorf("read %s: got message %s, want %d", name, got, next)
+					return
+				}
+				next++
+			}
+		}()
+	}
+
+	// the registry changes while the topics are read and written
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < messages; j++ {
+			name := TopicName("churn." + strconv.Itoa(j%4))
+			if err := b.CreateTopic(name, TopicConfig{}); err != nil {
+				t.Errorf("create %s: %v", name, err)
+				return
+			}
+			_ = b.Write(name, &Message{Payload: []byte("x")})
+			if err := b.DeleteTopic(name); err != nil {
+				t.Errorf("delete %s: %v", name, err)
+				return
+			}
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sub, err := NewSubscription("churn.*")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for j := 0; j < messages; j++ {
+			if _, _, err := b.ReadSubscription(sub, "churn"); err != nil {
+				t.Errorf("read subscription: %v", err)
+				return
+			}
+			_ = b.Topics()
+		}
+	}()
+
+	wg.Wait()
+
+	for _, stats := range b.Topics() {
+		if stats.Name[:6] == "churn." {
+			t.Errorf("topic %s is not deleted", stats.Name)
+			continue
+		}
+		if stats.WriteOffset != messages || stats.Lag != 0 {
+			t.Errorf("topic %s: write offset %d lag %d, want %d and 0", stats.Name, stats.WriteOffset, stats.Lag, messages)
+		}
+	}
+}
+
+func TestReadSubscriptionMatchesRegistryChanges(t *testing.T) {
+	b := NewBroker()
+	sub, err := NewSubscription("orders.*", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names, _ := b.Match(sub); len(names) != 1 || names[0] != "audit" {
+		t.Fatalf("matched %v, want the literal audit only", names)
+	}
+
+	if err := b.Write("orders.eu", &Message{Payload: []byte("eu")}); err != nil {
+		t.Fatal(err)
+	}
+	topic, m, err := b.ReadSubscription(sub, DefaultGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topic != "orders.eu" || m == nil || string(m.Payload) != "eu" {
+		t.Fatalf("read %s %v, want the message of the created topic orders.eu", topic, m)
+	}
+
+	if err := b.DeleteTopic("orders.eu"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.DeleteTopic("audit"); err != nil {
+		t.Fatal(err)
+	}
+	names, _ := b.Match(sub)
+	if len(names) != 1 || names[0] != "audit" {
+		t.Fatalf("matched %v after delete, want the literal audit created again", names)
+	}
+}
+
+func BenchmarkProduce(b *testing.B) {
+	payload := make([]byte, 256)
+	for _, topics := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("topics=%d", topics), func(b *testing.B) {
+			broker := NewBroker()
+			names := make([]TopicName, topics)
+			for i := range names {
+				names[i] = TopicName("bench." + strconv.Itoa(i))
+			}
+
+			var seq sync.Mutex
+			next := 0
+			b.SetBytes(int64(len(payload)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				// every goroutine writes its own topic
+				seq.Lock()
+				name := names[next%topics]
+				next++
+				seq.Unlock()
+
+				for pb.Next() {
+					if err := broker.Write(name, &Message{Payload: payload}); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestSeekAndGroupOffsets(t *testing.T) {
+	b := NewBroker()
+
+	before := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := b.Write("orders", &Message{Payload: []byte(strconv.Itoa(i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := b.Seek("orders", "billing", 3); err != nil {
+		t.Fatal(err)
+	}
+	m, err := b.Read("orders", "billing")
+	if err != nil || m == nil || string(m.Payload) != "3" {
+		t.Fatalf("read after seek = %v, %v, want message 3", m, err)
+	}
+
+	// the offsets are clamped by the topic bounds
+	if err := b.Seek("orders", "audit", 100); err != nil {
+		t.Fatal(err)
+	}
+	if read, write, _ := b.Offsets("orders", "audit"); read != write {
+		t.Fatalf("seek past the end = %d, want %d", read, write)
+	}
+
+	if err := b.SeekTime("orders", "billing", before); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := b.Read("orders", "billing"); m == nil || string(m.Payload) != "0" {
+		t.Fatalf("read after seek by time = %v, want message 0", m)
+	}
+
+	offsets, err := b.Group("billing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offsets) != 1 || offsets[0].Offset != 1 || offsets[0].Lag != 4 {
+		t.Fatalf("billing offsets = %+v, want offset 1 lag 4", offsets)
+	}
+
+	groups := b.Groups()
+	if len(groups) < 2 || groups[0].Group > groups[len(groups)-1].Group {
+		t.Fatalf("groups = %+v, want sorted audit and billing", groups)
+	}
+
+	if _, err := b.Group("shipping"); !errors.Is(err, ErrGroupNotFound) {
+		t.Fatalf("unknown group = %v, want not found", err)
+	}
+}
+
+// discardConn drops the writes.
+type discardConn struct {
+	net.Conn
+}
+
+func (discardConn) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func BenchmarkDeliver(b *testing.B) {
+	for _, size := range []int{512, 64 << 10} {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			h := NewHandler(discardConn{}, NewBroker(), nil, newClients())
+			m := &Message{Payload: make([]byte, size), Headers: map[string]string{"source": "bench"}}
+			ctx := context.Background()
+
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := h.deliver(ctx, "orders", m, &messages.ConsumerResponse{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
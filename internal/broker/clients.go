@@ -0,0 +1,161 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	pinger "github.com/baibikov/jellyfish/pkg/ping"
+	"github.com/baibikov/jellyfish/protogenerated/messages"
+)
+
+// ClientInfo is a snapshot of a connected client used by introspection.
+type ClientInfo struct {
+	RemoteAddr  string    `json:"remote_addr"`
+	Role        string    `json:"role"`
+	ConnectedAt time.Time `json:"connected_at"`
+	// ClientID, ClientVersion and Features are told by the client in the handshake,
+	// Features are the ones agreed on.
+	ClientID        string   `json:"client_id,omitempty"`
+	ClientVersion   string   `json:"client_version,omitempty"`
+	ProtocolVersion uint32   `json:"protocol_version"`
+	Features        []string `json:"features,omitempty"`
+}
+
+// clients keeps track of the connections served by the listener
+// and drains them on shutdown.
+type clients struct {
+	mutex     sync.RWMutex
+	mp        map[*Handler]*ClientInfo
+	wg        sync.WaitGroup
+	goingAway atomic.Bool
+}
+
+func newClients() *clients {
+	return &clients{
+		mp: make(map[*Handler]*ClientInfo),
+	}
+}
+
+// add registers the handler before it is served, it reports false once
+// the broker is going away, drain and wait would miss the handler.
+func (c *clients) add(h *Handler) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.goingAway.Load() {
+		return false
+	}
+
+	c.wg.Add(1)
+	c.mp[h] = &ClientInfo{
+		RemoteAddr:  h.conn.RemoteAddr().String(),
+		Role:        "unknown",
+		ConnectedAt: time.Now(),
+	}
+	return true
+}
+
+// hello records the client role and the negotiated handshake.
+func (c *clients) hello(h *Handler, ping *messages.Ping, pong *messages.Pong) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if info, ok := c.mp[h]; ok {
+		info.Role = pinger.PayloadType(ping.GetPing()).String()
+		info.ClientID = ping.ClientId
+		info.ClientVersion = ping.ClientVersion
+		info.ProtocolVersion = pong.Version
+		info.Features = pong.Features
+	}
+}
+
+func (c *clients) remove(h *Handler) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.mp[h]; !ok {
+		return
+	}
+
+	delete(c.mp, h)
+	c.wg.Done()
+}
+
+func (c *clients) isGoingAway() bool {
+	return c != nil && c.goingAway.Load()
+}
+
+// drain marks the broker as going away and wakes up the handlers blocked
+// on reading, a request arrived within the interval is still served.
+func (c *clients) drain(interval time.Duration) {
+	c.goingAway.Store(true)
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	deadline := time.Now().Add(interval)
+	for h := range c.mp {
+		if err := h.conn.SetReadDeadline(deadline); err != nil {
+			logrus.Error("drain: ", err)
+		}
+	}
+}
+
+// wait waits for every handler to finish, connections still served
+// when ctx is done are closed forcibly.
+func (c *clients) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	c.mutex.RLock()
+	n := len(c.mp)
+	for h := range c.mp {
+		_ = h.conn.Close()
+	}
+	c.mutex.RUnlock()
+
+	return errors.Errorf("%d connections closed forcibly", n)
+}
+
+func (c *clients) list() []ClientInfo {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	list := make([]ClientInfo, 0, len(c.mp))
+	for _, info := range c.mp {
+		list = append(list, *info)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ConnectedAt.Before(list[j].ConnectedAt)
+	})
+	return list
+}
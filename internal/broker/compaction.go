@@ -0,0 +1,103 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"time"
+)
+
+// Cleanup policies of a topic.
+const (
+	// CleanupDelete keeps every message, it is the default policy.
+	CleanupDelete = "delete"
+	// CleanupCompact keeps only the latest message by key.
+	CleanupCompact = "compact"
+)
+
+// DefaultTombstoneRetention is how long a compacted topic keeps a tombstone
+// without its own retention, so the consumers reading the topic see the deletion.
+const DefaultTombstoneRetention = time.Hour
+
+// Compact removes the messages superseded by a later message with the same key
+// from the compacted topics and the tombstones older than their retention,
+// the offsets of the kept messages do not change. It returns the count of
+// the removed messages.
+func (b *Broker) Compact() int {
+	now := time.Now()
+	b.advance(now)
+
+	removed := 0
+	for _, p := range b.topic.packs() {
+		p.mutex.Lock()
+		removed += p.compact(now)
+		p.mutex.Unlock()
+	}
+
+	return removed
+}
+
+// compact keeps the latest message by key, the messages without a key are kept
+// and a message with an empty payload is a tombstone removed after its retention.
+// The aborted transaction messages are removed, the open ones are kept and do not
+// supersede the earlier messages until committed.
+func (m *pack) compact(now time.Time) int {
+	if m.config.CleanupPolicy != CleanupCompact {
+		return 0
+	}
+
+	latest := make(map[string]int, len(m.messages))
+	for i, p := range m.messages {
+		if p.Key != "" && m.visibility(p, readOptions{committed: true}) == visible {
+			latest[p.Key] = i
+		}
+	}
+
+	retention := m.config.TombstoneRetention
+	if retention == 0 {
+		retention = DefaultTombstoneRetention
+	}
+
+	kept := m.messages[:0]
+	for i, p := range m.messages {
+		switch m.visibility(p, readOptions{committed: true}) {
+		case blocked:
+			kept = append(kept, p)
+			continue
+		case skipped:
+			if !p.control {
+				continue
+			}
+		}
+
+		if p.Key != "" {
+			if latest[p.Key] != i {
+				continue
+			}
+			if len(p.Payload) == 0 && now.Sub(p.Timestamp) > retention {
+				continue
+			}
+		}
+
+		kept = append(kept, p)
+	}
+
+	removed := len(m.messages) - len(kept)
+	for i := len(kept); i < len(m.messages); i++ {
+		m.messages[i] = nil
+	}
+	m.messages = kept
+	m.compacted += removed
+
+	return removed
+}
@@ -0,0 +1,149 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"testing"
+	"time"
+)
+
+// payloads returns the stored messages of the topic by offset.
+func payloads(b *Broker, name TopicName) map[int]string {
+	p := b.topic.get(name)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	out := make(map[int]string, len(p.messages))
+	for _, m := range p.messages {
+		if !m.control {
+			out[m.Offset] = string(m.Payload)
+		}
+	}
+	return out
+}
+
+func TestCompactKeepsLatestByKey(t *testing.T) {
+	b := NewBroker()
+	if err := b.CreateTopic("prices", TopicConfig{CleanupPolicy: CleanupCompact, TombstoneRetention: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []*Message{
+		{Key: "eur", Payload: []byte("1.05")},
+		{Key: "usd", Payload: []byte("1.00")},
+		{Payload: []byte("keyless")},
+		{Key: "eur", Payload: []byte("1.07")},
+		{Key: "gbp", Payload: []byte("1.20")},
+		{Key: "gbp", Timestamp: time.Now().Add(-time.Hour)}, // expired tombstone
+		{Key: "usd"}, // fresh tombstone
+	} {
+		if err := b.Write("prices", m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if removed := b.Compact(); removed != 4 {
+		t.Fatalf("removed %d, want 4", removed)
+	}
+
+	// the kept messages keep their offsets
+	got := payloads(b, "prices")
+	want := map[int]string{2: "keyless", 3: "1.07", 6: ""}
+	if len(got) != len(want) {
+		t.Fatalf("kept %v, want %v", got, want)
+	}
+	for offset, payload := range want {
+		if p, ok := got[offset]; !ok || p != payload {
+			t.Fatalf("kept %v, want %v", got, want)
+		}
+	}
+
+	stats, err := b.Topic("prices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Compacted != 4 || stats.Messages != 3 || stats.WriteOffset != 7 {
+		t.Fatalf("stats = compacted %d messages %d written %d", stats.Compacted, stats.Messages, stats.WriteOffset)
+	}
+
+	// the reads and seeks skip the offset gaps
+	if err := b.Seek("prices", "audit", 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, b, "prices", "audit"); len(got) != 3 || got[0] != "keyless" || got[1] != "1.07" || got[2] != "" {
+		t.Fatalf("read after compaction = %q", got)
+	}
+
+	if removed := b.Compact(); removed != 0 {
+		t.Fatalf("second compaction removed %d", removed)
+	}
+}
+
+func TestCompactDeletePolicy(t *testing.T) {
+	b := NewBroker()
+	for _, payload := range []string{"1", "2"} {
+		if err := b.Write("prices", &Message{Key: "eur", Payload: []byte(payload)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if removed := b.Compact(); removed != 0 {
+		t.Fatalf("removed %d of a delete policy topic", removed)
+	}
+}
+
+func TestCompactTransactions(t *testing.T) {
+	b := NewBroker()
+	if err := b.CreateTopic("prices", TopicConfig{CleanupPolicy: CleanupCompact}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Write("prices", &Message{Key: "eur", Payload: []byte("committed")}); err != nil {
+		t.Fatal(err)
+	}
+
+	open, err := b.BeginTxn(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.WriteTxn(open, "prices", &Message{Key: "eur", Payload: []byte("open")}); err != nil {
+		t.Fatal(err)
+	}
+
+	aborted, err := b.BeginTxn(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.WriteTxn(aborted, "prices", &Message{Key: "usd", Payload: []byte("aborted")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AbortTxn(aborted); err != nil {
+		t.Fatal(err)
+	}
+
+	// the open message does not supersede the committed one, the aborted one is removed
+	b.Compact()
+	got := payloads(b, "prices")
+	if len(got) != 2 || got[0] != "committed" || got[1] != "open" {
+		t.Fatalf("kept %v, want the committed and the open message", got)
+	}
+
+	if err := b.CommitTxn(open); err != nil {
+		t.Fatal(err)
+	}
+	b.Compact()
+	if got := payloads(b, "prices"); len(got) != 1 || got[1] != "open" {
+		t.Fatalf("kept %v, want the committed transaction message", got)
+	}
+}
@@ -15,19 +15,21 @@ package broker
 
 import (
 	"context"
-	"net"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/multierr"
 	"google.golang.org/protobuf/proto"
 
 	"github.com/baibikov/jellyfish/protogenerated/messages"
 )
 
 func (h *Handler) consumerDo(ctx context.Context) {
-	defer closeConnection(h.conn, "consumer")
+	defer h.close("consumer")
 
-	pp, err := consumerPayload(h.conn)
+	pp, sub, err := h.consumerPayload()
 	if err != nil {
 		if isSysError(err) {
 			logrus.Info("consumer: close connection")
@@ -38,12 +40,33 @@ func (h *Handler) consumerDo(ctx context.Context) {
 		return
 	}
 
+	if pp.Snapshot {
+		pp.Offset, pp.Timestamp = proto.Int64(0), nil
+	}
+
+	h.maxWait = time.Duration(pp.MaxWait)
+	if h.maxWait > maxPollWait {
+		h.maxWait = maxPollWait
+	}
+
+	if err := h.seek(pp, sub); err != nil {
+		logrus.Error("consumer: ", err)
+		return
+	}
+
+	if pp.Snapshot {
+		if h.snapshot, err = newSnapshot(h.broker, sub); err != nil {
+			logrus.Error("consumer: ", err)
+			return
+		}
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			if err := h.consumer(TopicName(pp.Topic)); err != nil {
+			if err := h.consumer(ctx, sub, pp.Group); err != nil {
 				if isSysError(err) {
 					logrus.Info("consumer: close connection")
 					return
@@ -52,62 +75,250 @@ func (h *Handler) consumerDo(ctx context.Context) {
 				logrus.Error("consumer: ", err)
 				return
 			}
+			if h.notified {
+				logrus.Info("consumer: broker is going away, close connection")
+				return
+			}
 		}
 	}
 }
 
-const (
-	consumerMessageSize     = 1024
-	consumerPingMessageSize = 1024
-)
+// consumerPayload reads the subscription and echoes it to the consumer,
+// a refused one is echoed with the typed error.
+func (h *Handler) consumerPayload() (*messages.ConsumerPayload, *Subscription, error) {
+	cp := &messages.ConsumerPayload{}
+	err := h.conn.ReadProto(cp)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "read consumer payload message")
+	}
+	if err := h.features.consumer(cp); err != nil {
+		cp.Error = errorFormat(err)
+		return nil, nil, multierr.Append(err, errors.Wrap(h.conn.WriteProto(cp), "write refused consumer payload to connection"))
+	}
 
-func consumerPayload(conn net.Conn) (*messages.ConsumerPayload, error) {
-	buff := make([]byte, consumerMessageSize)
-	n, err := conn.Read(buff)
+	if cp.Ephemeral {
+		name, err := h.broker.CreateReplyTopic()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "create reply topic")
+		}
+		h.ephemeral = name
+		cp.Topic = string(name)
+	}
+
+	sub, err := subscription(cp)
+	if err != nil {
+		cp.Error = errorFormat(err)
+		return nil, nil, multierr.Append(err, errors.Wrap(h.conn.WriteProto(cp), "write refused consumer payload to connection"))
+	}
+
+	err = h.conn.WriteProto(cp)
 	if err != nil {
-		return nil, errors.Wrap(err, "read from buffer")
+		return nil, nil, errors.Wrap(err, "write to pong payload to connection")
 	}
-	if n == 0 {
-		return nil, errNullMessage
+
+	return cp, sub, nil
+}
+
+// subscription is the topic with the more topics and patterns of the payload
+// and its filter.
+func subscription(pp *messages.ConsumerPayload) (*Subscription, error) {
+	topics := make([]string, 0, len(pp.Topics)+1)
+	if pp.Topic != "" || len(pp.Topics) == 0 {
+		topics = append(topics, pp.Topic)
 	}
 
-	cp := &messages.ConsumerPayload{}
-	err = proto.Unmarshal(buff[:n], cp)
+	sub, err := NewSubscription(append(topics, pp.Topics...)...)
+	if err != nil {
+		return nil, errors.Wrap(err, "consumer subscription")
+	}
+
+	if pp.Filter != "" {
+		filter, err := ParseFilter(pp.Filter)
+		if err != nil {
+			return nil, errors.Wrap(err, "consumer subscription")
+		}
+		sub.SetFilter(filter)
+	}
+	sub.SetReadCommitted(pp.ReadCommitted)
+
+	return sub, nil
+}
+
+// seek moves the consumer group to the requested start position
+// in every topic the subscription reads at the moment.
+func (h *Handler) seek(pp *messages.ConsumerPayload, sub *Subscription) error {
+	if pp.Offset == nil && pp.Timestamp == nil && !pp.ResumeCommitted {
+		return nil
+	}
+
+	names, err := h.broker.Match(sub)
 	if err != nil {
-		return nil, errors.Wrap(err, "proto-unmarshal consumer payload message")
+		return errors.Wrap(err, "match subscription topics")
+	}
+
+	for _, name := range names {
+		switch {
+		case pp.Offset != nil:
+			err = errors.Wrapf(
+				h.broker.Seek(name, pp.Group, int(pp.GetOffset())),
+				"seek topic %s to offset %d", name, pp.GetOffset(),
+			)
+		case pp.Timestamp != nil:
+			err = errors.Wrapf(
+				h.broker.SeekTime(name, pp.Group, time.Unix(0, pp.GetTimestamp())),
+				"seek topic %s to timestamp %d", name, pp.GetTimestamp(),
+			)
+		default:
+			err = errors.Wrapf(
+				h.broker.SeekCommitted(name, pp.Group),
+				"seek topic %s to committed offset", name,
+			)
+		}
+		if err != nil {
+			return err
+		}
 	}
 
-	_, err = conn.Write(buff[:n])
+	return nil
+}
+
+// snapshot is the write offsets by topic the consumer group has to read
+// past before the snapshot ends.
+type snapshot map[TopicName]int
+
+// newSnapshot remembers the write offsets of the subscription topics.
+func newSnapshot(b *Broker, sub *Subscription) (snapshot, error) {
+	names, err := b.Match(sub)
 	if err != nil {
-		return nil, errors.Wrap(err, "write to pong payload to connection")
+		return nil, errors.Wrap(err, "match snapshot topics")
 	}
 
-	return cp, nil
+	s := make(snapshot, len(names))
+	for _, name := range names {
+		_, write, err := b.Offsets(name, "")
+		if err != nil {
+			return nil, errors.Wrap(err, "snapshot topic offsets")
+		}
+		s[name] = write
+	}
+
+	return s, nil
 }
 
-func (h *Handler) consumer(topic TopicName) error {
-	buff := make([]byte, consumerPingMessageSize)
-	n, err := h.conn.Read(buff)
+// ended reports whether the group read every snapshot topic
+// past its write offset at the subscription, deleted topics are ended.
+func (s snapshot) ended(b *Broker, group string) (bool, error) {
+	for name, end := range s {
+		read, _, err := b.Offsets(name, group)
+		if err != nil && !errors.Is(err, ErrTopicNotFound) {
+			return false, errors.Wrap(err, "snapshot topic offsets")
+		}
+		if err != nil || read >= end {
+			delete(s, name)
+		}
+	}
+
+	return len(s) == 0, nil
+}
+
+// maxPollWait bounds the wait of a poll, the shutdown waits for it.
+const maxPollWait = time.Second * 5
+
+func (h *Handler) consumer(ctx context.Context, sub *Subscription, group string) error {
+	// every empty frame from the consumer polls the next message
+	err := h.conn.DiscardFrame()
 	if err != nil {
-		return errors.Wrap(err, "read from buffer")
+		return errors.Wrap(err, "read consumer poll")
 	}
-	if n == 0 {
-		return errNullMessage
+
+	mm := &messages.ConsumerResponse{
+		GoingAway: h.goingAway(),
+	}
+
+	if h.snapshot != nil {
+		ended, err := h.snapshot.ended(h.broker, group)
+		if err != nil {
+			return h.fail(err)
+		}
+		if ended {
+			h.snapshot = nil
+			mm.IsEmpty, mm.SnapshotEnd = true, true
+			return errors.Wrap(h.conn.WriteProto(mm), "write snapshot end to connection")
+		}
+	}
+	// taken before the read, so a write right after it is not missed
+	var written <-chan struct{}
+	if h.maxWait > 0 {
+		var stop func()
+		written, stop = h.broker.written(sub)
+		defer stop()
 	}
 
-	mm := &messages.ConsumerResponse{}
-	bb, err := h.broker.Read(topic)
+	topic, bb, err := h.broker.ReadSubscription(sub, group)
+	if err == nil && bb == nil && h.maxWait > 0 && h.waitWritten(ctx, written) {
+		topic, bb, err = h.broker.ReadSubscription(sub, group)
+		mm.GoingAway = h.goingAway()
+	}
 	if err != nil {
-		return errors.Wrapf(err, "read from broker by topic %s", topic)
+		return h.fail(errors.Wrap(err, "read from broker by subscription"))
 	}
 	if bb == nil {
 		mm.IsEmpty = true
-		return errors.Wrap(writeProto(h.conn, mm), "write zero message to connection")
+		return errors.Wrap(h.conn.WriteProto(mm), "write zero message to connection")
 	}
 
-	mm.Message = bb
+	return h.deliver(ctx, topic, bb, mm)
+}
+
+// waitWritten waits up to maxWait for a write to the subscription topics,
+// false when none happened.
+func (h *Handler) waitWritten(ctx context.Context, written <-chan struct{}) bool {
+	timer := time.NewTimer(h.maxWait)
+	defer timer.Stop()
+
+	select {
+	case <-written:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// fail answers the poll with the typed error, the connection is closed after it.
+func (h *Handler) fail(err error) error {
+	return multierr.Append(err, errors.Wrap(
+		h.conn.WriteProto(&messages.ConsumerResponse{
+			IsEmpty: true,
+			Error:   errorFormat(err),
+		}),
+		"write poll error to connection",
+	))
+}
+
+// fillResponse sets the message fields but the payload, the headers carry
+// the trace context of ctx.
+func fillResponse(ctx context.Context, topic TopicName, m *Message, mm *messages.ConsumerResponse) {
+	mm.Topic = string(topic)
+	mm.Key = m.Key
+	mm.Headers = injectSpan(ctx, m.Headers)
+	mm.Offset = int64(m.Offset)
+	mm.Timestamp = m.Timestamp.UnixNano()
+	mm.Priority = int32(m.Priority)
+}
+
+// consumerMessageField is the number of the ConsumerResponse message field.
+var consumerMessageField = (&messages.ConsumerResponse{}).ProtoReflect().Descriptor().Fields().ByName("message").Number()
+
+func (h *Handler) deliver(ctx context.Context, topic TopicName, m *Message, mm *messages.ConsumerResponse) (err error) {
+	ctx, span := startSpan(ctx, "jellyfish.deliver", trace.SpanKindProducer, topic, m.Headers)
+	defer func() { endSpan(span, err) }()
+
+	fillResponse(ctx, topic, m, mm)
+	// the payload is written from the storage memory, not copied into the frame
 	return errors.Wrapf(
-		writeProto(h.conn, mm),
+		h.conn.WriteProtoBytes(mm, consumerMessageField, m.Payload),
 		"write message by topic %s to connection",
 		topic,
 	)
@@ -0,0 +1,420 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/baibikov/jellyfish/pkg/conn"
+	"github.com/baibikov/jellyfish/protogenerated/messages"
+)
+
+// muxProduceQueue is the produce requests read ahead of the one being written.
+const muxProduceQueue = 64
+
+// maxFetchBytes stops a fetch once its messages reach the size.
+const maxFetchBytes = 1 << 20
+
+// maxFetchedSize is the size of the fetched messages fitting the frame with
+// the response envelope, a message not fitting is kept for the next fetch.
+const maxFetchedSize = conn.MaxFrameSize - 64
+
+// mux is the state of a multiplexed connection, its requests are served
+// concurrently and answered in the order they complete. The messages are
+// written one by one in the order they were sent, as by a producer connection.
+type mux struct {
+	// write serializes the responses.
+	write sync.Mutex
+
+	mutex sync.Mutex
+	subs  map[uint64]*muxSub
+
+	wg        sync.WaitGroup
+	goingAway atomic.Bool
+}
+
+// muxSub is a subscription of the multiplexed connection.
+type muxSub struct {
+	// mutex serializes the fetches of the subscription.
+	mutex    sync.Mutex
+	sub      *Subscription
+	group    string
+	snapshot snapshot
+	// pending is the message read by the fetch it did not fit,
+	// the next fetch starts with it.
+	pending *messages.ConsumerResponse
+}
+
+func (h *Handler) muxDo(ctx context.Context) {
+	defer h.close("multiplex")
+
+	m := &mux{subs: make(map[uint64]*muxSub)}
+	// the requests in flight are answered before the connection is closed
+	defer m.wg.Wait()
+
+	produce := make(chan *messages.MuxRequest, muxProduceQueue)
+	defer close(produce)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		for req := range produce {
+			h.muxProduce(ctx, m, req.Id, req.GetProduce())
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		req := &messages.MuxRequest{}
+		if err := h.conn.ReadProto(req); err != nil {
+			if isSysError(err) {
+				logrus.Info("multiplex: close connection")
+				return
+			}
+
+			logrus.Error("multiplex: ", err)
+			return
+		}
+
+		if req.GetProduce() != nil {
+			produce <- req
+		} else {
+			m.wg.Add(1)
+			go func() {
+				defer m.wg.Done()
+				h.serve(ctx, m, req)
+			}()
+		}
+
+		if m.goingAway.Load() {
+			logrus.Info("multiplex: broker is going away, close connection")
+			return
+		}
+	}
+}
+
+// serve answers the request, a failed one with the typed error.
+func (h *Handler) serve(ctx context.Context, m *mux, req *messages.MuxRequest) {
+	resp := &messages.MuxResponse{Id: req.Id}
+
+	var err error
+	switch body := req.Body.(type) {
+	case *messages.MuxRequest_Subscribe:
+		err = h.muxSubscribe(m, req.Id, body.Subscribe)
+	case *messages.MuxRequest_Fetch:
+		var fetched *messages.Fetched
+		fetched, err = h.muxFetch(ctx, m, body.Fetch)
+		resp.Body = &messages.MuxResponse_Fetched{Fetched: fetched}
+	case *messages.MuxRequest_Heartbeat:
+	case *messages.MuxRequest_Unsubscribe:
+		err = h.muxRelease(m, body.Unsubscribe, nil)
+	case *messages.MuxRequest_Release:
+		err = h.muxRelease(m, body.Release.Subscription, body.Release.Undelivered)
+	case *messages.MuxRequest_Admin:
+		var topics []byte
+		topics, err = h.muxAdmin(body.Admin)
+		if topics != nil {
+			resp.Body = &messages.MuxResponse_Topics{Topics: topics}
+		}
+	default:
+		err = errors.Wrapf(ErrInvalidRequest, "request %d has no body", req.Id)
+	}
+	if err != nil {
+		logrus.Info("multiplex: ", err)
+		resp.Body, resp.Error = nil, errorFormat(err)
+	}
+
+	h.muxWrite(m, resp)
+}
+
+func (h *Handler) muxWrite(m *mux, resp *messages.MuxResponse) {
+	resp.GoingAway = h.clients.isGoingAway()
+	if resp.GoingAway {
+		m.goingAway.Store(true)
+	}
+
+	m.write.Lock()
+	err := h.conn.WriteProto(resp)
+	if errors.Is(err, conn.ErrFrameTooLarge) {
+		// nothing was written, the request is answered with the error
+		logrus.Info("multiplex: ", err)
+		err = h.conn.WriteProto(&messages.MuxResponse{Id: resp.Id, Error: errorFormat(err), GoingAway: resp.GoingAway})
+	}
+	m.write.Unlock()
+	if err != nil && !isSysError(err) {
+		logrus.Error("multiplex: ", errors.Wrapf(err, "write response %d to connection", resp.Id))
+	}
+}
+
+// muxProduce writes the message as the producer connection does, the ask
+// is the response. The transactions are bound to the producer connection.
+func (h *Handler) muxProduce(ctx context.Context, m *mux, id uint64, pp *messages.ProducerPayload) {
+	answer := func(err error) {
+		resp := &messages.MuxResponse{Id: id}
+		if err != nil {
+			resp.Error = errorFormat(err)
+		} else {
+			resp.Body = &messages.MuxResponse_Ask{Ask: &messages.ProducerAsk{Ask: true}}
+		}
+		h.muxWrite(m, resp)
+	}
+
+	err := h.muxAppend(ctx, pp, func() {
+		if pp.Acks == messages.Acks_ACKS_LEADER {
+			answer(nil)
+		}
+	})
+	if err != nil {
+		logrus.Info("multiplex: ", err)
+	}
+
+	switch pp.Acks {
+	case messages.Acks_ACKS_ALL:
+		answer(err)
+	case messages.Acks_ACKS_LEADER:
+		if errors.Is(err, errReplication) {
+			// asked once written
+			return
+		}
+		if err != nil {
+			answer(err)
+		}
+	}
+}
+
+// muxAppend writes and replicates the message, written is called
+// between the two.
+func (h *Handler) muxAppend(ctx context.Context, pp *messages.ProducerPayload, written func()) (err error) {
+	if pp.Txn != 0 || pp.TxnOp != messages.TxnOp_TXN_OP_NONE {
+		return errors.Wrap(ErrInvalidRequest, "transactions are not multiplexed")
+	}
+	if err := h.features.producer(pp); err != nil {
+		return err
+	}
+
+	if err := checkMessageSize(pp); err != nil {
+		return err
+	}
+
+	ctx, span := startSpan(ctx, "jellyfish.append", trace.SpanKindServer, TopicName(pp.Topic), pp.Headers)
+	defer func() { endSpan(span, err) }()
+
+	at := deliverAt(pp)
+	message, partition := payloadMessage(ctx, pp, at)
+	err = h.broker.WriteAt(TopicName(pp.Topic), message, at)
+	if err != nil {
+		return errors.Wrap(err, "write message to broker")
+	}
+	written()
+
+	if h.pp != nil && h.pp.HasPeers() {
+		return h.replicate(ctx, partition)
+	}
+	return nil
+}
+
+// muxSubscribe opens the subscription under the request id.
+func (h *Handler) muxSubscribe(m *mux, id uint64, cp *messages.ConsumerPayload) error {
+	if cp.Ephemeral {
+		return errors.Wrap(ErrInvalidRequest, "reply topics are not multiplexed")
+	}
+	if err := h.features.consumer(cp); err != nil {
+		return err
+	}
+
+	sub, err := subscription(cp)
+	if err != nil {
+		return err
+	}
+	if cp.Snapshot {
+		cp.Offset, cp.Timestamp = proto.Int64(0), nil
+	}
+	if err := h.seek(cp, sub); err != nil {
+		return err
+	}
+
+	ms := &muxSub{sub: sub, group: cp.Group}
+	if cp.Snapshot {
+		if ms.snapshot, err = newSnapshot(h.broker, sub); err != nil {
+			return err
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.subs[id]; ok {
+		return errors.Wrapf(ErrInvalidRequest, "subscription %d is open", id)
+	}
+	m.subs[id] = ms
+	return nil
+}
+
+// muxRelease closes the subscription, its group is moved back to the first
+// of the undelivered messages and of the pending one by topic, so they are
+// delivered again rather than lost.
+func (h *Handler) muxRelease(m *mux, id uint64, undelivered []*messages.Position) error {
+	m.mutex.Lock()
+	ms := m.subs[id]
+	delete(m.subs, id)
+	m.mutex.Unlock()
+	if ms == nil {
+		return nil
+	}
+
+	// a fetch in flight ends first
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if mm := ms.pending; mm != nil && !mm.IsEmpty {
+		undelivered = append(undelivered, &messages.Position{Topic: mm.Topic, Offset: mm.Offset})
+	}
+
+	first := make(map[TopicName]int)
+	for _, pos := range undelivered {
+		name := TopicName(pos.Topic)
+		if offset, ok := first[name]; !ok || int(pos.Offset) < offset {
+			first[name] = int(pos.Offset)
+		}
+	}
+
+	for name, offset := range first {
+		err := h.broker.Seek(name, ms.group, offset)
+		if err != nil && !errors.Is(err, ErrTopicNotFound) {
+			return errors.Wrapf(err, "release topic %s to offset %d", name, offset)
+		}
+	}
+	return nil
+}
+
+// muxFetch reads up to max messages of the subscription, the snapshot end
+// is the last response of the fetch it happens in. The fetched messages fit
+// the frame, a message never fitting it stays pending and the fetch fails
+// with ErrFrameTooLarge, the produce refuses such messages.
+func (h *Handler) muxFetch(ctx context.Context, m *mux, f *messages.Fetch) (*messages.Fetched, error) {
+	m.mutex.Lock()
+	ms := m.subs[f.Subscription]
+	m.mutex.Unlock()
+	if ms == nil {
+		return nil, errors.Wrapf(ErrInvalidRequest, "subscription %d not found", f.Subscription)
+	}
+
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	limit := int(f.Max)
+	if limit < 1 {
+		limit = 1
+	}
+
+	fetched := &messages.Fetched{}
+	for size := 0; len(fetched.Messages) < limit && size < maxFetchBytes; {
+		mm := ms.pending
+		ms.pending = nil
+		if mm == nil {
+			var err error
+			if mm, err = h.fetchNext(ctx, ms); err != nil {
+				return nil, err
+			}
+			if mm == nil {
+				break
+			}
+		}
+
+		n := protowire.SizeTag(fetchedMessagesField) + protowire.SizeBytes(proto.Size(mm))
+		if size+n > maxFetchedSize {
+			ms.pending = mm
+			if len(fetched.Messages) == 0 {
+				return nil, errors.Wrapf(conn.ErrFrameTooLarge,
+					"message %d of topic %s is %d bytes", mm.Offset, mm.Topic, n)
+			}
+			break
+		}
+
+		fetched.Messages = append(fetched.Messages, mm)
+		size += n
+		if mm.SnapshotEnd {
+			break
+		}
+	}
+
+	return fetched, nil
+}
+
+// fetchedMessagesField is the number of the Fetched messages field.
+var fetchedMessagesField = (&messages.Fetched{}).ProtoReflect().Descriptor().Fields().ByName("messages").Number()
+
+// fetchNext reads the next message of the subscription, nil when there is none.
+func (h *Handler) fetchNext(ctx context.Context, ms *muxSub) (*messages.ConsumerResponse, error) {
+	if ms.snapshot != nil {
+		ended, err := ms.snapshot.ended(h.broker, ms.group)
+		if err != nil {
+			return nil, err
+		}
+		if ended {
+			ms.snapshot = nil
+			return &messages.ConsumerResponse{IsEmpty: true, SnapshotEnd: true}, nil
+		}
+	}
+
+	topic, message, err := h.broker.ReadSubscription(ms.sub, ms.group)
+	if err != nil {
+		return nil, errors.Wrap(err, "read from broker by subscription")
+	}
+	if message == nil {
+		return nil, nil
+	}
+
+	spanCtx, span := startSpan(ctx, "jellyfish.deliver", trace.SpanKindProducer, topic, message.Headers)
+	mm := &messages.ConsumerResponse{Message: message.Payload}
+	fillResponse(spanCtx, topic, message, mm)
+	endSpan(span, nil)
+
+	return mm, nil
+}
+
+// muxAdmin serves the admin request, the topics are answered in the json
+// of the admin endpoints.
+func (h *Handler) muxAdmin(a *messages.Admin) ([]byte, error) {
+	switch a.Op {
+	case messages.AdminOp_ADMIN_OP_TOPICS:
+		topics, err := json.Marshal(h.broker.Topics())
+		return topics, errors.Wrap(err, "json-marshal topics")
+	case messages.AdminOp_ADMIN_OP_CREATE_TOPIC:
+		var config TopicConfig
+		if len(a.Config) != 0 {
+			if err := json.Unmarshal(a.Config, &config); err != nil {
+				return nil, errors.Wrapf(ErrInvalidTopicConfig, "json-unmarshal: %s", err)
+			}
+		}
+		return nil, h.broker.CreateTopic(TopicName(a.Topic), config)
+	case messages.AdminOp_ADMIN_OP_DELETE_TOPIC:
+		return nil, h.broker.DeleteTopic(TopicName(a.Topic))
+	default:
+		return nil, errors.Wrapf(ErrInvalidRequest, "undefined admin operation %d", a.Op)
+	}
+}
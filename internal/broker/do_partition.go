@@ -15,16 +15,16 @@ package broker
 
 import (
 	"context"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
-	"github.com/baibikov/jellyfish/pkg/conn"
 	"github.com/baibikov/jellyfish/protogenerated/messages"
 )
 
 func (h *Handler) partitionDo(ctx context.Context) {
-	defer closeConnection(h.conn, "partition")
+	defer h.close("partition")
 	for {
 		select {
 		case <-ctx.Done():
@@ -39,21 +39,29 @@ func (h *Handler) partitionDo(ctx context.Context) {
 				logrus.Error("partition:", err)
 				return
 			}
+			if h.clients.isGoingAway() {
+				logrus.Info("partition: broker is going away, close connection")
+				return
+			}
 		}
 	}
 }
 
 func (h *Handler) partition() error {
-	pc := conn.New(h.conn)
-
 	mm := &messages.Partition{}
-	err := pc.ReadProto(mm)
+	err := h.conn.ReadProto(mm)
 	if err != nil {
 		return errors.Wrap(err, "read from partition")
 	}
 
-	err = pc.WriteProto(&messages.PartitionAsk{
-		Ask: true,
+	// the slave keeps the replica as the leader wrote it
+	err = h.broker.WriteAt(TopicName(mm.Topic), partitionMessage(mm), partitionDeliverAt(mm))
+	if err != nil {
+		logrus.Info("partition: ", err)
+	}
+
+	err = h.conn.WriteProto(&messages.PartitionAsk{
+		Ask: err == nil,
 	})
 	if err != nil {
 		return errors.Wrap(err, "write ask from partition")
@@ -62,3 +70,24 @@ func (h *Handler) partition() error {
 	logrus.Debugf("partition topic %s message %s asked", mm.Topic, mm.Message)
 	return nil
 }
+
+// partitionMessage is the message of the replica.
+func partitionMessage(mm *messages.Partition) *Message {
+	return &Message{
+		Key:      mm.Key,
+		Payload:  mm.Message,
+		Headers:  mm.Headers,
+		TTL:      time.Duration(mm.Ttl),
+		Priority: int(mm.Priority),
+	}
+}
+
+// partitionDeliverAt is the time the replica becomes visible,
+// zero is at once.
+func partitionDeliverAt(mm *messages.Partition) time.Time {
+	if mm.DeliverAt == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, mm.DeliverAt)
+}
@@ -15,16 +15,20 @@ package broker
 
 import (
 	"context"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/multierr"
 	"google.golang.org/protobuf/proto"
 
+	"github.com/baibikov/jellyfish/pkg/conn"
 	"github.com/baibikov/jellyfish/protogenerated/messages"
 )
 
 func (h *Handler) producerDo(ctx context.Context) {
-	defer closeConnection(h.conn, "producer")
+	defer h.close("producer")
 	for {
 		select {
 		case <-ctx.Done():
@@ -39,50 +43,195 @@ func (h *Handler) producerDo(ctx context.Context) {
 				logrus.Error("producer:", err)
 				return
 			}
+			if h.notified {
+				logrus.Info("producer: broker is going away, close connection")
+				return
+			}
 		}
 	}
 }
 
-func (h *Handler) producer(ctx context.Context) error {
-	buff := make([]byte, produceMessageSize)
-	n, err := h.conn.Read(buff)
+func (h *Handler) producer(ctx context.Context) (err error) {
+	pp := &messages.ProducerPayload{}
+	// the payload is kept by the storage in the memory it was read into
+	err = h.conn.ReadProtoBytes(pp, producerMessageField)
+	if errors.Is(err, conn.ErrFrameTooLarge) {
+		// the frame body is not read, the stream can not go on
+		return multierr.Append(err, h.refuse(err))
+	}
 	if err != nil {
-		return errors.Wrap(err, "read to buffer")
+		return errors.Wrap(err, "read producer payload")
 	}
-	if n == 0 {
-		return errNullMessage
+
+	if err := h.features.producer(pp); err != nil {
+		// the message is refused, the connection goes on
+		logrus.Info("producer: ", err)
+		if pp.Acks == messages.Acks_ACKS_NONE && pp.TxnOp == messages.TxnOp_TXN_OP_NONE {
+			return nil
+		}
+		return h.refuse(err)
 	}
 
-	pp := &messages.ProducerPayload{}
-	err = proto.Unmarshal(buff[:n], pp)
-	if err != nil {
-		return errors.Wrap(err, "unmarshal message from buffer")
+	if pp.TxnOp != messages.TxnOp_TXN_OP_NONE {
+		return h.txnControl(ctx, pp)
+	}
+
+	if err := checkMessageSize(pp); err != nil {
+		// the message is refused, the connection goes on
+		logrus.Info("producer: ", err)
+		if pp.Acks == messages.Acks_ACKS_NONE {
+			return nil
+		}
+		return h.refuse(err)
+	}
+
+	ctx, span := startSpan(ctx, "jellyfish.append", trace.SpanKindServer, TopicName(pp.Topic), pp.Headers)
+	defer func() { endSpan(span, err) }()
+
+	at := deliverAt(pp)
+	message, partition := payloadMessage(ctx, pp, at)
+
+	if pp.Txn != 0 {
+		// the transaction messages are replicated on commit
+		err = h.writeTxn(pp, message, partition)
+		if pp.Acks == messages.Acks_ACKS_NONE {
+			return nil
+		}
+		if err != nil {
+			logrus.Info("producer: ", err)
+			return h.refuse(err)
+		}
+		return h.ask()
 	}
 
-	err = h.broker.Write(TopicName(pp.Topic), pp.Message)
+	err = h.broker.WriteAt(TopicName(pp.Topic), message, at)
+	if errors.Is(err, ErrSchemaRejected) {
+		// the message is refused, the connection goes on
+		logrus.Info("producer: ", err)
+		if pp.Acks == messages.Acks_ACKS_NONE {
+			return nil
+		}
+		return h.refuse(err)
+	}
 	if err != nil {
 		return errors.Wrap(err, "write message to broker")
 	}
 
-	ask := &messages.ProducerAsk{
-		Ask: true,
+	if pp.Acks == messages.Acks_ACKS_LEADER {
+		if err = h.ask(); err != nil {
+			return err
+		}
 	}
 
-	if h.pp != nil {
-		err = h.pp.AskByPeers(ctx, &messages.Partition{
-			Topic:   pp.Topic,
-			Message: pp.Message,
-		})
+	if h.pp != nil && h.pp.HasPeers() {
+		err = h.replicate(ctx, partition)
+		if err != nil && pp.Acks == messages.Acks_ACKS_ALL {
+			// the message is written by the leader, the producer decides on a retry
+			logrus.Info("producer: ", err)
+			return h.refuse(err)
+		}
 		if err != nil {
-			return err
+			// the message is asked already, the connection goes on
+			logrus.Info("producer: ", err)
 		}
 	}
 
-	err = writeProto(h.conn, ask)
-	if err != nil {
-		return errors.Wrap(err, "ask message to connection")
+	if pp.Acks == messages.Acks_ACKS_ALL {
+		if err = h.ask(); err != nil {
+			return err
+		}
 	}
 
 	logrus.Debugf("message %s by topic %s asked and saved", pp.Message, pp.Topic)
 	return nil
 }
+
+// deliveryHeadroom is the part of the frame left for the fields and headers
+// a message gets on delivery and for the response envelope.
+const deliveryHeadroom = 4 << 10
+
+// maxMessageSize is the largest produced message, a bigger one would not fit
+// the frame it is delivered in.
+const maxMessageSize = conn.MaxFrameSize - deliveryHeadroom
+
+// checkMessageSize refuses the message not fitting the delivery frame.
+func checkMessageSize(pp *messages.ProducerPayload) error {
+	if n := proto.Size(pp); n > maxMessageSize {
+		return errors.Wrapf(conn.ErrFrameTooLarge, "message of %d bytes, at most %d", n, maxMessageSize)
+	}
+	return nil
+}
+
+// producerMessageField is the number of the ProducerPayload message field.
+var producerMessageField = (&messages.ProducerPayload{}).ProtoReflect().Descriptor().Fields().ByName("message").Number()
+
+// payloadMessage is the message of the payload and its replica held
+// until at, the headers carry the trace context of ctx.
+func payloadMessage(ctx context.Context, pp *messages.ProducerPayload, at time.Time) (*Message, *messages.Partition) {
+	headers := injectSpan(ctx, pp.Headers)
+	message := &Message{
+		Key:      pp.Key,
+		Payload:  pp.Message,
+		Headers:  headers,
+		TTL:      time.Duration(pp.Ttl),
+		Priority: int(pp.Priority),
+	}
+	partition := &messages.Partition{
+		Topic:    pp.Topic,
+		Message:  pp.Message,
+		Headers:  headers,
+		Key:      pp.Key,
+		Ttl:      pp.Ttl,
+		Priority: pp.Priority,
+	}
+	if !at.IsZero() {
+		partition.DeliverAt = at.UnixNano()
+	}
+
+	return message, partition
+}
+
+// deliverAt is the time the message becomes visible to consumers,
+// zero is at once.
+func deliverAt(pp *messages.ProducerPayload) time.Time {
+	switch {
+	case pp.DeliverAt != nil:
+		return time.Unix(0, pp.GetDeliverAt())
+	case pp.Delay != nil:
+		return time.Now().Add(time.Duration(pp.GetDelay()))
+	default:
+		return time.Time{}
+	}
+}
+
+func (h *Handler) ask() error {
+	return errors.Wrap(
+		h.conn.WriteProto(&messages.ProducerAsk{
+			Ask:       true,
+			GoingAway: h.goingAway(),
+		}),
+		"ask message to connection",
+	)
+}
+
+// refuse asks the message as failed with the typed error.
+func (h *Handler) refuse(err error) error {
+	return errors.Wrap(
+		h.conn.WriteProto(&messages.ProducerAsk{
+			Error:     err.Error(),
+			Failure:   errorFormat(err),
+			GoingAway: h.goingAway(),
+		}),
+		"refuse message to connection",
+	)
+}
+
+func (h *Handler) replicate(ctx context.Context, m *messages.Partition) (err error) {
+	ctx, span := startSpan(ctx, "jellyfish.replicate", trace.SpanKindClient, TopicName(m.Topic), nil)
+	defer func() { endSpan(span, err) }()
+
+	if err := h.pp.AskByPeers(ctx, m); err != nil {
+		return errors.Wrapf(errReplication, "topic %s: %s", m.Topic, err)
+	}
+	return nil
+}
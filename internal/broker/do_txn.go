@@ -0,0 +1,148 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/baibikov/jellyfish/protogenerated/messages"
+)
+
+// connTxn is a transaction begun by the producer connection.
+type connTxn struct {
+	// err is the failed write that aborted the transaction, reported on commit.
+	err error
+	// partitions are the messages replicated once the transaction is committed.
+	partitions []*messages.Partition
+}
+
+// txnControl begins, commits or aborts a transaction. The request is always
+// asked, a failed one with the error and the connection stays open.
+func (h *Handler) txnControl(ctx context.Context, pp *messages.ProducerPayload) error {
+	ask := &messages.ProducerAsk{Ask: true}
+
+	var err error
+	switch pp.TxnOp {
+	case messages.TxnOp_TXN_OP_BEGIN:
+		ask.Txn, err = h.broker.BeginTxn(time.Duration(pp.TxnTimeout))
+		if err == nil {
+			h.txns[ask.Txn] = &connTxn{}
+		}
+	case messages.TxnOp_TXN_OP_COMMIT:
+		err = h.commitTxn(ctx, pp.Txn)
+	case messages.TxnOp_TXN_OP_OFFSET:
+		if _, err = h.txn(pp.Txn); err == nil {
+			err = h.broker.TxnOffset(pp.Txn, TopicName(pp.Topic), pp.Group, int(pp.Offset))
+		}
+	case messages.TxnOp_TXN_OP_ABORT:
+		if _, err = h.txn(pp.Txn); err == nil {
+			delete(h.txns, pp.Txn)
+			err = h.broker.AbortTxn(pp.Txn)
+		}
+	default:
+		err = errors.Wrapf(ErrInvalidTxn, "undefined operation %d", pp.TxnOp)
+	}
+	if err != nil {
+		logrus.Info("producer: ", err)
+		ask.Ask, ask.Error, ask.Failure = false, err.Error(), errorFormat(err)
+	}
+	ask.GoingAway = h.goingAway()
+
+	return errors.Wrap(h.conn.WriteProto(ask), "ask transaction to connection")
+}
+
+// txn returns the transaction begun by the connection, the transactions
+// of the other connections are not found.
+func (h *Handler) txn(id uint64) (*connTxn, error) {
+	t, ok := h.txns[id]
+	if !ok {
+		return nil, errors.Wrapf(ErrTxnNotFound, "transaction %d was not begun by the connection", id)
+	}
+
+	return t, nil
+}
+
+// writeTxn writes the message in its transaction. A failed write aborts
+// the transaction instead of closing the connection, the commit reports it.
+// A transaction not begun by the connection refuses the message.
+func (h *Handler) writeTxn(pp *messages.ProducerPayload, message *Message, partition *messages.Partition) error {
+	t, err := h.txn(pp.Txn)
+	if err != nil {
+		return err
+	}
+
+	if deliverAt(pp).IsZero() {
+		err = h.broker.WriteTxn(pp.Txn, TopicName(pp.Topic), message)
+	} else {
+		err = errors.Wrap(ErrInvalidTxn, "delayed message in a transaction")
+	}
+	if err == nil {
+		t.partitions = append(t.partitions, partition)
+		return nil
+	}
+
+	logrus.Infof("producer: abort transaction %d: %s", pp.Txn, err)
+	if t.err == nil {
+		t.err = err
+	}
+	if err := h.broker.AbortTxn(pp.Txn); err != nil && !errors.Is(err, ErrTxnNotFound) {
+		logrus.Error("producer: ", err)
+	}
+	return nil
+}
+
+func (h *Handler) commitTxn(ctx context.Context, id uint64) error {
+	t, err := h.txn(id)
+	if err != nil {
+		return err
+	}
+
+	delete(h.txns, id)
+	if t.err != nil {
+		return errors.Wrapf(t.err, "transaction %d aborted", id)
+	}
+
+	if err := h.broker.CommitTxn(id); err != nil {
+		return err
+	}
+	if h.pp == nil || !h.pp.HasPeers() {
+		return nil
+	}
+
+	for _, partition := range t.partitions {
+		if err := h.replicate(ctx, partition); err != nil {
+			return errors.Wrapf(err, "transaction %d committed", id)
+		}
+	}
+	return nil
+}
+
+// abortTxns aborts the transactions the closed connection left open.
+func (h *Handler) abortTxns() {
+	for id := range h.txns {
+		err := h.broker.AbortTxn(id)
+		if err != nil && !errors.Is(err, ErrTxnNotFound) {
+			logrus.Error("producer: ", err)
+			continue
+		}
+		if err == nil {
+			logrus.Infof("producer: connection closed, transaction %d aborted", id)
+		}
+	}
+	h.txns = nil
+}
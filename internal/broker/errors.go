@@ -0,0 +1,61 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/pkg/conn"
+	"github.com/baibikov/jellyfish/protogenerated/messages"
+)
+
+// ErrInvalidRequest is returned for a request the connection does not serve.
+var ErrInvalidRequest = errors.New("invalid request")
+
+// errReplication is returned when the peers did not ask a replicated message.
+var errReplication = errors.New("replication failed")
+
+// errorFormat is the typed wire error the client maps to its error values,
+// the errors without a code are sent as ERROR_CODE_UNKNOWN with the text.
+func errorFormat(err error) *messages.ErrorFormat {
+	f := &messages.ErrorFormat{Message: err.Error()}
+	switch {
+	case errors.Is(err, ErrTopicNotFound):
+		f.Code = messages.ErrorCode_ERROR_CODE_TOPIC_NOT_FOUND
+	case errors.Is(err, ErrTopicExists):
+		f.Code = messages.ErrorCode_ERROR_CODE_TOPIC_EXISTS
+	case errors.Is(err, ErrSchemaRejected):
+		f.Code = messages.ErrorCode_ERROR_CODE_SCHEMA_REJECTED
+	case errors.Is(err, conn.ErrFrameTooLarge):
+		f.Code = messages.ErrorCode_ERROR_CODE_MESSAGE_TOO_LARGE
+	case errors.Is(err, ErrTxnNotFound):
+		f.Code = messages.ErrorCode_ERROR_CODE_TXN_NOT_FOUND
+	case errors.Is(err, ErrInvalidRequest),
+		errors.Is(err, ErrInvalidFilter),
+		errors.Is(err, ErrInvalidSubscription),
+		errors.Is(err, ErrInvalidTopicConfig),
+		errors.Is(err, ErrInvalidSchema),
+		errors.Is(err, ErrIncompatibleSchema),
+		errors.Is(err, ErrInvalidTxn):
+		f.Code = messages.ErrorCode_ERROR_CODE_INVALID_REQUEST
+	case errors.Is(err, errIncompatible):
+		f.Code = messages.ErrorCode_ERROR_CODE_INCOMPATIBLE
+	case errors.Is(err, errGoingAway):
+		f.Code, f.Retriable = messages.ErrorCode_ERROR_CODE_GOING_AWAY, true
+	case errors.Is(err, errReplication):
+		f.Code, f.Retriable = messages.ErrorCode_ERROR_CODE_REPLICATION_FAILED, true
+	}
+
+	return f
+}
@@ -0,0 +1,55 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/pkg/brokererr"
+	"github.com/baibikov/jellyfish/pkg/conn"
+)
+
+func TestErrorFormat(t *testing.T) {
+	tests := []struct {
+		err       error
+		want      error
+		retriable bool
+	}{
+		{ErrTopicNotFound, brokererr.ErrTopicNotFound, false},
+		{ErrTopicExists, brokererr.ErrTopicExists, false},
+		{ErrSchemaRejected, brokererr.ErrSchemaRejected, false},
+		{conn.ErrFrameTooLarge, brokererr.ErrMessageTooLarge, false},
+		{ErrTxnNotFound, brokererr.ErrTxnNotFound, false},
+		{ErrInvalidFilter, brokererr.ErrInvalidRequest, false},
+		{ErrInvalidTxn, brokererr.ErrInvalidRequest, false},
+		{errIncompatible, brokererr.ErrIncompatible, false},
+		{errGoingAway, brokererr.ErrGoingAway, true},
+		{errReplication, brokererr.ErrReplicationFailed, true},
+		{errors.New("disk on fire"), brokererr.ErrUnknown, false},
+	}
+	for _, tt := range tests {
+		err := errors.Wrap(tt.err, "request")
+
+		f := errorFormat(err)
+		if f.Message != err.Error() || f.Retriable != tt.retriable {
+			t.Errorf("errorFormat(%v) = %v", err, f)
+		}
+		// the client gets its error value of the code
+		if got := brokererr.FromProto(f); !errors.Is(got, tt.want) {
+			t.Errorf("%v is received as %v, want %v", err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// Filter is a compiled consumer filter expression, it selects the messages
+// by the topic, the key and the headers:
+//
+//	headers.type == "order" && (key prefix "eu-" || topic in ("a", "b"))
+//
+// Fields are topic, key and headers.<name>, a missing header is empty.
+// Comparisons are ==, !=, prefix and in (...), they combine with &&, || and !
+// and group by parentheses. Strings are double or single quoted.
+type Filter struct {
+	expr string
+	root node
+}
+
+const (
+	maxFilterLength = 4096
+	maxFilterDepth  = 32
+)
+
+// ErrInvalidFilter is returned for an expression the filter engine does not parse.
+var ErrInvalidFilter = errors.New("invalid filter")
+
+func ParseFilter(expr string) (*Filter, error) {
+	if len(expr) > maxFilterLength {
+		return nil, errors.Wrapf(ErrInvalidFilter, "expression is longer than %d", maxFilterLength)
+	}
+
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidFilter, err.Error())
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.or(0)
+	if err == nil && !p.done() {
+		err = errors.Errorf("unexpected %q", p.peek().text)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidFilter, "%q: %s", expr, err)
+	}
+
+	return &Filter{
+		expr: expr,
+		root: root,
+	}, nil
+}
+
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// Match reports whether the message of the topic passes the filter, a nil filter passes all.
+func (f *Filter) Match(topic TopicName, m *Message) bool {
+	if f == nil {
+		return true
+	}
+
+	return f.root.eval(topic, m)
+}
+
+type node interface {
+	eval(topic TopicName, m *Message) bool
+}
+
+type (
+	and struct{ left, right node }
+	or  struct{ left, right node }
+	not struct{ node node }
+	cmp struct {
+		field field
+		op    string
+		args  []string
+	}
+)
+
+func (n and) eval(topic TopicName, m *Message) bool {
+	return n.left.eval(topic, m) && n.right.eval(topic, m)
+}
+
+func (n or) eval(topic TopicName, m *Message) bool {
+	return n.left.eval(topic, m) || n.right.eval(topic, m)
+}
+
+func (n not) eval(topic TopicName, m *Message) bool {
+	return !n.node.eval(topic, m)
+}
+
+func (n cmp) eval(topic TopicName, m *Message) bool {
+	v := n.field(topic, m)
+	switch n.op {
+	case "==":
+		return v == n.args[0]
+	case "!=":
+		return v != n.args[0]
+	case "prefix":
+		return strings.HasPrefix(v, n.args[0])
+	default: // in
+		for _, arg := range n.args {
+			if v == arg {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// field reads the compared value of the message.
+type field func(topic TopicName, m *Message) string
+
+const headersField = "headers."
+
+func parseField(name string) (field, error) {
+	switch {
+	case name == "topic":
+		return func(topic TopicName, _ *Message) string { return string(topic) }, nil
+	case name == "key":
+		return func(_ TopicName, m *Message) string { return m.Key }, nil
+	case strings.HasPrefix(name, headersField) && len(name) > len(headersField):
+		header := strings.TrimPrefix(name, headersField)
+		return func(_ TopicName, m *Message) string { return m.Headers[header] }, nil
+	default:
+		return nil, errors.Errorf("undefined field %q, want topic, key or headers.<name>", name)
+	}
+}
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenString
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func lex(expr string) ([]token, error) {
+	tokens := make([]token, 0)
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			for ; end < len(expr) && expr[end] != expr[i]; end++ {
+				if expr[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(expr) {
+				return nil, errors.Errorf("unterminated string at %d", i)
+			}
+
+			s, err := unquote(expr[i : end+1])
+			if err != nil {
+				return nil, errors.Wrapf(err, "string at %d", i)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: s})
+			i = end + 1
+		case strings.HasPrefix(expr[i:], "&&"), strings.HasPrefix(expr[i:], "||"),
+			strings.HasPrefix(expr[i:], "=="), strings.HasPrefix(expr[i:], "!="):
+			tokens = append(tokens, token{kind: tokenOp, text: expr[i : i+2]})
+			i += 2
+		case strings.ContainsRune("!(),", c):
+			tokens = append(tokens, token{kind: tokenOp, text: string(c)})
+			i++
+		case isIdent(c):
+			end := i
+			for end < len(expr) && isIdent(rune(expr[end])) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: expr[i:end]})
+			i = end
+		default:
+			return nil, errors.Errorf("unexpected %q at %d", c, i)
+		}
+	}
+
+	return tokens, nil
+}
+
+func isIdent(c rune) bool {
+	return c == '_' || c == '.' || c == '-' || c < unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c))
+}
+
+func unquote(s string) (string, error) {
+	if s[0] == '\'' {
+		s = `"` + strings.ReplaceAll(strings.ReplaceAll(s[1:len(s)-1], `\'`, `'`), `"`, `\"`) + `"`
+	}
+
+	return strconv.Unquote(s)
+}
+
+// parser is a recursive descent parser of the filter grammar:
+//
+//	or    = and { "||" and }
+//	and   = unary { "&&" unary }
+//	unary = "!" unary | "(" or ")" | field ( "==" | "!=" | "prefix" ) string
+//	      | field "in" "(" string { "," string } ")"
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() token {
+	if p.done() {
+		return token{kind: tokenOp, text: "end of expression"}
+	}
+
+	return p.tokens[p.pos]
+}
+
+func (p *parser) accept(kind tokenKind, text string) bool {
+	if t := p.peek(); !p.done() && t.kind == kind && t.text == text {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) expect(kind tokenKind, text string) error {
+	if !p.accept(kind, text) {
+		return errors.Errorf("want %q, got %q", text, p.peek().text)
+	}
+
+	return nil
+}
+
+func (p *parser) str() (string, error) {
+	t := p.peek()
+	if p.done() || t.kind != tokenString {
+		return "", errors.Errorf("want a string, got %q", t.text)
+	}
+
+	p.pos++
+	return t.text, nil
+}
+
+func (p *parser) or(depth int) (node, error) {
+	left, err := p.and(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept(tokenOp, "||") {
+		right, err := p.and(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = or{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) and(depth int) (node, error) {
+	left, err := p.unary(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept(tokenOp, "&&") {
+		right, err := p.unary(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = and{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) unary(depth int) (node, error) {
+	if depth > maxFilterDepth {
+		return nil, errors.Errorf("expression is nested deeper than %d", maxFilterDepth)
+	}
+
+	if p.accept(tokenOp, "!") {
+		n, err := p.unary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return not{node: n}, nil
+	}
+
+	if p.accept(tokenOp, "(") {
+		n, err := p.or(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect(tokenOp, ")")
+	}
+
+	return p.cmp()
+}
+
+func (p *parser) cmp() (node, error) {
+	t := p.peek()
+	if p.done() || t.kind != tokenIdent {
+		return nil, errors.Errorf("want a field, got %q", t.text)
+	}
+	p.pos++
+
+	f, err := parseField(t.text)
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.peek()
+	p.pos++
+	switch {
+	case op.kind == tokenOp && (op.text == "==" || op.text == "!="),
+		op.kind == tokenIdent && op.text == "prefix":
+		arg, err := p.str()
+		if err != nil {
+			return nil, err
+		}
+		return cmp{field: f, op: op.text, args: []string{arg}}, nil
+	case op.kind == tokenIdent && op.text == "in":
+		if err := p.expect(tokenOp, "("); err != nil {
+			return nil, err
+		}
+
+		args := make([]string, 0)
+		for {
+			arg, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+
+			if !p.accept(tokenOp, ",") {
+				break
+			}
+		}
+		return cmp{field: f, op: "in", args: args}, p.expect(tokenOp, ")")
+	default:
+		return nil, errors.Errorf("want ==, !=, prefix or in after %s, got %q", t.text, op.text)
+	}
+}
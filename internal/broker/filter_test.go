@@ -0,0 +1,124 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestFilterMatch(t *testing.T) {
+	m := &Message{
+		Key:     "eu-42",
+		Headers: map[string]string{"type": "order", "quote": `say "hi"`},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`headers.type == "order"`, true},
+		{`headers.type != "order"`, false},
+		{`headers.missing == ""`, true},
+		{`key prefix "eu-"`, true},
+		{`key prefix 'us-'`, false},
+		{`topic in ("orders", "payments")`, true},
+		{`topic in ('payments')`, false},
+		{`headers.type == "order" && key prefix "us-"`, false},
+		{`headers.type == "order" || key prefix "us-"`, true},
+		{`!(key prefix "us-")`, true},
+		{`!!(topic == "orders")`, true},
+		// && binds tighter than ||
+		{`topic == "x" && key == "y" || headers.type == "order"`, true},
+		{`topic == "x" && (key == "y" || headers.type == "order")`, false},
+		{`headers.quote == "say \"hi\""`, true},
+		{`headers.quote == 'say "hi"'`, true},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.expr, err)
+		}
+		if got := f.Match("orders", m); got != tt.want {
+			t.Errorf("%s = %t, want %t", tt.expr, got, tt.want)
+		}
+		if f.String() != tt.expr {
+			t.Errorf("String() = %s, want %s", f.String(), tt.expr)
+		}
+	}
+
+	var none *Filter
+	if !none.Match("orders", m) {
+		t.Error("nil filter does not pass the message")
+	}
+}
+
+func TestFilterInvalid(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`key`,
+		`key ==`,
+		`key == order`,
+		`value == "x"`,
+		`headers. == "x"`,
+		`key == "x" &&`,
+		`key == "x" key == "y"`,
+		`(key == "x"`,
+		`key in ()`,
+		`key in ("a" "b")`,
+		`key ~ "x"`,
+		`key == "unterminated`,
+		strings.Repeat("!", maxFilterDepth+2) + `key == "x"`,
+		strings.Repeat("(", maxFilterDepth+2) + `key == "x"` + strings.Repeat(")", maxFilterDepth+2),
+		`key == "` + strings.Repeat("x", maxFilterLength) + `"`,
+	} {
+		if _, err := ParseFilter(expr); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("%.40q: %v, want invalid filter", expr, err)
+		}
+	}
+}
+
+func TestReadSubscriptionFilter(t *testing.T) {
+	b := NewBroker()
+	for _, typ := range []string{"order", "refund", "order"} {
+		if err := b.Write("events", &Message{Payload: []byte(typ), Headers: map[string]string{"type": typ}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := NewSubscription("events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ParseFilter(`headers.type == "refund"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetFilter(f)
+
+	_, m, err := b.ReadSubscription(s, "")
+	if err != nil || m == nil || string(m.Payload) != "refund" {
+		t.Fatalf("read %v, %v, want the refund", m, err)
+	}
+	if _, m, _ := b.ReadSubscription(s, ""); m != nil {
+		t.Fatalf("read %s, want nothing", m.Payload)
+	}
+
+	// the skipped messages moved the group offset
+	if read, write, _ := b.Offsets("events", ""); read != write {
+		t.Fatalf("read offset %d, want %d", read, write)
+	}
+}
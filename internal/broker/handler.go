@@ -17,79 +17,98 @@ import (
 	"context"
 	"io"
 	"net"
+	"os"
 	"syscall"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
-	"google.golang.org/protobuf/proto"
 
+	"github.com/baibikov/jellyfish/pkg/conn"
 	pinger "github.com/baibikov/jellyfish/pkg/ping"
 	"github.com/baibikov/jellyfish/protogenerated/messages"
 )
 
 type Handler struct {
-	conn   net.Conn
-	broker *Broker
-	pp     *Partition
+	conn    *conn.Conn
+	broker  *Broker
+	pp      *Partition
+	clients *clients
+
+	// features are agreed on in the handshake, the requests using
+	// the other features are refused.
+	features features
+	// notified is set once the client was told the broker is going away.
+	notified bool
+	// ephemeral is the reply topic deleted when the connection closes.
+	ephemeral TopicName
+	// snapshot is the consumer snapshot, nil out of the snapshot.
+	snapshot snapshot
+	// maxWait is how long a consumer poll finding no message waits for one.
+	maxWait time.Duration
+	// txns are the transactions begun by the connection,
+	// they are aborted when the connection closes.
+	txns map[uint64]*connTxn
 }
 
-func NewHandler(conn net.Conn, broker *Broker, pp *Partition) *Handler {
+func NewHandler(c net.Conn, broker *Broker, pp *Partition, clients *clients) *Handler {
 	return &Handler{
-		conn:   conn,
-		broker: broker,
-		pp:     pp,
+		conn:    conn.New(c),
+		broker:  broker,
+		pp:      pp,
+		clients: clients,
+		txns:    make(map[uint64]*connTxn),
 	}
 }
 
 func (h *Handler) Do(ctx context.Context) {
 	if err := h.do(ctx); err != nil {
-		closeConnection(h.conn, "do")
+		h.close("do")
+		if errors.Is(err, errGoingAway) {
+			logrus.Info("broker: ", err)
+			return
+		}
 		logrus.Error("broker", err)
 	}
 }
 
-const (
-	pingMessageSize    = 512
-	produceMessageSize = 1024
-)
-
 func (h *Handler) do(ctx context.Context) error {
 	select {
 	case <-ctx.Done():
-		return nil
+		return errGoingAway
 	default:
 	}
-
-	buff := make([]byte, pingMessageSize)
-	n, err := h.conn.Read(buff)
-	if err != nil {
-		return errors.Wrap(err, "do connection read ping")
-	}
-	if n == 0 {
-		return errNullMessage
+	if h.clients.isGoingAway() {
+		return errGoingAway
 	}
 
 	ping := &messages.Ping{}
-	err = proto.Unmarshal(buff[:n], ping)
-	if err != nil {
-		return errors.Wrap(err, "proto-message unmarshal")
+	err := h.conn.ReadHandshake(ping)
+	if errors.Is(err, conn.ErrUnframed) {
+		pong, rejected := legacyPong(err)
+		if err := h.conn.WriteUnframed(pong); err != nil {
+			return errors.Wrap(err, "do connection write pong")
+		}
+		return rejected
 	}
-
-	pong := &messages.Pong{
-		Pong: true,
-	}
-
-	bb, err := proto.Marshal(pong)
 	if err != nil {
-		return errors.Wrap(err, "proto-message marshal")
+		return errors.Wrap(err, "do connection read ping")
 	}
 
-	_, err = h.conn.Write(bb)
+	pong, rejected := negotiate(ping)
+	err = h.conn.WriteProto(pong)
 	if err != nil {
 		return errors.Wrap(err, "do connection write pong")
 	}
+	if rejected != nil {
+		return rejected
+	}
 
-	logrus.Debugf("start listen messages by type %d", ping.GetPing())
+	logrus.Debugf("start listen messages by type %d, protocol version %d", ping.GetPing(), pong.Version)
+	h.features = negotiated(pong)
+	if h.clients != nil {
+		h.clients.hello(h, ping, pong)
+	}
 
 	switch ping.Ping {
 	case pinger.Publisher.Int32():
@@ -101,6 +120,9 @@ func (h *Handler) do(ctx context.Context) error {
 	case pinger.Partition.Int32():
 		logrus.Info("start partition execution")
 		go h.partitionDo(ctx)
+	case pinger.Multiplex.Int32():
+		logrus.Info("start multiplex execution")
+		go h.muxDo(ctx)
 	default:
 		return errors.New("undefined ping message type")
 	}
@@ -108,29 +130,44 @@ func (h *Handler) do(ctx context.Context) error {
 	return nil
 }
 
+func (h *Handler) goingAway() bool {
+	if h.clients.isGoingAway() {
+		h.notified = true
+	}
+
+	return h.notified
+}
+
 func isSysError(err error) bool {
-	return errors.Is(err, io.EOF) || errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, os.ErrDeadlineExceeded)
 }
 
-func closeConnection(conn net.Conn, space string) {
+func (h *Handler) close(space string) {
 	if v := recover(); v != any(nil) {
 		logrus.Errorf("space %s rec error: %+v", space, v)
 	}
 
-	err := conn.Close()
-	if err != nil {
-		logrus.Error(space, err)
+	if h.clients != nil {
+		h.clients.remove(h)
 	}
-}
 
-var errNullMessage = errors.New("null message")
+	h.abortTxns()
 
-func writeProto(conn net.Conn, message proto.Message) error {
-	bb, err := proto.Marshal(message)
-	if err != nil {
-		return errors.Wrap(err, "proto marshal")
+	if h.ephemeral != "" {
+		if err := h.broker.DeleteTopic(h.ephemeral); err != nil && !errors.Is(err, ErrTopicNotFound) {
+			logrus.Error(space, err)
+		}
+		h.ephemeral = ""
 	}
 
-	_, err = conn.Write(bb)
-	return errors.Wrap(err, "write proto message to connection")
+	err := h.conn.Close()
+	if err != nil {
+		logrus.Error(space, err)
+	}
 }
+
+var errGoingAway = errors.New("broker is going away")
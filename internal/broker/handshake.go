@@ -0,0 +1,180 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/pkg/conn"
+	pinger "github.com/baibikov/jellyfish/pkg/ping"
+	"github.com/baibikov/jellyfish/protogenerated/messages"
+)
+
+// errIncompatible is returned for a client rejected by the handshake.
+var errIncompatible = errors.New("incompatible client")
+
+// negotiate picks the highest protocol version both the client and the broker
+// speak and the features both support. An incompatible client gets the pong
+// with the reason and the error is returned.
+func negotiate(ping *messages.Ping) (*messages.Pong, error) {
+	version, minVersion := ping.Version, ping.MinVersion
+	if version == 0 {
+		// a framed client older than the negotiation, the unframed
+		// clients of version 1 are rejected by legacyPong
+		version, minVersion = conn.FramedVersion, conn.FramedVersion
+	}
+	if minVersion == 0 {
+		minVersion = conn.FramedVersion
+	}
+
+	if minVersion > pinger.ProtocolVersion || version < pinger.MinProtocolVersion {
+		client := strconv.Quote(ping.ClientId)
+		if ping.ClientVersion != "" {
+			client += " " + ping.ClientVersion
+		}
+		reason := errors.Errorf(
+			"client %s speaks protocol versions [%d, %d], broker speaks [%d, %d]",
+			client, minVersion, version, pinger.MinProtocolVersion, pinger.ProtocolVersion,
+		)
+		err := errors.Wrap(errIncompatible, reason.Error())
+		return &messages.Pong{Failure: errorFormat(err)}, err
+	}
+	if version > pinger.ProtocolVersion {
+		version = pinger.ProtocolVersion
+	}
+
+	pong := &messages.Pong{
+		Pong:          true,
+		Version:       version,
+		BrokerVersion: pinger.Version(),
+		Features:      commonFeatures(ping.Features),
+	}
+	if ping.Ping == pinger.Multiplex.Int32() {
+		if err := negotiated(pong).require(pinger.FeatureMultiplex); err != nil {
+			return &messages.Pong{Failure: errorFormat(err)}, err
+		}
+	}
+
+	return pong, nil
+}
+
+// legacyPong rejects a client of version 1 writing bare protobuf messages,
+// the pong is written bare too for the client to read the reason.
+func legacyPong(cause error) (*messages.Pong, error) {
+	err := errors.Wrapf(errIncompatible, "client speaks protocol version 1, broker speaks [%d, %d]: %s",
+		pinger.MinProtocolVersion, pinger.ProtocolVersion, cause)
+	return &messages.Pong{Failure: errorFormat(err)}, err
+}
+
+// commonFeatures returns the client features the broker supports in the client order.
+func commonFeatures(features []string) []string {
+	supported := make(map[string]bool, len(pinger.Features))
+	for _, f := range pinger.Features {
+		supported[f] = true
+	}
+
+	common := make([]string, 0, len(features))
+	for _, f := range features {
+		if supported[f] {
+			common = append(common, f)
+			// listed once
+			supported[f] = false
+		}
+	}
+
+	return common
+}
+
+// features are the features agreed on with the client, nil for a client
+// older than the negotiation, it is served every feature.
+type features map[string]bool
+
+// negotiated are the features of the pong.
+func negotiated(pong *messages.Pong) features {
+	if pong.Version < pinger.ProtocolVersion {
+		return nil
+	}
+
+	f := make(features, len(pong.Features))
+	for _, feature := range pong.Features {
+		f[feature] = true
+	}
+
+	return f
+}
+
+// require refuses the request using a feature not agreed on.
+func (f features) require(used ...string) error {
+	if f == nil {
+		return nil
+	}
+
+	for _, feature := range used {
+		if !f[feature] {
+			return errors.Wrapf(ErrInvalidRequest, "feature %s was not negotiated", feature)
+		}
+	}
+
+	return nil
+}
+
+// producer refuses the payload using a feature not agreed on, the acks
+// levels below ACKS_ALL the batches are pushed with are the batching.
+func (f features) producer(pp *messages.ProducerPayload) error {
+	var used []string
+	if pp.Txn != 0 || pp.TxnOp != messages.TxnOp_TXN_OP_NONE {
+		used = append(used, pinger.FeatureTransactions)
+	}
+	if pp.DeliverAt != nil || pp.Delay != nil {
+		used = append(used, pinger.FeatureDelayed)
+	}
+	if pp.Priority != 0 {
+		used = append(used, pinger.FeaturePriority)
+	}
+	if pp.Acks != messages.Acks_ACKS_ALL {
+		used = append(used, pinger.FeatureBatching)
+	}
+
+	return f.require(used...)
+}
+
+// consumer refuses the subscription using a feature not agreed on.
+func (f features) consumer(cp *messages.ConsumerPayload) error {
+	var used []string
+	if isPattern(cp.Topic) {
+		used = append(used, pinger.FeaturePatterns)
+	}
+	for _, topic := range cp.Topics {
+		if isPattern(topic) {
+			used = append(used, pinger.FeaturePatterns)
+			break
+		}
+	}
+	if cp.Filter != "" {
+		used = append(used, pinger.FeatureFilters)
+	}
+	if cp.Snapshot {
+		used = append(used, pinger.FeatureSnapshot)
+	}
+	if cp.Ephemeral {
+		used = append(used, pinger.FeatureRequestReply)
+	}
+	if cp.ReadCommitted || cp.ResumeCommitted {
+		used = append(used, pinger.FeatureTransactions)
+	}
+
+	return f.require(used...)
+}
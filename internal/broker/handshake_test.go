@@ -0,0 +1,195 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/baibikov/jellyfish/pkg/conn"
+	pinger "github.com/baibikov/jellyfish/pkg/ping"
+	"github.com/baibikov/jellyfish/protogenerated/messages"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name                string
+		version, minVersion uint32
+		want                uint32
+		rejected            bool
+	}{
+		{"current", pinger.ProtocolVersion, pinger.MinProtocolVersion, pinger.ProtocolVersion, false},
+		{"newer client", pinger.ProtocolVersion + 2, pinger.MinProtocolVersion, pinger.ProtocolVersion, false},
+		{"framed before negotiation", 0, 0, conn.FramedVersion, false},
+		{"unframed", 1, 1, 0, true},
+		{"too new", pinger.ProtocolVersion + 2, pinger.ProtocolVersion + 1, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pong, err := negotiate(&messages.Ping{Version: tt.version, MinVersion: tt.minVersion, ClientId: "c"})
+			if tt.rejected {
+				if err == nil || pong.Pong || pong.Failure.GetCode() != messages.ErrorCode_ERROR_CODE_INCOMPATIBLE {
+					t.Fatalf("pong %v, err %v, want rejected as incompatible", pong, err)
+				}
+				return
+			}
+			if err != nil || !pong.Pong || pong.Version != tt.want {
+				t.Fatalf("pong %v, err %v, want version %d", pong, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommonFeatures(t *testing.T) {
+	got := commonFeatures([]string{pinger.FeatureMultiplex, "compression:gzip", pinger.FeatureBatching, pinger.FeatureMultiplex})
+	if strings.Join(got, ",") != pinger.FeatureMultiplex+","+pinger.FeatureBatching {
+		t.Fatalf("common features %v, want the supported ones once in the client order", got)
+	}
+}
+
+func TestHandshakeSession(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go NewHandler(server, NewBroker(), nil, newClients()).Do(ctx)
+
+	session, err := pinger.New(client).Handshake(ctx, pinger.Publisher, pinger.Hello{ClientID: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Version != pinger.ProtocolVersion || strings.Join(session.Features, ",") != strings.Join(pinger.Features, ",") {
+		t.Fatalf("session %+v, want the current version with every feature", session)
+	}
+}
+
+func TestLegacyClientRejected(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go NewHandler(server, NewBroker(), nil, newClients()).Do(ctx)
+
+	// a client of version 1 writes the bare ping and reads the bare pong,
+	// the broker reads only the first byte so the write does not end
+	ping, err := proto.Marshal(&messages.Ping{Ping: pinger.Publisher.Int32()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _, _ = client.Write(ping) }()
+
+	b := make([]byte, 1024)
+	n, err := client.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pong := &messages.Pong{}
+	if err := proto.Unmarshal(b[:n], pong); err != nil {
+		t.Fatalf("unmarshal bare pong: %v", err)
+	}
+	if pong.Pong || pong.Failure.GetCode() != messages.ErrorCode_ERROR_CODE_INCOMPATIBLE {
+		t.Fatalf("pong %v, want rejected as incompatible", pong)
+	}
+
+	if _, err := client.Read(b); err == nil {
+		t.Fatal("connection of the legacy client is kept open")
+	}
+}
+
+func TestFeaturesRequired(t *testing.T) {
+	agreed := negotiated(&messages.Pong{Version: pinger.ProtocolVersion, Features: []string{pinger.FeatureFilters}})
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"agreed", agreed.consumer(&messages.ConsumerPayload{Topic: "orders", Filter: `key == "a"`}), true},
+		{"filter only", agreed.consumer(&messages.ConsumerPayload{Topic: "orders.*", Filter: `key == "a"`}), false},
+		{"snapshot", agreed.consumer(&messages.ConsumerPayload{Topic: "orders", Snapshot: true}), false},
+		{"reply topic", agreed.consumer(&messages.ConsumerPayload{Ephemeral: true}), false},
+		{"read committed", agreed.consumer(&messages.ConsumerPayload{Topic: "orders", ReadCommitted: true}), false},
+		{"plain message", agreed.producer(&messages.ProducerPayload{Topic: "orders"}), true},
+		{"priority", agreed.producer(&messages.ProducerPayload{Topic: "orders", Priority: 5}), false},
+		{"delay", agreed.producer(&messages.ProducerPayload{Topic: "orders", Delay: proto.Int64(1)}), false},
+		{"transaction", agreed.producer(&messages.ProducerPayload{TxnOp: messages.TxnOp_TXN_OP_BEGIN}), false},
+		{"batching", agreed.producer(&messages.ProducerPayload{Topic: "orders", Acks: messages.Acks_ACKS_LEADER}), false},
+		{"before negotiation", features(nil).producer(&messages.ProducerPayload{Topic: "orders", Priority: 5, Txn: 1}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.err == nil) != tt.want || (tt.err != nil && !errors.Is(tt.err, ErrInvalidRequest)) {
+				t.Fatalf("err = %v, want allowed %t", tt.err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultiplexRequiresFeature(t *testing.T) {
+	pong, err := negotiate(&messages.Ping{
+		Ping:       pinger.Multiplex.Int32(),
+		Version:    pinger.ProtocolVersion,
+		MinVersion: pinger.MinProtocolVersion,
+		Features:   []string{pinger.FeatureBatching},
+	})
+	if !errors.Is(err, ErrInvalidRequest) || pong.Pong || pong.Failure.GetCode() != messages.ErrorCode_ERROR_CODE_INVALID_REQUEST {
+		t.Fatalf("pong %v, err %v, want refused as invalid request", pong, err)
+	}
+}
+
+func TestUnnegotiatedFeatureRefused(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go NewHandler(server, NewBroker(), nil, newClients()).Do(ctx)
+
+	session, err := pinger.New(client).Handshake(ctx, pinger.Publisher, pinger.Hello{Features: []string{pinger.FeatureBatching}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Has(pinger.FeaturePriority) {
+		t.Fatalf("session %+v, want priority left out", session)
+	}
+
+	c := conn.New(client)
+	ask := &messages.ProducerAsk{}
+	if err := c.WriteProto(&messages.ProducerPayload{Topic: "orders", Message: []byte("a"), Priority: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ReadProto(ask); err != nil {
+		t.Fatal(err)
+	}
+	if ask.Ask || ask.Failure.GetCode() != messages.ErrorCode_ERROR_CODE_INVALID_REQUEST {
+		t.Fatalf("ask %v, want refused as invalid request", ask)
+	}
+
+	// the connection goes on with the negotiated features
+	if err := c.WriteProto(&messages.ProducerPayload{Topic: "orders", Message: []byte("b")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ReadProto(ask); err != nil {
+		t.Fatal(err)
+	}
+	if !ask.Ask {
+		t.Fatalf("ask %v, want the plain message asked", ask)
+	}
+}
@@ -16,19 +16,31 @@ package broker
 import (
 	"context"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/multierr"
 
 	"github.com/baibikov/jellyfish/internal/config"
 )
 
 type Listener struct {
-	closed    bool
+	closed    atomic.Bool
+	ready     atomic.Bool
 	listener  net.Listener
 	broker    *Broker
 	partition *Partition
-	config    *config.Config
+	clients   *clients
+	config    atomic.Pointer[config.Config]
+
+	// ctx is a handlers context, it is canceled after shutdown
+	// so the handlers are not abandoned by a canceled broadcast context.
+	ctx    context.Context
+	cancel context.CancelFunc
+	once   sync.Once
 }
 
 const tcpProtocol = "tcp"
@@ -43,41 +55,189 @@ func New(config *config.Config) (*Listener, error) {
 		return nil, errors.Wrap(err, "run listen broker")
 	}
 
+	return NewWithListener(config, l, net.Dial)
+}
+
+// NewWithListener serves the broker on an already listening l, dial
+// connects to the slaves, it allows in-memory transports in tests.
+func NewWithListener(config *config.Config, l net.Listener, dial DialFunc) (*Listener, error) {
+	if config == nil {
+		return nil, errors.New("config has not be empty")
+	}
+
+	var err error
+	ctx, cancel := context.WithCancel(context.Background())
 	listener := &Listener{
 		listener: l,
-		config:   config,
 		broker:   NewBroker(),
+		clients:  newClients(),
+		ctx:      ctx,
+		cancel:   cancel,
 	}
 
-	if len(config.Slaves) != 0 {
-		listener.partition, err = NewPartition(time.Second*2, config.Slaves)
-		if err != nil {
-			return nil, err
-		}
+	listener.config.Store(config)
+	listener.partition, err = NewPartition(time.Second*2, config.Slaves, dial)
+	if err != nil {
+		cancel()
+		return nil, multierr.Append(err, l.Close())
 	}
 
+	go listener.compact()
+
 	return listener, err
 }
 
+const (
+	defaultShutdownTimeout    = time.Second * 10
+	defaultCompactionInterval = time.Second * 30
+	drainInterval             = time.Millisecond * 500
+)
+
+// compact compacts the compacted topics every configured interval
+// until the listener is shut down.
+func (l *Listener) compact() {
+	for {
+		interval := l.config.Load().CompactionInterval
+		if interval <= 0 {
+			interval = defaultCompactionInterval
+		}
+
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-time.After(interval):
+			if removed := l.broker.Compact(); removed != 0 {
+				logrus.Debugf("compaction removed %d messages", removed)
+			}
+		}
+	}
+}
+
+// Close shuts the listener down gracefully within the configured timeout.
 func (l *Listener) Close() error {
-	l.closed = true
-	return l.listener.Close()
+	timeout := l.config.Load().ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return l.Shutdown(ctx)
 }
 
+// Shutdown stops accepting connections, tells connected clients the broker
+// is going away, lets the in-flight requests and replication finish and
+// waits for the handlers until ctx is done.
+func (l *Listener) Shutdown(ctx context.Context) (err error) {
+	l.once.Do(func() {
+		defer l.cancel()
+
+		l.ready.Store(false)
+		err = l.stopAccept()
+
+		interval := drainInterval
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < interval {
+			interval = time.Until(deadline)
+		}
+		l.clients.drain(interval)
+
+		multierr.AppendInto(&err, errors.Wrap(l.clients.wait(ctx), "wait handlers"))
+		multierr.AppendInto(&err, errors.Wrap(l.partition.Close(), "close partition"))
+	})
+
+	return err
+}
+
+func (l *Listener) stopAccept() error {
+	if l.closed.Swap(true) {
+		return nil
+	}
+
+	return errors.Wrap(l.listener.Close(), "close listener")
+}
+
+// Broadcast accepts connections until the listener is shut down or ctx is done.
 func (l *Listener) Broadcast(ctx context.Context) error {
-	return l.broadcast(ctx)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = l.stopAccept()
+		case <-l.ctx.Done():
+		}
+	}()
+
+	return l.broadcast()
 }
 
-func (l *Listener) broadcast(ctx context.Context) error {
+// Reconfigure applies the config changes safe for a running broker:
+// the slaves are connected or disconnected, the shutdown timeout and
+// the compaction interval are updated.
+// The listen address is never changed.
+func (l *Listener) Reconfigure(cnf *config.Config) error {
+	if cnf == nil {
+		return errors.New("config has not be empty")
+	}
+
+	if err := l.partition.SetPeers(cnf.Slaves); err != nil {
+		return errors.Wrap(err, "set slaves")
+	}
+
+	l.config.Store(cnf)
+	return nil
+}
+
+// Ready reports whether the listener accepts connections and,
+// when slaves are configured, every replication peer is connected.
+func (l *Listener) Ready() bool {
+	if !l.ready.Load() {
+		return false
+	}
+
+	return l.partition.Connected()
+}
+
+func (l *Listener) Topics() []TopicStats {
+	return l.broker.Topics()
+}
+
+// Addr returns the address the broker listens on.
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// Storage returns the topics storage served by the listener.
+func (l *Listener) Storage() *Broker {
+	return l.broker
+}
+
+func (l *Listener) Clients() []ClientInfo {
+	return l.clients.list()
+}
+
+func (l *Listener) Peers() []PeerStatus {
+	return l.partition.Peers()
+}
+
+func (l *Listener) broadcast() error {
+	l.ready.Store(true)
+	defer l.ready.Store(false)
+
 	for {
 		conn, err := l.listener.Accept()
 		if err != nil {
-			if l.closed {
+			if l.closed.Load() {
 				return nil
 			}
 			return errors.Wrap(err, "broadcast accept connection")
 		}
 
-		go NewHandler(conn, l.broker, l.partition).Do(ctx)
+		// the handler is registered before it runs, so the shutdown waits for it
+		h := NewHandler(conn, l.broker, l.partition, l.clients)
+		if !l.clients.add(h) {
+			_ = conn.Close()
+			continue
+		}
+		go h.Do(l.ctx)
 	}
 }
@@ -0,0 +1,262 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/internal/config"
+	"github.com/baibikov/jellyfish/pkg/consumer"
+	"github.com/baibikov/jellyfish/pkg/producer"
+)
+
+// startListener serves a broker without slaves on a loopback port
+// until the test ends.
+func startListener(t *testing.T) *Listener {
+	t.Helper()
+
+	nl, err := net.Listen(tcpProtocol, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cnf := config.Default()
+	cnf.Addr = nl.Addr().String()
+	l, err := NewWithListener(cnf, nl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if err := l.Broadcast(context.Background()); err != nil {
+			t.Errorf("broadcast: %v", err)
+		}
+	}()
+	t.Cleanup(func() { _ = l.Close() })
+
+	return l
+}
+
+func TestShutdownDrainsClients(t *testing.T) {
+	l := startListener(t)
+	addr := l.Addr().String()
+
+	p, err := producer.New(&producer.Config{Addr: addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err := p.Push(ctx, &producer.Params{Topic: "orders", Message: []byte("created")}); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	c, err := consumer.New(&consumer.Config{Addr: addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	payloads := c.Consume(ctx, "orders")
+	if m := <-payloads; m.Err() != nil || string(m.Message) != "created" {
+		t.Fatalf("consumed %q, %v", m.Message, m.Err())
+	}
+
+	if err := l.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if l.Ready() {
+		t.Fatal("listener is ready after shutdown")
+	}
+	if clients := l.Clients(); len(clients) != 0 {
+		t.Fatalf("clients after shutdown = %v", clients)
+	}
+
+	var last error
+	for m := range payloads {
+		last = m.Err()
+	}
+	if !errors.Is(last, consumer.ErrGoingAway) {
+		t.Fatalf("consumer ended with %v, want going away", last)
+	}
+
+	if _, err := net.Dial(tcpProtocol, addr); err == nil {
+		t.Fatal("listener accepts connections after shutdown")
+	}
+}
+
+func TestShutdownClosesForcibly(t *testing.T) {
+	c := newClients()
+
+	server, client := net.Pipe()
+	defer client.Close()
+
+	// the handler never reads, so only the forced close ends it
+	h := NewHandler(server, NewBroker(), nil, c)
+	c.add(h)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	err := c.wait(ctx)
+	if err == nil || !strings.Contains(err.Error(), "1 connections closed forcibly") {
+		t.Fatalf("wait = %v, want one connection closed forcibly", err)
+	}
+
+	if _, err := client.Write([]byte{0}); err == nil {
+		t.Fatal("connection is not closed")
+	}
+}
+
+func TestClientsAddedBeforeDrain(t *testing.T) {
+	c := newClients()
+
+	server, client := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	h := NewHandler(server, NewBroker(), nil, c)
+	if !c.add(h) {
+		t.Fatal("handler not added")
+	}
+	c.drain(0)
+
+	// the handler added later would not be waited for
+	if c.add(NewHandler(server, NewBroker(), nil, c)) {
+		t.Fatal("handler added while going away")
+	}
+
+	c.remove(h)
+	if err := c.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandlerRefusesWhenGoingAway(t *testing.T) {
+	c := newClients()
+	c.drain(0)
+
+	server, client := net.Pipe()
+	defer client.Close()
+
+	h := NewHandler(server, NewBroker(), nil, c)
+	if err := h.do(context.Background()); !errors.Is(err, errGoingAway) {
+		t.Fatalf("do = %v, want going away", err)
+	}
+}
+
+func TestProducerAcksLevels(t *testing.T) {
+	l := startListener(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	for _, acks := range []producer.Acks{producer.AcksAll, producer.AcksLeader, producer.AcksNone} {
+		p, err := producer.New(&producer.Config{Addr: l.Addr().String(), Acks: acks})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		batch := []*producer.Params{
+			{Topic: "orders", Message: []byte("created")},
+			{Topic: "orders", Message: []byte("paid")},
+		}
+		if err := p.PushBatch(ctx, batch); err != nil {
+			t.Fatalf("acks %d: push batch: %v", acks, err)
+		}
+		if err := p.Push(ctx, &producer.Params{Topic: "orders", Message: []byte("shipped")}); err != nil {
+			t.Fatalf("acks %d: push: %v", acks, err)
+		}
+		_ = p.Close()
+	}
+
+	// the messages not acknowledged are written shortly
+	deadline := time.Now().Add(time.Second * 2)
+	for {
+		_, write, err := l.Storage().Offsets("orders", "")
+		if err == nil && write == 9 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("written %d messages, want 9", write)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	for i := 0; i < 9; i++ {
+		m, err := l.Storage().Read("orders", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"created", "paid", "shipped"}[i%3]; string(m.Payload) != want {
+			t.Fatalf("message %d = %s, want %s", i, m.Payload, want)
+		}
+	}
+}
+
+func TestProducerKeepsConnectionAfterLeaderAck(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// the slave closes the connection before the handshake, every replication fails
+	pp, err := NewPartition(time.Second, []string{"dead"}, func(_, _ string) (net.Conn, error) {
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pp.Close()
+
+	b := NewBroker()
+	dials := 0
+	p, err := producer.New(&producer.Config{
+		Addr: "leader",
+		Acks: producer.AcksLeader,
+		Dial: func(_, _ string) (net.Conn, error) {
+			dials++
+			client, server := net.Pipe()
+			go NewHandler(server, b, pp, newClients()).Do(ctx)
+			return client, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	for _, m := range []string{"created", "paid"} {
+		if err := p.Push(ctx, &producer.Params{Topic: "orders", Message: []byte(m)}); err != nil {
+			t.Fatalf("push %s: %v", m, err)
+		}
+	}
+
+	_, write, err := b.Offsets("orders", "")
+	if err != nil || write != 2 {
+		t.Fatalf("written %d messages (%v), want 2", write, err)
+	}
+	if dials != 1 {
+		t.Fatalf("leader dialed %d times, want the connection kept", dials)
+	}
+}
@@ -0,0 +1,166 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/pkg/brokererr"
+	"github.com/baibikov/jellyfish/pkg/conn"
+	muxclient "github.com/baibikov/jellyfish/pkg/mux"
+	"github.com/baibikov/jellyfish/pkg/ping"
+	"github.com/baibikov/jellyfish/pkg/producer"
+	"github.com/baibikov/jellyfish/protogenerated/messages"
+)
+
+func dialMux(ctx context.Context, t *testing.T, l *Listener) *muxclient.Conn {
+	t.Helper()
+
+	c, err := muxclient.Dial(ctx, &muxclient.Config{Addr: l.Addr().String(), PollInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+
+	return c
+}
+
+func TestMuxConcurrentRequests(t *testing.T) {
+	l := startListener(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	c := dialMux(ctx, t, l)
+
+	const publishers, published = 4, 25
+	var wg sync.WaitGroup
+	for i := 0; i < publishers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < published; j++ {
+				params := &producer.Params{Topic: fmt.Sprintf("orders.%d", i), Message: []byte(fmt.Sprint(j))}
+				if err := c.Publish(ctx, params); err != nil {
+					t.Errorf("publish: %v", err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	topics, err := c.Topics(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(topics) != publishers {
+		t.Fatalf("topics %v, want %d", topics, publishers)
+	}
+
+	// every topic keeps the order of its publisher
+	next := make(map[string]int)
+	payloads := c.Subscribe(ctx, muxclient.Subscription{Topics: []string{"orders.*"}, Group: "g"})
+	for read := 0; read < publishers*published; read++ {
+		p := <-payloads
+		if p.Err() != nil {
+			t.Fatal(p.Err())
+		}
+		if string(p.Message) != fmt.Sprint(next[p.Topic]) {
+			t.Fatalf("read %s from %s, want %d", p.Message, p.Topic, next[p.Topic])
+		}
+		next[p.Topic]++
+	}
+}
+
+func TestMuxFetchFitsFrame(t *testing.T) {
+	l := startListener(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	c := dialMux(ctx, t, l)
+
+	// the big message does not fit the frame after the small one, the fetch is split
+	for _, size := range []int{512 << 10, conn.MaxFrameSize - 1024, 512 << 10} {
+		if err := l.Storage().Write("big", &Message{Payload: make([]byte, size)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	payloads := c.Subscribe(ctx, muxclient.Subscription{Topics: []string{"big"}})
+	for i := 0; i < 3; i++ {
+		if p := <-payloads; p.Err() != nil || p.Offset != int64(i) {
+			t.Fatalf("read offset %d, %v, want %d", p.Offset, p.Err(), i)
+		}
+	}
+
+	// a message never fitting the frame is refused, not left unanswered
+	if err := l.Storage().Write("huge", &Message{Payload: make([]byte, conn.MaxFrameSize-8)}); err != nil {
+		t.Fatal(err)
+	}
+	payloads = c.Subscribe(ctx, muxclient.Subscription{Topics: []string{"huge"}})
+	if p := <-payloads; !errors.Is(p.Err(), brokererr.ErrMessageTooLarge) {
+		t.Fatalf("read %d bytes, %v, want ErrMessageTooLarge", len(p.Message), p.Err())
+	}
+	// the message is not skipped, the released subscription moved back to it
+	for range payloads {
+	}
+	if read, _, err := l.Storage().Offsets("huge", ""); err != nil || read != 0 {
+		t.Fatalf("huge read offset %d (%v), want 0", read, err)
+	}
+
+	// such a message is refused on produce
+	err := c.Publish(ctx, &producer.Params{Topic: "huge", Message: make([]byte, conn.MaxFrameSize-1024)})
+	if !errors.Is(err, brokererr.ErrMessageTooLarge) {
+		t.Fatalf("publish = %v, want ErrMessageTooLarge", err)
+	}
+}
+
+func TestMuxRejectsTransactions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go NewHandler(server, NewBroker(), nil, newClients()).Do(ctx)
+
+	session, err := ping.New(client).Handshake(ctx, ping.Multiplex, ping.Hello{Features: ping.Features})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !session.Has(ping.FeatureMultiplex) {
+		t.Fatalf("session %+v has no multiplex", session)
+	}
+
+	c := conn.New(client)
+	for id, pp := range map[uint64]*messages.ProducerPayload{
+		1: {Topic: "orders", Txn: 1, Acks: messages.Acks_ACKS_ALL},
+		2: {TxnOp: messages.TxnOp_TXN_OP_BEGIN, Acks: messages.Acks_ACKS_ALL},
+	} {
+		req := &messages.MuxRequest{Id: id, Body: &messages.MuxRequest_Produce{Produce: pp}}
+		if err := c.WriteProto(req); err != nil {
+			t.Fatal(err)
+		}
+		resp := &messages.MuxResponse{}
+		if err := c.ReadProto(resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Id != id || resp.Error.GetCode() != messages.ErrorCode_ERROR_CODE_INVALID_REQUEST {
+			t.Fatalf("response %v to a transaction request %d, want refused", resp, id)
+		}
+	}
+}
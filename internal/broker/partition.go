@@ -16,9 +16,11 @@ package broker
 import (
 	"context"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"go.uber.org/multierr"
 
 	"github.com/baibikov/jellyfish/internal/pkg/timeoutgroup"
@@ -30,27 +32,97 @@ import (
 // simple ISR message writing implement
 
 type Partition struct {
+	mutex           sync.RWMutex
 	pullConnections []*peer
 	timeout         time.Duration
+	dial            DialFunc
+
+	done chan struct{}
+	once sync.Once
 }
 
-func NewPartition(timeout time.Duration, connections []string) (*Partition, error) {
-	if connections == nil {
-		return nil, errors.New("broker connections has not be empty")
+// DialFunc connects to a broker by the address.
+type DialFunc func(network, addr string) (net.Conn, error)
+
+// Backoff of the redial of a failed peer, it doubles by every failed redial.
+const (
+	minRedialBackoff = time.Millisecond * 250
+	maxRedialBackoff = time.Second * 10
+)
+
+// NewPartition connects to the slaves, a partition without connections
+// replicates nothing until peers are set. The failed peers are redialed
+// in the background until the partition is closed.
+func NewPartition(timeout time.Duration, connections []string, dial DialFunc) (*Partition, error) {
+	if dial == nil {
+		dial = net.Dial
 	}
 
-	pull, err := initPullConnections(connections)
+	pull, err := initPullConnections(connections, dial)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Partition{
+	p := &Partition{
 		pullConnections: pull,
 		timeout:         timeout,
-	}, nil
+		dial:            dial,
+		done:            make(chan struct{}),
+	}
+	go p.redial()
+
+	return p, nil
 }
 
-func initPullConnections(connections []string) (peers []*peer, err error) {
+// SetPeers disconnects the removed slaves and adds the new ones as failed,
+// the redial connects them in the background, the kept slaves stay connected.
+func (p *Partition) SetPeers(connections []string) (err error) {
+	for i, addr := range connections {
+		if addr == "" {
+			return errors.Errorf("connection by index - [%d] empty", i)
+		}
+	}
+
+	p.mutex.Lock()
+	current := make(map[string]*peer, len(p.pullConnections))
+	for _, pp := range p.pullConnections {
+		current[pp.addr] = pp
+	}
+
+	pull := make([]*peer, 0, len(connections))
+	for _, addr := range connections {
+		if pp, ok := current[addr]; ok {
+			pull = append(pull, pp)
+			delete(current, addr)
+			continue
+		}
+
+		pp := newPeer(addr, nil, p.dial)
+		pp.isFail = true
+		pull = append(pull, pp)
+	}
+	p.pullConnections = pull
+	p.mutex.Unlock()
+
+	for _, pp := range current {
+		multierr.AppendInto(&err, errors.Wrapf(pp.Close(), "close peer %s", pp.addr))
+	}
+
+	return err
+}
+
+func (p *Partition) peers() []*peer {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.pullConnections
+}
+
+func (p *Partition) HasPeers() bool {
+	return len(p.peers()) != 0
+}
+
+func initPullConnections(connections []string, dial DialFunc) (peers []*peer, err error) {
 	pull := make([]*peer, len(connections))
 	defer func() {
 		if err == nil {
@@ -70,40 +142,141 @@ func initPullConnections(connections []string) (peers []*peer, err error) {
 			return nil, errors.Errorf("connection by index - [%d] empty", i)
 		}
 
-		c, err := net.Dial(tcpProtocol, connections[i])
+		c, err := dial(tcpProtocol, connections[i])
 		if err != nil {
 			return nil, errors.Wrapf(err, "connection by index - [%d]", i)
 		}
 
-		pull[i] = newPeer(c)
+		pull[i] = newPeer(connections[i], c, dial)
 	}
 
 	return pull, nil
 }
 
 type peer struct {
+	addr string
+	dial DialFunc
+	// exchange is held across a request and its reply on the connection,
+	// the handlers replicating concurrently would read the replies of each other.
+	// A redial holds it too, so the connection is not replaced under a request.
+	exchange sync.Mutex
+
+	mutex  sync.RWMutex
+	conn   net.Conn
 	isFail bool
 	isInit bool
+	closed bool
+	// retryAt is when the failed or not initialized peer is redialed,
+	// backoff is the delay of the next failed redial.
+	retryAt time.Time
+	backoff time.Duration
+}
 
-	net.Conn
+func newPeer(addr string, c net.Conn, dial DialFunc) *peer {
+	return &peer{
+		addr:    addr,
+		dial:    dial,
+		conn:    c,
+		backoff: minRedialBackoff,
+	}
 }
 
 func (p *peer) init() {
+	p.mutex.Lock()
 	p.isInit = true
+	p.mutex.Unlock()
 }
 
+// failed marks the peer failed and schedules its redial.
 func (p *peer) failed() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
 	p.isFail = true
+	p.retryAt = time.Now().Add(p.backoff)
+	p.backoff *= 2
+	if p.backoff > maxRedialBackoff {
+		p.backoff = maxRedialBackoff
+	}
 }
 
 func (p *peer) success() {
+	p.mutex.Lock()
 	p.isFail = false
+	p.backoff = minRedialBackoff
+	p.mutex.Unlock()
 }
 
-func newPeer(conn net.Conn) *peer {
-	return &peer{
-		Conn: conn,
+func (p *peer) state() (isInit, isFail bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.isInit, p.isFail
+}
+
+// due reports whether the peer has to be redialed by now.
+func (p *peer) due(now time.Time) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if p.closed || (p.isInit && !p.isFail) {
+		return false
+	}
+
+	return !now.Before(p.retryAt)
+}
+
+func (p *peer) connection() net.Conn {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.conn
+}
+
+func (p *peer) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.closed = true
+	if p.conn == nil {
+		// added by SetPeers and not dialed yet
+		return nil
 	}
+	return p.conn.Close()
+}
+
+// PeerStatus is a snapshot of a replication peer state used by introspection.
+type PeerStatus struct {
+	Addr        string `json:"addr"`
+	Initialized bool   `json:"initialized"`
+	Failed      bool   `json:"failed"`
+}
+
+func (p *Partition) Peers() []PeerStatus {
+	pull := p.peers()
+	statuses := make([]PeerStatus, 0, len(pull))
+	for _, pp := range pull {
+		isInit, isFail := pp.state()
+		statuses = append(statuses, PeerStatus{
+			Addr:        pp.addr,
+			Initialized: isInit,
+			Failed:      isFail,
+		})
+	}
+
+	return statuses
+}
+
+// Connected reports whether every replication peer answered the handshake
+// and did not fail since.
+func (p *Partition) Connected() bool {
+	for _, pp := range p.peers() {
+		if isInit, isFail := pp.state(); !isInit || isFail {
+			return false
+		}
+	}
+
+	return true
 }
 
 func (p *Partition) AskByPeers(ctx context.Context, m *messages.Partition) error {
@@ -112,40 +285,153 @@ func (p *Partition) AskByPeers(ctx context.Context, m *messages.Partition) error
 
 	tg := timeoutgroup.New(ctx)
 
-	tg.Go(func() error {
-		for _, pp := range p.pullConnections {
-			if pp.isFail {
-				continue
-			}
+	tg.Go(func() (err error) {
+		// a failed peer does not keep the message from the others
+		for _, pp := range p.peers() {
+			multierr.AppendInto(&err, pp.replicate(ctx, m))
+		}
+		return err
+	})
 
-			if !pp.isInit && !pp.ping(ctx) {
-				pp.failed()
-				continue
-			}
+	return tg.Wait()
+}
 
-			if !pp.isInit {
-				pp.init()
-			}
+// replicate writes the message to the peer and reads its ask,
+// a failed peer misses the message until it is redialed.
+func (p *peer) replicate(ctx context.Context, m *messages.Partition) error {
+	p.exchange.Lock()
+	defer p.exchange.Unlock()
+
+	isInit, isFail := p.state()
+	if isFail {
+		return errors.Errorf("by remote addr - %s: peer failed", p.addr)
+	}
+
+	c := p.connection()
+	// a reply not read in time would be read by the next request,
+	// the peer is failed by the timeout instead
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := c.SetDeadline(deadline); err != nil {
+			p.failed()
+			return errors.Wrapf(err, "by remote addr - %s", p.addr)
+		}
+		defer c.SetDeadline(time.Time{})
+	}
+
+	if !isInit {
+		if err := handshake(ctx, c); err != nil {
+			p.failed()
+			return errors.Wrapf(err, "by remote addr - %s: handshake", p.addr)
+		}
+		p.init()
+	}
+
+	if err := tryWrite(c, m); err != nil {
+		p.failed()
+		return errors.Wrapf(err, "by remote addr - %s", p.addr)
+	}
 
-			if err := pp.tryWrite(m); err != nil {
-				pp.failed()
-				return errors.Wrapf(err, "by remote addr - %s", pp.RemoteAddr())
+	p.success()
+	return nil
+}
+
+// redial reconnects the failed and not initialized peers by their backoff
+// until the partition is closed.
+func (p *Partition) redial() {
+	ticker := time.NewTicker(minRedialBackoff)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case now := <-ticker.C:
+			for _, pp := range p.peers() {
+				if pp.due(now) {
+					pp.redial(p.timeout)
+				}
 			}
+		}
+	}
+}
 
-			pp.success()
+// redial replaces the connection of a failed peer and repeats the handshake,
+// the recovered peer replicates again.
+func (p *peer) redial(timeout time.Duration) {
+	p.exchange.Lock()
+	defer p.exchange.Unlock()
+
+	isInit, isFail := p.state()
+	if isInit && !isFail {
+		// recovered by a replication meanwhile
+		return
+	}
+
+	c := p.connection()
+	if isFail {
+		next, err := p.dial(tcpProtocol, p.addr)
+		if err != nil {
+			logrus.Debugf("partition: redial peer %s: %s", p.addr, err)
+			p.failed()
+			return
 		}
-		return nil
+
+		p.mutex.Lock()
+		if p.closed {
+			p.mutex.Unlock()
+			next.Close()
+			return
+		}
+		// the stream of the failed connection may be out of sync
+		if p.conn != nil {
+			if err := p.conn.Close(); err != nil {
+				logrus.Debugf("partition: close failed peer %s: %s", p.addr, err)
+			}
+		}
+		c, p.conn = next, next
+		p.mutex.Unlock()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	deadline, _ := ctx.Deadline()
+	if err := c.SetDeadline(deadline); err != nil {
+		p.failed()
+		return
+	}
+	defer c.SetDeadline(time.Time{})
+
+	if err := handshake(ctx, c); err != nil {
+		logrus.Debugf("partition: handshake peer %s: %s", p.addr, err)
+		p.failed()
+		return
+	}
+
+	p.init()
+	p.success()
+	logrus.Infof("partition: peer %s connected", p.addr)
+}
+
+func (p *Partition) Close() (err error) {
+	p.once.Do(func() {
+		close(p.done)
 	})
 
-	return tg.Wait()
+	for _, pp := range p.peers() {
+		multierr.AppendInto(&err, pp.Close())
+	}
+
+	return err
 }
 
-func (p *peer) ping(ctx context.Context) bool {
-	return ping.New(p.Conn).Ping(ctx, ping.Partition) == nil
+func handshake(ctx context.Context, c net.Conn) error {
+	_, err := ping.New(c).Handshake(ctx, ping.Partition, ping.Hello{})
+	return err
 }
 
-func (p *peer) tryWrite(m *messages.Partition) error {
-	pc := conn.New(p)
+func tryWrite(c net.Conn, m *messages.Partition) error {
+	pc := conn.New(c)
 
 	err := pc.WriteProto(m)
 	if err != nil {
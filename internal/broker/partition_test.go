@@ -0,0 +1,342 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/pkg/producer"
+	"github.com/baibikov/jellyfish/protogenerated/messages"
+)
+
+// exchangeConn fails the test when a request is written before the reply
+// to the previous one was read, the replies would reach the wrong callers.
+type exchangeConn struct {
+	net.Conn
+	t *testing.T
+
+	mutex   sync.Mutex
+	pending bool
+	read    []byte
+}
+
+func (c *exchangeConn) Write(b []byte) (int, error) {
+	c.mutex.Lock()
+	if c.pending {
+		c.t.Error("request written before the previous reply was read")
+	}
+	c.pending = true
+	c.mutex.Unlock()
+
+	return c.Conn.Write(b)
+}
+
+func (c *exchangeConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.read = append(c.read, b[:n]...)
+	for len(c.read) >= 4 {
+		size := 4 + int(binary.BigEndian.Uint32(c.read))
+		if len(c.read) < size {
+			break
+		}
+		c.read = c.read[size:]
+		c.pending = false
+	}
+
+	return n, err
+}
+
+// checkedSlave dials a slave handler served over net.Pipe.
+func checkedSlave(ctx context.Context, t *testing.T) DialFunc {
+	return func(_, _ string) (net.Conn, error) {
+		client, server := net.Pipe()
+		go NewHandler(server, NewBroker(), nil, newClients()).Do(ctx)
+		return &exchangeConn{Conn: client, t: t}, nil
+	}
+}
+
+func TestAskByPeersConcurrent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p, err := NewPartition(time.Second*5, []string{"slave"}, checkedSlave(ctx, t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := p.AskByPeers(ctx, &messages.Partition{Topic: "t", Message: []byte("m")}); err != nil {
+					t.Errorf("ask by peers: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, status := range p.Peers() {
+		if !status.Initialized || status.Failed {
+			t.Errorf("peer %s: initialized %t failed %t, want a healthy peer", status.Addr, status.Initialized, status.Failed)
+		}
+	}
+}
+
+func TestAskByPeersFailsWithFailedPeer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	slave := checkedSlave(ctx, t)
+	dial := func(network, addr string) (net.Conn, error) {
+		if addr == "dead" {
+			// the slave closes the connection before the handshake
+			client, server := net.Pipe()
+			server.Close()
+			return client, nil
+		}
+		return slave(network, addr)
+	}
+
+	p, err := NewPartition(time.Second, []string{"dead", "slave"}, dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// the handshake fails first, then the peer is failed until it is redialed
+	for i := 0; i < 2; i++ {
+		if err := p.AskByPeers(ctx, &messages.Partition{Topic: "t"}); err == nil {
+			t.Fatalf("replication %d with a failed peer succeeded", i)
+		}
+	}
+
+	for _, status := range p.Peers() {
+		if status.Addr == "slave" && (!status.Initialized || status.Failed) {
+			t.Errorf("peer %s: initialized %t failed %t, want the message replicated", status.Addr, status.Initialized, status.Failed)
+		}
+	}
+}
+
+func TestPeerRedialedAfterFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mutex sync.Mutex
+		slave net.Conn
+		dials int
+	)
+	dial := func(_, _ string) (net.Conn, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		client, server := net.Pipe()
+		go NewHandler(server, NewBroker(), nil, newClients()).Do(ctx)
+		slave = server
+		dials++
+		return client, nil
+	}
+
+	p, err := NewPartition(time.Second, []string{"slave"}, dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	waitConnected(t, p)
+
+	// the slave drops the connection, the next replication fails the peer
+	mutex.Lock()
+	slave.Close()
+	mutex.Unlock()
+	if err := p.AskByPeers(ctx, &messages.Partition{Topic: "t"}); err == nil {
+		t.Fatal("replication to the dropped slave succeeded")
+	}
+	if p.Connected() {
+		t.Fatal("partition connected with a failed peer")
+	}
+
+	waitConnected(t, p)
+	if err := p.AskByPeers(ctx, &messages.Partition{Topic: "t"}); err != nil {
+		t.Fatalf("replication to the redialed slave: %v", err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if dials != 2 {
+		t.Errorf("slave dialed %d times, want 2", dials)
+	}
+}
+
+func TestConnectedRequiresHandshake(t *testing.T) {
+	// the slave accepts the connection and never answers
+	dial := func(_, _ string) (net.Conn, error) {
+		client, server := net.Pipe()
+		t.Cleanup(func() { server.Close() })
+		return client, nil
+	}
+
+	p, err := NewPartition(time.Millisecond*100, []string{"slave"}, dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if p.Connected() {
+		t.Fatal("partition connected before the peer handshake")
+	}
+}
+
+func TestSetPeersKeepsConnected(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dials := make(map[string]int)
+	var mutex sync.Mutex
+	dial := func(network, addr string) (net.Conn, error) {
+		mutex.Lock()
+		dials[addr]++
+		mutex.Unlock()
+
+		if addr == "down" {
+			return nil, errors.New("connection refused")
+		}
+		return checkedSlave(ctx, t)(network, addr)
+	}
+
+	p, err := NewPartition(time.Second, []string{"a", "b"}, dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	waitConnected(t, p)
+
+	if err := p.SetPeers([]string{"b", "c"}); err != nil {
+		t.Fatal(err)
+	}
+	// the new slave is connected by the redial
+	waitConnected(t, p)
+
+	addrs := make([]string, 0)
+	for _, status := range p.Peers() {
+		addrs = append(addrs, status.Addr)
+	}
+	if len(addrs) != 2 || addrs[0] != "b" || addrs[1] != "c" {
+		t.Fatalf("peers = %v, want b and c", addrs)
+	}
+
+	mutex.Lock()
+	if dials["a"] != 1 || dials["b"] != 1 || dials["c"] != 1 {
+		t.Fatalf("dials = %v, want every slave dialed once", dials)
+	}
+	mutex.Unlock()
+
+	// an unreachable slave stays failed and does not fail the others
+	if err := p.SetPeers([]string{"b", "c", "down"}); err != nil {
+		t.Fatalf("set unreachable slave: %v", err)
+	}
+	if p.Connected() {
+		t.Fatal("partition connected with an unreachable slave")
+	}
+	for _, status := range p.Peers() {
+		if status.Addr != "down" && (!status.Initialized || status.Failed) {
+			t.Errorf("peer %s: initialized %t failed %t, want the kept peer healthy", status.Addr, status.Initialized, status.Failed)
+		}
+	}
+
+	if err := p.SetPeers([]string{""}); err == nil {
+		t.Fatal("empty slave address is accepted")
+	}
+}
+
+// replicatedProducer pushes to a leader replicating to the returned slave storage.
+func replicatedProducer(ctx context.Context, t *testing.T) (*producer.Producer, *Broker) {
+	t.Helper()
+
+	slave := NewBroker()
+	pp, err := NewPartition(time.Second, []string{"slave"}, func(_, _ string) (net.Conn, error) {
+		client, server := net.Pipe()
+		go NewHandler(server, slave, nil, newClients()).Do(ctx)
+		return client, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = pp.Close() })
+
+	leader := NewBroker()
+	p, err := producer.New(&producer.Config{
+		Addr: "leader",
+		Dial: func(_, _ string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go NewHandler(server, leader, pp, newClients()).Do(ctx)
+			return client, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = p.Close() })
+
+	return p, slave
+}
+
+func TestReplicationKeepsMessageFields(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	p, slave := replicatedProducer(ctx, t)
+
+	at := time.Now().Add(time.Hour)
+	err := p.Push(ctx, &producer.Params{Topic: "orders", Key: "order-1", Message: []byte("created"), DeliverAt: at, TTL: time.Minute, Priority: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item := slave.schedule.due(at)
+	if item == nil || item.topic != "orders" || !item.at.Equal(at) {
+		t.Fatalf("slave schedule = %+v, want orders due at %v", item, at)
+	}
+	if m := item.message; m.Key != "order-1" || string(m.Payload) != "created" || m.TTL != time.Minute || m.Priority != 7 {
+		t.Fatalf("slave message = %+v, want order-1 created living a minute by priority 7", m)
+	}
+}
+
+func waitConnected(t *testing.T, p *Partition) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second * 5)
+	for !p.Connected() {
+		if time.Now().After(deadline) {
+			t.Fatalf("peers %v not connected", p.Peers())
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
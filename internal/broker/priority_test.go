@@ -0,0 +1,111 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPriorityDelivery(t *testing.T) {
+	b := NewBroker()
+	if err := b.CreateTopic("jobs", TopicConfig{Priority: true, PriorityAging: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []*Message{
+		{Payload: []byte("low"), Priority: 1},
+		{Payload: []byte("high"), Priority: 7},
+		{Payload: []byte("clamped"), Priority: 42},
+		{Payload: []byte("high again"), Priority: 7},
+		{Payload: []byte("negative"), Priority: -3},
+	} {
+		if err := b.Write("jobs", m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"clamped", "high", "high again", "low", "negative"}
+	for _, group := range []string{"", "audit"} {
+		got := readAll(t, b, "jobs", group)
+		if len(got) != len(want) {
+			t.Fatalf("group %q read %v, want %v", group, got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("group %q read %v, want %v", group, got, want)
+			}
+		}
+	}
+
+	// every message is delivered, the group offset is past the topic
+	read, write, err := b.Offsets("jobs", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read != write {
+		t.Fatalf("read offset %d, want %d", read, write)
+	}
+}
+
+func TestPriorityAging(t *testing.T) {
+	b := NewBroker()
+	if err := b.CreateTopic("jobs", TopicConfig{Priority: true, PriorityAging: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	// waiting five minutes ages the priority 0 past the new priority 3
+	writes := []*Message{
+		{Payload: []byte("starved"), Priority: 0, Timestamp: time.Now().Add(-time.Minute * 5)},
+		{Payload: []byte("urgent"), Priority: 3},
+	}
+	for _, m := range writes {
+		if err := b.Write("jobs", m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := readAll(t, b, "jobs", ""); len(got) != 2 || got[0] != "starved" {
+		t.Fatalf("read %v, want the aged message first", got)
+	}
+}
+
+func TestPriorityModeChange(t *testing.T) {
+	b := NewBroker()
+	if err := b.CreateTopic("jobs", TopicConfig{Priority: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []*Message{
+		{Payload: []byte("a"), Priority: 0},
+		{Payload: []byte("b"), Priority: 9},
+		{Payload: []byte("c"), Priority: 0},
+	} {
+		if err := b.Write("jobs", m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if m, _ := b.Read("jobs", ""); m == nil || string(m.Payload) != "b" {
+		t.Fatalf("read %v, want b", m)
+	}
+
+	// the messages delivered by priority are not delivered again in the write order
+	if err := b.ConfigureTopic("jobs", TopicConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, b, "jobs", ""); len(got) != 2 || got[0] != "a" || got[1] != "c" {
+		t.Fatalf("read %v after the mode change, want a and c", got)
+	}
+}
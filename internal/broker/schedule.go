@@ -0,0 +1,154 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"container/heap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// scheduled is a message held until it is due.
+type scheduled struct {
+	topic   TopicName
+	message *Message
+	at      time.Time
+	// seq keeps the write order of the messages due at the same time.
+	seq uint64
+}
+
+// schedule is a min-heap of the held messages by the due time.
+type schedule struct {
+	mutex sync.Mutex
+	// next is the unix nano due time of the earliest message, zero is none.
+	// It is read without the lock to skip the promotion when nothing is due.
+	next  atomic.Int64
+	items []*scheduled
+	seq   uint64
+	// byTopic is the count of the held messages by topic.
+	byTopic map[TopicName]int
+}
+
+func newSchedule() *schedule {
+	return &schedule{
+		byTopic: make(map[TopicName]int),
+	}
+}
+
+func (s *schedule) Len() int { return len(s.items) }
+
+func (s *schedule) Less(i, j int) bool {
+	if !s.items[i].at.Equal(s.items[j].at) {
+		return s.items[i].at.Before(s.items[j].at)
+	}
+
+	return s.items[i].seq < s.items[j].seq
+}
+
+func (s *schedule) Swap(i, j int) { s.items[i], s.items[j] = s.items[j], s.items[i] }
+
+func (s *schedule) Push(x any) { s.items = append(s.items, x.(*scheduled)) }
+
+func (s *schedule) Pop() any {
+	n := len(s.items)
+	item := s.items[n-1]
+	s.items[n-1] = nil
+	s.items = s.items[:n-1]
+	return item
+}
+
+func (s *schedule) add(topic TopicName, message *Message, at time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.seq++
+	heap.Push(s, &scheduled{
+		topic:   topic,
+		message: message,
+		at:      at,
+		seq:     s.seq,
+	})
+	s.byTopic[topic]++
+	s.reset()
+}
+
+// pending reports whether a message may be due at or before now.
+func (s *schedule) pending(now time.Time) bool {
+	next := s.next.Load()
+	return next != 0 && next <= now.UnixNano()
+}
+
+// due pops the next message due at or before now.
+func (s *schedule) due(now time.Time) *scheduled {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.items) == 0 || s.items[0].at.After(now) {
+		return nil
+	}
+
+	item := heap.Pop(s).(*scheduled)
+	s.decrement(item.topic)
+	s.reset()
+	return item
+}
+
+// drop removes the held messages of the topic.
+func (s *schedule) drop(topic TopicName) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.byTopic[topic] == 0 {
+		return
+	}
+
+	items := s.items[:0]
+	for _, item := range s.items {
+		if item.topic != topic {
+			items = append(items, item)
+		}
+	}
+	for i := len(items); i < len(s.items); i++ {
+		s.items[i] = nil
+	}
+	s.items = items
+	heap.Init(s)
+	delete(s.byTopic, topic)
+	s.reset()
+}
+
+func (s *schedule) count(topic TopicName) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.byTopic[topic]
+}
+
+// reset stores the due time of the earliest message.
+func (s *schedule) reset() {
+	if len(s.items) == 0 {
+		s.next.Store(0)
+		return
+	}
+
+	s.next.Store(s.items[0].at.UnixNano())
+}
+
+func (s *schedule) decrement(topic TopicName) {
+	s.byTopic[topic]--
+	if s.byTopic[topic] == 0 {
+		delete(s.byTopic, topic)
+	}
+}
@@ -0,0 +1,135 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/baibikov/jellyfish/protogenerated/messages"
+)
+
+// readAll reads the visible messages of the topic for the group.
+func readAll(t *testing.T, b *Broker, name TopicName, group string) []string {
+	t.Helper()
+
+	out := make([]string, 0)
+	for {
+		m, err := b.Read(name, group)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m == nil {
+			return out
+		}
+		out = append(out, string(m.Payload))
+	}
+}
+
+func TestWriteAtHoldsUntilDue(t *testing.T) {
+	b := NewBroker()
+	now := time.Now()
+
+	writes := []struct {
+		payload string
+		at      time.Time
+	}{
+		{"late", now.Add(time.Hour * 2)},
+		{"first", now.Add(time.Hour)},
+		{"second", now.Add(time.Hour)},
+		{"now", time.Time{}},
+		{"past", now.Add(-time.Hour)},
+	}
+	for _, w := range writes {
+		if err := b.WriteAt("orders", &Message{Payload: []byte(w.payload)}, w.at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := b.Topic("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Scheduled != 3 || stats.WriteOffset != 2 {
+		t.Fatalf("stats = scheduled %d written %d, want 3 and 2", stats.Scheduled, stats.WriteOffset)
+	}
+	if got := readAll(t, b, "orders", ""); len(got) != 2 || got[0] != "now" || got[1] != "past" {
+		t.Fatalf("visible = %v, want now and past", got)
+	}
+
+	// the messages due at the same time keep their write order
+	b.promote(now.Add(time.Hour))
+	got := readAll(t, b, "orders", "")
+	if len(got) != 2 || got[0] != "first" || got[1] != "second" {
+		t.Fatalf("due in an hour = %v, want first and second", got)
+	}
+
+	b.promote(now.Add(time.Hour * 2))
+	if got := readAll(t, b, "orders", ""); len(got) != 1 || got[0] != "late" {
+		t.Fatalf("due in two hours = %v, want late", got)
+	}
+
+	// the promoted message is timestamped by its due time
+	if err := b.Seek("orders", "audit", 4); err != nil {
+		t.Fatal(err)
+	}
+	m, _ := b.Read("orders", "audit")
+	if m == nil || !m.Timestamp.Equal(now.Add(time.Hour*2)) {
+		t.Fatalf("promoted message = %+v, want the due timestamp", m)
+	}
+}
+
+func TestDeleteTopicDropsScheduled(t *testing.T) {
+	b := NewBroker()
+	at := time.Now().Add(time.Hour)
+
+	for _, name := range []TopicName{"orders", "payments"} {
+		if err := b.WriteAt(name, &Message{Payload: []byte(name)}, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.DeleteTopic("orders"); err != nil {
+		t.Fatal(err)
+	}
+	if n := b.schedule.count("orders"); n != 0 {
+		t.Fatalf("held messages of the deleted topic = %d", n)
+	}
+
+	b.promote(at)
+	if got := readAll(t, b, "payments", ""); len(got) != 1 {
+		t.Fatalf("payments = %v, want the held message", got)
+	}
+	if got := readAll(t, b, "orders", ""); len(got) != 0 {
+		t.Fatalf("deleted topic got its held messages %v", got)
+	}
+}
+
+func TestDeliverAt(t *testing.T) {
+	at := time.Unix(100, 0)
+	if got := deliverAt(&messages.ProducerPayload{DeliverAt: proto.Int64(at.UnixNano()), Delay: proto.Int64(int64(time.Hour))}); !got.Equal(at) {
+		t.Fatalf("deliver at = %s, want %s over the delay", got, at)
+	}
+
+	before := time.Now()
+	got := deliverAt(&messages.ProducerPayload{Delay: proto.Int64(int64(time.Minute))})
+	if got.Before(before.Add(time.Minute)) || got.After(time.Now().Add(time.Minute)) {
+		t.Fatalf("delayed = %s, want a minute from now", got)
+	}
+
+	if got := deliverAt(&messages.ProducerPayload{}); !got.IsZero() {
+		t.Fatalf("not delayed = %s, want zero", got)
+	}
+}
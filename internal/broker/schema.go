@@ -0,0 +1,553 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// HeaderSchemaID is the id of the schema the message was encoded with.
+const HeaderSchemaID = "jellyfish-schema-id"
+
+// SchemaType is the language of a schema.
+type SchemaType string
+
+const (
+	// SchemaJSON is a JSON Schema document.
+	SchemaJSON SchemaType = "json"
+	// SchemaProtobuf is a base64 serialized FileDescriptorSet with the message name.
+	SchemaProtobuf SchemaType = "protobuf"
+)
+
+// Compatibility is checked between a new schema version and the latest one,
+// the transitive modes check it against every registered version.
+type Compatibility string
+
+const (
+	// CompatibilityBackward lets the consumers of the new version read the messages of the latest one.
+	CompatibilityBackward Compatibility = "backward"
+	// CompatibilityForward lets the consumers of the latest version read the messages of the new one.
+	CompatibilityForward Compatibility = "forward"
+	// CompatibilityFull is backward and forward.
+	CompatibilityFull Compatibility = "full"
+	// CompatibilityNone registers any version.
+	CompatibilityNone Compatibility = "none"
+
+	// CompatibilityBackwardTransitive is backward with every registered version.
+	CompatibilityBackwardTransitive Compatibility = "backward_transitive"
+	// CompatibilityForwardTransitive is forward with every registered version.
+	CompatibilityForwardTransitive Compatibility = "forward_transitive"
+	// CompatibilityFullTransitive is full with every registered version.
+	CompatibilityFullTransitive Compatibility = "full_transitive"
+)
+
+// transitiveSuffix ends the name of a transitive compatibility.
+const transitiveSuffix = "_transitive"
+
+// mode returns the compatibility checked with every version, transitive
+// is set when it is checked against every registered version.
+func (c Compatibility) mode() (mode Compatibility, transitive bool) {
+	if trimmed := strings.TrimSuffix(string(c), transitiveSuffix); trimmed != string(c) {
+		return Compatibility(trimmed), true
+	}
+
+	return c, false
+}
+
+// DefaultCompatibility is the compatibility of a topic without one.
+const DefaultCompatibility = CompatibilityBackward
+
+var (
+	ErrSchemaNotFound = errors.New("schema not found")
+	ErrInvalidSchema  = errors.New("invalid schema")
+	// ErrIncompatibleSchema is returned for a version breaking the topic compatibility.
+	ErrIncompatibleSchema = errors.New("incompatible schema")
+	// ErrSchemaRejected is returned for a message of a topic requiring the schema
+	// without the id of a schema registered for the topic.
+	ErrSchemaRejected = errors.New("schema not registered for topic")
+)
+
+// Schema is a registered version of the topic messages format.
+type Schema struct {
+	// ID is unique across the topics, the messages carry it in HeaderSchemaID.
+	ID      int        `json:"id"`
+	Topic   TopicName  `json:"topic"`
+	Version int        `json:"version"`
+	Type    SchemaType `json:"type"`
+	// Schema is the JSON Schema document or the base64 FileDescriptorSet.
+	Schema string `json:"schema"`
+	// Message is the full name of the protobuf message.
+	Message string `json:"message,omitempty"`
+
+	// parsed is the *jsonSchema or the protoreflect.MessageDescriptor of the schema.
+	parsed any
+}
+
+// SchemaSubject is the schema versions of a topic.
+type SchemaSubject struct {
+	Topic         TopicName     `json:"topic"`
+	Compatibility Compatibility `json:"compatibility"`
+	Versions      []*Schema     `json:"versions"`
+}
+
+// schemas is the schema registry, it is locked alone.
+type schemas struct {
+	mutex    sync.RWMutex
+	seq      int
+	ids      map[int]*Schema
+	subjects map[TopicName]*SchemaSubject
+}
+
+func newSchemas() *schemas {
+	return &schemas{
+		ids:      make(map[int]*Schema),
+		subjects: make(map[TopicName]*SchemaSubject),
+	}
+}
+
+// RegisterSchema adds the next version of the topic schema checked against
+// the latest version, or every version of a transitive mode, by the topic
+// compatibility. The schema equal to a registered version returns it.
+func (b *Broker) RegisterSchema(topic TopicName, typ SchemaType, schema, message string) (*Schema, error) {
+	s := &Schema{Topic: topic, Type: typ, Schema: schema, Message: message}
+	var err error
+	if s.parsed, err = parseSchema(s); err != nil {
+		return nil, err
+	}
+
+	b.schemas.mutex.Lock()
+	defer b.schemas.mutex.Unlock()
+
+	subject := b.schemas.subjects[topic]
+	if subject == nil {
+		subject = &SchemaSubject{Topic: topic, Compatibility: DefaultCompatibility}
+	}
+	for _, v := range subject.Versions {
+		if v.Type == s.Type && v.Message == s.Message && v.Schema == s.Schema {
+			return v, nil
+		}
+	}
+
+	mode, transitive := subject.Compatibility.mode()
+	checked := subject.Versions
+	if !transitive && len(checked) > 1 {
+		checked = checked[len(checked)-1:]
+	}
+	// the latest version first, it is the most likely to fail
+	for i := len(checked) - 1; i >= 0; i-- {
+		v := checked[i]
+		if err := compatible(mode, s.parsed, v.parsed); err != nil {
+			return nil, errors.Wrapf(
+				ErrIncompatibleSchema, "topic %s %s with version %d: %s", topic, subject.Compatibility, v.Version, err,
+			)
+		}
+	}
+
+	b.schemas.seq++
+	s.ID, s.Version = b.schemas.seq, len(subject.Versions)+1
+	subject.Versions = append(subject.Versions, s)
+	b.schemas.subjects[topic] = subject
+	b.schemas.ids[s.ID] = s
+
+	return s, nil
+}
+
+// SetSchemaCompatibility sets the compatibility the next versions of the topic
+// schema are checked by, the registered versions are not checked again.
+func (b *Broker) SetSchemaCompatibility(topic TopicName, c Compatibility) error {
+	switch c {
+	case CompatibilityBackward, CompatibilityForward, CompatibilityFull, CompatibilityNone,
+		CompatibilityBackwardTransitive, CompatibilityForwardTransitive, CompatibilityFullTransitive:
+	default:
+		return errors.Wrapf(ErrInvalidSchema,
+			"compatibility %q, want backward, forward, full or none, the first three optionally %s", c, transitiveSuffix)
+	}
+
+	b.schemas.mutex.Lock()
+	defer b.schemas.mutex.Unlock()
+
+	subject := b.schemas.subjects[topic]
+	if subject == nil {
+		subject = &SchemaSubject{Topic: topic}
+		b.schemas.subjects[topic] = subject
+	}
+	subject.Compatibility = c
+
+	return nil
+}
+
+// SchemaSubject returns the schema versions of the topic.
+func (b *Broker) SchemaSubject(topic TopicName) (SchemaSubject, error) {
+	b.schemas.mutex.RLock()
+	defer b.schemas.mutex.RUnlock()
+
+	subject := b.schemas.subjects[topic]
+	if subject == nil {
+		return SchemaSubject{}, errors.Wrapf(ErrSchemaNotFound, "topic %s", topic)
+	}
+
+	s := *subject
+	s.Versions = append([]*Schema{}, subject.Versions...)
+	return s, nil
+}
+
+// SchemaSubjects returns the topics with schemas by name.
+func (b *Broker) SchemaSubjects() []SchemaSubject {
+	b.schemas.mutex.RLock()
+	defer b.schemas.mutex.RUnlock()
+
+	subjects := make([]SchemaSubject, 0, len(b.schemas.subjects))
+	for _, subject := range b.schemas.subjects {
+		s := *subject
+		s.Versions = append([]*Schema{}, subject.Versions...)
+		subjects = append(subjects, s)
+	}
+	sort.Slice(subjects, func(i, j int) bool { return subjects[i].Topic < subjects[j].Topic })
+
+	return subjects
+}
+
+// Schema returns the schema by id.
+func (b *Broker) Schema(id int) (*Schema, error) {
+	b.schemas.mutex.RLock()
+	defer b.schemas.mutex.RUnlock()
+
+	s := b.schemas.ids[id]
+	if s == nil {
+		return nil, errors.Wrapf(ErrSchemaNotFound, "id %d", id)
+	}
+
+	return s, nil
+}
+
+// dropSchemas removes the schemas of the deleted topic,
+// the messages of a topic created again are not of its schemas.
+func (b *Broker) dropSchemas(topic TopicName) {
+	b.schemas.mutex.Lock()
+	defer b.schemas.mutex.Unlock()
+
+	subject := b.schemas.subjects[topic]
+	if subject == nil {
+		return
+	}
+	for _, v := range subject.Versions {
+		delete(b.schemas.ids, v.ID)
+	}
+	delete(b.schemas.subjects, topic)
+}
+
+// checkSchema rejects the message of a topic requiring the schema
+// without the id of a schema registered for the topic.
+func (b *Broker) checkSchema(name TopicName, p *pack, message *Message) error {
+	p.mutex.Lock()
+	require := p.config.RequireSchema
+	p.mutex.Unlock()
+	if !require {
+		return nil
+	}
+
+	header, ok := message.Headers[HeaderSchemaID]
+	if !ok {
+		return errors.Wrapf(ErrSchemaRejected, "topic %s message has no %s header", name, HeaderSchemaID)
+	}
+	id, err := strconv.Atoi(header)
+	if err != nil {
+		return errors.Wrapf(ErrSchemaRejected, "topic %s schema id %q", name, header)
+	}
+
+	b.schemas.mutex.RLock()
+	s := b.schemas.ids[id]
+	b.schemas.mutex.RUnlock()
+	if s == nil || s.Topic != name {
+		return errors.Wrapf(ErrSchemaRejected, "topic %s schema id %d", name, id)
+	}
+
+	return nil
+}
+
+func parseSchema(s *Schema) (any, error) {
+	switch s.Type {
+	case SchemaJSON:
+		js := &jsonSchema{}
+		if err := json.Unmarshal([]byte(s.Schema), js); err != nil {
+			return nil, errors.Wrapf(ErrInvalidSchema, "json schema: %s", err)
+		}
+		return js, nil
+	case SchemaProtobuf:
+		return parseProto(s)
+	default:
+		return nil, errors.Wrapf(ErrInvalidSchema, "type %q, want json or protobuf", s.Type)
+	}
+}
+
+func parseProto(s *Schema) (protoreflect.MessageDescriptor, error) {
+	bb, err := base64.StdEncoding.DecodeString(s.Schema)
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidSchema, "protobuf schema base64: %s", err)
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(bb, set); err != nil {
+		return nil, errors.Wrapf(ErrInvalidSchema, "protobuf file descriptor set: %s", err)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidSchema, "protobuf file descriptor set: %s", err)
+	}
+
+	d, err := files.FindDescriptorByName(protoreflect.FullName(s.Message))
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidSchema, "protobuf message %q: %s", s.Message, err)
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, errors.Wrapf(ErrInvalidSchema, "protobuf %q is not a message", s.Message)
+	}
+
+	return md, nil
+}
+
+// compatible checks the new schema against a registered one by the compatibility
+// of a single version.
+func compatible(c Compatibility, next, latest any) error {
+	if c == CompatibilityNone {
+		return nil
+	}
+	if reflect.TypeOf(next) != reflect.TypeOf(latest) {
+		return errors.New("schema type changed")
+	}
+
+	if c == CompatibilityBackward || c == CompatibilityFull {
+		if err := readable(next, latest); err != nil {
+			return errors.Wrap(err, "new version can not read the registered one")
+		}
+	}
+	if c == CompatibilityForward || c == CompatibilityFull {
+		if err := readable(latest, next); err != nil {
+			return errors.Wrap(err, "registered version can not read the new one")
+		}
+	}
+
+	return nil
+}
+
+// readable reports whether the reader schema reads every message of the writer one.
+func readable(reader, writer any) error {
+	switch r := reader.(type) {
+	case *jsonSchema:
+		return r.reads(writer.(*jsonSchema), "$")
+	case protoreflect.MessageDescriptor:
+		return protoReads(r, writer.(protoreflect.MessageDescriptor), map[protoPair]bool{})
+	default:
+		return errors.Errorf("undefined schema %T", reader)
+	}
+}
+
+// jsonSchema is the part of JSON Schema the compatibility is checked by.
+type jsonSchema struct {
+	Type                 jsonTypes              `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Enum                 []json.RawMessage      `json:"enum"`
+}
+
+// jsonTypes is the type keyword, a name or a list of names, empty is any type.
+type jsonTypes []string
+
+func (t *jsonTypes) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*t = jsonTypes{name}
+		return nil
+	}
+
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return errors.Wrap(err, "type is not a name or a list of names")
+	}
+	*t = names
+	return nil
+}
+
+// has reports whether the value of the type is valid by t, an integer is a number.
+func (t jsonTypes) has(typ string) bool {
+	for _, name := range t {
+		if name == typ || (name == "number" && typ == "integer") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *jsonSchema) closed() bool {
+	return string(s.AdditionalProperties) == "false"
+}
+
+func (s *jsonSchema) required(name string) bool {
+	for _, r := range s.Required {
+		if r == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reads reports whether every value valid by w is valid by s.
+func (s *jsonSchema) reads(w *jsonSchema, path string) error {
+	if len(s.Type) != 0 {
+		if len(w.Type) == 0 {
+			return errors.Errorf("%s type %v, writer any", path, s.Type)
+		}
+		for _, typ := range w.Type {
+			if !s.Type.has(typ) {
+				return errors.Errorf("%s type %v, writer %v", path, s.Type, w.Type)
+			}
+		}
+	}
+
+	if len(s.Enum) != 0 {
+		values := make(map[string]bool, len(s.Enum))
+		for _, v := range s.Enum {
+			values[string(v)] = true
+		}
+		if len(w.Enum) == 0 {
+			return errors.Errorf("%s enum, writer any value", path)
+		}
+		for _, v := range w.Enum {
+			if !values[string(v)] {
+				return errors.Errorf("%s enum has no writer value %s", path, v)
+			}
+		}
+	}
+
+	for _, name := range s.Required {
+		if !w.required(name) {
+			return errors.Errorf("%s.%s required, writer optional", path, name)
+		}
+	}
+
+	if s.closed() {
+		if !w.closed() {
+			return errors.Errorf("%s additional properties not allowed, writer allows", path)
+		}
+		for name := range w.Properties {
+			if _, ok := s.Properties[name]; !ok {
+				return errors.Errorf("%s.%s not allowed", path, name)
+			}
+		}
+	}
+
+	for name, rp := range s.Properties {
+		if wp, ok := w.Properties[name]; ok {
+			if err := rp.reads(wp, path+"."+name); err != nil {
+				return err
+			}
+		}
+	}
+
+	if s.Items != nil && w.Items != nil {
+		return s.Items.reads(w.Items, path+"[]")
+	}
+
+	return nil
+}
+
+// protoPair is the reader and the writer messages checked by protoReads.
+type protoPair struct {
+	reader, writer protoreflect.FullName
+}
+
+// protoReads reports whether the reader message decodes the writer messages:
+// the fields of a number have to be wire compatible and a required
+// reader field has to be required by the writer. A pair already seen is
+// checked once, a reader message is checked against every writer of its fields.
+func protoReads(r, w protoreflect.MessageDescriptor, seen map[protoPair]bool) error {
+	pair := protoPair{reader: r.FullName(), writer: w.FullName()}
+	if seen[pair] {
+		return nil
+	}
+	seen[pair] = true
+
+	rf, wf := r.Fields(), w.Fields()
+	for i := 0; i < rf.Len(); i++ {
+		f := rf.Get(i)
+		g := wf.ByNumber(f.Number())
+		if g == nil {
+			if f.Cardinality() == protoreflect.Required {
+				return errors.Errorf("%s required, writer has no field %d", f.FullName(), f.Number())
+			}
+			continue
+		}
+
+		if f.Cardinality() == protoreflect.Required && g.Cardinality() != protoreflect.Required {
+			return errors.Errorf("%s required, writer optional", f.FullName())
+		}
+		if f.IsList() != g.IsList() || f.IsMap() != g.IsMap() {
+			return errors.Errorf("%s cardinality changed", f.FullName())
+		}
+		if !wireCompatible(f.Kind(), g.Kind()) {
+			return errors.Errorf("%s kind %s, writer %s", f.FullName(), f.Kind(), g.Kind())
+		}
+		if f.Message() != nil {
+			if err := protoReads(f.Message(), g.Message(), seen); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// kindGroups are the kinds sharing the wire encoding.
+var kindGroups = map[protoreflect.Kind]int{
+	protoreflect.Int32Kind:    1,
+	protoreflect.Int64Kind:    1,
+	protoreflect.Uint32Kind:   1,
+	protoreflect.Uint64Kind:   1,
+	protoreflect.BoolKind:     1,
+	protoreflect.EnumKind:     1,
+	protoreflect.Sint32Kind:   2,
+	protoreflect.Sint64Kind:   2,
+	protoreflect.Fixed32Kind:  3,
+	protoreflect.Sfixed32Kind: 3,
+	protoreflect.Fixed64Kind:  4,
+	protoreflect.Sfixed64Kind: 4,
+	protoreflect.StringKind:   5,
+	protoreflect.BytesKind:    5,
+}
+
+func wireCompatible(r, w protoreflect.Kind) bool {
+	if r == w {
+		return true
+	}
+
+	gr, ok := kindGroups[r]
+	return ok && gr == kindGroups[w]
+}
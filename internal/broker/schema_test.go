@@ -0,0 +1,234 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"encoding/base64"
+	"strconv"
+	"testing"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// protoSchema is the base64 descriptor set of the shop.proto file with the messages,
+// a message is its fields by name, a field type is a scalar type or a message name.
+func protoSchema(t *testing.T, messages map[string][][2]string) string {
+	t.Helper()
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("shop.proto"),
+		Package: proto.String("shop"),
+		Syntax:  proto.String("proto3"),
+	}
+	for name, fields := range messages {
+		m := &descriptorpb.DescriptorProto{Name: proto.String(name)}
+		for i, f := range fields {
+			field := &descriptorpb.FieldDescriptorProto{
+				Name:   proto.String(f[0]),
+				Number: proto.Int32(int32(i + 1)),
+				Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			}
+			switch f[1] {
+			case "string":
+				field.Type = descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()
+			case "int64":
+				field.Type = descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum()
+			default:
+				field.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+				field.TypeName = proto.String(".shop." + f[1])
+			}
+			m.Field = append(m.Field, field)
+		}
+		file.MessageType = append(file.MessageType, m)
+	}
+
+	bb, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{file}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(bb)
+}
+
+func TestRegisterSchema(t *testing.T) {
+	b := NewBroker()
+
+	v1, err := b.RegisterSchema("orders", SchemaJSON, `{"type":"object","properties":{"id":{"type":"string"}}}`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := b.RegisterSchema("orders", SchemaJSON, v1.Schema, "")
+	if err != nil || again.ID != v1.ID {
+		t.Fatalf("registered the same schema as %v, %v, want version 1", again, err)
+	}
+
+	// backward by default: the new version reads the messages of the latest
+	if _, err := b.RegisterSchema("orders", SchemaJSON,
+		`{"type":"object","properties":{"id":{"type":"string"}},"required":["id"]}`, ""); !errors.Is(err, ErrIncompatibleSchema) {
+		t.Fatalf("register of a new required field: %v, want ErrIncompatibleSchema", err)
+	}
+	v2, err := b.RegisterSchema("orders", SchemaJSON,
+		`{"type":"object","properties":{"id":{"type":"string"},"note":{"type":"string"}}}`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v2.Version != 2 {
+		t.Fatalf("version %d, want 2", v2.Version)
+	}
+
+	other, err := b.RegisterSchema("payments", SchemaJSON, v1.Schema, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.ID == v1.ID || other.ID == v2.ID || other.Version != 1 {
+		t.Fatalf("schema of another topic %+v, want a new id of version 1", other)
+	}
+
+	if _, err := b.RegisterSchema("orders", SchemaJSON, `{"type":`, ""); !errors.Is(err, ErrInvalidSchema) {
+		t.Fatalf("register of invalid json: %v, want ErrInvalidSchema", err)
+	}
+	if err := b.SetSchemaCompatibility("orders", "sideways"); !errors.Is(err, ErrInvalidSchema) {
+		t.Fatalf("set an undefined compatibility: %v, want ErrInvalidSchema", err)
+	}
+}
+
+func TestSchemaCompatibilityTransitive(t *testing.T) {
+	versions := []string{
+		`{"type":"object","properties":{"amount":{"type":"string"}}}`,
+		`{"type":"object"}`,
+		// reads version 2 without the property, not version 1 with the string
+		`{"type":"object","properties":{"amount":{"type":"integer"}}}`,
+	}
+
+	for _, tt := range []struct {
+		compatibility Compatibility
+		rejected      bool
+	}{
+		{CompatibilityBackward, false},
+		{CompatibilityBackwardTransitive, true},
+		{CompatibilityFullTransitive, true},
+		{CompatibilityNone, false},
+	} {
+		b := NewBroker()
+		if err := b.SetSchemaCompatibility("orders", tt.compatibility); err != nil {
+			t.Fatal(err)
+		}
+		for i, schema := range versions {
+			_, err := b.RegisterSchema("orders", SchemaJSON, schema, "")
+			if i < len(versions)-1 && err != nil {
+				t.Fatalf("%s: version %d: %v", tt.compatibility, i+1, err)
+			}
+			if i == len(versions)-1 && errors.Is(err, ErrIncompatibleSchema) != tt.rejected {
+				t.Fatalf("%s: last version: %v, want rejected %t", tt.compatibility, err, tt.rejected)
+			}
+		}
+	}
+}
+
+func TestProtoSchemaCompatibility(t *testing.T) {
+	b := NewBroker()
+
+	// the writer items differ, both have to be read by the one reader item
+	if _, err := b.RegisterSchema("orders", SchemaProtobuf, protoSchema(t, map[string][][2]string{
+		"Order": {{"item", "Item"}, {"gift", "Gift"}},
+		"Item":  {{"name", "string"}},
+		"Gift":  {{"name", "int64"}},
+	}), "shop.Order"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := b.RegisterSchema("orders", SchemaProtobuf, protoSchema(t, map[string][][2]string{
+		"Order": {{"item", "Item"}, {"gift", "Item"}},
+		"Item":  {{"name", "string"}},
+	}), "shop.Order")
+	if !errors.Is(err, ErrIncompatibleSchema) {
+		t.Fatalf("register of a string read from int64: %v, want ErrIncompatibleSchema", err)
+	}
+
+	// a recursive message is checked once
+	if _, err := b.RegisterSchema("trees", SchemaProtobuf, protoSchema(t, map[string][][2]string{
+		"Node": {{"name", "string"}, {"child", "Node"}},
+	}), "shop.Node"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.RegisterSchema("trees", SchemaProtobuf, protoSchema(t, map[string][][2]string{
+		"Node": {{"name", "string"}, {"child", "Node"}, {"weight", "int64"}},
+	}), "shop.Node"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.RegisterSchema("trees", SchemaProtobuf, protoSchema(t, map[string][][2]string{
+		"Node": {{"name", "string"}},
+	}), "shop.Missing"); !errors.Is(err, ErrInvalidSchema) {
+		t.Fatalf("register of a missing message: %v, want ErrInvalidSchema", err)
+	}
+}
+
+func TestRequireSchema(t *testing.T) {
+	b := NewBroker()
+	if err := b.CreateTopic("orders", TopicConfig{RequireSchema: true}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := b.RegisterSchema("orders", SchemaJSON, `{"type":"object"}`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := b.RegisterSchema("payments", SchemaJSON, `{"type":"object"}`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, headers := range []map[string]string{
+		nil,
+		{HeaderSchemaID: "x"},
+		{HeaderSchemaID: "100"},
+		{HeaderSchemaID: strconv.Itoa(other.ID)},
+	} {
+		if err := b.Write("orders", &Message{Headers: headers}); !errors.Is(err, ErrSchemaRejected) {
+			t.Fatalf("write with headers %v: %v, want ErrSchemaRejected", headers, err)
+		}
+	}
+	if err := b.Write("orders", &Message{Headers: map[string]string{HeaderSchemaID: strconv.Itoa(s.ID)}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteTopicDropsSchemas(t *testing.T) {
+	b := NewBroker()
+	if err := b.CreateTopic("orders", TopicConfig{RequireSchema: true}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := b.RegisterSchema("orders", SchemaJSON, `{"type":"object"}`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.DeleteTopic("orders"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.SchemaSubject("orders"); !errors.Is(err, ErrSchemaNotFound) {
+		t.Fatalf("schemas of the deleted topic: %v, want ErrSchemaNotFound", err)
+	}
+	if _, err := b.Schema(s.ID); !errors.Is(err, ErrSchemaNotFound) {
+		t.Fatalf("schema %d of the deleted topic: %v, want ErrSchemaNotFound", s.ID, err)
+	}
+
+	// the topic created again does not take the messages of the old schemas
+	if err := b.CreateTopic("orders", TopicConfig{RequireSchema: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Write("orders", &Message{Headers: map[string]string{HeaderSchemaID: strconv.Itoa(s.ID)}}); !errors.Is(err, ErrSchemaRejected) {
+		t.Fatalf("write with the dropped schema: %v, want ErrSchemaRejected", err)
+	}
+}
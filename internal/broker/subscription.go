@@ -0,0 +1,154 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Pattern syntax of the subscription topics.
+const (
+	// WildcardToken matches exactly one dot-separated token.
+	WildcardToken = "*"
+	// WildcardTail matches one or more trailing tokens, it must be the last token.
+	WildcardTail = ">"
+	// RegexpPrefix starts a regular expression matched against the whole topic name.
+	RegexpPrefix = "re:"
+)
+
+// ErrInvalidSubscription is returned for a topic pattern that does not parse.
+var ErrInvalidSubscription = errors.New("invalid subscription")
+
+// Subscription is the set of the topics and the topic patterns a consumer reads,
+// the messages are taken from the matching topics in turn.
+type Subscription struct {
+	literals []TopicName
+	patterns []func(TopicName) bool
+	// next is the turn of the topic read first by the next poll.
+	next int
+	// filter skips the not matching messages, nil passes all.
+	filter *Filter
+	// committed is the read committed isolation.
+	committed bool
+
+	// matched are the topics matched by the registry generation.
+	matched    []TopicName
+	generation uint64
+}
+
+// NewSubscription parses the topics, a topic with wildcards or the regexp
+// prefix is a pattern, any other is a literal topic created on read.
+func NewSubscription(topics ...string) (*Subscription, error) {
+	s := &Subscription{}
+	for _, topic := range topics {
+		switch {
+		case strings.HasPrefix(topic, RegexpPrefix):
+			re, err := regexp.Compile("^(?:" + strings.TrimPrefix(topic, RegexpPrefix) + ")$")
+			if err != nil {
+				return nil, errors.Wrapf(ErrInvalidSubscription, "parse topic pattern %q: %s", topic, err)
+			}
+			s.patterns = append(s.patterns, func(name TopicName) bool {
+				return re.MatchString(string(name))
+			})
+		case isWildcard(topic):
+			match, err := wildcard(topic)
+			if err != nil {
+				return nil, err
+			}
+			s.patterns = append(s.patterns, match)
+		default:
+			s.literals = append(s.literals, TopicName(topic))
+		}
+	}
+
+	if len(s.literals) == 0 && len(s.patterns) == 0 {
+		return nil, errors.Wrap(ErrInvalidSubscription, "subscription has no topics")
+	}
+
+	return s, nil
+}
+
+// isPattern reports whether the topic is a pattern of the subscription.
+func isPattern(topic string) bool {
+	return strings.HasPrefix(topic, RegexpPrefix) || isWildcard(topic)
+}
+
+func isWildcard(topic string) bool {
+	for _, token := range strings.Split(topic, ".") {
+		if token == WildcardToken || token == WildcardTail {
+			return true
+		}
+	}
+
+	return false
+}
+
+func wildcard(pattern string) (func(TopicName) bool, error) {
+	tokens := strings.Split(pattern, ".")
+	for i, token := range tokens {
+		if token == WildcardTail && i != len(tokens)-1 {
+			return nil, errors.Wrapf(ErrInvalidSubscription, "topic pattern %q has %s not as the last token", pattern, WildcardTail)
+		}
+	}
+
+	return func(name TopicName) bool {
+		parts := strings.Split(string(name), ".")
+		for i, token := range tokens {
+			if token == WildcardTail {
+				return len(parts) > i
+			}
+			if i >= len(parts) || (token != WildcardToken && token != parts[i]) {
+				return false
+			}
+		}
+
+		return len(parts) == len(tokens)
+	}, nil
+}
+
+// SetFilter makes the broker skip the messages not matching the filter,
+// the skipped messages move the group offset as the read ones.
+func (s *Subscription) SetFilter(f *Filter) {
+	s.filter = f
+}
+
+// SetReadCommitted makes the subscription read only the committed transaction
+// messages, by default the messages of open and aborted transactions are read too.
+func (s *Subscription) SetReadCommitted(committed bool) {
+	s.committed = committed
+}
+
+// matches reports whether the existing topic is read by the subscription,
+// the reply topics are matched only literally.
+func (s *Subscription) matches(name TopicName) bool {
+	for _, literal := range s.literals {
+		if literal == name {
+			return true
+		}
+	}
+	if name.isReply() {
+		return false
+	}
+
+	for _, match := range s.patterns {
+		if match(name) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,157 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestSubscriptionMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		match   []TopicName
+		skip    []TopicName
+	}{
+		{"orders", []TopicName{"orders"}, []TopicName{"orders.eu", "order"}},
+		{"orders.*", []TopicName{"orders.eu", "orders.us"}, []TopicName{"orders", "orders.eu.paid", "payments.eu"}},
+		{"orders.*.paid", []TopicName{"orders.eu.paid"}, []TopicName{"orders.eu", "orders.eu.created", "orders.eu.paid.late"}},
+		{"orders.>", []TopicName{"orders.eu", "orders.eu.paid"}, []TopicName{"orders", "payments.eu"}},
+		{"*.>", []TopicName{"orders.eu", "payments.eu.paid"}, []TopicName{"orders"}},
+		{"re:orders-[0-9]+", []TopicName{"orders-1", "orders-42"}, []TopicName{"orders-", "orders-1x", "xorders-1"}},
+		{"re:.*", []TopicName{"orders"}, []TopicName{ReplyTopicPrefix + "abc"}},
+	}
+	for _, tt := range tests {
+		s, err := NewSubscription(tt.pattern)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.pattern, err)
+		}
+		for _, name := range tt.match {
+			if !s.matches(name) {
+				t.Errorf("%s does not match %s", tt.pattern, name)
+			}
+		}
+		for _, name := range tt.skip {
+			if s.matches(name) {
+				t.Errorf("%s matches %s", tt.pattern, name)
+			}
+		}
+	}
+
+	// a reply topic is read only by its literal name
+	s, err := NewSubscription(ReplyTopicPrefix + "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.matches(ReplyTopicPrefix + "abc") {
+		t.Error("literal reply topic is not matched")
+	}
+}
+
+func TestSubscriptionInvalid(t *testing.T) {
+	for _, topics := range [][]string{
+		nil,
+		{"orders.>.paid"},
+		{"re:orders(["},
+	} {
+		if _, err := NewSubscription(topics...); !errors.Is(err, ErrInvalidSubscription) {
+			t.Errorf("%q: %v, want invalid subscription", topics, err)
+		}
+	}
+}
+
+func TestReadSubscriptionInTurn(t *testing.T) {
+	b := NewBroker()
+	for _, name := range []TopicName{"orders.eu", "orders.us", "payments.eu"} {
+		for _, payload := range []string{"1", "2"} {
+			if err := b.Write(name, &Message{Payload: []byte(string(name) + "/" + payload)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	s, err := NewSubscription("orders.*", "invoices")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := b.Match(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	if len(names) != 3 || names[0] != "invoices" || names[1] != "orders.eu" || names[2] != "orders.us" {
+		t.Fatalf("matched %v, want the literal and the orders topics", names)
+	}
+
+	counts := make(map[TopicName]int)
+	var last TopicName
+	for {
+		name, m, err := b.ReadSubscription(s, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m == nil {
+			break
+		}
+		// the topics are read in turn while both have messages
+		if counts[name] < 1 && name == last {
+			t.Fatalf("%s read twice in a row before the other topic", name)
+		}
+		counts[name]++
+		last = name
+	}
+	if counts["orders.eu"] != 2 || counts["orders.us"] != 2 || counts["payments.eu"] != 0 {
+		t.Fatalf("read by topic %v, want both orders topics twice", counts)
+	}
+
+	// a topic created later is attached to the pattern
+	if err := b.Write("orders.asia", &Message{Payload: []byte("late")}); err != nil {
+		t.Fatal(err)
+	}
+	if name, m, _ := b.ReadSubscription(s, ""); m == nil || name != "orders.asia" {
+		t.Fatalf("read %s %v, want the message of the created topic", name, m)
+	}
+}
+
+func TestWrittenWakesThePoll(t *testing.T) {
+	b := NewBroker()
+
+	for _, topics := range [][]string{{"orders"}, {"orders", "payments"}} {
+		s, err := NewSubscription(topics...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		written, stop := b.written(s)
+		select {
+		case <-written:
+			t.Fatalf("%v: written before a write", topics)
+		default:
+		}
+
+		if err := b.Write(TopicName(topics[len(topics)-1]), &Message{Payload: []byte("m")}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-written:
+		case <-time.After(time.Second):
+			t.Fatalf("%v: the write did not wake the poll", topics)
+		}
+		stop()
+	}
+}
@@ -0,0 +1,70 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/baibikov/jellyfish/internal/broker"
+
+var (
+	tracer     = otel.Tracer(tracerName)
+	propagator = propagation.TraceContext{}
+)
+
+// startSpan continues the trace carried by the message headers.
+func startSpan(
+	ctx context.Context,
+	name string,
+	kind trace.SpanKind,
+	topic TopicName,
+	headers map[string]string,
+) (context.Context, trace.Span) {
+	ctx = propagator.Extract(ctx, propagation.MapCarrier(headers))
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(kind),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "jellyfish"),
+			attribute.String("messaging.destination", string(topic)),
+		),
+	)
+}
+
+// injectSpan returns a copy of headers with the trace context of ctx,
+// so the next hop continues the trace from the broker span.
+func injectSpan(ctx context.Context, headers map[string]string) map[string]string {
+	out := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		out[k] = v
+	}
+
+	propagator.Inject(ctx, propagation.MapCarrier(out))
+	return out
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
@@ -0,0 +1,139 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/baibikov/jellyfish/pkg/consumer"
+	"github.com/baibikov/jellyfish/pkg/producer"
+	"github.com/baibikov/jellyfish/protogenerated/messages"
+)
+
+var (
+	recordOnce sync.Once
+	recordTP   *sdktrace.TracerProvider
+	recorder   *tracetest.SpanRecorder
+)
+
+// recordSpans returns the tracer provider recording the ended spans and the
+// spans ended so far. The global tracer of the package delegates to the first
+// provider set, so the provider is installed once for every test.
+func recordSpans() (*sdktrace.TracerProvider, func() []sdktrace.ReadOnlySpan) {
+	recordOnce.Do(func() {
+		recorder = tracetest.NewSpanRecorder()
+		recordTP = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		otel.SetTracerProvider(recordTP)
+	})
+
+	skip := len(recorder.Ended())
+	return recordTP, func() []sdktrace.ReadOnlySpan {
+		return recorder.Ended()[skip:]
+	}
+}
+
+func TestTracePropagatedFromProducerToConsumer(t *testing.T) {
+	tp, ended := recordSpans()
+
+	ctx, produce := tp.Tracer("test").Start(context.Background(), "produce")
+	pp := producer.NewPayload(ctx, &producer.Params{
+		Topic:   "orders",
+		Message: []byte("created"),
+		Headers: map[string]string{"source": "test"},
+	}, producer.AcksAll)
+	produce.End()
+
+	if pp.Headers["traceparent"] == "" {
+		t.Fatalf("producer headers %v have no traceparent", pp.Headers)
+	}
+	if pp.Headers["source"] != "test" {
+		t.Fatalf("producer headers %v lost the user header", pp.Headers)
+	}
+
+	spanCtx, span := startSpan(context.Background(), "jellyfish.deliver", trace.SpanKindProducer, "orders", pp.Headers)
+	mm := &messages.ConsumerResponse{Message: pp.Message}
+	fillResponse(spanCtx, "orders", &Message{Payload: pp.Message, Headers: pp.Headers}, mm)
+	endSpan(span, nil)
+
+	if mm.Headers["traceparent"] == pp.Headers["traceparent"] {
+		t.Fatal("delivered headers carry the producer span instead of the broker one")
+	}
+
+	spans := ended()
+	if len(spans) != 2 {
+		t.Fatalf("ended spans = %d, want 2", len(spans))
+	}
+	deliver := spans[1]
+	if deliver.Parent().SpanID() != produce.SpanContext().SpanID() {
+		t.Fatalf("broker span parent = %s, want the producer span %s", deliver.Parent().SpanID(), produce.SpanContext().SpanID())
+	}
+	if deliver.SpanKind() != trace.SpanKindProducer {
+		t.Fatalf("broker span kind = %s, want producer", deliver.SpanKind())
+	}
+
+	got := trace.SpanContextFromContext(consumer.NewPayload(context.Background(), mm).Context())
+	if got.TraceID() != produce.SpanContext().TraceID() {
+		t.Fatalf("consumer trace = %s, want %s", got.TraceID(), produce.SpanContext().TraceID())
+	}
+	if got.SpanID() != deliver.SpanContext().SpanID() {
+		t.Fatalf("consumer parent span = %s, want the broker span %s", got.SpanID(), deliver.SpanContext().SpanID())
+	}
+	if !got.IsRemote() {
+		t.Fatal("consumer span context is not remote")
+	}
+}
+
+func TestInjectSpanCopiesHeaders(t *testing.T) {
+	tp, _ := recordSpans()
+
+	ctx, span := tp.Tracer("test").Start(context.Background(), "deliver")
+	defer span.End()
+
+	headers := map[string]string{"source": "test"}
+	out := injectSpan(ctx, headers)
+
+	if _, ok := headers["traceparent"]; ok {
+		t.Fatal("injectSpan changed the message headers")
+	}
+	if out["source"] != "test" || out["traceparent"] == "" {
+		t.Fatalf("injected headers = %v", out)
+	}
+}
+
+func TestStartSpanWithoutTrace(t *testing.T) {
+	_, ended := recordSpans()
+
+	_, span := startSpan(context.Background(), "jellyfish.append", trace.SpanKindServer, "orders", nil)
+	endSpan(span, errors.New("disk is full"))
+
+	spans := ended()
+	if len(spans) != 1 {
+		t.Fatalf("ended spans = %d, want 1", len(spans))
+	}
+	if spans[0].Parent().IsValid() {
+		t.Fatal("span without trace headers has a parent")
+	}
+	if spans[0].Status().Code != codes.Error {
+		t.Fatalf("failed span status = %s, want error", spans[0].Status().Code)
+	}
+}
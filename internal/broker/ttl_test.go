@@ -0,0 +1,115 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestTTLExpiry(t *testing.T) {
+	b := NewBroker()
+	if err := b.CreateTopic("orders", TopicConfig{TTL: time.Minute, ExpiryTopic: "orders.expired"}); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-time.Minute * 2)
+	writes := []*Message{
+		{Payload: []byte("expired by topic"), Timestamp: old, Headers: map[string]string{"type": "order"}},
+		{Payload: []byte("kept by message ttl"), Timestamp: old, TTL: time.Hour},
+		{Payload: []byte("expired by message ttl"), TTL: time.Nanosecond, Timestamp: time.Now().Add(-time.Second)},
+		{Payload: []byte("fresh")},
+	}
+	for _, m := range writes {
+		if err := b.Write("orders", m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := readAll(t, b, "orders", ""); len(got) != 2 || got[0] != "kept by message ttl" || got[1] != "fresh" {
+		t.Fatalf("visible = %v", got)
+	}
+
+	// another group skips the same messages, they are routed once
+	if got := readAll(t, b, "orders", "audit"); len(got) != 2 {
+		t.Fatalf("visible to audit = %v", got)
+	}
+
+	stats, err := b.Topic("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Expired != 2 {
+		t.Fatalf("expired = %d, want 2", stats.Expired)
+	}
+
+	m, err := b.Read("orders.expired", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || string(m.Payload) != "expired by topic" ||
+		m.Headers[HeaderExpiredTopic] != "orders" || m.Headers[HeaderExpiredOffset] != "0" || m.Headers["type"] != "order" {
+		t.Fatalf("routed message = %+v", m)
+	}
+	if got := readAll(t, b, "orders.expired", ""); len(got) != 1 || got[0] != "expired by message ttl" {
+		t.Fatalf("rest of the expiry topic = %v", got)
+	}
+}
+
+func TestTTLWithoutExpiryTopic(t *testing.T) {
+	b := NewBroker()
+	if err := b.CreateTopic("orders", TopicConfig{TTL: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Write("orders", &Message{Payload: []byte("old"), Timestamp: time.Now().Add(-time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, b, "orders", ""); len(got) != 0 {
+		t.Fatalf("visible = %v, want the message dropped", got)
+	}
+	if len(b.Topics()) != 1 {
+		t.Fatalf("topics = %v, want no expiry topic created", b.Topics())
+	}
+}
+
+func TestTopicConfigValidate(t *testing.T) {
+	for name, config := range map[string]TopicConfig{
+		"negative ttl":      {TTL: -time.Second},
+		"own expiry topic":  {ExpiryTopic: "orders"},
+		"negative aging":    {PriorityAging: -time.Second},
+		"undefined cleanup": {CleanupPolicy: "archive"},
+		"negative retention": {
+			CleanupPolicy:      CleanupCompact,
+			TombstoneRetention: -time.Second,
+		},
+	} {
+		if err := NewBroker().CreateTopic("orders", config); !errors.Is(err, ErrInvalidTopicConfig) {
+			t.Errorf("%s: create = %v, want invalid topic config", name, err)
+		}
+	}
+
+	b := NewBroker()
+	if err := b.CreateTopic("orders", TopicConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.ConfigureTopic("orders", TopicConfig{TTL: -time.Second}); !errors.Is(err, ErrInvalidTopicConfig) {
+		t.Fatalf("configure = %v, want invalid topic config", err)
+	}
+	if err := b.ConfigureTopic("payments", TopicConfig{}); !errors.Is(err, ErrTopicNotFound) {
+		t.Fatalf("configure missing topic = %v, want not found", err)
+	}
+}
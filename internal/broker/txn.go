@@ -0,0 +1,288 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Transaction timeouts, a transaction not ended within its timeout is aborted.
+const (
+	DefaultTxnTimeout = time.Minute
+	MaxTxnTimeout     = time.Minute * 15
+)
+
+// HeaderTxnMarker is the header of a transaction marker, it is TxnCommitted or TxnAborted.
+const HeaderTxnMarker = "jellyfish-txn-marker"
+
+// Transaction outcomes written by the markers.
+const (
+	TxnCommitted = "commit"
+	TxnAborted   = "abort"
+)
+
+var (
+	// ErrTxnNotFound is returned for a transaction never begun, already ended or timed out.
+	ErrTxnNotFound = errors.New("transaction not found")
+	// ErrInvalidTxn is returned for a request a transaction can not serve.
+	ErrInvalidTxn = errors.New("invalid transaction request")
+)
+
+// txn is an open transaction.
+type txn struct {
+	deadline time.Time
+	// topics are the topics the transaction wrote to.
+	topics map[TopicName]struct{}
+	// offsets are the group offsets by topic committed with the transaction.
+	offsets map[TopicName]map[string]int
+}
+
+// BeginTxn begins a transaction aborted after the timeout,
+// zero is DefaultTxnTimeout.
+func (b *Broker) BeginTxn(timeout time.Duration) (uint64, error) {
+	if timeout < 0 || timeout > MaxTxnTimeout {
+		return 0, errors.Wrapf(ErrInvalidTxn, "timeout %s is out of [0, %s]", timeout, MaxTxnTimeout)
+	}
+	if timeout == 0 {
+		timeout = DefaultTxnTimeout
+	}
+
+	now := time.Now()
+	b.advance(now)
+
+	b.txnMutex.Lock()
+	defer b.txnMutex.Unlock()
+
+	b.txnSeq++
+	b.txns[b.txnSeq] = &txn{
+		deadline: now.Add(timeout),
+		topics:   make(map[TopicName]struct{}),
+		offsets:  make(map[TopicName]map[string]int),
+	}
+	b.resetTxnDeadline()
+	return b.txnSeq, nil
+}
+
+// WriteTxn writes the message in the transaction, the message is visible
+// to the read committed consumers only after the transaction is committed.
+func (b *Broker) WriteTxn(id uint64, name TopicName, message *Message) error {
+	b.advance(time.Now())
+
+	b.txnMutex.Lock()
+	defer b.txnMutex.Unlock()
+
+	t, ok := b.txns[id]
+	if !ok {
+		return errors.Wrapf(ErrTxnNotFound, "transaction %d", id)
+	}
+
+	p := b.topic.writable(name)
+	if p == nil {
+		logrus.Debugf("drop message to the closed reply topic %s", name)
+		return nil
+	}
+	if err := b.checkSchema(name, p, message); err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	message.Txn = id
+	p.append(message)
+	p.open[id] = struct{}{}
+	p.mutex.Unlock()
+
+	t.topics[name] = struct{}{}
+	return nil
+}
+
+// TxnOffset commits the offset of the next message the group reads from the
+// topic once the transaction is committed, the group never moves back by it.
+func (b *Broker) TxnOffset(id uint64, name TopicName, group string, offset int) error {
+	b.advance(time.Now())
+
+	b.txnMutex.Lock()
+	defer b.txnMutex.Unlock()
+
+	t, ok := b.txns[id]
+	if !ok {
+		return errors.Wrapf(ErrTxnNotFound, "transaction %d", id)
+	}
+
+	p := b.topic.get(name)
+	if p == nil {
+		return errors.Wrapf(ErrTopicNotFound, "topic %s", name)
+	}
+	p.mutex.Lock()
+	writeOffset := p.writeOffset
+	p.mutex.Unlock()
+	if offset < 0 || offset > writeOffset {
+		return errors.Wrapf(ErrInvalidTxn, "offset %d is out of [0, %d] of topic %s", offset, writeOffset, name)
+	}
+
+	if t.offsets[name] == nil {
+		t.offsets[name] = make(map[string]int)
+	}
+	t.offsets[name][group] = offset
+	return nil
+}
+
+// SeekCommitted moves the group to the offset of the topic committed by
+// a transaction, the group offset is kept when none was committed.
+func (b *Broker) SeekCommitted(name TopicName, group string) error {
+	b.advance(time.Now())
+
+	p := b.topic.get(name)
+	if p == nil {
+		return nil
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if offset, ok := p.committedOffsets[group]; ok {
+		p.seek(group, offset)
+	}
+	return nil
+}
+
+// CommitTxn makes the transaction messages visible to the read committed consumers.
+func (b *Broker) CommitTxn(id uint64) error {
+	return b.endTxn(id, true)
+}
+
+// AbortTxn hides the transaction messages from the read committed consumers.
+func (b *Broker) AbortTxn(id uint64) error {
+	return b.endTxn(id, false)
+}
+
+func (b *Broker) endTxn(id uint64, commit bool) error {
+	b.advance(time.Now())
+
+	b.txnMutex.Lock()
+	defer b.txnMutex.Unlock()
+
+	t, ok := b.txns[id]
+	if !ok {
+		return errors.Wrapf(ErrTxnNotFound, "transaction %d", id)
+	}
+
+	b.end(id, t, commit)
+	return nil
+}
+
+// end writes the transaction marker to every topic of the transaction,
+// the caller holds txnMutex.
+func (b *Broker) end(id uint64, t *txn, commit bool) {
+	outcome := TxnAborted
+	if commit {
+		outcome = TxnCommitted
+	}
+
+	for name := range t.topics {
+		p := b.topic.get(name)
+		if p == nil {
+			continue
+		}
+
+		p.mutex.Lock()
+		delete(p.open, id)
+		if !commit {
+			p.aborted[id] = struct{}{}
+		}
+		p.append(&Message{
+			Headers: map[string]string{HeaderTxnMarker: outcome},
+			Txn:     id,
+			control: true,
+		})
+		p.mutex.Unlock()
+	}
+
+	if commit {
+		for name, groups := range t.offsets {
+			p := b.topic.get(name)
+			if p == nil {
+				continue
+			}
+
+			p.mutex.Lock()
+			for group, offset := range groups {
+				p.commitOffset(group, offset)
+			}
+			p.mutex.Unlock()
+		}
+	}
+
+	delete(b.txns, id)
+	b.resetTxnDeadline()
+}
+
+// resetTxnDeadline stores the earliest deadline of the open transactions,
+// the caller holds txnMutex.
+func (b *Broker) resetTxnDeadline() {
+	var earliest int64
+	for _, t := range b.txns {
+		if deadline := t.deadline.UnixNano(); earliest == 0 || deadline < earliest {
+			earliest = deadline
+		}
+	}
+
+	b.txnDeadline.Store(earliest)
+}
+
+// commitOffset records the committed offset of the group and moves the group
+// to it unless the group already read past.
+func (m *pack) commitOffset(group string, offset int) {
+	m.committedOffsets[group] = offset
+	if m.readOffsets[group] >= offset {
+		return
+	}
+
+	delivered := m.delivered[group]
+	for o := range delivered {
+		if o < offset {
+			delete(delivered, o)
+		}
+	}
+	m.readOffsets[group] = offset
+	// the offsets already delivered by priority past the committed one are skipped
+	for i := m.index(offset); i < len(m.messages); i++ {
+		o := m.messages[i].Offset
+		if _, ok := delivered[o]; !ok {
+			m.readOffsets[group] = o
+			return
+		}
+		delete(delivered, o)
+	}
+	m.readOffsets[group] = m.writeOffset
+}
+
+// abortTimedOut aborts the transactions not ended within their timeout.
+func (b *Broker) abortTimedOut(now time.Time) {
+	if deadline := b.txnDeadline.Load(); deadline == 0 || now.UnixNano() <= deadline {
+		return
+	}
+
+	b.txnMutex.Lock()
+	defer b.txnMutex.Unlock()
+
+	for id, t := range b.txns {
+		if now.After(t.deadline) {
+			logrus.Infof("transaction %d timed out, abort", id)
+			b.end(id, t, false)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+// Package broker
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package broker
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/pkg/conn"
+	"github.com/baibikov/jellyfish/pkg/consumer"
+	"github.com/baibikov/jellyfish/pkg/ping"
+	"github.com/baibikov/jellyfish/pkg/producer"
+	"github.com/baibikov/jellyfish/protogenerated/messages"
+)
+
+// producerConn is a producer connection to a handler of the broker.
+func producerConn(ctx context.Context, t *testing.T, b *Broker) *conn.Conn {
+	t.Helper()
+
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	go NewHandler(server, b, nil, newClients()).Do(ctx)
+
+	if _, err := ping.New(client).Handshake(ctx, ping.Publisher, ping.Hello{}); err != nil {
+		t.Fatal(err)
+	}
+
+	return conn.New(client)
+}
+
+// request writes the payload and reads its ask.
+func request(t *testing.T, c *conn.Conn, pp *messages.ProducerPayload) *messages.ProducerAsk {
+	t.Helper()
+
+	if err := c.WriteProto(pp); err != nil {
+		t.Fatal(err)
+	}
+	ask := &messages.ProducerAsk{}
+	if err := c.ReadProto(ask); err != nil {
+		t.Fatal(err)
+	}
+
+	return ask
+}
+
+// readCommitted returns the payloads of the topic visible to the read committed group.
+func readCommitted(t *testing.T, b *Broker, name TopicName, group string) []string {
+	t.Helper()
+
+	s, err := NewSubscription(string(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetReadCommitted(true)
+
+	out := make([]string, 0)
+	for {
+		_, m, err := b.ReadSubscription(s, group)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m == nil {
+			return out
+		}
+		out = append(out, string(m.Payload))
+	}
+}
+
+func TestTxnCommitAndAbort(t *testing.T) {
+	b := NewBroker()
+
+	committed, err := b.BeginTxn(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aborted, err := b.BeginTxn(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range []struct {
+		txn     uint64
+		payload string
+	}{
+		{committed, "a"}, {aborted, "x"}, {committed, "b"},
+	} {
+		if err := b.WriteTxn(w.txn, "orders", &Message{Payload: []byte(w.payload)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := readCommitted(t, b, "orders", "g"); len(got) != 0 {
+		t.Fatalf("read %v of the open transactions, want none", got)
+	}
+
+	if err := b.AbortTxn(aborted); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.CommitTxn(committed); err != nil {
+		t.Fatal(err)
+	}
+	if got := readCommitted(t, b, "orders", "g"); strings.Join(got, ",") != "a,b" {
+		t.Fatalf("read %v, want the committed messages a and b", got)
+	}
+
+	if err := b.CommitTxn(committed); !errors.Is(err, ErrTxnNotFound) {
+		t.Fatalf("commit of the ended transaction: %v, want ErrTxnNotFound", err)
+	}
+	if _, err := b.BeginTxn(MaxTxnTimeout + time.Second); !errors.Is(err, ErrInvalidTxn) {
+		t.Fatalf("begin with a too long timeout: %v, want ErrInvalidTxn", err)
+	}
+}
+
+func TestTxnTimeout(t *testing.T) {
+	b := NewBroker()
+
+	id, err := b.BeginTxn(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.WriteTxn(id, "orders", &Message{Payload: []byte("late")}); err != nil {
+		t.Fatal(err)
+	}
+
+	b.abortTimedOut(time.Now().Add(time.Hour))
+	if err := b.CommitTxn(id); !errors.Is(err, ErrTxnNotFound) {
+		t.Fatalf("commit of the timed out transaction: %v, want ErrTxnNotFound", err)
+	}
+	if got := readCommitted(t, b, "orders", "g"); len(got) != 0 {
+		t.Fatalf("read %v of the timed out transaction, want none", got)
+	}
+}
+
+func TestTxnOwnedByConnection(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := NewBroker()
+	owner, other := producerConn(ctx, t, b), producerConn(ctx, t, b)
+
+	begin := request(t, owner, &messages.ProducerPayload{TxnOp: messages.TxnOp_TXN_OP_BEGIN})
+	if !begin.Ask {
+		t.Fatalf("begin: %s", begin.Error)
+	}
+	id := begin.Txn
+
+	// the other connection can not use the transaction
+	for _, pp := range []*messages.ProducerPayload{
+		{Txn: id, Topic: "orders", Message: []byte("forged"), Acks: messages.Acks_ACKS_ALL},
+		{Txn: id, TxnOp: messages.TxnOp_TXN_OP_OFFSET, Topic: "orders", Group: "g"},
+		{Txn: id, TxnOp: messages.TxnOp_TXN_OP_COMMIT},
+		{Txn: id, TxnOp: messages.TxnOp_TXN_OP_ABORT},
+	} {
+		ask := request(t, other, pp)
+		if ask.Ask || !strings.Contains(ask.Error, "not begun by the connection") {
+			t.Fatalf("operation %s of another connection: ask %t error %q, want refused", pp.TxnOp, ask.Ask, ask.Error)
+		}
+	}
+
+	// a transaction never begun is refused too, the message is not written
+	if ask := request(t, owner, &messages.ProducerPayload{Txn: id + 1, Topic: "orders", Message: []byte("orphan")}); ask.Ask {
+		t.Fatal("message of a transaction never begun is asked")
+	}
+
+	if ask := request(t, owner, &messages.ProducerPayload{Txn: id, Topic: "orders", Message: []byte("owned"), Acks: messages.Acks_ACKS_ALL}); !ask.Ask {
+		t.Fatalf("write: %s", ask.Error)
+	}
+	if ask := request(t, owner, &messages.ProducerPayload{Txn: id, TxnOp: messages.TxnOp_TXN_OP_COMMIT}); !ask.Ask {
+		t.Fatalf("commit: %s", ask.Error)
+	}
+
+	if got := readAll(t, b, "orders", "g"); strings.Join(got, ",") != "owned" {
+		t.Fatalf("read %v, want only the message of the owner", got)
+	}
+}
+
+func TestTxnOffset(t *testing.T) {
+	b := NewBroker()
+	for _, payload := range []string{"0", "1", "2", "3", "4"} {
+		if err := b.Write("orders", &Message{Payload: []byte(payload)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	readAll(t, b, "orders", "done")
+	if m, err := b.Read("orders", "slow"); err != nil || string(m.Payload) != "0" {
+		t.Fatalf("read %v, %v", m, err)
+	}
+
+	id, err := b.BeginTxn(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, group := range []string{"slow", "done"} {
+		if err := b.TxnOffset(id, "orders", group, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.TxnOffset(id, "orders", "slow", 6); !errors.Is(err, ErrInvalidTxn) {
+		t.Fatalf("offset past the topic end: %v, want ErrInvalidTxn", err)
+	}
+	if err := b.TxnOffset(id, "missing", "slow", 0); !errors.Is(err, ErrTopicNotFound) {
+		t.Fatalf("offset of a missing topic: %v, want ErrTopicNotFound", err)
+	}
+
+	// the offset moves the group only once committed
+	if m, err := b.Read("orders", "slow"); err != nil || string(m.Payload) != "1" {
+		t.Fatalf("read %v, %v before the commit, want 1", m, err)
+	}
+	if err := b.CommitTxn(id); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, b, "orders", "slow"); strings.Join(got, ",") != "3,4" {
+		t.Fatalf("read %v after the commit, want 3 and 4", got)
+	}
+
+	// the group read past the committed offset is not moved back,
+	// it seeks to it explicitly
+	if got := readAll(t, b, "orders", "done"); len(got) != 0 {
+		t.Fatalf("read %v, want the group kept past the committed offset", got)
+	}
+	if err := b.SeekCommitted("orders", "done"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, b, "orders", "done"); strings.Join(got, ",") != "3,4" {
+		t.Fatalf("read %v after the seek, want 3 and 4", got)
+	}
+}
+
+func TestTxnOffsetAborted(t *testing.T) {
+	b := NewBroker()
+	for _, payload := range []string{"0", "1"} {
+		if err := b.Write("orders", &Message{Payload: []byte(payload)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	id, err := b.BeginTxn(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.TxnOffset(id, "orders", "g", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AbortTxn(id); err != nil {
+		t.Fatal(err)
+	}
+
+	// no offset was committed, the group keeps its own
+	if err := b.SeekCommitted("orders", "g"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, b, "orders", "g"); strings.Join(got, ",") != "0,1" {
+		t.Fatalf("read %v, want the aborted offset ignored", got)
+	}
+}
+
+func TestResumeCommitted(t *testing.T) {
+	l := startListener(t)
+	addr := l.Addr().String()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	p, err := producer.New(&producer.Config{Addr: addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	for _, payload := range []string{"0", "1", "2"} {
+		if err := p.Push(ctx, &producer.Params{Topic: "input", Message: []byte(payload)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the processor publishes the output of the input 0 with its offset
+	txn, err := p.BeginTxn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Push(ctx, &producer.Params{Topic: "output", Message: []byte("processed 0")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.CommitOffset(ctx, "processor", "input", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := consumer.New(&consumer.Config{Addr: addr, Group: "processor", ResumeCommitted: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if m := <-c.Consume(ctx, "input"); m.Err() != nil || string(m.Message) != "1" {
+		t.Fatalf("consumed %q, %v, want the input after the committed offset", m.Message, m.Err())
+	}
+}
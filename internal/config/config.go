@@ -14,31 +14,113 @@
 package config
 
 import (
+	"bytes"
+	"io"
 	"os"
+	"time"
 
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
+
+	"github.com/baibikov/jellyfish/internal/tracing"
 )
 
 type Config struct {
-	Addr   string   `yaml:"addr"`
-	Slaves []string `yaml:"slaves"`
+	Addr      string         `yaml:"addr"`
+	AdminAddr string         `yaml:"admin_addr"`
+	Slaves    []string       `yaml:"slaves"`
+	Tracing   tracing.Config `yaml:"tracing"`
+	// ShutdownTimeout bounds the graceful shutdown, connections still
+	// served when it expires are closed forcibly.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// LogLevel is a logrus level name.
+	LogLevel string `yaml:"log_level"`
+	// CompactionInterval is the period the compacted topics are compacted with.
+	CompactionInterval time.Duration `yaml:"compaction_interval"`
+}
+
+// Default returns the config used for the fields missing in every source.
+func Default() *Config {
+	return &Config{
+		Addr:               "localhost:7654",
+		ShutdownTimeout:    time.Second * 10,
+		LogLevel:           "debug",
+		CompactionInterval: time.Second * 30,
+		Tracing: tracing.Config{
+			Exporter: tracing.ExporterNone,
+		},
+	}
 }
 
+// New reads the config file over the defaults,
+// unknown keys are rejected.
 func New(path string) (*Config, error) {
+	cnf := Default()
+	if err := cnf.decodeFile(path); err != nil {
+		return nil, err
+	}
+
+	return cnf, nil
+}
+
+func (c *Config) decodeFile(path string) error {
 	file, err := os.Open(path)
 	if err != nil {
-		return nil, errors.Wrap(err, "open config by path")
+		return errors.Wrap(err, "open config by path")
 	}
+	defer file.Close()
 
-	cnf := Config{}
-	err = yaml.NewDecoder(file).Decode(&cnf)
-	if err != nil {
-		return nil, errors.Wrap(
-			yaml.NewDecoder(file).Decode(&cnf),
-			"decode config information",
-		)
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+
+	err = decoder.Decode(c)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return errors.Wrap(err, "decode config information")
+	}
+
+	return nil
+}
+
+// Load builds the effective config, every next source overrides the previous:
+//
+//	defaults < config file < JELLYFISH_* environment variables < command-line flags
+//
+// A missing file is ignored unless it was requested explicitly.
+// The result is validated and every problem is reported together.
+func Load(path string, explicit bool, env, flags map[string]string) (*Config, error) {
+	cnf := Default()
+
+	err := cnf.decodeFile(path)
+	if err != nil && (explicit || !errors.Is(err, os.ErrNotExist)) {
+		return nil, errors.Wrapf(err, "config file %s", path)
+	}
+
+	if err := cnf.apply(env); err != nil {
+		return nil, errors.Wrap(err, "environment")
+	}
+	if err := cnf.apply(flags); err != nil {
+		return nil, errors.Wrap(err, "flags")
+	}
+
+	if err := cnf.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cnf, nil
+}
+
+// Marshal encodes the config as yaml.
+func (c *Config) Marshal() ([]byte, error) {
+	buff := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buff)
+	encoder.SetIndent(2)
+
+	if err := encoder.Encode(c); err != nil {
+		return nil, errors.Wrap(err, "encode config")
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, errors.Wrap(err, "encode config")
 	}
 
-	return &cnf, nil
+	return buff.Bytes(), nil
 }
@@ -0,0 +1,201 @@
+// Package config
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes the yaml config into the test directory.
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "broker.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, `
+addr: 'localhost:7001'
+admin_addr: 'localhost:7002'
+log_level: 'warn'
+shutdown_timeout: '20s'
+slaves:
+  - 'localhost:7010'
+`)
+
+	env := Environ(func(key string) (string, bool) {
+		v, ok := map[string]string{
+			"JELLYFISH_ADMIN_ADDR":       "localhost:7003",
+			"JELLYFISH_LOG_LEVEL":        "info",
+			"JELLYFISH_TRACING_EXPORTER": "stdout",
+		}[key]
+		return v, ok
+	})
+
+	fs := flag.NewFlagSet("broker", flag.ContinueOnError)
+	flags := Flags(fs)
+	if err := fs.Parse([]string{"--log-level", "error", "--slaves", "localhost:7011, localhost:7012"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cnf, err := Load(path, true, env, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Default()
+	want.Addr = "localhost:7001"                               // file
+	want.AdminAddr = "localhost:7003"                          // env over file
+	want.LogLevel = "error"                                    // flag over env and file
+	want.ShutdownTimeout = time.Second * 20                    // file over default
+	want.Slaves = []string{"localhost:7011", "localhost:7012"} // flag over file
+	want.Tracing.Exporter = "stdout"                           // env over default
+	if !reflect.DeepEqual(cnf, want) {
+		t.Fatalf("config = %+v, want %+v", cnf, want)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+
+	cnf, err := Load(missing, false, nil, nil)
+	if err != nil {
+		t.Fatalf("implicit missing file: %v", err)
+	}
+	if !reflect.DeepEqual(cnf, Default()) {
+		t.Fatalf("config without sources = %+v, want the defaults", cnf)
+	}
+
+	if _, err := Load(missing, true, nil, nil); err == nil {
+		t.Fatal("explicit missing file is accepted")
+	}
+
+	if _, err := Load(writeConfig(t, "adress: 'localhost:7001'\n"), true, nil, nil); err == nil {
+		t.Fatal("unknown key is accepted")
+	}
+
+	if _, err := Load(writeConfig(t, ""), true, nil, nil); err != nil {
+		t.Fatalf("empty file: %v", err)
+	}
+}
+
+func TestLoadInvalidValue(t *testing.T) {
+	_, err := Load("", false, map[string]string{"shutdown_timeout": "soon"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "environment") || !strings.Contains(err.Error(), "shutdown_timeout") {
+		t.Fatalf("invalid duration = %v", err)
+	}
+
+	_, err = Load("", false, nil, map[string]string{"tracing.insecure": "maybe"})
+	if err == nil || !strings.Contains(err.Error(), "flags") || !strings.Contains(err.Error(), "tracing.insecure") {
+		t.Fatalf("invalid bool = %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("defaults: %v", err)
+	}
+
+	cnf := Default()
+	cnf.Addr = "localhost"
+	cnf.AdminAddr = "127.0.0.1:7654"
+	cnf.Slaves = []string{"localhost:7001", "localhost:7001", "localhost:99999"}
+	cnf.Tracing.Exporter = "jaeger"
+	cnf.ShutdownTimeout = -time.Second
+	cnf.CompactionInterval = time.Hour * 48
+	cnf.LogLevel = "verbose"
+
+	err := cnf.Validate()
+	if err == nil {
+		t.Fatal("invalid config is accepted")
+	}
+
+	// every problem is reported together
+	for _, want := range []string{
+		"addr: address localhost: missing port",
+		"slaves[1] localhost:7001 is duplicated",
+		"slaves[2]: address localhost:99999 port is invalid",
+		`tracing.exporter "jaeger"`,
+		"shutdown_timeout -1s",
+		"compaction_interval 48h0m0s",
+		"log_level",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not report %q", err, want)
+		}
+	}
+
+	cnf = Default()
+	cnf.AdminAddr = "127.0.0.1:7654"
+	cnf.Slaves = []string{"0.0.0.0:7654"}
+	err = cnf.Validate()
+	for _, want := range []string{"admin_addr 127.0.0.1:7654 is the broker addr", "slaves[0] 0.0.0.0:7654 is the broker itself"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("error %v does not report %q", err, want)
+		}
+	}
+}
+
+func TestFlagsNames(t *testing.T) {
+	fs := flag.NewFlagSet("broker", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	Flags(fs)
+
+	for _, name := range []string{"addr", "admin-addr", "slaves", "tracing-exporter", "tracing-insecure", "shutdown-timeout"} {
+		if fs.Lookup(name) == nil {
+			t.Errorf("flag --%s is not registered", name)
+		}
+	}
+
+	// a bool flag needs no value
+	fs = flag.NewFlagSet("broker", flag.ContinueOnError)
+	values := Flags(fs)
+	if err := fs.Parse([]string{"--tracing-insecure"}); err != nil {
+		t.Fatal(err)
+	}
+	if values["tracing.insecure"] != "true" {
+		t.Fatalf("bool flag = %q, want true", values["tracing.insecure"])
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	cnf := Default()
+	cnf.Slaves = []string{"localhost:7001"}
+	cnf.AdminAddr = "localhost:7655"
+
+	bb, err := cnf.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := New(writeConfig(t, string(bb)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, cnf) {
+		t.Fatalf("decoded %+v, want %+v", got, cnf)
+	}
+}
@@ -0,0 +1,60 @@
+// Package config
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Changes returns the yaml paths of the fields which differ between
+// the configs, nested structs are compared by their fields.
+func Changes(old, new *Config) []string {
+	return changes(reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem(), "")
+}
+
+func changes(old, new reflect.Value, prefix string) []string {
+	out := make([]string, 0)
+	for i := 0; i < old.NumField(); i++ {
+		sf := old.Type().Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" || !sf.IsExported() {
+			continue
+		}
+
+		path := prefix + name
+		if old.Field(i).Kind() == reflect.Struct {
+			out = append(out, changes(old.Field(i), new.Field(i), path+".")...)
+			continue
+		}
+
+		if !equal(old.Field(i), new.Field(i)) {
+			out = append(out, path)
+		}
+	}
+
+	return out
+}
+
+// equal compares values treating nil and empty slices and maps as equal.
+func equal(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Slice, reflect.Map:
+		if a.Len() == 0 && b.Len() == 0 {
+			return true
+		}
+	}
+
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
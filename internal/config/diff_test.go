@@ -0,0 +1,49 @@
+// Package config
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChanges(t *testing.T) {
+	old := Default()
+	old.Slaves = []string{"localhost:7001"}
+
+	same := Default()
+	same.Slaves = []string{"localhost:7001"}
+	if changes := Changes(old, same); len(changes) != 0 {
+		t.Fatalf("changes of equal configs = %v", changes)
+	}
+
+	next := Default()
+	next.Slaves = nil
+	next.Addr = "localhost:7001"
+	next.Tracing.Endpoint = "collector:4318"
+	next.ShutdownTimeout = time.Second
+
+	want := []string{"addr", "slaves", "tracing.endpoint", "shutdown_timeout"}
+	if changes := Changes(old, next); !reflect.DeepEqual(changes, want) {
+		t.Fatalf("changes = %v, want %v", changes, want)
+	}
+
+	// nil and empty slaves are equal
+	old.Slaves, next = nil, Default()
+	next.Slaves = []string{}
+	if changes := Changes(old, next); len(changes) != 0 {
+		t.Fatalf("changes of nil and empty slaves = %v", changes)
+	}
+}
@@ -0,0 +1,189 @@
+// Package config
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package config
+
+import (
+	"flag"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+// EnvPrefix prefixes the environment variables of the config fields,
+// e.g. JELLYFISH_ADMIN_ADDR or JELLYFISH_TRACING_EXPORTER.
+const EnvPrefix = "JELLYFISH_"
+
+// field is a scalar config field addressed by its yaml path, e.g. tracing.exporter.
+type field struct {
+	path  string
+	value reflect.Value
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// fields walks the config by the yaml tags, only the fields
+// representable as a single string value are returned.
+func fields(v reflect.Value, prefix string) []field {
+	out := make([]field, 0)
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" || !sf.IsExported() {
+			continue
+		}
+
+		path := prefix + name
+		fv := v.Field(i)
+		switch {
+		case fv.Kind() == reflect.Struct:
+			out = append(out, fields(fv, path+".")...)
+		case isScalar(fv.Type()):
+			out = append(out, field{path: path, value: fv})
+		}
+	}
+
+	return out
+}
+
+func isScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	default:
+		return false
+	}
+}
+
+func (f field) env() string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_").Replace(f.path))
+}
+
+func (f field) flag() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(f.path)
+}
+
+// set parses s into the field, slices are comma separated.
+func (f field) set(s string) error {
+	switch {
+	case f.value.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(int64(d))
+	case f.value.Kind() == reflect.String:
+		f.value.SetString(s)
+	case f.value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.value.SetBool(b)
+	case f.value.Kind() == reflect.Int, f.value.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(n)
+	case f.value.Kind() == reflect.Slice:
+		items := make([]string, 0)
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		f.value.Set(reflect.ValueOf(items))
+	}
+
+	return nil
+}
+
+// apply sets the values keyed by the field paths.
+func (c *Config) apply(values map[string]string) (err error) {
+	for _, f := range fields(reflect.ValueOf(c).Elem(), "") {
+		s, ok := values[f.path]
+		if !ok {
+			continue
+		}
+
+		if e := f.set(s); e != nil {
+			multierr.AppendInto(&err, errors.Wrapf(e, "%s", f.path))
+		}
+	}
+
+	return err
+}
+
+// Environ collects the JELLYFISH_* variables by the field paths.
+func Environ(lookup func(string) (string, bool)) map[string]string {
+	values := make(map[string]string)
+	for _, f := range fields(reflect.ValueOf(Default()).Elem(), "") {
+		if s, ok := lookup(f.env()); ok {
+			values[f.path] = s
+		}
+	}
+
+	return values
+}
+
+// Flags registers a flag by every config field, e.g. --admin-addr or
+// --tracing-exporter, the returned map collects the values set by the
+// command line after fs is parsed.
+func Flags(fs *flag.FlagSet) map[string]string {
+	values := make(map[string]string)
+	for _, f := range fields(reflect.ValueOf(Default()).Elem(), "") {
+		path := f.path
+		usage := "overrides " + path + ", env " + f.env()
+		if f.value.Kind() == reflect.Slice {
+			usage += ", comma separated"
+		}
+
+		fs.Var(&flagValue{
+			values: values,
+			path:   path,
+			isBool: f.value.Kind() == reflect.Bool,
+		}, f.flag(), usage)
+	}
+
+	return values
+}
+
+type flagValue struct {
+	values map[string]string
+	path   string
+	isBool bool
+}
+
+func (v *flagValue) String() string {
+	if v == nil || v.values == nil {
+		return ""
+	}
+
+	return v.values[v.path]
+}
+
+func (v *flagValue) Set(s string) error {
+	v.values[v.path] = s
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	return v.isBool
+}
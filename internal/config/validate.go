@@ -0,0 +1,125 @@
+// Package config
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package config
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/multierr"
+
+	"github.com/baibikov/jellyfish/internal/tracing"
+)
+
+const (
+	maxShutdownTimeout    = time.Minute * 10
+	maxCompactionInterval = time.Hour * 24
+)
+
+// Validate checks the config semantics, every problem is reported together.
+func (c *Config) Validate() (err error) {
+	if e := validateAddr(c.Addr); e != nil {
+		multierr.AppendInto(&err, errors.Wrap(e, "addr"))
+	}
+
+	if c.AdminAddr != "" {
+		if e := validateAddr(c.AdminAddr); e != nil {
+			multierr.AppendInto(&err, errors.Wrap(e, "admin_addr"))
+		} else if sameAddr(c.AdminAddr, c.Addr) {
+			multierr.AppendInto(&err, errors.Errorf("admin_addr %s is the broker addr", c.AdminAddr))
+		}
+	}
+
+	seen := make(map[string]bool, len(c.Slaves))
+	for i, slave := range c.Slaves {
+		switch e := validateAddr(slave); {
+		case e != nil:
+			multierr.AppendInto(&err, errors.Wrapf(e, "slaves[%d]", i))
+		case sameAddr(slave, c.Addr):
+			multierr.AppendInto(&err, errors.Errorf("slaves[%d] %s is the broker itself", i, slave))
+		case seen[slave]:
+			multierr.AppendInto(&err, errors.Errorf("slaves[%d] %s is duplicated", i, slave))
+		}
+		seen[slave] = true
+	}
+
+	switch c.Tracing.Exporter {
+	case "", tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		multierr.AppendInto(&err, errors.Errorf(
+			"tracing.exporter %q is not one of none, stdout or otlp", c.Tracing.Exporter,
+		))
+	}
+
+	if c.ShutdownTimeout < 0 || c.ShutdownTimeout > maxShutdownTimeout {
+		multierr.AppendInto(&err, errors.Errorf(
+			"shutdown_timeout %s is out of [0, %s]", c.ShutdownTimeout, maxShutdownTimeout,
+		))
+	}
+
+	if c.CompactionInterval < 0 || c.CompactionInterval > maxCompactionInterval {
+		multierr.AppendInto(&err, errors.Errorf(
+			"compaction_interval %s is out of [0, %s]", c.CompactionInterval, maxCompactionInterval,
+		))
+	}
+
+	if _, e := logrus.ParseLevel(c.LogLevel); e != nil {
+		multierr.AppendInto(&err, errors.Wrap(e, "log_level"))
+	}
+
+	return errors.Wrap(err, "invalid config")
+}
+
+// validateAddr checks the address is a host:port pair.
+func validateAddr(addr string) error {
+	if addr == "" {
+		return errors.New("address is empty")
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 0 || n > 65535 {
+		return errors.Errorf("address %s port is invalid", addr)
+	}
+
+	return nil
+}
+
+// sameAddr compares addresses treating every local host alias as equal.
+func sameAddr(a, b string) bool {
+	aHost, aPort, aErr := net.SplitHostPort(a)
+	bHost, bPort, bErr := net.SplitHostPort(b)
+	if aErr != nil || bErr != nil {
+		return a == b
+	}
+
+	return aPort == bPort && (aHost == bHost || isLocalHost(aHost) && isLocalHost(bHost))
+}
+
+func isLocalHost(host string) bool {
+	switch host {
+	case "", "localhost", "0.0.0.0", "::":
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
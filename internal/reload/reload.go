@@ -0,0 +1,124 @@
+// Package reload
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package reload
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/baibikov/jellyfish/internal/config"
+)
+
+// Broker is the running broker reconfigured by the reloader.
+type Broker interface {
+	Reconfigure(cnf *config.Config) error
+}
+
+// live are the config fields applied to a running broker,
+// a change of any other field requires a restart. Topic defaults,
+// quotas and ACLs are not in the config yet.
+var live = map[string]func(running, loaded *config.Config){
+	"slaves": func(running, loaded *config.Config) {
+		running.Slaves = loaded.Slaves
+	},
+	"log_level": func(running, loaded *config.Config) {
+		running.LogLevel = loaded.LogLevel
+	},
+	"shutdown_timeout": func(running, loaded *config.Config) {
+		running.ShutdownTimeout = loaded.ShutdownTimeout
+	},
+	"compaction_interval": func(running, loaded *config.Config) {
+		running.CompactionInterval = loaded.CompactionInterval
+	},
+}
+
+// Result lists the yaml paths of the applied and rejected changes.
+type Result struct {
+	Applied  []string `json:"applied"`
+	Rejected []string `json:"rejected"`
+}
+
+// Reloader re-reads the config and applies the safe changes to the running broker.
+type Reloader struct {
+	mutex   sync.Mutex
+	running *config.Config
+	load    func() (*config.Config, error)
+	broker  Broker
+}
+
+func New(running *config.Config, load func() (*config.Config, error), broker Broker) *Reloader {
+	return &Reloader{
+		running: running,
+		load:    load,
+		broker:  broker,
+	}
+}
+
+// Running returns a copy of the config the broker runs with.
+func (r *Reloader) Running() config.Config {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return *r.running
+}
+
+// Reload loads the config, applies the live changes and rejects
+// the others with a logged explanation, the running config keeps
+// the rejected fields so they are reported by every next reload.
+func (r *Reloader) Reload() (*Result, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	loaded, err := r.load()
+	if err != nil {
+		return nil, errors.Wrap(err, "reload config")
+	}
+
+	next := *r.running
+	result := &Result{
+		Applied:  make([]string, 0),
+		Rejected: make([]string, 0),
+	}
+	for _, path := range config.Changes(r.running, loaded) {
+		apply, ok := live[path]
+		if !ok {
+			logrus.Warnf("reload: config change of %s requires a restart, rejected", path)
+			result.Rejected = append(result.Rejected, path)
+			continue
+		}
+
+		apply(&next, loaded)
+		result.Applied = append(result.Applied, path)
+	}
+
+	if len(result.Applied) == 0 {
+		logrus.Info("reload: no config changes to apply")
+		return result, nil
+	}
+
+	level, err := logrus.ParseLevel(next.LogLevel)
+	if err != nil {
+		return nil, errors.Wrap(err, "reload log level")
+	}
+	if err := r.broker.Reconfigure(&next); err != nil {
+		return nil, errors.Wrap(err, "reconfigure broker")
+	}
+	logrus.SetLevel(level)
+
+	r.running = &next
+	logrus.Infof("reload: applied config changes %v", result.Applied)
+	return result, nil
+}
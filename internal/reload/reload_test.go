@@ -0,0 +1,112 @@
+// Package reload
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package reload
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/internal/config"
+)
+
+type fakeBroker struct {
+	applied []*config.Config
+	err     error
+}
+
+func (b *fakeBroker) Reconfigure(cnf *config.Config) error {
+	if b.err != nil {
+		return b.err
+	}
+
+	b.applied = append(b.applied, cnf)
+	return nil
+}
+
+// loader returns the config set by the test.
+type loader struct {
+	cnf *config.Config
+	err error
+}
+
+func (l *loader) load() (*config.Config, error) {
+	return l.cnf, l.err
+}
+
+func TestReloadAppliesLiveChanges(t *testing.T) {
+	running := config.Default()
+	l := &loader{cnf: config.Default()}
+	b := &fakeBroker{}
+	r := New(running, l.load, b)
+
+	l.cnf.Slaves = []string{"localhost:7001"}
+	l.cnf.ShutdownTimeout = time.Second
+	l.cnf.Addr = "localhost:7100"
+
+	result, err := r.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"slaves", "shutdown_timeout"}; !reflect.DeepEqual(result.Applied, want) {
+		t.Fatalf("applied = %v, want %v", result.Applied, want)
+	}
+	if want := []string{"addr"}; !reflect.DeepEqual(result.Rejected, want) {
+		t.Fatalf("rejected = %v, want %v", result.Rejected, want)
+	}
+
+	if len(b.applied) != 1 {
+		t.Fatalf("broker reconfigured %d times, want once", len(b.applied))
+	}
+	got := r.Running()
+	if got.Addr != "localhost:7654" || got.ShutdownTimeout != time.Second || !reflect.DeepEqual(got.Slaves, l.cnf.Slaves) {
+		t.Fatalf("running config = %+v", got)
+	}
+
+	// the rejected change is reported again, nothing is applied
+	result, err = r.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Applied) != 0 || !reflect.DeepEqual(result.Rejected, []string{"addr"}) {
+		t.Fatalf("second reload = %+v", result)
+	}
+	if len(b.applied) != 1 {
+		t.Fatalf("broker reconfigured %d times without changes", len(b.applied))
+	}
+}
+
+func TestReloadFailureKeepsRunning(t *testing.T) {
+	running := config.Default()
+	l := &loader{err: errors.New("invalid config")}
+	b := &fakeBroker{}
+	r := New(running, l.load, b)
+
+	if _, err := r.Reload(); err == nil {
+		t.Fatal("load error is not returned")
+	}
+
+	l.cnf, l.err = config.Default(), nil
+	l.cnf.Slaves = []string{"localhost:7001"}
+	b.err = errors.New("slave unreachable")
+	if _, err := r.Reload(); err == nil {
+		t.Fatal("reconfigure error is not returned")
+	}
+
+	if got := r.Running(); len(got.Slaves) != 0 {
+		t.Fatalf("running config changed by a failed reload: %+v", got)
+	}
+}
@@ -0,0 +1,93 @@
+// Package tracing
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+package tracing
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+const serviceName = "jellyfish"
+
+type Config struct {
+	// Exporter is one of none, stdout or otlp, empty means none.
+	Exporter string `yaml:"exporter"`
+	// Endpoint is the otlp http collector address, e.g. localhost:4318.
+	Endpoint string `yaml:"endpoint"`
+	// Insecure disables tls for the otlp exporter.
+	Insecure bool `yaml:"insecure"`
+}
+
+// Init installs the global tracer provider and the w3c trace context
+// propagator. The returned function flushes and stops the exporter.
+func Init(ctx context.Context, cnf Config) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	exporter, err := newExporter(ctx, cnf)
+	if err != nil {
+		return nil, err
+	}
+	if exporter == nil {
+		return func(ctx context.Context) error { return nil }, nil
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			semconv.ServiceNameKey.String(serviceName),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		return errors.Wrap(provider.Shutdown(ctx), "tracing shutdown")
+	}, nil
+}
+
+func newExporter(ctx context.Context, cnf Config) (sdktrace.SpanExporter, error) {
+	switch cnf.Exporter {
+	case "", ExporterNone:
+		return nil, nil
+	case ExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		return exporter, errors.Wrap(err, "init stdout trace exporter")
+	case ExporterOTLP:
+		opts := make([]otlptracehttp.Option, 0, 2)
+		if cnf.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cnf.Endpoint))
+		}
+		if cnf.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(ctx, opts...)
+		return exporter, errors.Wrap(err, "init otlp trace exporter")
+	default:
+		return nil, errors.Errorf("undefined trace exporter %q", cnf.Exporter)
+	}
+}
@@ -0,0 +1,349 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type Config struct {
+	// Addr is the broker admin http address.
+	Addr string
+	// Timeout bounds every request, zero means defaultTimeout.
+	Timeout time.Duration
+}
+
+// Admin is a client of the broker admin http api.
+type Admin struct {
+	config *Config
+	client *http.Client
+}
+
+const defaultTimeout = time.Second * 5
+
+func New(config *Config) (*Admin, error) {
+	if config == nil {
+		return nil, errors.New("config has not empty")
+	}
+	if config.Addr == "" {
+		return nil, errors.New("admin addr has not empty")
+	}
+
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	return &Admin{
+		config: config,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}, nil
+}
+
+type Topic struct {
+	Name        string `json:"name"`
+	WriteOffset int64  `json:"write_offset"`
+	ReadOffset  int64  `json:"read_offset"`
+	Lag         int64  `json:"lag"`
+	// Scheduled is the count of the delayed messages not yet due.
+	Scheduled int64 `json:"scheduled"`
+	// Expired is the count of the messages skipped by the consumers as expired.
+	Expired int64 `json:"expired"`
+	// Ephemeral is set for the reply topics deleted with their connection.
+	Ephemeral bool `json:"ephemeral"`
+	// Messages is the count of the stored messages, less than the write
+	// offset once the topic is compacted.
+	Messages int64 `json:"messages"`
+	// Compacted is the count of the messages removed by the compaction.
+	Compacted int64         `json:"compacted"`
+	Config    TopicConfig   `json:"config"`
+	Groups    []GroupOffset `json:"groups"`
+}
+
+// TopicConfig is the per-topic settings.
+type TopicConfig struct {
+	// TTL is the default time to live of the topic messages, zero never expires.
+	TTL time.Duration `json:"ttl"`
+	// ExpiryTopic receives the expired messages, empty drops them.
+	ExpiryTopic string `json:"expiry_topic,omitempty"`
+	// Priority delivers the highest priority message first instead of in the write order.
+	Priority bool `json:"priority"`
+	// PriorityAging raises the priority of a waiting message by one every
+	// interval, the broker default when zero.
+	PriorityAging time.Duration `json:"priority_aging,omitempty"`
+	// CleanupPolicy is CleanupDelete, when empty, or CleanupCompact.
+	CleanupPolicy string `json:"cleanup_policy,omitempty"`
+	// TombstoneRetention is how long a compacted topic keeps a message with
+	// an empty payload, the broker default when zero.
+	TombstoneRetention time.Duration `json:"tombstone_retention,omitempty"`
+	// RequireSchema rejects the messages without the id of a schema registered
+	// for the topic, producer.ErrSchemaRejected on the producer side.
+	RequireSchema bool `json:"require_schema,omitempty"`
+}
+
+// Cleanup policies of a topic.
+const (
+	// CleanupDelete keeps every message, it is the default policy.
+	CleanupDelete = "delete"
+	// CleanupCompact keeps only the latest message by key.
+	CleanupCompact = "compact"
+)
+
+func (c TopicConfig) query() string {
+	query := url.Values{}
+	if c.TTL != 0 {
+		query.Set("ttl", c.TTL.String())
+	}
+	if c.ExpiryTopic != "" {
+		query.Set("expiry_topic", c.ExpiryTopic)
+	}
+	if c.Priority {
+		query.Set("priority", "true")
+	}
+	if c.PriorityAging != 0 {
+		query.Set("priority_aging", c.PriorityAging.String())
+	}
+	if c.CleanupPolicy != "" {
+		query.Set("cleanup_policy", c.CleanupPolicy)
+	}
+	if c.TombstoneRetention != 0 {
+		query.Set("tombstone_retention", c.TombstoneRetention.String())
+	}
+	if c.RequireSchema {
+		query.Set("require_schema", "true")
+	}
+	if len(query) == 0 {
+		return ""
+	}
+
+	return "?" + query.Encode()
+}
+
+// Schema types of the registry.
+const (
+	SchemaJSON     = "json"
+	SchemaProtobuf = "protobuf"
+)
+
+// Compatibility modes a new schema version is checked by against the latest one,
+// the transitive ones check it against every registered version.
+const (
+	CompatibilityBackward           = "backward"
+	CompatibilityForward            = "forward"
+	CompatibilityFull               = "full"
+	CompatibilityNone               = "none"
+	CompatibilityBackwardTransitive = "backward_transitive"
+	CompatibilityForwardTransitive  = "forward_transitive"
+	CompatibilityFullTransitive     = "full_transitive"
+)
+
+// Schema is a registered schema version, the producers tag
+// the messages encoded with it by its ID.
+type Schema struct {
+	ID      int    `json:"id"`
+	Topic   string `json:"topic"`
+	Version int    `json:"version"`
+	Type    string `json:"type"`
+	// Schema is the JSON Schema document or the base64 encoded
+	// protobuf FileDescriptorSet.
+	Schema string `json:"schema"`
+	// Message is the full name of the protobuf message of the set.
+	Message string `json:"message,omitempty"`
+}
+
+// SchemaSubject is the schema versions of a topic.
+type SchemaSubject struct {
+	Topic         string   `json:"topic"`
+	Compatibility string   `json:"compatibility"`
+	Versions      []Schema `json:"versions"`
+}
+
+type GroupOffset struct {
+	Group  string `json:"group"`
+	Topic  string `json:"topic"`
+	Offset int64  `json:"offset"`
+	Lag    int64  `json:"lag"`
+	// Committed is the offset committed by a producer transaction, nil is none.
+	Committed *int64 `json:"committed,omitempty"`
+}
+
+type Client struct {
+	RemoteAddr  string    `json:"remote_addr"`
+	Role        string    `json:"role"`
+	ConnectedAt time.Time `json:"connected_at"`
+
+	ClientID        string   `json:"client_id,omitempty"`
+	ClientVersion   string   `json:"client_version,omitempty"`
+	ProtocolVersion uint32   `json:"protocol_version"`
+	Features        []string `json:"features,omitempty"`
+}
+
+type Peer struct {
+	Addr        string `json:"addr"`
+	Initialized bool   `json:"initialized"`
+	Failed      bool   `json:"failed"`
+}
+
+type Status struct {
+	Ready   bool     `json:"ready"`
+	Topics  int      `json:"topics"`
+	Clients []Client `json:"clients"`
+	Peers   []Peer   `json:"peers"`
+}
+
+func (a *Admin) Topics(ctx context.Context) ([]Topic, error) {
+	topics := make([]Topic, 0)
+	return topics, a.do(ctx, http.MethodGet, "/topics", nil, &topics)
+}
+
+func (a *Admin) Topic(ctx context.Context, name string) (*Topic, error) {
+	topic := &Topic{}
+	return topic, a.do(ctx, http.MethodGet, "/topics/"+url.PathEscape(name), nil, topic)
+}
+
+func (a *Admin) CreateTopic(ctx context.Context, name string, config TopicConfig) error {
+	return a.do(ctx, http.MethodPost, "/topics/"+url.PathEscape(name)+config.query(), nil, nil)
+}
+
+// ConfigureTopic replaces the settings of the topic.
+func (a *Admin) ConfigureTopic(ctx context.Context, name string, config TopicConfig) error {
+	return a.do(ctx, http.MethodPut, "/topics/"+url.PathEscape(name)+config.query(), nil, nil)
+}
+
+func (a *Admin) DeleteTopic(ctx context.Context, name string) error {
+	return a.do(ctx, http.MethodDelete, "/topics/"+url.PathEscape(name), nil, nil)
+}
+
+func (a *Admin) Groups(ctx context.Context) ([]GroupOffset, error) {
+	groups := make([]GroupOffset, 0)
+	return groups, a.do(ctx, http.MethodGet, "/groups", nil, &groups)
+}
+
+func (a *Admin) Group(ctx context.Context, group string) ([]GroupOffset, error) {
+	offsets := make([]GroupOffset, 0)
+	return offsets, a.do(ctx, http.MethodGet, "/groups/"+groupSegment(group), nil, &offsets)
+}
+
+// Reset positions accepted by ResetOffsets besides an offset number or a RFC3339 time.
+const (
+	ResetEarliest = "earliest"
+	ResetLatest   = "latest"
+)
+
+// ResetOffsets moves the group offsets of the topic, or of every topic
+// the group consumes when topic is empty, to the position to.
+func (a *Admin) ResetOffsets(ctx context.Context, group, topic, to string) ([]GroupOffset, error) {
+	query := url.Values{}
+	query.Set("to", to)
+	if topic != "" {
+		query.Set("topic", topic)
+	}
+
+	offsets := make([]GroupOffset, 0)
+	return offsets, a.do(
+		ctx,
+		http.MethodPost,
+		"/groups/"+groupSegment(group)+"/reset-offsets?"+query.Encode(),
+		nil,
+		&offsets,
+	)
+}
+
+func (a *Admin) SchemaSubjects(ctx context.Context) ([]SchemaSubject, error) {
+	subjects := make([]SchemaSubject, 0)
+	return subjects, a.do(ctx, http.MethodGet, "/schemas", nil, &subjects)
+}
+
+func (a *Admin) SchemaSubject(ctx context.Context, topic string) (*SchemaSubject, error) {
+	subject := &SchemaSubject{}
+	return subject, a.do(ctx, http.MethodGet, "/schemas/"+url.PathEscape(topic), nil, subject)
+}
+
+// RegisterSchema registers a schema version of the topic, the same schema as
+// a registered version returns that version. A schema not compatible with the
+// latest version, or every version of a transitive mode, by the topic
+// compatibility mode fails.
+func (a *Admin) RegisterSchema(ctx context.Context, topic, typ, schema, message string) (*Schema, error) {
+	body := struct {
+		Type    string `json:"type"`
+		Schema  string `json:"schema"`
+		Message string `json:"message,omitempty"`
+	}{Type: typ, Schema: schema, Message: message}
+
+	registered := &Schema{}
+	return registered, a.do(ctx, http.MethodPost, "/schemas/"+url.PathEscape(topic), body, registered)
+}
+
+func (a *Admin) SetSchemaCompatibility(ctx context.Context, topic, compatibility string) error {
+	query := url.Values{}
+	query.Set("compatibility", compatibility)
+	return a.do(ctx, http.MethodPut, "/schemas/"+url.PathEscape(topic)+"?"+query.Encode(), nil, nil)
+}
+
+func (a *Admin) Schema(ctx context.Context, id int) (*Schema, error) {
+	schema := &Schema{}
+	return schema, a.do(ctx, http.MethodGet, "/schema-ids/"+strconv.Itoa(id), nil, schema)
+}
+
+func (a *Admin) Status(ctx context.Context) (*Status, error) {
+	status := &Status{}
+	return status, a.do(ctx, http.MethodGet, "/status", nil, status)
+}
+
+// groupSegment maps the default group to its path segment.
+func groupSegment(group string) string {
+	if group == "" {
+		return "-"
+	}
+
+	return url.PathEscape(group)
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (a *Admin) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		bb, err := json.Marshal(body)
+		if err != nil {
+			return errors.Wrap(err, "json-marshal request")
+		}
+		reader = bytes.NewReader(bb)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, "http://"+a.config.Addr+path, reader)
+	if err != nil {
+		return errors.Wrap(err, "new admin request")
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "admin: %s %s", method, path)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		e := &errorResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(e); err != nil || e.Error == "" {
+			return errors.Errorf("admin: %s %s: %s", method, path, resp.Status)
+		}
+		return errors.Errorf("admin: %s %s: %s", method, path, e.Error)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(out), "json-decode admin response")
+}
@@ -0,0 +1,112 @@
+// Package brokererr maps the typed errors the broker sends on the wire to error
+// values, the producer and the consumer return them so callers test the cause
+// with errors.Is, e.g. errors.Is(err, brokererr.ErrTopicNotFound).
+package brokererr
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/protogenerated/messages"
+)
+
+// Code classifies a broker error.
+type Code = messages.ErrorCode
+
+// Error values by code, a broker Error matches the value of its code.
+var (
+	ErrUnknown           = errors.New("broker error")
+	ErrTopicNotFound     = errors.New("topic not found")
+	ErrUnauthorized      = errors.New("unauthorized")
+	ErrMessageTooLarge   = errors.New("message too large")
+	ErrNotLeader         = errors.New("broker is not the leader")
+	ErrThrottled         = errors.New("throttled")
+	ErrInvalidRequest    = errors.New("invalid request")
+	ErrTxnNotFound       = errors.New("transaction not found")
+	ErrIncompatible      = errors.New("incompatible protocol")
+	ErrGoingAway         = errors.New("broker is going away")
+	ErrReplicationFailed = errors.New("replication failed")
+	ErrTopicExists       = errors.New("topic already exists")
+	ErrSchemaRejected    = errors.New("schema not registered for topic")
+)
+
+var byCode = map[Code]error{
+	messages.ErrorCode_ERROR_CODE_UNKNOWN:            ErrUnknown,
+	messages.ErrorCode_ERROR_CODE_TOPIC_NOT_FOUND:    ErrTopicNotFound,
+	messages.ErrorCode_ERROR_CODE_UNAUTHORIZED:       ErrUnauthorized,
+	messages.ErrorCode_ERROR_CODE_MESSAGE_TOO_LARGE:  ErrMessageTooLarge,
+	messages.ErrorCode_ERROR_CODE_NOT_LEADER:         ErrNotLeader,
+	messages.ErrorCode_ERROR_CODE_THROTTLED:          ErrThrottled,
+	messages.ErrorCode_ERROR_CODE_INVALID_REQUEST:    ErrInvalidRequest,
+	messages.ErrorCode_ERROR_CODE_TXN_NOT_FOUND:      ErrTxnNotFound,
+	messages.ErrorCode_ERROR_CODE_INCOMPATIBLE:       ErrIncompatible,
+	messages.ErrorCode_ERROR_CODE_GOING_AWAY:         ErrGoingAway,
+	messages.ErrorCode_ERROR_CODE_REPLICATION_FAILED: ErrReplicationFailed,
+	messages.ErrorCode_ERROR_CODE_TOPIC_EXISTS:       ErrTopicExists,
+	messages.ErrorCode_ERROR_CODE_SCHEMA_REJECTED:    ErrSchemaRejected,
+}
+
+// Error is an error sent by the broker.
+type Error struct {
+	Code    Code
+	Message string
+	// Retriable is set when the same request may succeed later.
+	Retriable bool
+	// Leader is the broker address to retry on for ErrNotLeader.
+	Leader string
+}
+
+func (e *Error) Error() string {
+	if e.Leader != "" {
+		return fmt.Sprintf("%s, leader %s", e.Message, e.Leader)
+	}
+
+	return e.Message
+}
+
+// Is matches the error value of the code, the codes unknown
+// to this version match ErrUnknown.
+func (e *Error) Is(target error) bool {
+	if err, ok := byCode[e.Code]; ok {
+		return target == err
+	}
+
+	return target == ErrUnknown
+}
+
+// FromProto returns the error of the wire format, nil for nil.
+func FromProto(f *messages.ErrorFormat) error {
+	if f == nil {
+		return nil
+	}
+
+	return &Error{
+		Code:      f.GetCode(),
+		Message:   f.GetMessage(),
+		Retriable: f.GetRetriable(),
+		Leader:    f.GetLeader(),
+	}
+}
+
+// ToProto returns the wire format of the error, an error not
+// of this package is ERROR_CODE_UNKNOWN.
+func ToProto(err error) *messages.ErrorFormat {
+	var e *Error
+	if !errors.As(err, &e) {
+		return &messages.ErrorFormat{Message: err.Error()}
+	}
+
+	return &messages.ErrorFormat{
+		Message:   err.Error(),
+		Code:      e.Code,
+		Retriable: e.Retriable,
+		Leader:    e.Leader,
+	}
+}
+
+// IsRetriable reports whether the broker said the request may succeed later.
+func IsRetriable(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Retriable
+}
@@ -0,0 +1,72 @@
+package brokererr
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/protogenerated/messages"
+)
+
+func TestFromProto(t *testing.T) {
+	if err := FromProto(nil); err != nil {
+		t.Fatalf("FromProto(nil) = %v, want nil", err)
+	}
+
+	for code, value := range byCode {
+		err := errors.Wrap(FromProto(&messages.ErrorFormat{Code: code, Message: "m"}), "push")
+		if !errors.Is(err, value) {
+			t.Errorf("%s does not match %v", code, value)
+		}
+		for other, otherValue := range byCode {
+			if other != code && errors.Is(err, otherValue) {
+				t.Errorf("%s matches %v of %s", code, otherValue, other)
+			}
+		}
+	}
+
+	// a code added by a newer broker
+	if err := FromProto(&messages.ErrorFormat{Code: 1000, Message: "m"}); !errors.Is(err, ErrUnknown) {
+		t.Errorf("unknown code: %v, want ErrUnknown", err)
+	}
+}
+
+func TestToProto(t *testing.T) {
+	f := &messages.ErrorFormat{
+		Code:      messages.ErrorCode_ERROR_CODE_NOT_LEADER,
+		Message:   "not the leader",
+		Retriable: true,
+		Leader:    "127.0.0.1:4000",
+	}
+	err := FromProto(f)
+	if err.Error() != "not the leader, leader 127.0.0.1:4000" {
+		t.Errorf("error %q", err)
+	}
+
+	got := ToProto(errors.Wrap(err, "push"))
+	if got.Code != f.Code || !got.Retriable || got.Leader != f.Leader {
+		t.Errorf("ToProto = %v, want the code, retriable and leader of %v", got, f)
+	}
+
+	if got := ToProto(errors.New("plain")); got.Code != messages.ErrorCode_ERROR_CODE_UNKNOWN || got.Message != "plain" {
+		t.Errorf("ToProto of a plain error = %v", got)
+	}
+}
+
+func TestIsRetriable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{FromProto(&messages.ErrorFormat{Code: messages.ErrorCode_ERROR_CODE_GOING_AWAY, Retriable: true}), true},
+		{errors.Wrap(FromProto(&messages.ErrorFormat{Code: messages.ErrorCode_ERROR_CODE_THROTTLED, Retriable: true}), "push"), true},
+		{FromProto(&messages.ErrorFormat{Code: messages.ErrorCode_ERROR_CODE_TOPIC_NOT_FOUND}), false},
+		{ErrThrottled, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsRetriable(tt.err); got != tt.want {
+			t.Errorf("IsRetriable(%v) = %t, want %t", tt.err, got, tt.want)
+		}
+	}
+}
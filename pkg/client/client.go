@@ -0,0 +1,176 @@
+// Package client is the broker client safe for concurrent use: it owns a pool
+// of multiplexed connections shared by the producers and consumers it hands out.
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/pkg/admin"
+	"github.com/baibikov/jellyfish/pkg/mux"
+	"github.com/baibikov/jellyfish/pkg/producer"
+)
+
+// Defaults of the pool.
+const (
+	DefaultPoolSize            = 4
+	DefaultIdleTimeout         = 5 * time.Minute
+	DefaultHealthCheckInterval = 30 * time.Second
+)
+
+// ErrClosed is returned by the requests of a closed client.
+var ErrClosed = errors.New("client closed")
+
+type Config struct {
+	Addr string
+	// ClientID names the client to the broker, it is shown by the admin clients.
+	ClientID string
+	// Acks of the pushed messages, AcksAll by default.
+	Acks producer.Acks
+	// PoolSize is the most connections, DefaultPoolSize when zero. A new connection
+	// is dialed while every open one has requests in flight.
+	PoolSize int
+	// IdleTimeout closes a connection without requests in flight for the
+	// duration, DefaultIdleTimeout when zero, negative never closes one.
+	IdleTimeout time.Duration
+	// HealthCheckInterval checks the idle connections by a heartbeat and closes
+	// the broken ones, DefaultHealthCheckInterval when zero, negative never checks.
+	HealthCheckInterval time.Duration
+	// PollInterval and FetchMax are the mux.Config settings of the subscriptions.
+	PollInterval time.Duration
+	FetchMax     int
+	// Dial connects to the broker, net.Dial by default.
+	Dial func(network, addr string) (net.Conn, error)
+}
+
+// Client is safe for concurrent use, the producers and consumers it
+// hands out share its connections.
+type Client struct {
+	config *Config
+	pool   *pool
+
+	done chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// New dials the first connection of the pool, so a broker not available fails at once.
+func New(ctx context.Context, config *Config) (*Client, error) {
+	if config == nil {
+		return nil, errors.New("config has not empty")
+	}
+
+	c := &Client{
+		config: config,
+		pool:   newPool(config),
+		done:   make(chan struct{}),
+	}
+
+	pc, err := c.pool.acquire(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "client: connect by addr %s", config.Addr)
+	}
+	c.pool.release(pc)
+
+	interval := config.HealthCheckInterval
+	if interval == 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	if interval > 0 {
+		c.wg.Add(1)
+		go c.check(interval)
+	}
+
+	return c, nil
+}
+
+// Close closes the connections, the subscriptions end with mux.ErrClosed.
+func (c *Client) Close() error {
+	c.once.Do(func() {
+		close(c.done)
+	})
+	c.wg.Wait()
+
+	return errors.Wrap(c.pool.close(), "client close")
+}
+
+// check closes the idle and broken connections every interval.
+func (c *Client) check(interval time.Duration) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.pool.check(interval)
+		}
+	}
+}
+
+// Stats is the state of the pool.
+type Stats struct {
+	// Conns is the count of the open connections.
+	Conns int
+	// InFlight is the count of the requests and subscriptions in flight.
+	InFlight int
+}
+
+func (c *Client) Stats() Stats {
+	return c.pool.stats()
+}
+
+// Producer returns a producer pushing by the pool.
+func (c *Client) Producer() *Producer {
+	return &Producer{client: c}
+}
+
+// Consumer returns a consumer reading by the pool with the config.
+func (c *Client) Consumer(config ConsumerConfig) *Consumer {
+	return &Consumer{client: c, config: config}
+}
+
+// Topics describes the topics.
+func (c *Client) Topics(ctx context.Context) (topics []admin.Topic, err error) {
+	err = c.do(ctx, func(conn *mux.Conn) error {
+		topics, err = conn.Topics(ctx)
+		return err
+	})
+	return topics, err
+}
+
+func (c *Client) CreateTopic(ctx context.Context, name string, config admin.TopicConfig) error {
+	return c.do(ctx, func(conn *mux.Conn) error {
+		return conn.CreateTopic(ctx, name, config)
+	})
+}
+
+func (c *Client) DeleteTopic(ctx context.Context, name string) error {
+	return c.do(ctx, func(conn *mux.Conn) error {
+		return conn.DeleteTopic(ctx, name)
+	})
+}
+
+// do runs the request on a connection of the pool.
+func (c *Client) do(ctx context.Context, request func(conn *mux.Conn) error) error {
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+
+	pc, err := c.pool.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.pool.release(pc)
+
+	return request(pc.conn)
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/baibikov/jellyfish/pkg/consumer"
+	"github.com/baibikov/jellyfish/pkg/mux"
+)
+
+// ConsumerConfig are the consumer.Config settings of the subscriptions.
+type ConsumerConfig struct {
+	Group           string
+	Offset          *int64
+	Since           time.Time
+	Filter          string
+	Snapshot        bool
+	ReadCommitted   bool
+	ResumeCommitted bool
+}
+
+// Consumer reads by the client pool, every ConsumeTopics holds a connection
+// shared with the other requests until its context is done.
+type Consumer struct {
+	client *Client
+	config ConsumerConfig
+}
+
+// ConsumeTopics reads the topics or patterns in turn as consumer.Consumer does,
+// the error is delivered as the last payload.
+func (c *Consumer) ConsumeTopics(ctx context.Context, topics ...string) <-chan consumer.Payload {
+	payloads := make(chan consumer.Payload)
+	go func() {
+		defer close(payloads)
+
+		err := c.client.do(ctx, func(conn *mux.Conn) error {
+			for p := range conn.Subscribe(ctx, c.subscription(topics)) {
+				select {
+				case payloads <- p:
+				case <-ctx.Done():
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			select {
+			case payloads <- consumer.ErrPayload(err):
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return payloads
+}
+
+func (c *Consumer) subscription(topics []string) mux.Subscription {
+	return mux.Subscription{
+		Topics:          topics,
+		Group:           c.config.Group,
+		Offset:          c.config.Offset,
+		Since:           c.config.Since,
+		Filter:          c.config.Filter,
+		Snapshot:        c.config.Snapshot,
+		ReadCommitted:   c.config.ReadCommitted,
+		ResumeCommitted: c.config.ResumeCommitted,
+	}
+}
@@ -0,0 +1,274 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/multierr"
+
+	"github.com/baibikov/jellyfish/pkg/mux"
+)
+
+// pooled is a connection of the pool.
+type pooled struct {
+	conn *mux.Conn
+	// inFlight is the count of the requests using the connection.
+	inFlight int
+	// idleSince is the time the last request released the connection.
+	idleSince time.Time
+	// retired is removed from the pool, it is closed once released.
+	retired bool
+}
+
+// usable reports whether the connection takes new requests.
+func (pc *pooled) usable() bool {
+	select {
+	case <-pc.conn.Done():
+		return false
+	default:
+		return !pc.conn.GoingAway()
+	}
+}
+
+type pool struct {
+	config *Config
+	size   int
+
+	mutex sync.Mutex
+	conns []*pooled
+	// dialing is the semaphore of the dials in flight, a dial holds a slot.
+	dialing chan struct{}
+	// done is closed with the pool.
+	done   chan struct{}
+	closed bool
+}
+
+func newPool(config *Config) *pool {
+	size := config.PoolSize
+	if size <= 0 {
+		size = DefaultPoolSize
+	}
+
+	return &pool{
+		config:  config,
+		size:    size,
+		dialing: make(chan struct{}, size),
+		done:    make(chan struct{}),
+	}
+}
+
+// acquire returns the open connection with the fewest requests in flight,
+// a new one is dialed while every open one is used and the pool is not full.
+// Waiting for the dials in flight ends with ctx.
+func (p *pool) acquire(ctx context.Context) (*pooled, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for {
+		if p.closed {
+			return nil, ErrClosed
+		}
+
+		p.retireUnusable()
+
+		var best *pooled
+		for _, pc := range p.conns {
+			if best == nil || pc.inFlight < best.inFlight {
+				best = pc
+			}
+		}
+		full := len(p.conns)+len(p.dialing) >= p.size
+		if best != nil && (best.inFlight == 0 || full) {
+			best.inFlight++
+			return best, nil
+		}
+		if full {
+			// every slot is being dialed
+			p.mutex.Unlock()
+			err := p.waitDial(ctx)
+			p.mutex.Lock()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		return p.dial(ctx)
+	}
+}
+
+// waitDial waits until a dial in flight ends, the semaphore slot
+// taken to learn it is given back at once.
+func (p *pool) waitDial(ctx context.Context) error {
+	select {
+	case p.dialing <- struct{}{}:
+		<-p.dialing
+		return nil
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// dial opens a connection in flight, the mutex is released while dialing.
+func (p *pool) dial(ctx context.Context) (*pooled, error) {
+	p.dialing <- struct{}{}
+	p.mutex.Unlock()
+
+	conn, err := mux.Dial(ctx, &mux.Config{
+		Addr:         p.config.Addr,
+		ClientID:     p.config.ClientID,
+		Acks:         p.config.Acks,
+		PollInterval: p.config.PollInterval,
+		FetchMax:     p.config.FetchMax,
+		Dial:         p.config.Dial,
+	})
+
+	p.mutex.Lock()
+	<-p.dialing
+	if err != nil {
+		return nil, err
+	}
+	if p.closed {
+		conn.Close()
+		return nil, ErrClosed
+	}
+
+	pc := &pooled{conn: conn, inFlight: 1}
+	p.conns = append(p.conns, pc)
+	return pc, nil
+}
+
+// release ends a request of the connection.
+func (p *pool) release(pc *pooled) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	pc.inFlight--
+	if pc.inFlight == 0 {
+		pc.idleSince = time.Now()
+		if pc.retired {
+			p.closeConn(pc)
+		}
+	}
+}
+
+// retireUnusable removes the broken and going away connections,
+// the used ones are closed once released.
+func (p *pool) retireUnusable() {
+	conns := p.conns[:0]
+	for _, pc := range p.conns {
+		if pc.usable() {
+			conns = append(conns, pc)
+			continue
+		}
+		p.retire(pc)
+	}
+	p.conns = conns
+}
+
+// retire marks the connection removed from the pool, it is closed when not used.
+func (p *pool) retire(pc *pooled) {
+	pc.retired = true
+	if pc.inFlight == 0 {
+		p.closeConn(pc)
+	}
+}
+
+func (p *pool) closeConn(pc *pooled) {
+	if err := pc.conn.Close(); err != nil {
+		logrus.Debug("client: ", err)
+	}
+}
+
+// check closes the connections idle longer than the idle timeout and
+// the idle ones not answering the heartbeat within the timeout.
+func (p *pool) check(timeout time.Duration) {
+	idleTimeout := p.config.IdleTimeout
+	if idleTimeout == 0 {
+		idleTimeout = DefaultIdleTimeout
+	}
+
+	p.mutex.Lock()
+	p.retireUnusable()
+
+	var idle []*pooled
+	conns := p.conns[:0]
+	for _, pc := range p.conns {
+		switch {
+		case pc.inFlight != 0:
+			conns = append(conns, pc)
+		case idleTimeout > 0 && time.Since(pc.idleSince) > idleTimeout:
+			p.retire(pc)
+		default:
+			// the heartbeat is a request in flight, the connection is not closed meanwhile
+			pc.inFlight++
+			idle = append(idle, pc)
+			conns = append(conns, pc)
+		}
+	}
+	p.conns = conns
+	p.mutex.Unlock()
+
+	for _, pc := range idle {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := pc.conn.Ping(ctx)
+		cancel()
+
+		p.mutex.Lock()
+		if err != nil {
+			logrus.Info("client: close connection: ", err)
+			p.remove(pc)
+		}
+		// the heartbeat does not make the connection used
+		pc.inFlight--
+		if pc.inFlight == 0 && pc.retired {
+			p.closeConn(pc)
+		}
+		p.mutex.Unlock()
+	}
+}
+
+// remove retires the connection if it is in the pool.
+func (p *pool) remove(pc *pooled) {
+	for i, c := range p.conns {
+		if c == pc {
+			p.conns = append(p.conns[:i], p.conns[i+1:]...)
+			pc.retired = true
+			return
+		}
+	}
+}
+
+func (p *pool) stats() Stats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	s := Stats{Conns: len(p.conns)}
+	for _, pc := range p.conns {
+		s.InFlight += pc.inFlight
+	}
+	return s
+}
+
+// close closes every connection, the requests in flight fail.
+func (p *pool) close() (err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+	for _, pc := range p.conns {
+		pc.retired = true
+		multierr.AppendInto(&err, pc.conn.Close())
+	}
+	p.conns = nil
+
+	return err
+}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/pkg/jellyfishtest"
+	"github.com/baibikov/jellyfish/pkg/producer"
+)
+
+// blockedDial dials the server once unblocked.
+func blockedDial(s *jellyfishtest.Server, unblock <-chan struct{}) func(network, addr string) (net.Conn, error) {
+	return func(network, addr string) (net.Conn, error) {
+		<-unblock
+		return s.Dial(network, addr)
+	}
+}
+
+func TestPoolDialsWhileUsed(t *testing.T) {
+	s := jellyfishtest.NewServer(t)
+	p := newPool(&Config{Addr: s.Addr, Dial: s.Dial, PoolSize: 2})
+	defer p.close()
+
+	ctx := context.Background()
+	first, err := p.acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := p.acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatal("used connection acquired while the pool is not full")
+	}
+
+	// the full pool shares the connection with the fewest requests
+	p.release(first)
+	third, err := p.acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third != first {
+		t.Fatal("acquired the busier connection")
+	}
+	if stats := p.stats(); stats.Conns != 2 || stats.InFlight != 2 {
+		t.Fatalf("stats %+v, want 2 connections with 2 requests", stats)
+	}
+}
+
+func TestAcquireWaitEndsWithContext(t *testing.T) {
+	s := jellyfishtest.NewServer(t)
+	unblock := make(chan struct{})
+	p := newPool(&Config{Addr: s.Addr, Dial: blockedDial(s, unblock), PoolSize: 1})
+	defer p.close()
+
+	dialed := make(chan error, 1)
+	go func() {
+		pc, err := p.acquire(context.Background())
+		if err == nil {
+			p.release(pc)
+		}
+		dialed <- err
+	}()
+	for p.stats().Conns == 0 && len(p.dialing) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the only slot is being dialed
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if _, err := p.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire = %v, want the context deadline", err)
+	}
+
+	close(unblock)
+	if err := <-dialed; err != nil {
+		t.Fatal(err)
+	}
+	pc, err := p.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.release(pc)
+}
+
+func TestAcquireWaitEndsWithClose(t *testing.T) {
+	s := jellyfishtest.NewServer(t)
+	unblock := make(chan struct{})
+	defer close(unblock)
+	p := newPool(&Config{Addr: s.Addr, Dial: blockedDial(s, unblock), PoolSize: 1})
+
+	go func() { _, _ = p.acquire(context.Background()) }()
+	for len(p.dialing) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	waited := make(chan error, 1)
+	go func() {
+		_, err := p.acquire(context.Background())
+		waited <- err
+	}()
+	time.Sleep(time.Millisecond * 10)
+
+	if err := p.close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-waited; !errors.Is(err, ErrClosed) {
+		t.Fatalf("acquire = %v, want ErrClosed", err)
+	}
+	if err := p.close(); err != nil {
+		t.Fatalf("second close: %v", err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	s := jellyfishtest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c, err := New(ctx, &Config{Addr: s.Addr, Dial: s.Dial, PollInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Producer().PushBatch(ctx, []*producer.Params{
+		{Topic: "orders", Message: []byte("created")},
+		{Topic: "orders", Message: []byte("paid")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	payloads := c.Consumer(ConsumerConfig{Group: "billing"}).ConsumeTopics(ctx, "orders")
+	for _, want := range []string{"created", "paid"} {
+		if p := <-payloads; p.Err() != nil || string(p.Message) != want {
+			t.Fatalf("consumed %q, %v, want %s", p.Message, p.Err(), want)
+		}
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Producer().Push(ctx, &producer.Params{Topic: "orders"}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("push after close = %v, want ErrClosed", err)
+	}
+}
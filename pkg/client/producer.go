@@ -0,0 +1,33 @@
+package client
+
+import (
+	"context"
+
+	"github.com/baibikov/jellyfish/pkg/mux"
+	"github.com/baibikov/jellyfish/pkg/producer"
+)
+
+// Producer pushes by the client pool, it is safe for concurrent use.
+type Producer struct {
+	client *Client
+}
+
+func (p *Producer) Push(ctx context.Context, params *producer.Params) error {
+	if params == nil {
+		return nil
+	}
+
+	return p.PushBatch(ctx, []*producer.Params{params})
+}
+
+// PushBatch sends every message before waiting for the acknowledgements,
+// the messages are written in order by one connection.
+func (p *Producer) PushBatch(ctx context.Context, batch []*producer.Params) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	return p.client.do(ctx, func(conn *mux.Conn) error {
+		return conn.Publish(ctx, batch...)
+	})
+}
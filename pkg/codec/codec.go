@@ -0,0 +1,125 @@
+// Package codec encodes the typed messages of producer.Typed and consumer.Typed,
+// the codec name is sent in the HeaderContentType header so a consumer of
+// another codec fails with ErrContentType instead of decoding garbage.
+package codec
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// HeaderContentType carries the name of the codec the message was encoded with.
+const HeaderContentType = "jellyfish-content-type"
+
+// ErrContentType is returned for a message encoded with another codec.
+var ErrContentType = errors.New("content type mismatch")
+
+// Codec marshals the values of a type, Unmarshal takes a pointer to the value.
+type Codec interface {
+	// Name is the content type of the encoded messages.
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// Built-in codecs.
+var (
+	JSON    Codec = jsonCodec{}
+	Proto   Codec = protoCodec{}
+	Msgpack Codec = msgpackCodec{}
+	// Raw passes []byte and string values as is.
+	Raw Codec = rawCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "application/json" }
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	bb, err := json.Marshal(v)
+	return bb, errors.Wrap(err, "json-marshal")
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return errors.Wrap(json.Unmarshal(data, v), "json-unmarshal")
+}
+
+type protoCodec struct{}
+
+func (protoCodec) Name() string { return "application/protobuf" }
+
+func (protoCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, errors.Errorf("proto-marshal: %T is not a proto message", v)
+	}
+
+	bb, err := proto.Marshal(m)
+	return bb, errors.Wrap(err, "proto-marshal")
+}
+
+// Unmarshal takes a proto message or a pointer to a message pointer,
+// the nil message is allocated.
+func (protoCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		ptr := reflect.ValueOf(v)
+		if ptr.Kind() != reflect.Pointer || ptr.IsNil() || ptr.Elem().Kind() != reflect.Pointer {
+			return errors.Errorf("proto-unmarshal: %T is not a proto message", v)
+		}
+		elem := ptr.Elem()
+		if elem.IsNil() {
+			elem.Set(reflect.New(elem.Type().Elem()))
+		}
+		if m, ok = elem.Interface().(proto.Message); !ok {
+			return errors.Errorf("proto-unmarshal: %T is not a proto message", v)
+		}
+	}
+
+	return errors.Wrap(proto.Unmarshal(data, m), "proto-unmarshal")
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "application/msgpack" }
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	bb, err := msgpack.Marshal(v)
+	return bb, errors.Wrap(err, "msgpack-marshal")
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	return errors.Wrap(msgpack.Unmarshal(data, v), "msgpack-unmarshal")
+}
+
+type rawCodec struct{}
+
+func (rawCodec) Name() string { return "application/octet-stream" }
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	default:
+		return nil, errors.Errorf("raw-marshal: %T is not []byte or string", v)
+	}
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	switch v := v.(type) {
+	case *[]byte:
+		*v = data
+	case *string:
+		*v = string(data)
+	default:
+		return errors.Errorf("raw-unmarshal: %T is not *[]byte or *string", v)
+	}
+
+	return nil
+}
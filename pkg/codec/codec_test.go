@@ -0,0 +1,90 @@
+package codec
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/baibikov/jellyfish/protogenerated/messages"
+)
+
+type order struct {
+	ID    string `json:"id" msgpack:"id"`
+	Items int    `json:"items" msgpack:"items"`
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, c := range []Codec{JSON, Msgpack} {
+		data, err := c.Marshal(order{ID: "1", Items: 2})
+		if err != nil {
+			t.Fatalf("%s: %v", c.Name(), err)
+		}
+		var got order
+		if err := c.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%s: %v", c.Name(), err)
+		}
+		if got != (order{ID: "1", Items: 2}) {
+			t.Errorf("%s: decoded %+v", c.Name(), got)
+		}
+	}
+}
+
+func TestProto(t *testing.T) {
+	data, err := Proto.Marshal(&messages.Ping{ClientId: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a message or a pointer to a nil message pointer
+	m := &messages.Ping{}
+	if err := Proto.Unmarshal(data, m); err != nil || m.ClientId != "c" {
+		t.Fatalf("unmarshal into a message: %v, %v", m, err)
+	}
+	var ptr *messages.Ping
+	if err := Proto.Unmarshal(data, &ptr); err != nil || ptr.GetClientId() != "c" {
+		t.Fatalf("unmarshal into a nil message pointer: %v, %v", ptr, err)
+	}
+
+	if _, err := Proto.Marshal(order{}); err == nil {
+		t.Error("marshal of a struct succeeded")
+	}
+	var o order
+	if err := Proto.Unmarshal(data, &o); err == nil {
+		t.Error("unmarshal into a struct succeeded")
+	}
+}
+
+func TestRaw(t *testing.T) {
+	for _, v := range []any{[]byte("order"), "order"} {
+		data, err := Raw.Marshal(v)
+		if err != nil || string(data) != "order" {
+			t.Fatalf("marshal %T: %q, %v", v, data, err)
+		}
+	}
+
+	var b []byte
+	var s string
+	if err := Raw.Unmarshal([]byte("order"), &b); err != nil || string(b) != "order" {
+		t.Fatalf("unmarshal into bytes: %q, %v", b, err)
+	}
+	if err := Raw.Unmarshal([]byte("order"), &s); err != nil || s != "order" {
+		t.Fatalf("unmarshal into a string: %q, %v", s, err)
+	}
+
+	if _, err := Raw.Marshal(1); err == nil {
+		t.Error("marshal of an int succeeded")
+	}
+	var i int
+	if err := Raw.Unmarshal([]byte("1"), &i); err == nil {
+		t.Error("unmarshal into an int succeeded")
+	}
+}
+
+func TestNames(t *testing.T) {
+	names := make(map[string]Codec)
+	for _, c := range []Codec{JSON, Proto, Msgpack, Raw} {
+		if other, ok := names[c.Name()]; ok {
+			t.Errorf("%s is the name of %s and %s", c.Name(), reflect.TypeOf(c), reflect.TypeOf(other))
+		}
+		names[c.Name()] = c
+	}
+}
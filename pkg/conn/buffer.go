@@ -0,0 +1,38 @@
+package conn
+
+import "sync"
+
+// Frame buffers are pooled, a frame is marshaled into or read into a pooled
+// buffer and the buffer is reused once the frame is written or unmarshaled.
+const (
+	// defaultBufferSize fits the most frames without growing.
+	defaultBufferSize = 4 << 10
+	// maxPooledBufferSize keeps a rare big frame from pinning its memory in the pool.
+	maxPooledBufferSize = 1 << 20
+)
+
+var buffers = sync.Pool{
+	New: func() any {
+		bb := make([]byte, 0, defaultBufferSize)
+		return &bb
+	},
+}
+
+// getBuffer returns an empty pooled buffer with at least size capacity.
+func getBuffer(size int) *[]byte {
+	bb := buffers.Get().(*[]byte)
+	if cap(*bb) < size {
+		*bb = make([]byte, 0, size)
+	}
+
+	*bb = (*bb)[:0]
+	return bb
+}
+
+func putBuffer(bb *[]byte) {
+	if cap(*bb) > maxPooledBufferSize {
+		return
+	}
+
+	buffers.Put(bb)
+}
@@ -1,10 +1,14 @@
 package conn
 
 import (
+	"encoding/binary"
+	"io"
 	"net"
 
 	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 type Conn struct {
@@ -17,27 +21,273 @@ func New(c net.Conn) *Conn {
 	}
 }
 
-const maxMessageSize = 512
+// FramedVersion is the protocol version of the length-prefixed frames,
+// the peers of version 1 wrote bare protobuf messages and are not understood.
+const FramedVersion = 2
 
+// ErrUnframed is returned by ReadHandshake for a peer of version 1.
+var ErrUnframed = errors.New("unframed message")
+
+// Every message on the wire is a frame prefixed by the body length
+// encoded as 4 bytes big endian.
+const frameHeaderSize = 4
+
+// MaxFrameSize limits a frame body, bigger frames are rejected before reading.
+const MaxFrameSize = 16 << 20
+
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// WriteProto marshals the message into a pooled buffer after the frame header
+// and writes the frame at once.
 func (c Conn) WriteProto(m proto.Message) error {
-	bb, err := proto.Marshal(m)
+	return c.WriteProtos(m)
+}
+
+// WriteProtos writes the messages as consecutive frames in one write.
+func (c Conn) WriteProtos(mm ...proto.Message) error {
+	bb := getBuffer(defaultBufferSize)
+	defer putBuffer(bb)
+
+	for _, m := range mm {
+		start := len(*bb)
+		frame, err := marshalOptions.MarshalAppend(append(*bb, 0, 0, 0, 0), m)
+		if err != nil {
+			return errors.Wrap(err, "proto-marshal message")
+		}
+		*bb = frame
+
+		size := len(frame) - start - frameHeaderSize
+		if size > MaxFrameSize {
+			return errors.Wrapf(ErrFrameTooLarge, "write frame of %d bytes", size)
+		}
+		binary.BigEndian.PutUint32(frame[start:], uint32(size))
+	}
+
+	_, err := c.Write(*bb)
+	return errors.Wrap(err, "write to connection")
+}
+
+var marshalOptions = proto.MarshalOptions{}
+
+// vectoredSize is the bytes field size WriteProtoBytes writes without copying,
+// a smaller field is cheaper to copy than to write as a separate buffer.
+const vectoredSize = 4 << 10
+
+// WriteProtoBytes writes the message with the bytes field of the number set to
+// value, the field of m has to be empty. A big value is not copied into the frame
+// but written from its own memory with one vectored write.
+func (c Conn) WriteProtoBytes(m proto.Message, field protowire.Number, value []byte) error {
+	bb := getBuffer(defaultBufferSize)
+	defer putBuffer(bb)
+
+	frame, err := marshalOptions.MarshalAppend(append(*bb, 0, 0, 0, 0), m)
 	if err != nil {
 		return errors.Wrap(err, "proto-marshal message")
 	}
+	if len(value) != 0 {
+		frame = protowire.AppendTag(frame, field, protowire.BytesType)
+		frame = protowire.AppendVarint(frame, uint64(len(value)))
+	}
+	*bb = frame
+
+	size := len(frame) - frameHeaderSize + len(value)
+	if size > MaxFrameSize {
+		return errors.Wrapf(ErrFrameTooLarge, "write frame of %d bytes", size)
+	}
+	binary.BigEndian.PutUint32(frame, uint32(size))
+
+	if len(value) < vectoredSize {
+		*bb = append(frame, value...)
+		_, err = c.Write(*bb)
+		return errors.Wrap(err, "write to connection")
+	}
 
-	_, err = c.Write(bb)
+	buffers := net.Buffers{frame, value}
+	_, err = buffers.WriteTo(c.Conn)
 	return errors.Wrap(err, "write to connection")
 }
 
+// WriteFrame writes the header and the body with one vectored write,
+// the body is not copied.
+func (c Conn) WriteFrame(body []byte) error {
+	if len(body) > MaxFrameSize {
+		return errors.Wrapf(ErrFrameTooLarge, "write frame of %d bytes", len(body))
+	}
+
+	header := getBuffer(frameHeaderSize)
+	defer putBuffer(header)
+	*header = binary.BigEndian.AppendUint32(*header, uint32(len(body)))
+	if len(body) == 0 {
+		// an empty write still waits for the peer to read on a synchronous
+		// transport as net.Pipe, the peer reading only the header never does
+		_, err := c.Write(*header)
+		return errors.Wrap(err, "write to connection")
+	}
+
+	buffers := net.Buffers{*header, body}
+	_, err := buffers.WriteTo(c.Conn)
+	return errors.Wrap(err, "write to connection")
+}
+
+// DiscardFrame reads the frame skipping its body.
+func (c Conn) DiscardFrame() error {
+	size, err := c.readHeader()
+	if err != nil || size == 0 {
+		return err
+	}
+
+	_, err = io.CopyN(io.Discard, c.Conn, int64(size))
+	return errors.Wrap(err, "discard frame body from connection")
+}
+
+// ReadFrame reads the frame body into a new slice owned by the caller.
+func (c Conn) ReadFrame() ([]byte, error) {
+	size, err := c.readHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(c.Conn, body); err != nil {
+		return nil, errors.Wrap(err, "read frame body from connection")
+	}
+
+	return body, nil
+}
+
+func (c Conn) readHeader() (int, error) {
+	header := getBuffer(frameHeaderSize)
+	defer putBuffer(header)
+
+	*header = (*header)[:frameHeaderSize]
+	if _, err := io.ReadFull(c.Conn, *header); err != nil {
+		return 0, errors.Wrap(err, "read frame header from connection")
+	}
+
+	return frameSize(*header)
+}
+
+func frameSize(header []byte) (int, error) {
+	size := binary.BigEndian.Uint32(header)
+	if size > MaxFrameSize {
+		return 0, errors.Wrapf(ErrFrameTooLarge, "read frame of %d bytes", size)
+	}
+
+	return int(size), nil
+}
+
+// ReadHandshake reads the first message of the peer as ReadProto. The first
+// byte of a frame is zero as the frames are limited by MaxFrameSize, a bare
+// protobuf message of version 1 starts with a field tag, it is not read
+// further and ErrUnframed is returned.
+func (c Conn) ReadHandshake(m proto.Message) error {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(c.Conn, header[:1]); err != nil {
+		return errors.Wrap(err, "read frame header from connection")
+	}
+	if header[0] != 0 {
+		return errors.Wrapf(ErrUnframed, "message starts with %#x", header[0])
+	}
+	if _, err := io.ReadFull(c.Conn, header[1:]); err != nil {
+		return errors.Wrap(err, "read frame header from connection")
+	}
+
+	size, err := frameSize(header[:])
+	if err != nil {
+		return err
+	}
+
+	return c.readBody(size, m)
+}
+
+// WriteUnframed writes the bare message as the peers of version 1 read it,
+// only to answer them.
+func (c Conn) WriteUnframed(m proto.Message) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return errors.Wrap(err, "proto-marshal message")
+	}
+
+	_, err = c.Write(b)
+	return errors.Wrap(err, "write to connection")
+}
+
+// ReadProto reads the frame into a pooled buffer, the unmarshaled message
+// copies the bytes fields so the buffer is reused at once. Only the frame body
+// allocation is saved, the bytes fields are allocated by the unmarshal.
 func (c Conn) ReadProto(m proto.Message) error {
-	bb := make([]byte, maxMessageSize)
-	n, err := c.Read(bb)
+	size, err := c.readHeader()
+	if err != nil {
+		return err
+	}
+
+	return c.readBody(size, m)
+}
+
+// ReadProtoBytes reads the frame into memory owned by m, the bytes field of
+// the number aliases the frame instead of being copied by the unmarshal.
+// A caller keeping the field keeps the whole frame, it is the reader of
+// the payloads stored as they were read.
+func (c Conn) ReadProtoBytes(m proto.Message, field protowire.Number) error {
+	body, err := c.ReadFrame()
 	if err != nil {
-		return errors.Wrap(err, "read from connection")
+		return err
+	}
+
+	fd := m.ProtoReflect().Descriptor().Fields().ByNumber(field)
+	if fd == nil || fd.Kind() != protoreflect.BytesKind || fd.IsList() {
+		return errors.Errorf("field %d of %s is not bytes", field, m.ProtoReflect().Descriptor().FullName())
 	}
-	if n == 0 {
-		return errors.New("undefined message from broker")
+
+	// the other fields are unmarshaled around the occurrences of the field,
+	// the last occurrence wins as with the unmarshal
+	var value []byte
+	start := 0
+	for offset := 0; offset < len(body); {
+		num, typ, n := protowire.ConsumeTag(body[offset:])
+		if n < 0 {
+			return errors.Wrap(protowire.ParseError(n), "proto-unmarshal message")
+		}
+		if num != field || typ != protowire.BytesType {
+			size := protowire.ConsumeFieldValue(num, typ, body[offset+n:])
+			if size < 0 {
+				return errors.Wrap(protowire.ParseError(size), "proto-unmarshal message")
+			}
+			offset += n + size
+			continue
+		}
+
+		v, size := protowire.ConsumeBytes(body[offset+n:])
+		if size < 0 {
+			return errors.Wrap(protowire.ParseError(size), "proto-unmarshal message")
+		}
+		if err := mergeOptions.Unmarshal(body[start:offset], m); err != nil {
+			return errors.Wrap(err, "proto-unmarshal message")
+		}
+		value = v
+		offset += n + size
+		start = offset
+	}
+	if err := mergeOptions.Unmarshal(body[start:], m); err != nil {
+		return errors.Wrap(err, "proto-unmarshal message")
+	}
+
+	if value != nil {
+		m.ProtoReflect().Set(fd, protoreflect.ValueOfBytes(value))
+	}
+	return nil
+}
+
+var mergeOptions = proto.UnmarshalOptions{Merge: true}
+
+func (c Conn) readBody(size int, m proto.Message) error {
+	bb := getBuffer(size)
+	defer putBuffer(bb)
+
+	*bb = (*bb)[:size]
+	if _, err := io.ReadFull(c.Conn, *bb); err != nil {
+		return errors.Wrap(err, "read frame body from connection")
 	}
 
-	return errors.Wrap(proto.Unmarshal(bb[:n], m), "proto-unmarshal message")
+	return errors.Wrap(proto.Unmarshal(*bb, m), "proto-unmarshal message")
 }
@@ -0,0 +1,356 @@
+package conn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/baibikov/jellyfish/protogenerated/messages"
+)
+
+// pipe returns the connected ends, the writes are read asynchronously.
+func pipe(t *testing.T) (*Conn, *Conn) {
+	t.Helper()
+
+	a, b := net.Pipe()
+	t.Cleanup(func() {
+		_ = a.Close()
+		_ = b.Close()
+	})
+
+	return New(a), New(b)
+}
+
+// async runs the write concurrently with the read of the test,
+// net.Pipe writes block until read.
+func async(t *testing.T, write func() error) {
+	t.Helper()
+
+	done := make(chan error, 1)
+	go func() { done <- write() }()
+	t.Cleanup(func() {
+		if err := <-done; err != nil {
+			t.Errorf("write: %v", err)
+		}
+	})
+}
+
+func TestWriteProtosFrames(t *testing.T) {
+	w, r := pipe(t)
+
+	async(t, func() error {
+		return w.WriteProtos(
+			&messages.ProducerPayload{Topic: "orders", Message: []byte("created")},
+			&messages.ProducerPayload{Topic: "orders", Message: []byte("paid")},
+		)
+	})
+
+	for _, want := range []string{"created", "paid"} {
+		got := &messages.ProducerPayload{}
+		if err := r.ReadProto(got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Topic != "orders" || string(got.Message) != want {
+			t.Fatalf("read %v, want message %s", got, want)
+		}
+	}
+}
+
+func TestWriteProtoBytes(t *testing.T) {
+	field := (&messages.ConsumerResponse{}).ProtoReflect().Descriptor().Fields().ByName("message").Number()
+
+	for _, size := range []int{0, 16, vectoredSize, vectoredSize * 4} {
+		w, r := pipe(t)
+
+		value := bytes.Repeat([]byte{'x'}, size)
+		async(t, func() error {
+			return w.WriteProtoBytes(&messages.ConsumerResponse{Topic: "orders", Offset: 7}, field, value)
+		})
+
+		body, err := r.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the frame is the message marshaled with the field set
+		want, err := proto.Marshal(&messages.ConsumerResponse{Topic: "orders", Offset: 7, Message: value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := &messages.ConsumerResponse{}
+		if err := proto.Unmarshal(body, got); err != nil {
+			t.Fatal(err)
+		}
+		if len(body) != len(want) || !bytes.Equal(got.Message, value) || got.Offset != 7 {
+			t.Fatalf("value of %d bytes: frame of %d bytes, want %d", size, len(body), len(want))
+		}
+	}
+}
+
+// bodyConn remembers the buffer the frame body was read into.
+type bodyConn struct {
+	net.Conn
+	reader *bytes.Reader
+	body   []byte
+}
+
+func (c *bodyConn) Read(b []byte) (int, error) {
+	if len(b) > frameHeaderSize {
+		c.body = b
+	}
+	return c.reader.Read(b)
+}
+
+func TestReadProtoBytes(t *testing.T) {
+	field := (&messages.ProducerPayload{}).ProtoReflect().Descriptor().Fields().ByName("message").Number()
+
+	first := &messages.ProducerPayload{Topic: "orders", Message: []byte("stale"), Headers: map[string]string{"a": "1"}}
+	body, err := proto.Marshal(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the field repeated after the other fields, the last one wins
+	body = protowire.AppendTag(body, field, protowire.BytesType)
+	body = protowire.AppendBytes(body, []byte("created"))
+	body = protowire.AppendTag(body, 1, protowire.BytesType)
+	body = protowire.AppendString(body, "payments")
+
+	want := &messages.ProducerPayload{}
+	if err := proto.Unmarshal(body, want); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &bodyConn{reader: bytes.NewReader(append(binary.BigEndian.AppendUint32(nil, uint32(len(body))), body...))}
+	got := &messages.ProducerPayload{}
+	if err := New(c).ReadProtoBytes(got, field); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(got, want) || string(got.Message) != "created" || got.Topic != "payments" {
+		t.Fatalf("read %v, want %v", got, want)
+	}
+
+	// the field aliases the frame
+	start := uintptr(unsafe.Pointer(&c.body[0]))
+	if p := uintptr(unsafe.Pointer(&got.Message[0])); p < start || p >= start+uintptr(len(c.body)) {
+		t.Fatal("the field is copied out of the frame")
+	}
+
+	c.reader.Reset(append(binary.BigEndian.AppendUint32(nil, uint32(len(body))), body...))
+	if err := New(c).ReadProtoBytes(&messages.ProducerPayload{}, 1); err == nil {
+		t.Fatal("read into a string field")
+	}
+}
+
+func TestDiscardFrame(t *testing.T) {
+	w, r := pipe(t)
+
+	async(t, func() error {
+		if err := w.WriteFrame(nil); err != nil {
+			return err
+		}
+		if err := w.WriteFrame([]byte("skipped")); err != nil {
+			return err
+		}
+		return w.WriteProto(&messages.Ping{Ping: 1})
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := r.DiscardFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := &messages.Ping{}
+	if err := r.ReadProto(got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Ping != 1 {
+		t.Fatalf("read %v after the discarded frames", got)
+	}
+}
+
+func TestReadHandshake(t *testing.T) {
+	w, r := pipe(t)
+	async(t, func() error {
+		return w.WriteProto(&messages.Ping{Ping: 1, Version: 3})
+	})
+
+	got := &messages.Ping{}
+	if err := r.ReadHandshake(got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Ping != 1 || got.Version != 3 {
+		t.Fatalf("read %v", got)
+	}
+
+	// a bare message of version 1 is not read further than its first byte
+	w, r = pipe(t)
+	async(t, func() error {
+		return w.WriteUnframed(&messages.Ping{Ping: 1})
+	})
+	if err := r.ReadHandshake(got); !errors.Is(err, ErrUnframed) {
+		t.Fatalf("read of a bare message: %v, want ErrUnframed", err)
+	}
+	b := make([]byte, 8)
+	if n, err := r.Read(b); err != nil || n != 1 {
+		t.Fatalf("read %d bytes after the first one, %v, want the rest of the bare message", n, err)
+	}
+}
+
+func TestFrameTooLarge(t *testing.T) {
+	w, r := pipe(t)
+
+	if err := w.WriteFrame(make([]byte, MaxFrameSize+1)); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("write = %v, want frame too large", err)
+	}
+
+	// the header is rejected before the body is read
+	async(t, func() error {
+		_, err := w.Write(binary.BigEndian.AppendUint32(nil, MaxFrameSize+1))
+		return err
+	})
+	if err := r.ReadProto(&messages.Ping{}); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("read = %v, want frame too large", err)
+	}
+}
+
+func TestWriteEmptyFrameAnswered(t *testing.T) {
+	w, r := pipe(t)
+
+	// the peer answers once it read the header of the empty frame
+	async(t, func() error {
+		if err := r.DiscardFrame(); err != nil {
+			return err
+		}
+		return r.WriteProto(&messages.Ping{Ping: 2})
+	})
+
+	if err := w.WriteFrame(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	got := &messages.Ping{}
+	if err := w.ReadProto(got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Ping != 2 {
+		t.Fatalf("answer = %v", got)
+	}
+}
+
+// discardConn drops the writes.
+type discardConn struct {
+	net.Conn
+}
+
+func (discardConn) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// replayConn reads the frame over and over.
+type replayConn struct {
+	net.Conn
+	frame  []byte
+	reader bytes.Reader
+}
+
+func (c *replayConn) Read(b []byte) (int, error) {
+	if c.reader.Len() == 0 {
+		c.reader.Reset(c.frame)
+	}
+	return c.reader.Read(b)
+}
+
+func BenchmarkWriteProtos(b *testing.B) {
+	c := New(discardConn{})
+	batch := make([]proto.Message, 10)
+	for i := range batch {
+		batch[i] = &messages.ProducerPayload{Topic: "orders", Message: make([]byte, 256)}
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := c.WriteProtos(batch...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWriteProtoBytes(b *testing.B) {
+	c := New(discardConn{})
+	field := (&messages.ConsumerResponse{}).ProtoReflect().Descriptor().Fields().ByName("message").Number()
+	for _, size := range []int{512, 64 << 10} {
+		payload := make([]byte, size)
+
+		b.Run(fmt.Sprintf("size=%d/marshaled", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				m := &messages.ConsumerResponse{Topic: "orders", Message: payload}
+				if err := c.WriteProto(m); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("size=%d/bytes", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				m := &messages.ConsumerResponse{Topic: "orders"}
+				if err := c.WriteProtoBytes(m, field, payload); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkReadProto(b *testing.B) {
+	for _, size := range []int{512, 64 << 10} {
+		body, err := proto.Marshal(&messages.ProducerPayload{Topic: "orders", Message: make([]byte, size)})
+		if err != nil {
+			b.Fatal(err)
+		}
+		c := New(&replayConn{frame: append(binary.BigEndian.AppendUint32(nil, uint32(len(body))), body...)})
+
+		b.Run(fmt.Sprintf("size=%d/frame", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				frame, err := c.ReadFrame()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := proto.Unmarshal(frame, &messages.ProducerPayload{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("size=%d/owned", size), func(b *testing.B) {
+			field := (&messages.ProducerPayload{}).ProtoReflect().Descriptor().Fields().ByName("message").Number()
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := c.ReadProtoBytes(&messages.ProducerPayload{}, field); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("size=%d/pooled", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := c.ReadProto(&messages.ProducerPayload{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -4,47 +4,92 @@ import (
 	"context"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
 
+	"github.com/baibikov/jellyfish/pkg/brokererr"
 	"github.com/baibikov/jellyfish/pkg/conn"
 	"github.com/baibikov/jellyfish/pkg/ping"
 	"github.com/baibikov/jellyfish/protogenerated/messages"
 )
 
 type Consumer struct {
-	conn   *conn.Conn
-	config *Config
-	closed bool
-	pinged bool
+	conn    *conn.Conn
+	config  *Config
+	session atomic.Pointer[ping.Session]
 
 	payload chan Payload
-	once    sync.Once
+	// done is closed by Close, the payload channel is closed
+	// by the consuming goroutine when it stops.
+	done chan struct{}
+	once sync.Once
 }
 
-func (c *Consumer) writeMessage(b []byte) {
-	if c.closed {
-		return
-	}
-
-	c.payload <- Payload{
-		Message: b,
+func (c *Consumer) write(ctx context.Context, p Payload) {
+	select {
+	case c.payload <- p:
+	case <-ctx.Done():
+	case <-c.done:
 	}
 }
 
-func (c *Consumer) writeError(err error) {
-	if c.closed {
-		return
-	}
+func (c *Consumer) writeMessage(ctx context.Context, m *messages.ConsumerResponse) {
+	c.write(ctx, NewPayload(ctx, m))
+}
 
-	c.payload <- Payload{
-		err: err,
-	}
+func (c *Consumer) writeError(ctx context.Context, err error) {
+	c.write(ctx, ErrPayload(err))
 }
 
+// ErrGoingAway is delivered as the payload error after the broker announced
+// its shutdown, the consumer has to be recreated against an available broker.
+var ErrGoingAway = brokererr.ErrGoingAway
+
+// Errors the broker refuses the subscription or fails a poll with,
+// the payload error matches them with errors.Is.
+var (
+	ErrTopicNotFound  = brokererr.ErrTopicNotFound
+	ErrUnauthorized   = brokererr.ErrUnauthorized
+	ErrInvalidRequest = brokererr.ErrInvalidRequest
+	ErrNotLeader      = brokererr.ErrNotLeader
+	ErrThrottled      = brokererr.ErrThrottled
+)
+
 type Config struct {
 	Addr string
+	// ClientID names the consumer to the broker, it is shown by the admin clients.
+	ClientID string
+	// Group is a consumer group sharing the topic offset,
+	// empty is the broker default group.
+	Group string
+	// Offset moves the group to the offset before consuming.
+	Offset *int64
+	// Since moves the group to the first message written at or after it
+	// before consuming, it is ignored when Offset is set.
+	Since time.Time
+	// Filter makes the broker skip the messages not matching the expression,
+	// e.g. headers.type == "order" && key prefix "eu-". Fields are topic,
+	// key and headers.<name>, comparisons are ==, !=, prefix and in ("a", "b"),
+	// combined with &&, || and !. The skipped messages move the group offset.
+	Filter string
+	// Snapshot reads the topics from the earliest offset, the payload with
+	// SnapshotEnd is delivered once every message written before the
+	// subscription was read, then the topics are tailed.
+	Snapshot bool
+	// ReadCommitted reads only the messages of the committed transactions,
+	// the messages of the open ones are delivered once committed, of the
+	// aborted ones never. By default the transaction messages are read at once.
+	ReadCommitted bool
+	// ResumeCommitted moves the group to the offsets committed with the producer
+	// transactions by producer.Txn.CommitOffset before consuming, the topics without
+	// one are read from the group offset. It is ignored when Offset or Since is set.
+	ResumeCommitted bool
+	// Dial connects to the broker, net.Dial by default.
+	Dial func(network, addr string) (net.Conn, error)
 }
 
 func New(config *Config) (*Consumer, error) {
@@ -52,7 +97,12 @@ func New(config *Config) (*Consumer, error) {
 		return nil, errors.New("config has not empty")
 	}
 
-	nc, err := net.Dial("tcp", config.Addr)
+	dial := config.Dial
+	if dial == nil {
+		dial = net.Dial
+	}
+
+	nc, err := dial("tcp", config.Addr)
 	if err != nil {
 		return nil, errors.Wrapf(err, "consumer: connect by addr %s", config.Addr)
 	}
@@ -61,50 +111,96 @@ func New(config *Config) (*Consumer, error) {
 		conn:    conn.New(nc),
 		config:  config,
 		payload: make(chan Payload),
+		done:    make(chan struct{}),
 	}
 
 	return c, nil
 }
 
+// Session is the handshake negotiated with the broker once consuming started, nil before.
+func (c *Consumer) Session() *ping.Session {
+	return c.session.Load()
+}
+
 func (c *Consumer) Close() error {
 	c.once.Do(func() {
-		close(c.payload)
-		c.closed = true
+		close(c.done)
 	})
 	return errors.Wrap(c.conn.Close(), "consumer close")
 }
 
+// Consume reads the topic, it may be a pattern like ConsumeTopics topics.
 func (c *Consumer) Consume(ctx context.Context, topic string) <-chan Payload {
-	go c.do(ctx, topic)
+	return c.ConsumeTopics(ctx, topic)
+}
+
+// ConsumeTopics reads the topics in turn. A topic may be a pattern:
+// orders.* matches one dot-separated token, events.> one or more trailing
+// tokens and re:<regexp> a regular expression, the topics created later are
+// attached when they match. Payload.Topic is the topic a message came from.
+func (c *Consumer) ConsumeTopics(ctx context.Context, topics ...string) <-chan Payload {
+	go c.do(ctx, topics)
 	return c.payload
 }
 
-func (c *Consumer) do(ctx context.Context, topic string) {
-	if err := c.broadcast(ctx, topic); err != nil {
-		c.writeError(err)
+func (c *Consumer) do(ctx context.Context, topics []string) {
+	defer close(c.payload)
+
+	if err := c.broadcast(ctx, topics); err != nil {
+		select {
+		case <-c.done:
+			return
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		c.writeError(ctx, err)
 
 		logrus.Error("message from broadcast: ", err)
 	}
 }
 
-func (c *Consumer) broadcast(ctx context.Context, topic string) error {
-	if !c.pinged {
-		if err := ping.New(c.conn).Ping(ctx, ping.Consumer); err != nil {
+func (c *Consumer) broadcast(ctx context.Context, topics []string) error {
+	if len(topics) == 0 {
+		return errors.New("consume topics are empty")
+	}
+
+	if c.session.Load() == nil {
+		session, err := ping.New(c.conn).Handshake(ctx, ping.Consumer, ping.Hello{ClientID: c.config.ClientID})
+		if err != nil {
 			return err
 		}
-		c.pinged = true
+		c.session.Store(session)
 	}
 
-	err := c.conn.WriteProto(&messages.ConsumerPayload{Topic: topic})
+	cp := &messages.ConsumerPayload{
+		Topic:           topics[0],
+		Topics:          topics[1:],
+		Filter:          c.config.Filter,
+		Snapshot:        c.config.Snapshot,
+		ReadCommitted:   c.config.ReadCommitted,
+		ResumeCommitted: c.config.ResumeCommitted,
+		Group:           c.config.Group,
+		Offset:          c.config.Offset,
+	}
+	if c.config.Offset == nil && !c.config.Since.IsZero() {
+		cp.Timestamp = proto.Int64(c.config.Since.UnixNano())
+	}
+
+	err := c.conn.WriteProto(cp)
 	if err != nil {
 		return errors.Wrap(err, "proto-marshal message")
 	}
 
-	dest := make([]byte, 512)
-	_, err = c.conn.Read(dest)
+	ask := &messages.ConsumerPayload{}
+	err = c.conn.ReadProto(ask)
 	if err != nil {
 		return errors.Wrap(err, "read from broker")
 	}
+	if ask.Error != nil {
+		return errors.Wrap(brokererr.FromProto(ask.Error), "subscription refused")
+	}
 
 	message := &messages.ConsumerResponse{}
 
@@ -113,7 +209,7 @@ func (c *Consumer) broadcast(ctx context.Context, topic string) error {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			_, err = c.conn.Write([]byte("1"))
+			err = c.conn.WriteFrame(nil)
 			if err != nil {
 				return errors.Wrap(err, "ping consumer broker")
 			}
@@ -122,12 +218,24 @@ func (c *Consumer) broadcast(ctx context.Context, topic string) error {
 			if err != nil {
 				return errors.Wrap(err, "from broker")
 			}
+			if message.Error != nil {
+				return errors.Wrap(brokererr.FromProto(message.Error), "poll failed")
+			}
 
 			if message.IsEmpty {
+				if message.SnapshotEnd {
+					c.write(ctx, Payload{SnapshotEnd: true})
+				}
+				if message.GoingAway {
+					return ErrGoingAway
+				}
 				continue
 			}
 
-			c.writeMessage(message.GetMessage())
+			c.writeMessage(ctx, message)
+			if message.GoingAway {
+				return ErrGoingAway
+			}
 			message.Reset()
 		}
 	}
@@ -1,15 +1,66 @@
 package consumer
 
 import (
+	"context"
 	"encoding/json"
+	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/propagation"
 	"google.golang.org/protobuf/proto"
+
+	"github.com/baibikov/jellyfish/pkg/producer"
+	"github.com/baibikov/jellyfish/protogenerated/messages"
 )
 
 type Payload struct {
-	Message []byte
-	err     error
+	// Topic is the topic the message was consumed from.
+	Topic     string
+	Key       string
+	Message   []byte
+	Headers   map[string]string
+	Offset    int64
+	Timestamp time.Time
+	// Priority is the message priority, it orders the delivery of a priority topic.
+	Priority int
+	// SnapshotEnd is set on the payload without a message delivered
+	// in the snapshot mode once the snapshot is read.
+	SnapshotEnd bool
+	err         error
+	ctx         context.Context
+}
+
+// NewPayload is the payload of the broker response, its context continues
+// the trace of the message headers over ctx. The clients reading the broker
+// by other connections deliver the payloads of this package with it.
+func NewPayload(ctx context.Context, m *messages.ConsumerResponse) Payload {
+	return Payload{
+		Topic:       m.GetTopic(),
+		Key:         m.GetKey(),
+		Message:     m.GetMessage(),
+		Headers:     m.GetHeaders(),
+		Offset:      m.GetOffset(),
+		Timestamp:   time.Unix(0, m.GetTimestamp()),
+		Priority:    int(m.GetPriority()),
+		SnapshotEnd: m.GetSnapshotEnd(),
+		ctx:         propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier(m.GetHeaders())),
+	}
+}
+
+// ErrPayload is the payload delivering the consume error.
+func ErrPayload(err error) Payload {
+	return Payload{err: err}
+}
+
+// Context returns the consume context carrying the trace context of the
+// message, so handlers can continue the producer trace.
+func (p Payload) Context() context.Context {
+	if p.ctx == nil {
+		return context.Background()
+	}
+
+	return p.ctx
 }
 
 func (p Payload) JsonUnmarshal(v interface{}) error {
@@ -26,6 +77,12 @@ func (p Payload) ProtoUnmarshal(m proto.Message) error {
 	)
 }
 
+// SchemaID is the id of the registered schema the message was encoded with, zero is none.
+func (p Payload) SchemaID() int {
+	id, _ := strconv.Atoi(p.Headers[producer.HeaderSchemaID])
+	return id
+}
+
 func (p Payload) Err() error {
 	return p.err
 }
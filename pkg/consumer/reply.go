@@ -0,0 +1,72 @@
+package consumer
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/baibikov/jellyfish/pkg/producer"
+)
+
+// ReplyTo is the topic the requester waits for the reply on,
+// empty when the message is not a request.
+func (p Payload) ReplyTo() string {
+	return p.Headers[producer.HeaderReplyTo]
+}
+
+// CorrelationID matches the reply with the request.
+func (p Payload) CorrelationID() string {
+	return p.Headers[producer.HeaderCorrelationID]
+}
+
+// RequestHandler answers a request, the returned error is replied
+// to the requester instead of the message.
+type RequestHandler func(ctx context.Context, request Payload) ([]byte, error)
+
+// Reply pushes the reply to the request, or the handler error when err is set.
+func Reply(ctx context.Context, p *producer.Producer, request Payload, message []byte, err error) error {
+	if request.ReplyTo() == "" {
+		return errors.New("message is not a request, reply-to header is empty")
+	}
+
+	headers := map[string]string{
+		producer.HeaderCorrelationID: request.CorrelationID(),
+	}
+	if err != nil {
+		headers[producer.HeaderReplyError] = err.Error()
+		message = nil
+	}
+
+	return errors.Wrap(
+		p.Push(ctx, &producer.Params{
+			Topic:   request.ReplyTo(),
+			Message: message,
+			Headers: headers,
+		}),
+		"push reply",
+	)
+}
+
+// Serve consumes the requests of the topic and replies to every one by
+// the handler using p, it returns when the ctx is done or consuming fails.
+// Messages without the reply-to header are skipped.
+func (c *Consumer) Serve(ctx context.Context, topic string, p *producer.Producer, handler RequestHandler) error {
+	for request := range c.Consume(ctx, topic) {
+		if err := request.Err(); err != nil {
+			return err
+		}
+
+		if request.ReplyTo() == "" {
+			logrus.Warnf("consumer: skip message %d of topic %s without reply-to", request.Offset, topic)
+			continue
+		}
+
+		message, err := handler(request.Context(), request)
+		if err := Reply(ctx, p, request, message, err); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
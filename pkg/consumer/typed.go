@@ -0,0 +1,73 @@
+package consumer
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/pkg/codec"
+)
+
+// Subscriber reads the topics, e.g. Consumer or the client.Consumer of a pool.
+type Subscriber interface {
+	ConsumeTopics(ctx context.Context, topics ...string) <-chan Payload
+}
+
+// TypedPayload is the payload with its message decoded.
+type TypedPayload[T any] struct {
+	Payload
+	Value T
+}
+
+// Typed reads the values of T decoded by the codec. A message of another
+// content type is delivered with codec.ErrContentType and a message not
+// decoded with the codec error, the next messages are still delivered.
+// The messages without the content type are decoded as of the codec.
+type Typed[T any] struct {
+	subscriber Subscriber
+	codec      codec.Codec
+}
+
+func NewTyped[T any](subscriber Subscriber, c codec.Codec) *Typed[T] {
+	return &Typed[T]{subscriber: subscriber, codec: c}
+}
+
+// ConsumeTopics reads the topics as the subscriber does.
+func (t *Typed[T]) ConsumeTopics(ctx context.Context, topics ...string) <-chan TypedPayload[T] {
+	typed := make(chan TypedPayload[T])
+	go func() {
+		defer close(typed)
+
+		for p := range t.subscriber.ConsumeTopics(ctx, topics...) {
+			select {
+			case typed <- t.decode(p):
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return typed
+}
+
+func (t *Typed[T]) decode(p Payload) TypedPayload[T] {
+	tp := TypedPayload[T]{Payload: p}
+	if p.err != nil || p.SnapshotEnd {
+		return tp
+	}
+
+	if ct := p.ContentType(); ct != "" && ct != t.codec.Name() {
+		tp.err = errors.Wrapf(codec.ErrContentType, "topic %s offset %d has %q, want %q", p.Topic, p.Offset, ct, t.codec.Name())
+		return tp
+	}
+	if err := t.codec.Unmarshal(p.Message, &tp.Value); err != nil {
+		tp.err = errors.Wrapf(err, "decode topic %s offset %d", p.Topic, p.Offset)
+	}
+
+	return tp
+}
+
+// ContentType is the codec name the message was encoded with, empty when
+// it was not pushed by producer.Typed.
+func (p Payload) ContentType() string {
+	return p.Headers[codec.HeaderContentType]
+}
@@ -0,0 +1,66 @@
+package consumer_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/pkg/codec"
+	"github.com/baibikov/jellyfish/pkg/consumer"
+	"github.com/baibikov/jellyfish/pkg/jellyfishtest"
+	"github.com/baibikov/jellyfish/pkg/producer"
+)
+
+type order struct {
+	ID    string `json:"id" msgpack:"id"`
+	Items int    `json:"items" msgpack:"items"`
+}
+
+func TestTypedConsume(t *testing.T) {
+	s := jellyfishtest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	p, err := producer.New(s.ProducerConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	params := &producer.Params{Topic: "orders"}
+	if err := producer.NewTyped[order](p, codec.JSON).Push(ctx, params, order{ID: "1", Items: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := producer.NewTyped[order](p, codec.Msgpack).Push(ctx, params, order{ID: "2"}); err != nil {
+		t.Fatal(err)
+	}
+	// the messages without the content type are decoded by the codec
+	for _, message := range []string{`{"id":"3"}`, `not json`} {
+		if err := p.Push(ctx, &producer.Params{Topic: "orders", Message: []byte(message)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := consumer.New(s.ConsumerConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	payloads := consumer.NewTyped[order](c, codec.JSON).ConsumeTopics(ctx, "orders")
+
+	if tp := <-payloads; tp.Err() != nil || tp.Value != (order{ID: "1", Items: 2}) || tp.ContentType() != codec.JSON.Name() {
+		t.Fatalf("read %+v, %v", tp.Value, tp.Err())
+	}
+	if tp := <-payloads; !errors.Is(tp.Err(), codec.ErrContentType) {
+		t.Fatalf("read the msgpack message with %v, want ErrContentType", tp.Err())
+	}
+	if tp := <-payloads; tp.Err() != nil || tp.Value.ID != "3" {
+		t.Fatalf("read %+v, %v", tp.Value, tp.Err())
+	}
+	if tp := <-payloads; tp.Err() == nil || errors.Is(tp.Err(), codec.ErrContentType) {
+		t.Fatalf("read the invalid json with %v, want the decode error", tp.Err())
+	}
+}
@@ -0,0 +1,94 @@
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package jellyfishtest
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+// Cluster is a leader broker replicating its messages to the slaves.
+// The slaves acknowledge the replicated messages without storing them,
+// as the brokers of the ISR partition do, so the cluster tests the leader
+// against connected, failed or restarted slaves but a slave has no messages
+// to consume.
+type Cluster struct {
+	Leader *Server
+	Slaves []*Server
+}
+
+// NewCluster starts a leader with the number of slaves
+// and closes them on the test cleanup, the leader has connected
+// every slave once it is returned.
+func NewCluster(tb testing.TB, slaves int, opts ...Option) *Cluster {
+	tb.Helper()
+
+	c, err := StartCluster(slaves, opts...)
+	if err != nil {
+		tb.Fatalf("jellyfishtest: %v", err)
+	}
+	tb.Cleanup(func() {
+		if err := c.Close(); err != nil {
+			tb.Logf("jellyfishtest: %v", err)
+		}
+	})
+
+	return c
+}
+
+// StartCluster starts a leader with the number of slaves, the caller has to Close it.
+// Every node shares the options and the transport.
+func StartCluster(slaves int, opts ...Option) (*Cluster, error) {
+	if slaves < 1 {
+		return nil, errors.New("cluster needs at least one slave")
+	}
+
+	o := newOptions(opts)
+	c := &Cluster{
+		Slaves: make([]*Server, 0, slaves),
+	}
+
+	addrs := make([]string, 0, slaves)
+	for i := 0; i < slaves; i++ {
+		s, err := start(o, nil)
+		if err != nil {
+			return nil, multierr.Append(errors.Wrapf(err, "start slave %d", i), c.Close())
+		}
+
+		c.Slaves = append(c.Slaves, s)
+		addrs = append(addrs, s.Addr)
+	}
+
+	leader, err := start(o, addrs)
+	if err != nil {
+		return nil, multierr.Append(errors.Wrap(err, "start leader"), c.Close())
+	}
+	c.Leader = leader
+
+	return c, nil
+}
+
+// Close shuts the leader and then the slaves down.
+func (c *Cluster) Close() (err error) {
+	if c.Leader != nil {
+		multierr.AppendInto(&err, c.Leader.Close())
+	}
+	for _, s := range c.Slaves {
+		multierr.AppendInto(&err, s.Close())
+	}
+
+	return err
+}
@@ -0,0 +1,43 @@
+package jellyfishtest_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/baibikov/jellyfish/pkg/consumer"
+	"github.com/baibikov/jellyfish/pkg/jellyfishtest"
+	"github.com/baibikov/jellyfish/pkg/producer"
+)
+
+func Example() {
+	// a test would call jellyfishtest.NewServer(t, ...) closed on the test cleanup
+	s, err := jellyfishtest.Start(jellyfishtest.WithPipe())
+	if err != nil {
+		panic(err)
+	}
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	p, err := producer.New(s.ProducerConfig())
+	if err != nil {
+		panic(err)
+	}
+	defer p.Close()
+
+	if err := p.Push(ctx, &producer.Params{Topic: "orders", Message: []byte("created")}); err != nil {
+		panic(err)
+	}
+
+	c, err := consumer.New(s.ConsumerConfig())
+	if err != nil {
+		panic(err)
+	}
+	defer c.Close()
+
+	m := <-c.Consume(ctx, "orders")
+	fmt.Println(m.Topic, string(m.Message), m.Err())
+	// Output: orders created <nil>
+}
@@ -0,0 +1,114 @@
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package jellyfishtest
+
+import (
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// network is an in-memory transport, every connection is a net.Pipe.
+type network struct {
+	mutex     sync.Mutex
+	listeners map[string]*pipeListener
+	seq       int
+}
+
+func newNetwork() *network {
+	return &network{
+		listeners: make(map[string]*pipeListener),
+	}
+}
+
+func (n *network) listen() *pipeListener {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.seq++
+	l := &pipeListener{
+		addr:    pipeAddr(pipeName(n.seq)),
+		conns:   make(chan net.Conn),
+		done:    make(chan struct{}),
+		network: n,
+	}
+	n.listeners[string(l.addr)] = l
+	return l
+}
+
+func (n *network) Dial(_, addr string) (net.Conn, error) {
+	n.mutex.Lock()
+	l, ok := n.listeners[addr]
+	n.mutex.Unlock()
+	if !ok {
+		return nil, errors.Errorf("dial %s: connection refused", addr)
+	}
+
+	server, client := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		return nil, errors.Errorf("dial %s: connection refused", addr)
+	}
+}
+
+func pipeName(seq int) string {
+	return "pipe-" + strconv.Itoa(seq)
+}
+
+type pipeAddr string
+
+func (a pipeAddr) Network() string {
+	return "pipe"
+}
+
+func (a pipeAddr) String() string {
+	return string(a)
+}
+
+type pipeListener struct {
+	addr    pipeAddr
+	conns   chan net.Conn
+	done    chan struct{}
+	once    sync.Once
+	network *network
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+
+		l.network.mutex.Lock()
+		delete(l.network.listeners, string(l.addr))
+		l.network.mutex.Unlock()
+	})
+
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return l.addr
+}
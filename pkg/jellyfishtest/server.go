@@ -0,0 +1,237 @@
+/*
+   Copyright 2022 Jellyfish message broker
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package jellyfishtest starts fully functional in-process brokers for tests,
+// so pkg/producer and pkg/consumer can be tested end-to-end without
+// an external process.
+package jellyfishtest
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+
+	"github.com/baibikov/jellyfish/internal/admin"
+	"github.com/baibikov/jellyfish/internal/broker"
+	"github.com/baibikov/jellyfish/internal/config"
+	"github.com/baibikov/jellyfish/pkg/consumer"
+	"github.com/baibikov/jellyfish/pkg/producer"
+)
+
+type options struct {
+	pipe            bool
+	admin           bool
+	shutdownTimeout time.Duration
+	network         *network
+}
+
+type Option func(o *options)
+
+// WithPipe serves the broker over an in-memory net.Pipe transport instead
+// of an ephemeral tcp port, clients have to use Server.Dial.
+func WithPipe() Option {
+	return func(o *options) {
+		o.pipe = true
+	}
+}
+
+// WithAdmin starts the admin http api on an ephemeral tcp port.
+func WithAdmin() Option {
+	return func(o *options) {
+		o.admin = true
+	}
+}
+
+// WithShutdownTimeout bounds the graceful shutdown on Close, one second by default.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.shutdownTimeout = timeout
+	}
+}
+
+const defaultShutdownTimeout = time.Second
+
+// Server is an in-process broker.
+type Server struct {
+	// Addr is the broker address for producers and consumers.
+	Addr string
+	// AdminAddr is the admin http address, empty without WithAdmin.
+	AdminAddr string
+
+	listener *broker.Listener
+	admin    *admin.Server
+	dial     broker.DialFunc
+	timeout  time.Duration
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// NewServer starts a broker and closes it on the test cleanup,
+// the test fails when the broker does not start. The broker is ready
+// once it is returned.
+func NewServer(tb testing.TB, opts ...Option) *Server {
+	tb.Helper()
+
+	s, err := Start(opts...)
+	if err != nil {
+		tb.Fatalf("jellyfishtest: %v", err)
+	}
+	tb.Cleanup(func() {
+		if err := s.Close(); err != nil {
+			tb.Logf("jellyfishtest: %v", err)
+		}
+	})
+
+	return s
+}
+
+// Start starts a broker, the caller has to Close it.
+func Start(opts ...Option) (*Server, error) {
+	o := newOptions(opts)
+	return start(o, nil)
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		shutdownTimeout: defaultShutdownTimeout,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.pipe {
+		o.network = newNetwork()
+	}
+
+	return o
+}
+
+func start(o *options, slaves []string) (*Server, error) {
+	var (
+		l    net.Listener
+		dial broker.DialFunc = net.Dial
+		err  error
+	)
+	if o.pipe {
+		l, dial = o.network.listen(), o.network.Dial
+	} else {
+		l, err = net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, errors.Wrap(err, "listen ephemeral port")
+		}
+	}
+
+	cnf := &config.Config{
+		Addr:            l.Addr().String(),
+		Slaves:          slaves,
+		ShutdownTimeout: o.shutdownTimeout,
+	}
+
+	listener, err := broker.NewWithListener(cnf, l, dial)
+	if err != nil {
+		return nil, multierr.Append(errors.Wrap(err, "start broker"), l.Close())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		Addr:     cnf.Addr,
+		listener: listener,
+		dial:     dial,
+		timeout:  o.shutdownTimeout,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.done)
+		_ = listener.Broadcast(ctx)
+	}()
+
+	if err := s.waitReady(); err != nil {
+		return nil, multierr.Append(err, s.Close())
+	}
+
+	if o.admin {
+		s.admin, err = admin.New("127.0.0.1:0", listener)
+		if err != nil {
+			return nil, multierr.Append(errors.Wrap(err, "start admin"), s.Close())
+		}
+		s.AdminAddr = s.admin.Addr().String()
+		go func() {
+			_ = s.admin.Serve()
+		}()
+	}
+
+	return s, nil
+}
+
+// readyTimeout bounds the wait for the broker to accept connections
+// and for the leader to connect its slaves.
+const readyTimeout = time.Second * 5
+
+func (s *Server) waitReady() error {
+	deadline := time.Now().Add(readyTimeout)
+	for !s.listener.Ready() {
+		if time.Now().After(deadline) {
+			return errors.Errorf("broker is not ready within %s", readyTimeout)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	return nil
+}
+
+// Dial connects to the broker over its transport, it fits
+// producer.Config.Dial and consumer.Config.Dial.
+func (s *Server) Dial(network, addr string) (net.Conn, error) {
+	return s.dial(network, addr)
+}
+
+// ProducerConfig returns a producer config connected to the broker.
+func (s *Server) ProducerConfig() *producer.Config {
+	return &producer.Config{
+		Addr: s.Addr,
+		Dial: s.dial,
+	}
+}
+
+// ConsumerConfig returns a consumer config connected to the broker.
+func (s *Server) ConsumerConfig() *consumer.Config {
+	return &consumer.Config{
+		Addr: s.Addr,
+		Dial: s.dial,
+	}
+}
+
+// Ready reports whether the broker accepts connections and its slaves are connected.
+func (s *Server) Ready() bool {
+	return s.listener.Ready()
+}
+
+// Close shuts the broker down gracefully and waits for it.
+func (s *Server) Close() (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	if s.admin != nil {
+		multierr.AppendInto(&err, s.admin.Shutdown(ctx))
+	}
+	multierr.AppendInto(&err, s.listener.Shutdown(ctx))
+	s.cancel()
+	<-s.done
+
+	return err
+}
@@ -0,0 +1,94 @@
+package jellyfishtest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/baibikov/jellyfish/pkg/consumer"
+	"github.com/baibikov/jellyfish/pkg/producer"
+)
+
+// roundTrip pushes the message and consumes it back from the broker.
+func roundTrip(t *testing.T, s *Server, topic, message string) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	p, err := producer.New(s.ProducerConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if err := p.Push(ctx, &producer.Params{Topic: topic, Message: []byte(message)}); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	c, err := consumer.New(s.ConsumerConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	m := <-c.Consume(ctx, topic)
+	if m.Err() != nil || string(m.Message) != message {
+		t.Fatalf("consumed %q, %v, want %q", m.Message, m.Err(), message)
+	}
+}
+
+func TestServerTransports(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"tcp":  nil,
+		"pipe": {WithPipe()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := NewServer(t, opts...)
+			if !s.Ready() {
+				t.Fatal("server is not ready")
+			}
+
+			roundTrip(t, s, "orders", "created")
+		})
+	}
+}
+
+func TestServerAdmin(t *testing.T) {
+	s := NewServer(t, WithAdmin())
+	if s.AdminAddr == "" {
+		t.Fatal("admin address is empty")
+	}
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/healthz", s.AdminAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("healthz = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestCluster(t *testing.T) {
+	c := NewCluster(t, 2, WithPipe())
+	if len(c.Slaves) != 2 {
+		t.Fatalf("slaves = %d, want 2", len(c.Slaves))
+	}
+
+	// the leader is ready once every slave answered the handshake
+	if !c.Leader.Ready() {
+		t.Fatal("leader is not ready")
+	}
+
+	// acknowledged by every slave
+	roundTrip(t, c.Leader, "orders", "created")
+}
+
+func TestClusterNeedsSlaves(t *testing.T) {
+	if _, err := StartCluster(0); err == nil {
+		t.Fatal("cluster without slaves is started")
+	}
+}
@@ -0,0 +1,445 @@
+// Package mux is the client of a multiplexed broker connection: one connection
+// carries the concurrent produce, fetch and admin requests tagged with ids and
+// the responses are matched by the id in whatever order they arrive.
+package mux
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/baibikov/jellyfish/pkg/admin"
+	"github.com/baibikov/jellyfish/pkg/brokererr"
+	"github.com/baibikov/jellyfish/pkg/conn"
+	"github.com/baibikov/jellyfish/pkg/consumer"
+	"github.com/baibikov/jellyfish/pkg/ping"
+	"github.com/baibikov/jellyfish/pkg/producer"
+	"github.com/baibikov/jellyfish/protogenerated/messages"
+)
+
+// Defaults of the subscription fetches.
+const (
+	DefaultPollInterval = 10 * time.Millisecond
+	DefaultFetchMax     = 100
+)
+
+var (
+	// ErrGoingAway is returned after the broker announced its shutdown,
+	// the connection has to be dialed again against an available broker.
+	ErrGoingAway = brokererr.ErrGoingAway
+	// ErrClosed is returned by the requests of a closed connection.
+	ErrClosed = errors.New("multiplexed connection closed")
+)
+
+type Config struct {
+	Addr string
+	// ClientID names the client to the broker, it is shown by the admin clients.
+	ClientID string
+	// Acks of the published messages, AcksAll by default.
+	Acks producer.Acks
+	// PollInterval is the pause before fetching a drained subscription again,
+	// DefaultPollInterval when zero.
+	PollInterval time.Duration
+	// FetchMax is the most messages a fetch reads, DefaultFetchMax when zero.
+	FetchMax int
+	// Dial connects to the broker, net.Dial by default.
+	Dial func(network, addr string) (net.Conn, error)
+}
+
+// Conn is a multiplexed connection, it is safe for concurrent use.
+type Conn struct {
+	conn    *conn.Conn
+	config  *Config
+	session *ping.Session
+
+	// write serializes the requests.
+	write sync.Mutex
+
+	mutex   sync.Mutex
+	pending map[uint64]chan *messages.MuxResponse
+	err     error
+
+	next      atomic.Uint64
+	goingAway atomic.Bool
+	done      chan struct{}
+	once      sync.Once
+}
+
+// Dial connects and handshakes with the broker, a broker without
+// the multiplexed connections is ping.ErrIncompatible.
+func Dial(ctx context.Context, config *Config) (*Conn, error) {
+	if config == nil {
+		return nil, errors.New("config has not empty")
+	}
+
+	dial := config.Dial
+	if dial == nil {
+		dial = net.Dial
+	}
+
+	nc, err := dial("tcp", config.Addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "mux: connect by addr %s", config.Addr)
+	}
+
+	session, err := ping.New(nc).Handshake(ctx, ping.Multiplex, ping.Hello{ClientID: config.ClientID})
+	if err == nil && !session.Has(ping.FeatureMultiplex) {
+		err = errors.Wrap(ping.ErrIncompatible, "broker has no multiplexed connections")
+	}
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	c := &Conn{
+		conn:    conn.New(nc),
+		config:  config,
+		session: session,
+		pending: make(map[uint64]chan *messages.MuxResponse),
+		done:    make(chan struct{}),
+	}
+	go c.read()
+
+	return c, nil
+}
+
+// Session is the handshake negotiated with the broker.
+func (c *Conn) Session() *ping.Session {
+	return c.session
+}
+
+// Done is closed once the connection is closed or broken.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err is the reason the connection is done, nil before.
+func (c *Conn) Err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.err
+}
+
+// GoingAway reports whether the broker announced its shutdown.
+func (c *Conn) GoingAway() bool {
+	return c.goingAway.Load()
+}
+
+func (c *Conn) Close() error {
+	c.fail(ErrClosed)
+	return errors.Wrap(c.conn.Close(), "mux close")
+}
+
+// fail ends the requests in flight with the error, the first error wins.
+func (c *Conn) fail(err error) {
+	c.once.Do(func() {
+		c.mutex.Lock()
+		c.err = err
+		c.mutex.Unlock()
+		close(c.done)
+	})
+}
+
+// read dispatches the responses to the requests by id.
+func (c *Conn) read() {
+	for {
+		resp := &messages.MuxResponse{}
+		if err := c.conn.ReadProto(resp); err != nil {
+			c.fail(errors.Wrap(err, "read response"))
+			return
+		}
+		if resp.GoingAway {
+			c.goingAway.Store(true)
+		}
+
+		c.mutex.Lock()
+		ch := c.pending[resp.Id]
+		delete(c.pending, resp.Id)
+		c.mutex.Unlock()
+		if ch != nil {
+			ch <- resp
+		}
+	}
+}
+
+// send writes the request under a new id, the response is delivered to
+// the returned channel unless the request is not answered.
+func (c *Conn) send(req *messages.MuxRequest, answered bool) (uint64, chan *messages.MuxResponse, error) {
+	if c.goingAway.Load() {
+		return 0, nil, ErrGoingAway
+	}
+	select {
+	case <-c.done:
+		return 0, nil, c.Err()
+	default:
+	}
+
+	req.Id = c.next.Add(1)
+	var ch chan *messages.MuxResponse
+	if answered {
+		ch = make(chan *messages.MuxResponse, 1)
+		c.mutex.Lock()
+		c.pending[req.Id] = ch
+		c.mutex.Unlock()
+	}
+
+	c.write.Lock()
+	err := c.conn.WriteProto(req)
+	c.write.Unlock()
+	if err != nil {
+		c.forget(req.Id)
+		return 0, nil, errors.Wrapf(err, "write request %d", req.Id)
+	}
+
+	return req.Id, ch, nil
+}
+
+// wait returns the response of the request, the broker error of a failed one.
+func (c *Conn) wait(ctx context.Context, id uint64, ch chan *messages.MuxResponse) (*messages.MuxResponse, error) {
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return nil, brokererr.FromProto(resp.Error)
+		}
+		return resp, nil
+	case <-c.done:
+		return nil, c.Err()
+	case <-ctx.Done():
+		// the late response is dropped
+		c.forget(id)
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Conn) forget(id uint64) {
+	c.mutex.Lock()
+	delete(c.pending, id)
+	c.mutex.Unlock()
+}
+
+// do sends the request and waits for its response.
+func (c *Conn) do(ctx context.Context, req *messages.MuxRequest) (*messages.MuxResponse, error) {
+	id, ch, err := c.send(req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.wait(ctx, id, ch)
+}
+
+// Ping checks the connection by the broker answer.
+func (c *Conn) Ping(ctx context.Context) error {
+	_, err := c.do(ctx, &messages.MuxRequest{Body: &messages.MuxRequest_Heartbeat{Heartbeat: true}})
+	return errors.Wrap(err, "heartbeat")
+}
+
+// Publish sends every message before waiting for the acknowledgements, the
+// messages are written in order, those of concurrent calls interleaved.
+// The first refused message is returned, the others are written.
+func (c *Conn) Publish(ctx context.Context, batch ...*producer.Params) error {
+	answered := c.config.Acks != producer.AcksNone
+
+	type sent struct {
+		id uint64
+		ch chan *messages.MuxResponse
+	}
+	sends := make([]sent, 0, len(batch))
+	for _, params := range batch {
+		if params == nil {
+			continue
+		}
+
+		req := &messages.MuxRequest{Body: &messages.MuxRequest_Produce{
+			Produce: producer.NewPayload(ctx, params, c.config.Acks),
+		}}
+		id, ch, err := c.send(req, answered)
+		if err != nil {
+			return err
+		}
+		sends = append(sends, sent{id: id, ch: ch})
+	}
+	if !answered {
+		return nil
+	}
+
+	var refused error
+	for _, s := range sends {
+		_, err := c.wait(ctx, s.id, s.ch)
+		if err != nil && refused == nil {
+			refused = errors.Wrap(err, "message refused")
+		}
+	}
+
+	return refused
+}
+
+// Subscription is what Subscribe reads, the fields are the consumer.Config ones.
+type Subscription struct {
+	// Topics are the topics or patterns read in turn.
+	Topics          []string
+	Group           string
+	Offset          *int64
+	Since           time.Time
+	Filter          string
+	Snapshot        bool
+	ReadCommitted   bool
+	ResumeCommitted bool
+}
+
+// Subscribe reads the subscription until ctx is done or the connection breaks,
+// the error is delivered as the last payload. Any number of subscriptions
+// share the connection with the published messages.
+func (c *Conn) Subscribe(ctx context.Context, s Subscription) <-chan consumer.Payload {
+	payloads := make(chan consumer.Payload)
+	go func() {
+		defer close(payloads)
+
+		if err := c.consume(ctx, s, payloads); err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			logrus.Error("mux subscription: ", err)
+			select {
+			case payloads <- consumer.ErrPayload(err):
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return payloads
+}
+
+func (c *Conn) consume(ctx context.Context, s Subscription, payloads chan<- consumer.Payload) error {
+	if len(s.Topics) == 0 {
+		return errors.New("consume topics are empty")
+	}
+
+	cp := &messages.ConsumerPayload{
+		Topic:           s.Topics[0],
+		Topics:          s.Topics[1:],
+		Group:           s.Group,
+		Offset:          s.Offset,
+		Filter:          s.Filter,
+		Snapshot:        s.Snapshot,
+		ReadCommitted:   s.ReadCommitted,
+		ResumeCommitted: s.ResumeCommitted,
+	}
+	if s.Offset == nil && !s.Since.IsZero() {
+		cp.Timestamp = proto.Int64(s.Since.UnixNano())
+	}
+
+	subscribe := &messages.MuxRequest{Body: &messages.MuxRequest_Subscribe{Subscribe: cp}}
+	if _, err := c.do(ctx, subscribe); err != nil {
+		return errors.Wrap(err, "subscription refused")
+	}
+	// the fetched messages not delivered are released to be fetched again
+	var undelivered []*messages.ConsumerResponse
+	defer func() { c.release(subscribe.Id, undelivered) }()
+
+	interval := c.config.PollInterval
+	if interval == 0 {
+		interval = DefaultPollInterval
+	}
+	fetchMax := c.config.FetchMax
+	if fetchMax == 0 {
+		fetchMax = DefaultFetchMax
+	}
+
+	fetch := &messages.Fetch{Subscription: subscribe.Id, Max: int32(fetchMax)}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		// a fetch is answered at once, it is not abandoned with ctx
+		// as its messages would be lost
+		resp, err := c.do(context.Background(), &messages.MuxRequest{Body: &messages.MuxRequest_Fetch{Fetch: fetch}})
+		if err != nil {
+			return errors.Wrap(err, "fetch")
+		}
+
+		mm := resp.GetFetched().GetMessages()
+		for i, m := range mm {
+			select {
+			case payloads <- consumer.NewPayload(ctx, m):
+			case <-ctx.Done():
+				undelivered = mm[i:]
+				return ctx.Err()
+			}
+		}
+		if len(mm) != 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// release closes the subscription on the broker and moves its group back to
+// the undelivered messages, a subscription of the group opened after it
+// fetches them again.
+func (c *Conn) release(id uint64, undelivered []*messages.ConsumerResponse) {
+	req := &messages.MuxRequest{Body: &messages.MuxRequest_Unsubscribe{Unsubscribe: id}}
+	if len(undelivered) != 0 {
+		release := &messages.Release{Subscription: id}
+		for _, m := range undelivered {
+			if !m.IsEmpty {
+				release.Undelivered = append(release.Undelivered, &messages.Position{Topic: m.Topic, Offset: m.Offset})
+			}
+		}
+		req.Body = &messages.MuxRequest_Release{Release: release}
+	}
+
+	_, err := c.do(context.Background(), req)
+	if err != nil && !errors.Is(err, ErrClosed) {
+		logrus.Debug("mux unsubscribe: ", err)
+	}
+}
+
+// Topics describes the topics.
+func (c *Conn) Topics(ctx context.Context) ([]admin.Topic, error) {
+	resp, err := c.admin(ctx, &messages.Admin{Op: messages.AdminOp_ADMIN_OP_TOPICS})
+	if err != nil {
+		return nil, err
+	}
+
+	var topics []admin.Topic
+	return topics, errors.Wrap(json.Unmarshal(resp.GetTopics(), &topics), "json-unmarshal topics")
+}
+
+func (c *Conn) CreateTopic(ctx context.Context, name string, config admin.TopicConfig) error {
+	bb, err := json.Marshal(config)
+	if err != nil {
+		return errors.Wrap(err, "json-marshal topic config")
+	}
+
+	_, err = c.admin(ctx, &messages.Admin{Op: messages.AdminOp_ADMIN_OP_CREATE_TOPIC, Topic: name, Config: bb})
+	return err
+}
+
+func (c *Conn) DeleteTopic(ctx context.Context, name string) error {
+	_, err := c.admin(ctx, &messages.Admin{Op: messages.AdminOp_ADMIN_OP_DELETE_TOPIC, Topic: name})
+	return err
+}
+
+func (c *Conn) admin(ctx context.Context, a *messages.Admin) (*messages.MuxResponse, error) {
+	resp, err := c.do(ctx, &messages.MuxRequest{Body: &messages.MuxRequest_Admin{Admin: a}})
+	return resp, errors.Wrapf(err, "admin operation %s", a.Op)
+}
@@ -0,0 +1,137 @@
+package mux
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/pkg/jellyfishtest"
+	"github.com/baibikov/jellyfish/pkg/producer"
+	"github.com/baibikov/jellyfish/protogenerated/messages"
+)
+
+func dial(ctx context.Context, t *testing.T, s *jellyfishtest.Server, fetchMax int) *Conn {
+	t.Helper()
+
+	c, err := Dial(ctx, &Config{Addr: s.Addr, Dial: s.Dial, PollInterval: time.Millisecond, FetchMax: fetchMax})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+
+	return c
+}
+
+func publish(ctx context.Context, t *testing.T, c *Conn, topic string, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		if err := c.Publish(ctx, &producer.Params{Topic: topic, Message: []byte(fmt.Sprint(i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFetchMax(t *testing.T) {
+	s := jellyfishtest.NewServer(t, jellyfishtest.WithPipe())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c := dial(ctx, t, s, 0)
+	publish(ctx, t, c, "orders", 5)
+
+	subscribe := &messages.MuxRequest{Body: &messages.MuxRequest_Subscribe{Subscribe: &messages.ConsumerPayload{Topic: "orders"}}}
+	if _, err := c.do(ctx, subscribe); err != nil {
+		t.Fatal(err)
+	}
+
+	fetch := &messages.MuxRequest_Fetch{Fetch: &messages.Fetch{Subscription: subscribe.Id, Max: 2}}
+	for _, want := range []int{2, 2, 1, 0} {
+		resp, err := c.do(ctx, &messages.MuxRequest{Body: fetch})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(resp.GetFetched().GetMessages()); got != want {
+			t.Fatalf("fetched %d messages, want %d", got, want)
+		}
+	}
+
+	// the messages are delivered in order over the fetches
+	payloads := dial(ctx, t, s, 2).Subscribe(ctx, Subscription{Topics: []string{"orders"}, Group: "g"})
+	for i := 0; i < 5; i++ {
+		p := <-payloads
+		if p.Err() != nil || string(p.Message) != fmt.Sprint(i) {
+			t.Fatalf("read %s, %v, want %d", p.Message, p.Err(), i)
+		}
+	}
+}
+
+func TestCanceledSubscriptionReleasesFetched(t *testing.T) {
+	s := jellyfishtest.NewServer(t, jellyfishtest.WithPipe())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c := dial(ctx, t, s, 0)
+	publish(ctx, t, c, "orders", 5)
+
+	// the first fetch reads every message, the subscription ends after one
+	subCtx, subCancel := context.WithCancel(ctx)
+	payloads := c.Subscribe(subCtx, Subscription{Topics: []string{"orders"}, Group: "g"})
+	delivered := 0
+	if p := <-payloads; p.Err() != nil {
+		t.Fatal(p.Err())
+	}
+	delivered++
+	subCancel()
+	for p := range payloads {
+		if p.Err() == nil {
+			delivered++
+		}
+	}
+
+	// the undelivered messages are fetched again by the group
+	payloads = c.Subscribe(ctx, Subscription{Topics: []string{"orders"}, Group: "g"})
+	for i := delivered; i < 5; i++ {
+		p := <-payloads
+		if p.Err() != nil || string(p.Message) != fmt.Sprint(i) {
+			t.Fatalf("read %s, %v, want %d", p.Message, p.Err(), i)
+		}
+	}
+}
+
+func TestGoingAway(t *testing.T) {
+	s := jellyfishtest.NewServer(t, jellyfishtest.WithPipe())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	c := dial(ctx, t, s, 0)
+	if err := c.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	closed := make(chan error, 1)
+	go func() { closed <- s.Close() }()
+
+	// the requests within the drain window are answered with the going away flag
+	for !c.GoingAway() {
+		if err := c.Ping(ctx); err != nil && !c.GoingAway() {
+			t.Fatalf("ping = %v before going away", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := c.Publish(ctx, &producer.Params{Topic: "orders"}); !errors.Is(err, ErrGoingAway) {
+		t.Fatalf("publish = %v, want ErrGoingAway", err)
+	}
+
+	p := <-c.Subscribe(ctx, Subscription{Topics: []string{"orders"}})
+	if !errors.Is(p.Err(), ErrGoingAway) {
+		t.Fatalf("subscribe = %v, want ErrGoingAway", p.Err())
+	}
+
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,98 @@
+package ping
+
+import (
+	"runtime/debug"
+
+	"github.com/baibikov/jellyfish/pkg/brokererr"
+	"github.com/baibikov/jellyfish/pkg/conn"
+)
+
+// Protocol versions spoken by this client and broker. Version 1 wrote bare
+// protobuf messages and is not spoken, version 2 is the framed handshake of
+// the role only, version 3 negotiates the versions and the features.
+const (
+	ProtocolVersion    uint32 = 3
+	MinProtocolVersion uint32 = conn.FramedVersion
+)
+
+// Features a client and a broker may support, the handshake agrees on
+// the features both support and the broker refuses the requests using the
+// others. Batching are the acks levels below ACKS_ALL. Compression codecs
+// and auth mechanisms are not negotiated yet: the frames are not compressed,
+// the connections are not authenticated and such features are left out.
+const (
+	FeatureBatching     = "batching"
+	FeatureTransactions = "transactions"
+	FeatureDelayed      = "delayed"
+	FeaturePriority     = "priority"
+	FeatureFilters      = "filters"
+	FeaturePatterns     = "patterns"
+	FeatureSnapshot     = "snapshot"
+	FeatureRequestReply = "request-reply"
+	// FeatureMultiplex is the Multiplex connection role.
+	FeatureMultiplex = "multiplex"
+)
+
+// Features are the features of this version.
+var Features = []string{
+	FeatureBatching,
+	FeatureTransactions,
+	FeatureDelayed,
+	FeaturePriority,
+	FeatureFilters,
+	FeaturePatterns,
+	FeatureSnapshot,
+	FeatureRequestReply,
+	FeatureMultiplex,
+}
+
+// ErrIncompatible is returned when the broker rejected the client protocol.
+var ErrIncompatible = brokererr.ErrIncompatible
+
+// Hello is what the client tells the broker in the handshake.
+type Hello struct {
+	ClientID string
+	// ClientVersion is the client software version, the version of this module by default.
+	ClientVersion string
+	// Features are the features the client supports, nil is Features.
+	Features []string
+}
+
+// Session is the negotiated handshake.
+type Session struct {
+	Version       uint32
+	BrokerVersion string
+	// Features are the features both the client and the broker support.
+	Features []string
+}
+
+// Has reports whether the feature was agreed on.
+func (s *Session) Has(feature string) bool {
+	for _, f := range s.Features {
+		if f == feature {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Version is the software version of this module, (devel) when it is unknown.
+func Version() string {
+	const module = "github.com/baibikov/jellyfish"
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+	if info.Main.Path == module {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == module {
+			return dep.Version
+		}
+	}
+
+	return "(devel)"
+}
@@ -5,8 +5,9 @@ import (
 	"net"
 
 	"github.com/pkg/errors"
-	"google.golang.org/protobuf/proto"
 
+	"github.com/baibikov/jellyfish/pkg/brokererr"
+	"github.com/baibikov/jellyfish/pkg/conn"
 	"github.com/baibikov/jellyfish/protogenerated/messages"
 )
 
@@ -22,6 +23,9 @@ func New(conn net.Conn) Pinger {
 
 type Pinger interface {
 	Ping(ctx context.Context, pt PayloadType) error
+	// Handshake is Ping telling the broker about the client,
+	// it returns the negotiated protocol version and features.
+	Handshake(ctx context.Context, pt PayloadType, hello Hello) (*Session, error)
 }
 
 type PayloadType int
@@ -30,10 +34,27 @@ func (p PayloadType) Int32() int32 {
 	return int32(p)
 }
 
+func (p PayloadType) String() string {
+	switch p {
+	case Publisher:
+		return "publisher"
+	case Consumer:
+		return "consumer"
+	case Partition:
+		return "partition"
+	case Multiplex:
+		return "multiplex"
+	default:
+		return "unknown"
+	}
+}
+
 const (
 	Publisher PayloadType = iota + 1
 	Consumer
 	Partition
+	// Multiplex carries concurrent requests of any kind tagged with ids.
+	Multiplex
 )
 
 func (p *Ping) Ping(ctx context.Context, pt PayloadType) error {
@@ -44,43 +65,65 @@ func (p *Ping) Ping(ctx context.Context, pt PayloadType) error {
 
 	}
 
-	return p.ping(pt)
+	_, err := p.ping(pt, Hello{})
+	return err
 }
 
-func (p *Ping) ping(pt PayloadType) error {
-	message := messages.Ping{
-		Ping: pt.Int32(),
+func (p *Ping) Handshake(ctx context.Context, pt PayloadType, hello Hello) (*Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	bb, err := proto.Marshal(&message)
-	if err != nil {
-		return errors.Wrap(err, "proto-marsh ping message")
+
+	return p.ping(pt, hello)
+}
+
+func (p *Ping) ping(pt PayloadType, hello Hello) (*Session, error) {
+	c := conn.New(p.conn)
+
+	if hello.ClientVersion == "" {
+		hello.ClientVersion = Version()
 	}
-	if len(bb) == 0 {
-		return errors.New("proto-marshal null value")
+	if hello.Features == nil {
+		hello.Features = Features
 	}
 
-	_, err = p.conn.Write(bb)
+	err := c.WriteProto(&messages.Ping{
+		Ping:          pt.Int32(),
+		Version:       ProtocolVersion,
+		MinVersion:    MinProtocolVersion,
+		ClientId:      hello.ClientID,
+		ClientVersion: hello.ClientVersion,
+		Features:      hello.Features,
+	})
 	if err != nil {
-		return errors.Wrap(err, "write proto-message")
+		return nil, errors.Wrap(err, "write ping proto-message")
 	}
 
-	buff := make([]byte, 512)
-	n, err := p.conn.Read(buff)
+	pong := &messages.Pong{}
+	err = c.ReadProto(pong)
 	if err != nil {
-		return errors.Wrap(err, "read pong message")
+		return nil, errors.Wrap(err, "read pong proto-message")
 	}
-	if n == 0 {
-		return errors.New("null from buffer reader")
+	if !pong.Pong {
+		if pong.Failure != nil {
+			return nil, errors.Wrap(brokererr.FromProto(pong.Failure), "handshake rejected")
+		}
+		return nil, errors.New("ping message not ponged")
 	}
 
-	pong := &messages.Pong{}
-	err = proto.Unmarshal(buff[:n], pong)
-	if err != nil {
-		return errors.Wrap(err, "unmarshal pong proto-message")
+	// a broker older than the negotiation speaks the framed version without features
+	version := pong.Version
+	if version == 0 {
+		version = conn.FramedVersion
 	}
-	if !pong.Pong {
-		return errors.New("ping message not ponged")
+	if version < MinProtocolVersion || version > ProtocolVersion {
+		return nil, errors.Wrapf(ErrIncompatible, "broker protocol version %d, want [%d, %d]",
+			version, MinProtocolVersion, ProtocolVersion)
 	}
 
-	return nil
+	return &Session{
+		Version:       version,
+		BrokerVersion: pong.BrokerVersion,
+		Features:      pong.Features,
+	}, nil
 }
@@ -0,0 +1,77 @@
+package ping
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/pkg/conn"
+	"github.com/baibikov/jellyfish/protogenerated/messages"
+)
+
+// broker answers the ping with the pong.
+func broker(t *testing.T, pong *messages.Pong) net.Conn {
+	t.Helper()
+
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+	go func() {
+		defer server.Close()
+
+		c := conn.New(server)
+		ping := &messages.Ping{}
+		if err := c.ReadProto(ping); err != nil {
+			t.Errorf("read ping: %v", err)
+			return
+		}
+		if ping.Version != ProtocolVersion || ping.MinVersion != MinProtocolVersion {
+			t.Errorf("ping versions [%d, %d], want [%d, %d]", ping.MinVersion, ping.Version, MinProtocolVersion, ProtocolVersion)
+		}
+		if err := c.WriteProto(pong); err != nil {
+			t.Errorf("write pong: %v", err)
+		}
+	}()
+
+	return client
+}
+
+func TestHandshake(t *testing.T) {
+	ctx := context.Background()
+
+	session, err := New(broker(t, &messages.Pong{Pong: true, Version: ProtocolVersion, Features: []string{FeatureBatching}})).
+		Handshake(ctx, Publisher, Hello{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Version != ProtocolVersion || !session.Has(FeatureBatching) || session.Has(FeatureMultiplex) {
+		t.Fatalf("session %+v", session)
+	}
+
+	// a broker older than the negotiation answers without the version
+	session, err = New(broker(t, &messages.Pong{Pong: true})).Handshake(ctx, Publisher, Hello{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Version != conn.FramedVersion || len(session.Features) != 0 {
+		t.Fatalf("session %+v, want the framed version without features", session)
+	}
+}
+
+func TestHandshakeRejected(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := New(broker(t, &messages.Pong{Failure: &messages.ErrorFormat{
+		Code:    messages.ErrorCode_ERROR_CODE_INCOMPATIBLE,
+		Message: "client speaks protocol versions [9, 9]",
+	}})).Handshake(ctx, Publisher, Hello{})
+	if !errors.Is(err, ErrIncompatible) {
+		t.Fatalf("handshake: %v, want ErrIncompatible", err)
+	}
+
+	_, err = New(broker(t, &messages.Pong{Pong: true, Version: ProtocolVersion + 1})).Handshake(ctx, Publisher, Hello{})
+	if !errors.Is(err, ErrIncompatible) {
+		t.Fatalf("handshake with a newer broker version: %v, want ErrIncompatible", err)
+	}
+}
@@ -3,76 +3,169 @@ package producer
 import (
 	"context"
 	"net"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/propagation"
+	"go.uber.org/multierr"
 	"google.golang.org/protobuf/proto"
 
 	"github.com/baibikov/jellyfish/internal/pkg/timeoutgroup"
+	"github.com/baibikov/jellyfish/pkg/brokererr"
+	"github.com/baibikov/jellyfish/pkg/conn"
 	"github.com/baibikov/jellyfish/pkg/ping"
 	"github.com/baibikov/jellyfish/protogenerated/messages"
 )
 
+// Acks is a level of the message acknowledgement the producer waits for.
+type Acks int32
+
+const (
+	// AcksAll waits until the message is written and replicated.
+	AcksAll = Acks(messages.Acks_ACKS_ALL)
+	// AcksLeader waits until the message is written, before replication.
+	AcksLeader = Acks(messages.Acks_ACKS_LEADER)
+	// AcksNone does not wait at all.
+	AcksNone = Acks(messages.Acks_ACKS_NONE)
+)
+
 type Config struct {
 	Addr string
+	// ClientID names the producer to the broker, it is shown by the admin clients.
+	ClientID string
+	// Acks is AcksAll by default.
+	Acks Acks
+	// TxnTimeout aborts a transaction not ended within it,
+	// zero is the broker default of a minute.
+	TxnTimeout time.Duration
+	// Dial connects to the broker, net.Dial by default.
+	Dial func(network, addr string) (net.Conn, error)
 }
 
+// Producer is safe for concurrent use, the requests are serialized
+// on its connection.
 type Producer struct {
-	conn   net.Conn
+	conn   *conn.Conn
 	config *Config
 
-	pinged bool
+	// mutex is held across a request and its asks, a concurrent request
+	// would read the asks of another one.
+	mutex     sync.Mutex
+	session   *ping.Session
+	goingAway bool
+	// replies is the reply topic consumer started by the first Request,
+	// it is started again by the next Request once it failed.
+	repliesMutex sync.Mutex
+	replies      *replies
 }
 
+// ErrGoingAway is returned by Push after the broker announced its shutdown,
+// the producer has to be recreated against an available broker.
+var ErrGoingAway = brokererr.ErrGoingAway
+
+// Errors the broker refuses a message with, Push returns them wrapped
+// so they are matched with errors.Is.
+var (
+	ErrTopicNotFound     = brokererr.ErrTopicNotFound
+	ErrUnauthorized      = brokererr.ErrUnauthorized
+	ErrMessageTooLarge   = brokererr.ErrMessageTooLarge
+	ErrNotLeader         = brokererr.ErrNotLeader
+	ErrThrottled         = brokererr.ErrThrottled
+	ErrInvalidRequest    = brokererr.ErrInvalidRequest
+	ErrReplicationFailed = brokererr.ErrReplicationFailed
+	ErrSchemaRejected    = brokererr.ErrSchemaRejected
+)
+
 func New(config *Config) (*Producer, error) {
 	if config == nil {
 		return nil, errors.New("config has not empty")
 	}
 
-	conn, err := net.Dial("tcp", config.Addr)
+	dial := config.Dial
+	if dial == nil {
+		dial = net.Dial
+	}
+
+	nc, err := dial("tcp", config.Addr)
 	if err != nil {
 		return nil, errors.Wrapf(err, "publisher: connect by addr %s", config.Addr)
 	}
 
 	return &Producer{
-		conn:   conn,
+		conn:   conn.New(nc),
 		config: config,
 	}, nil
 }
 
 func (p *Producer) Close() error {
-	return errors.Wrap(p.conn.Close(), "publisher close")
+	err := errors.Wrap(p.conn.Close(), "publisher close")
+
+	p.repliesMutex.Lock()
+	defer p.repliesMutex.Unlock()
+	if p.replies != nil {
+		err = multierr.Append(err, p.replies.Close())
+		p.replies = nil
+	}
+
+	return err
 }
 
 type Params struct {
 	Topic   string
+	Key     string
 	Message []byte
+	// Headers is a message metadata delivered to consumers as is.
+	Headers map[string]string
+	// DeliverAt holds the message on the broker until the time.
+	DeliverAt time.Time
+	// Delay holds the message on the broker for the duration counted
+	// by the broker clock, it is ignored when DeliverAt is set.
+	Delay time.Duration
+	// TTL drops the message not consumed within the duration after it
+	// becomes visible, zero is the topic default.
+	TTL time.Duration
+	// Priority from 0 to 9 orders the delivery of a priority topic, higher first.
+	Priority int
+	// SchemaID is the id of the registered schema the message is encoded with,
+	// sent in HeaderSchemaID, zero is none.
+	SchemaID int
 }
 
+// HeaderSchemaID carries the schema id of the message, a topic requiring
+// the schema rejects the messages without a registered one by ErrSchemaRejected.
+const HeaderSchemaID = "jellyfish-schema-id"
+
 func (p *Producer) Push(ctx context.Context, params *Params) error {
 	if params == nil {
 		return nil
 	}
 
-	return p.push(ctx, params)
+	return p.push(ctx, 0, params)
 }
 
-func (p *Producer) push(ctx context.Context, params *Params) error {
-	if !p.pinged {
-		if err := ping.New(p.conn).Ping(ctx, ping.Publisher); err != nil {
-			return err
-		}
-		p.pinged = true
+// PushBatch sends every message before waiting for the acknowledgements,
+// the messages are written in order.
+func (p *Producer) PushBatch(ctx context.Context, batch []*Params) error {
+	if len(batch) == 0 {
+		return nil
 	}
 
-	pp := &messages.ProducerPayload{
-		Topic:   params.Topic,
-		Message: params.Message,
-	}
+	return p.push(ctx, 0, batch...)
+}
 
-	bb, err := proto.Marshal(pp)
-	if err != nil {
-		return errors.Wrap(err, "proto-marshal producer payload")
+// push sends the batch in the transaction, zero is none.
+func (p *Producer) push(ctx context.Context, txn uint64, batch ...*Params) error {
+	payloads := make([]*messages.ProducerPayload, 0, len(batch))
+	for _, params := range batch {
+		if params == nil {
+			continue
+		}
+
+		payload := NewPayload(ctx, params, p.config.Acks)
+		payload.Txn = txn
+		payloads = append(payloads, payload)
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, time.Second*2)
@@ -81,33 +174,124 @@ func (p *Producer) push(ctx context.Context, params *Params) error {
 	group := timeoutgroup.New(ctx)
 
 	group.Go(func() error {
-		return p.sendMessage(bb)
+		// held by the goroutine, a timed out push still reads its asks
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		if err := p.ping(ctx); err != nil {
+			return err
+		}
+		return p.sendMessages(payloads)
 	})
 
 	return errors.Wrap(group.Wait(), "message send")
 }
 
-const producerAskMessageSize = 512
+func (p *Producer) ping(ctx context.Context) error {
+	if p.goingAway {
+		return ErrGoingAway
+	}
 
-func (p *Producer) sendMessage(payload []byte) error {
-	_, err := p.conn.Write(payload)
-	if err != nil {
+	if p.session == nil {
+		session, err := ping.New(p.conn).Handshake(ctx, ping.Publisher, ping.Hello{ClientID: p.config.ClientID})
+		if err != nil {
+			return err
+		}
+		p.session = session
+	}
+
+	return nil
+}
+
+// Session is the handshake negotiated with the broker by the first request, nil before.
+func (p *Producer) Session() *ping.Session {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.session
+}
+
+// NewPayload is the wire payload of the message, its headers carry the trace
+// context of ctx. The clients writing to the broker by other connections send
+// the messages of this package with it.
+func NewPayload(ctx context.Context, params *Params, acks Acks) *messages.ProducerPayload {
+	payload := &messages.ProducerPayload{
+		Topic:    params.Topic,
+		Key:      params.Key,
+		Message:  params.Message,
+		Headers:  traceHeaders(ctx, params.Headers),
+		Acks:     messages.Acks(acks),
+		Ttl:      int64(params.TTL),
+		Priority: int32(params.Priority),
+	}
+	switch {
+	case !params.DeliverAt.IsZero():
+		payload.DeliverAt = proto.Int64(params.DeliverAt.UnixNano())
+	case params.Delay > 0:
+		payload.Delay = proto.Int64(int64(params.Delay))
+	}
+	if params.SchemaID != 0 {
+		payload.Headers[HeaderSchemaID] = strconv.Itoa(params.SchemaID)
+	}
+
+	return payload
+}
+
+// traceHeaders copies headers with the w3c trace context of ctx injected.
+func traceHeaders(ctx context.Context, headers map[string]string) map[string]string {
+	out := make(map[string]string, len(headers)+2)
+	for k, v := range headers {
+		out[k] = v
+	}
+
+	propagation.TraceContext{}.Inject(ctx, propagation.MapCarrier(out))
+	return out
+}
+
+func (p *Producer) sendMessages(payloads []*messages.ProducerPayload) error {
+	// the batch is written at once
+	mm := make([]proto.Message, 0, len(payloads))
+	for _, payload := range payloads {
+		mm = append(mm, payload)
+	}
+	if err := p.conn.WriteProtos(mm...); err != nil {
 		return errors.Wrap(err, "write payload to connection")
 	}
 
-	buff := make([]byte, producerAskMessageSize)
-	n, err := p.conn.Read(buff)
-	if err != nil {
-		return err
+	if p.config.Acks == AcksNone {
+		return nil
 	}
-	if n == 0 {
-		return errors.New("null from buffer reader")
+
+	// every ask of the batch is read to keep the stream in sync,
+	// the first refused message is reported
+	var refused error
+	for range payloads {
+		err := p.readAsk()
+		if errors.As(err, new(*brokererr.Error)) {
+			if refused == nil {
+				refused = err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
 	}
 
+	return refused
+}
+
+func (p *Producer) readAsk() error {
 	ask := &messages.ProducerAsk{}
-	err = proto.Unmarshal(buff[:n], ask)
+	err := p.conn.ReadProto(ask)
 	if err != nil {
-		return errors.Wrap(err, "proto-unmarshal ask message")
+		return errors.Wrap(err, "read ask message")
+	}
+	if ask.GoingAway {
+		p.goingAway = true
+	}
+	if ask.Failure != nil {
+		return errors.Wrap(brokererr.FromProto(ask.Failure), "message refused")
 	}
 	if !ask.Ask {
 		return errors.New("producer message dont asked")
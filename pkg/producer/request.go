@@ -0,0 +1,258 @@
+package producer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/multierr"
+
+	"github.com/baibikov/jellyfish/pkg/conn"
+	"github.com/baibikov/jellyfish/pkg/ping"
+	"github.com/baibikov/jellyfish/protogenerated/messages"
+)
+
+// Headers of the request and reply messages.
+const (
+	// HeaderReplyTo is the topic the reply is pushed to.
+	HeaderReplyTo = "jellyfish-reply-to"
+	// HeaderCorrelationID matches the reply with its request.
+	HeaderCorrelationID = "jellyfish-correlation-id"
+	// HeaderReplyError carries the error the request was failed with.
+	HeaderReplyError = "jellyfish-reply-error"
+)
+
+// DefaultRequestTimeout bounds Request when the ctx has no deadline.
+const DefaultRequestTimeout = time.Second * 10
+
+// ErrReply is returned by Request when the replier failed the request.
+var ErrReply = errors.New("request failed by the replier")
+
+// Reply is the response to a request.
+type Reply struct {
+	Message []byte
+	Headers map[string]string
+}
+
+// Request pushes the message with the reply-to and correlation-id headers
+// and waits for the matching reply. The replies are consumed from a private
+// reply topic the broker deletes when the producer is closed, the next Request
+// after the reply topic consumer failed subscribes a new one.
+// Concurrent requests wait for their replies together.
+func (p *Producer) Request(ctx context.Context, topic string, message []byte) (*Reply, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultRequestTimeout)
+		defer cancel()
+	}
+
+	replies, err := p.repliesConsumer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := correlationID()
+	if err != nil {
+		return nil, err
+	}
+
+	wait := replies.wait(id)
+	defer replies.cancel(id)
+
+	err = p.Push(ctx, &Params{
+		Topic:   topic,
+		Message: message,
+		Headers: map[string]string{
+			HeaderReplyTo:       replies.topic,
+			HeaderCorrelationID: id,
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "push request")
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, errors.Wrapf(ctx.Err(), "wait reply to the request %s", id)
+	case <-replies.done:
+		return nil, errors.Wrap(replies.err, "wait reply")
+	case m := <-wait:
+		if e := m.GetHeaders()[HeaderReplyError]; e != "" {
+			return nil, errors.Wrap(ErrReply, e)
+		}
+
+		return &Reply{
+			Message: m.GetMessage(),
+			Headers: m.GetHeaders(),
+		}, nil
+	}
+}
+
+// repliesConsumer returns the reply topic consumer, a failed one is closed
+// and replaced by a new reply topic.
+func (p *Producer) repliesConsumer(ctx context.Context) (*replies, error) {
+	p.repliesMutex.Lock()
+	defer p.repliesMutex.Unlock()
+
+	if p.replies != nil {
+		select {
+		case <-p.replies.done:
+			if err := p.replies.Close(); err != nil {
+				logrus.Debug("producer: ", err)
+			}
+			p.replies = nil
+		default:
+			return p.replies, nil
+		}
+	}
+
+	r, err := newReplies(ctx, p.config)
+	if err != nil {
+		return nil, err
+	}
+
+	p.replies = r
+	return r, nil
+}
+
+func correlationID() (string, error) {
+	bb := make([]byte, 16)
+	if _, err := rand.Read(bb); err != nil {
+		return "", errors.Wrap(err, "generate correlation id")
+	}
+
+	return hex.EncodeToString(bb), nil
+}
+
+// replyPollWait is how long the broker holds a poll of the empty reply topic.
+const replyPollWait = time.Second
+
+// replies consumes the reply topic and hands the replies to the waiting requests.
+type replies struct {
+	conn  *conn.Conn
+	topic string
+
+	mutex   sync.Mutex
+	pending map[string]chan *messages.ConsumerResponse
+
+	// err is the reason the consumption stopped, set before done is closed.
+	err  error
+	done chan struct{}
+}
+
+func newReplies(ctx context.Context, config *Config) (*replies, error) {
+	dial := config.Dial
+	if dial == nil {
+		dial = net.Dial
+	}
+
+	nc, err := dial("tcp", config.Addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "replies: connect by addr %s", config.Addr)
+	}
+
+	r := &replies{
+		conn:    conn.New(nc),
+		pending: make(map[string]chan *messages.ConsumerResponse),
+		done:    make(chan struct{}),
+	}
+	if err := r.subscribe(ctx, config.ClientID); err != nil {
+		return nil, multierr.Append(err, r.conn.Close())
+	}
+
+	go r.consume()
+	return r, nil
+}
+
+// subscribe asks the broker for the ephemeral reply topic.
+func (r *replies) subscribe(ctx context.Context, clientID string) error {
+	_, err := ping.New(r.conn).Handshake(ctx, ping.Consumer, ping.Hello{ClientID: clientID})
+	if err != nil {
+		return err
+	}
+
+	err = r.conn.WriteProto(&messages.ConsumerPayload{
+		Ephemeral: true,
+		MaxWait:   int64(replyPollWait),
+	})
+	if err != nil {
+		return errors.Wrap(err, "write reply topic subscription")
+	}
+
+	cp := &messages.ConsumerPayload{}
+	if err := r.conn.ReadProto(cp); err != nil {
+		return errors.Wrap(err, "read reply topic subscription")
+	}
+	if cp.GetTopic() == "" {
+		return errors.New("broker does not support reply topics")
+	}
+
+	r.topic = cp.GetTopic()
+	return nil
+}
+
+func (r *replies) consume() {
+	defer close(r.done)
+
+	for {
+		if err := r.conn.WriteFrame(nil); err != nil {
+			r.err = errors.Wrap(err, "poll reply topic")
+			return
+		}
+
+		m := &messages.ConsumerResponse{}
+		if err := r.conn.ReadProto(m); err != nil {
+			r.err = errors.Wrap(err, "read reply")
+			return
+		}
+
+		if m.IsEmpty {
+			if m.GoingAway {
+				r.err = ErrGoingAway
+				return
+			}
+			continue
+		}
+
+		r.mutex.Lock()
+		wait, ok := r.pending[m.GetHeaders()[HeaderCorrelationID]]
+		r.mutex.Unlock()
+		if ok {
+			// buffered by one, a late duplicate reply is dropped
+			select {
+			case wait <- m:
+			default:
+			}
+		}
+
+		if m.GoingAway {
+			r.err = ErrGoingAway
+			return
+		}
+	}
+}
+
+func (r *replies) wait(id string) <-chan *messages.ConsumerResponse {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	wait := make(chan *messages.ConsumerResponse, 1)
+	r.pending[id] = wait
+	return wait
+}
+
+func (r *replies) cancel(id string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.pending, id)
+}
+
+func (r *replies) Close() error {
+	return errors.Wrap(r.conn.Close(), "replies close")
+}
@@ -0,0 +1,177 @@
+package producer_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/pkg/consumer"
+	"github.com/baibikov/jellyfish/pkg/jellyfishtest"
+	"github.com/baibikov/jellyfish/pkg/producer"
+)
+
+// serveUpper replies to the requests of the topic with the upper cased message,
+// an empty message is failed.
+func serveUpper(ctx context.Context, t *testing.T, s *jellyfishtest.Server, topic string) {
+	t.Helper()
+
+	c, err := consumer.New(s.ConsumerConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	p, err := producer.New(s.ProducerConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+
+	go func() {
+		_ = c.Serve(ctx, topic, p, func(_ context.Context, request consumer.Payload) ([]byte, error) {
+			if len(request.Message) == 0 {
+				return nil, errors.New("empty request")
+			}
+			return []byte(strings.ToUpper(string(request.Message))), nil
+		})
+	}()
+}
+
+// recordingDial keeps the connections dialed by the producer.
+type recordingDial struct {
+	dial  func(network, addr string) (net.Conn, error)
+	mutex sync.Mutex
+	conns []net.Conn
+}
+
+func (d *recordingDial) Dial(network, addr string) (net.Conn, error) {
+	c, err := d.dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.conns = append(d.conns, c)
+	return c, nil
+}
+
+func (d *recordingDial) conn(i int) net.Conn {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if i >= len(d.conns) {
+		return nil
+	}
+	return d.conns[i]
+}
+
+func TestRequest(t *testing.T) {
+	s := jellyfishtest.NewServer(t, jellyfishtest.WithPipe())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	serveUpper(ctx, t, s, "upper")
+
+	p, err := producer.New(s.ProducerConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	reply, err := p.Request(ctx, "upper", []byte("eurusd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reply.Message) != "EURUSD" {
+		t.Fatalf("reply = %s, want EURUSD", reply.Message)
+	}
+
+	if _, err := p.Request(ctx, "upper", nil); !errors.Is(err, producer.ErrReply) {
+		t.Fatalf("failed request = %v, want the replier error", err)
+	}
+}
+
+func TestRequestConcurrent(t *testing.T) {
+	s := jellyfishtest.NewServer(t, jellyfishtest.WithPipe())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	serveUpper(ctx, t, s, "upper")
+
+	p, err := producer.New(s.ProducerConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			message := strings.Repeat("x", i+1)
+			reply, err := p.Request(ctx, "upper", []byte(message))
+			if err != nil {
+				t.Errorf("request %d: %v", i, err)
+				return
+			}
+			if want := strings.ToUpper(message); string(reply.Message) != want {
+				t.Errorf("request %d reply = %s, want %s", i, reply.Message, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestRequestRestartsFailedReplies(t *testing.T) {
+	s := jellyfishtest.NewServer(t, jellyfishtest.WithPipe())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	serveUpper(ctx, t, s, "upper")
+
+	d := &recordingDial{dial: s.Dial}
+	config := s.ProducerConfig()
+	config.Dial = d.Dial
+	p, err := producer.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if _, err := p.Request(ctx, "upper", []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the reply topic connection is the second one, it fails the waiting requests
+	replies := d.conn(1)
+	if replies == nil {
+		t.Fatal("reply topic connection is not dialed")
+	}
+	replies.Close()
+
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		reply, err := p.Request(ctx, "upper", []byte("second"))
+		if err == nil {
+			if string(reply.Message) != "SECOND" {
+				t.Fatalf("reply = %s, want SECOND", reply.Message)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("request after the reply consumer failed: %v", err)
+		}
+	}
+
+	if d.conn(2) == nil {
+		t.Fatal("reply topic consumer is not started again")
+	}
+}
@@ -0,0 +1,140 @@
+package producer
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+
+	"github.com/baibikov/jellyfish/internal/pkg/timeoutgroup"
+	"github.com/baibikov/jellyfish/pkg/brokererr"
+	"github.com/baibikov/jellyfish/protogenerated/messages"
+)
+
+// ErrTxn is returned when the broker refused a transaction request,
+// e.g. the commit of a transaction a failed push or the timeout aborted.
+var ErrTxn = errors.New("transaction failed")
+
+// Txn is a transaction, its messages written to any topics are delivered
+// to the read committed consumers all together on Commit or never on Abort.
+// A transaction is used by one goroutine, the producer serves one at a time.
+type Txn struct {
+	producer *Producer
+	id       uint64
+	ended    bool
+}
+
+// BeginTxn begins a transaction aborted by the broker after Config.TxnTimeout
+// or when the producer connection closes.
+func (p *Producer) BeginTxn(ctx context.Context) (*Txn, error) {
+	ask, err := p.control(ctx, &messages.ProducerPayload{
+		TxnOp:      messages.TxnOp_TXN_OP_BEGIN,
+		TxnTimeout: int64(p.config.TxnTimeout),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "begin transaction")
+	}
+
+	return &Txn{producer: p, id: ask.Txn}, nil
+}
+
+// ID is the broker transaction id.
+func (t *Txn) ID() uint64 {
+	return t.id
+}
+
+// Push writes the messages in the transaction, the delayed messages are refused.
+// A failed message aborts the transaction, Commit reports the failure.
+func (t *Txn) Push(ctx context.Context, batch ...*Params) error {
+	if t.ended {
+		return errors.Wrapf(ErrTxn, "transaction %d ended", t.id)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	return t.producer.push(ctx, t.id, batch...)
+}
+
+// CommitOffset commits the offset of the next message the consumer group reads
+// from the topic with the transaction, Payload.Offset+1 of the processed message.
+// A consumer with consumer.Config.ResumeCommitted starts from it, so a processor
+// publishing its outputs and committing its input offset in one transaction
+// processes every input message exactly once across restarts.
+func (t *Txn) CommitOffset(ctx context.Context, group, topic string, offset int64) error {
+	if t.ended {
+		return errors.Wrapf(ErrTxn, "transaction %d ended", t.id)
+	}
+
+	_, err := t.producer.control(ctx, &messages.ProducerPayload{
+		TxnOp:  messages.TxnOp_TXN_OP_OFFSET,
+		Txn:    t.id,
+		Topic:  topic,
+		Group:  group,
+		Offset: offset,
+	})
+	return errors.Wrapf(err, "commit offset %d of group %q on topic %s", offset, group, topic)
+}
+
+// Commit makes the transaction messages visible.
+func (t *Txn) Commit(ctx context.Context) error {
+	return t.end(ctx, messages.TxnOp_TXN_OP_COMMIT)
+}
+
+// Abort drops the transaction messages.
+func (t *Txn) Abort(ctx context.Context) error {
+	return t.end(ctx, messages.TxnOp_TXN_OP_ABORT)
+}
+
+func (t *Txn) end(ctx context.Context, op messages.TxnOp) error {
+	if t.ended {
+		return errors.Wrapf(ErrTxn, "transaction %d ended", t.id)
+	}
+	t.ended = true
+
+	_, err := t.producer.control(ctx, &messages.ProducerPayload{
+		TxnOp: op,
+		Txn:   t.id,
+	})
+	return errors.Wrapf(err, "end transaction %d", t.id)
+}
+
+// control sends the transaction request and reads its ask regardless of the acks.
+func (p *Producer) control(ctx context.Context, payload *messages.ProducerPayload) (*messages.ProducerAsk, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*2)
+	defer cancel()
+
+	ask := &messages.ProducerAsk{}
+	group := timeoutgroup.New(ctx)
+	group.Go(func() error {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		if err := p.ping(ctx); err != nil {
+			return err
+		}
+		if err := p.conn.WriteProto(payload); err != nil {
+			return errors.Wrap(err, "write payload to connection")
+		}
+		if err := p.conn.ReadProto(ask); err != nil {
+			return errors.Wrap(err, "read ask message")
+		}
+		if ask.GoingAway {
+			p.goingAway = true
+		}
+		if !ask.Ask && ask.Failure != nil {
+			// matches both ErrTxn and the broker error
+			return multierr.Append(ErrTxn, brokererr.FromProto(ask.Failure))
+		}
+		if !ask.Ask {
+			return errors.Wrap(ErrTxn, ask.Error)
+		}
+		return nil
+	})
+
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	return ask, nil
+}
@@ -0,0 +1,47 @@
+package producer
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/baibikov/jellyfish/pkg/codec"
+)
+
+// Pusher pushes the messages, e.g. Producer or the client.Producer of a pool.
+type Pusher interface {
+	Push(ctx context.Context, params *Params) error
+}
+
+// Typed pushes the values of T encoded by the codec, the codec name is sent
+// in the codec.HeaderContentType header.
+type Typed[T any] struct {
+	pusher Pusher
+	codec  codec.Codec
+}
+
+func NewTyped[T any](pusher Pusher, c codec.Codec) *Typed[T] {
+	return &Typed[T]{pusher: pusher, codec: c}
+}
+
+// Push pushes the value with the params, the params message is ignored.
+func (t *Typed[T]) Push(ctx context.Context, params *Params, value T) error {
+	if params == nil {
+		return errors.New("params has not be nil")
+	}
+
+	message, err := t.codec.Marshal(value)
+	if err != nil {
+		return errors.Wrapf(err, "encode %s", t.codec.Name())
+	}
+
+	typed := *params
+	typed.Message = message
+	typed.Headers = make(map[string]string, len(params.Headers)+1)
+	for k, v := range params.Headers {
+		typed.Headers[k] = v
+	}
+	typed.Headers[codec.HeaderContentType] = t.codec.Name()
+
+	return t.pusher.Push(ctx, &typed)
+}
@@ -0,0 +1,57 @@
+package producer_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/baibikov/jellyfish/pkg/codec"
+	"github.com/baibikov/jellyfish/pkg/producer"
+)
+
+// pushed records the pushed params.
+type pushed []*producer.Params
+
+func (p *pushed) Push(_ context.Context, params *producer.Params) error {
+	*p = append(*p, params)
+	return nil
+}
+
+func TestTypedPush(t *testing.T) {
+	var out pushed
+	typed := producer.NewTyped[map[string]int](&out, codec.JSON)
+
+	params := &producer.Params{Topic: "orders", Message: []byte("ignored"), Headers: map[string]string{"source": "test"}}
+	if err := typed.Push(context.Background(), params, map[string]int{"items": 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out) != 1 {
+		t.Fatalf("pushed %d messages, want 1", len(out))
+	}
+	got := out[0]
+	if got.Topic != "orders" || string(got.Message) != `{"items":2}` {
+		t.Errorf("pushed %s to %s", got.Message, got.Topic)
+	}
+	if got.Headers["source"] != "test" || got.Headers[codec.HeaderContentType] != codec.JSON.Name() {
+		t.Errorf("headers %v, want the params headers and the content type", got.Headers)
+	}
+	// the caller params are not changed
+	if string(params.Message) != "ignored" || len(params.Headers) != 1 {
+		t.Errorf("params changed to %+v", params)
+	}
+}
+
+func TestTypedPushFailed(t *testing.T) {
+	var out pushed
+	typed := producer.NewTyped[int](&out, codec.Raw)
+
+	if err := typed.Push(context.Background(), &producer.Params{Topic: "orders"}, 1); err == nil {
+		t.Error("push of a value the codec does not encode succeeded")
+	}
+	if err := typed.Push(context.Background(), nil, 1); err == nil {
+		t.Error("push without params succeeded")
+	}
+	if len(out) != 0 {
+		t.Errorf("pushed %d messages, want none", len(out))
+	}
+}
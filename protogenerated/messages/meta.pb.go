@@ -20,12 +20,101 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// ErrorCode classifies a broker error, the clients map it to their error values.
+type ErrorCode int32
+
+const (
+	ErrorCode_ERROR_CODE_UNKNOWN            ErrorCode = 0
+	ErrorCode_ERROR_CODE_TOPIC_NOT_FOUND    ErrorCode = 1
+	ErrorCode_ERROR_CODE_UNAUTHORIZED       ErrorCode = 2
+	ErrorCode_ERROR_CODE_MESSAGE_TOO_LARGE  ErrorCode = 3
+	ErrorCode_ERROR_CODE_NOT_LEADER         ErrorCode = 4
+	ErrorCode_ERROR_CODE_THROTTLED          ErrorCode = 5
+	ErrorCode_ERROR_CODE_INVALID_REQUEST    ErrorCode = 6
+	ErrorCode_ERROR_CODE_TXN_NOT_FOUND      ErrorCode = 7
+	ErrorCode_ERROR_CODE_INCOMPATIBLE       ErrorCode = 8
+	ErrorCode_ERROR_CODE_GOING_AWAY         ErrorCode = 9
+	ErrorCode_ERROR_CODE_REPLICATION_FAILED ErrorCode = 10
+	ErrorCode_ERROR_CODE_TOPIC_EXISTS       ErrorCode = 11
+	ErrorCode_ERROR_CODE_SCHEMA_REJECTED    ErrorCode = 12
+)
+
+// Enum value maps for ErrorCode.
+var (
+	ErrorCode_name = map[int32]string{
+		0:  "ERROR_CODE_UNKNOWN",
+		1:  "ERROR_CODE_TOPIC_NOT_FOUND",
+		2:  "ERROR_CODE_UNAUTHORIZED",
+		3:  "ERROR_CODE_MESSAGE_TOO_LARGE",
+		4:  "ERROR_CODE_NOT_LEADER",
+		5:  "ERROR_CODE_THROTTLED",
+		6:  "ERROR_CODE_INVALID_REQUEST",
+		7:  "ERROR_CODE_TXN_NOT_FOUND",
+		8:  "ERROR_CODE_INCOMPATIBLE",
+		9:  "ERROR_CODE_GOING_AWAY",
+		10: "ERROR_CODE_REPLICATION_FAILED",
+		11: "ERROR_CODE_TOPIC_EXISTS",
+		12: "ERROR_CODE_SCHEMA_REJECTED",
+	}
+	ErrorCode_value = map[string]int32{
+		"ERROR_CODE_UNKNOWN":            0,
+		"ERROR_CODE_TOPIC_NOT_FOUND":    1,
+		"ERROR_CODE_UNAUTHORIZED":       2,
+		"ERROR_CODE_MESSAGE_TOO_LARGE":  3,
+		"ERROR_CODE_NOT_LEADER":         4,
+		"ERROR_CODE_THROTTLED":          5,
+		"ERROR_CODE_INVALID_REQUEST":    6,
+		"ERROR_CODE_TXN_NOT_FOUND":      7,
+		"ERROR_CODE_INCOMPATIBLE":       8,
+		"ERROR_CODE_GOING_AWAY":         9,
+		"ERROR_CODE_REPLICATION_FAILED": 10,
+		"ERROR_CODE_TOPIC_EXISTS":       11,
+		"ERROR_CODE_SCHEMA_REJECTED":    12,
+	}
+)
+
+func (x ErrorCode) Enum() *ErrorCode {
+	p := new(ErrorCode)
+	*p = x
+	return p
+}
+
+func (x ErrorCode) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ErrorCode) Descriptor() protoreflect.EnumDescriptor {
+	return file_api_proto_meta_proto_enumTypes[0].Descriptor()
+}
+
+func (ErrorCode) Type() protoreflect.EnumType {
+	return &file_api_proto_meta_proto_enumTypes[0]
+}
+
+func (x ErrorCode) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ErrorCode.Descriptor instead.
+func (ErrorCode) EnumDescriptor() ([]byte, []int) {
+	return file_api_proto_meta_proto_rawDescGZIP(), []int{0}
+}
+
+// Ping opens the handshake of a connection, ping is the connection role.
+// A framed client older than the negotiation sends only the role and speaks version 2.
 type Ping struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
 	Ping int32 `protobuf:"varint,1,opt,name=ping,proto3" json:"ping,omitempty"`
+	// version and minVersion are the protocol versions the client speaks.
+	Version       uint32 `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	MinVersion    uint32 `protobuf:"varint,3,opt,name=minVersion,proto3" json:"minVersion,omitempty"`
+	ClientId      string `protobuf:"bytes,4,opt,name=clientId,proto3" json:"clientId,omitempty"`
+	ClientVersion string `protobuf:"bytes,5,opt,name=clientVersion,proto3" json:"clientVersion,omitempty"`
+	// features are the features the client supports, e.g. transactions or multiplex.
+	Features []string `protobuf:"bytes,6,rep,name=features,proto3" json:"features,omitempty"`
 }
 
 func (x *Ping) Reset() {
@@ -67,12 +156,55 @@ func (x *Ping) GetPing() int32 {
 	return 0
 }
 
+func (x *Ping) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Ping) GetMinVersion() uint32 {
+	if x != nil {
+		return x.MinVersion
+	}
+	return 0
+}
+
+func (x *Ping) GetClientId() string {
+	if x != nil {
+		return x.ClientId
+	}
+	return ""
+}
+
+func (x *Ping) GetClientVersion() string {
+	if x != nil {
+		return x.ClientVersion
+	}
+	return ""
+}
+
+func (x *Ping) GetFeatures() []string {
+	if x != nil {
+		return x.Features
+	}
+	return nil
+}
+
+// Pong answers the handshake, pong is false for a rejected client.
 type Pong struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
 	Pong bool `protobuf:"varint,1,opt,name=pong,proto3" json:"pong,omitempty"`
+	// version is the negotiated protocol version.
+	Version       uint32 `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	BrokerVersion string `protobuf:"bytes,3,opt,name=brokerVersion,proto3" json:"brokerVersion,omitempty"`
+	// features are the features both the client and the broker support.
+	Features []string `protobuf:"bytes,4,rep,name=features,proto3" json:"features,omitempty"`
+	// failure is the reason the client was rejected.
+	Failure *ErrorFormat `protobuf:"bytes,6,opt,name=failure,proto3" json:"failure,omitempty"`
 }
 
 func (x *Pong) Reset() {
@@ -114,12 +246,46 @@ func (x *Pong) GetPong() bool {
 	return false
 }
 
+func (x *Pong) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Pong) GetBrokerVersion() string {
+	if x != nil {
+		return x.BrokerVersion
+	}
+	return ""
+}
+
+func (x *Pong) GetFeatures() []string {
+	if x != nil {
+		return x.Features
+	}
+	return nil
+}
+
+func (x *Pong) GetFailure() *ErrorFormat {
+	if x != nil {
+		return x.Failure
+	}
+	return nil
+}
+
+// ErrorFormat is the typed error of a failed request.
 type ErrorFormat struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Message string `protobuf:"bytes,1,opt,name=Message,proto3" json:"Message,omitempty"`
+	Message string    `protobuf:"bytes,1,opt,name=Message,proto3" json:"Message,omitempty"`
+	Code    ErrorCode `protobuf:"varint,2,opt,name=code,proto3,enum=messages.ErrorCode" json:"code,omitempty"`
+	// retriable is set when the same request may succeed later.
+	Retriable bool `protobuf:"varint,3,opt,name=retriable,proto3" json:"retriable,omitempty"`
+	// leader is the broker address to retry on for ERROR_CODE_NOT_LEADER.
+	Leader string `protobuf:"bytes,4,opt,name=leader,proto3" json:"leader,omitempty"`
 }
 
 func (x *ErrorFormat) Reset() {
@@ -161,20 +327,91 @@ func (x *ErrorFormat) GetMessage() string {
 	return ""
 }
 
+func (x *ErrorFormat) GetCode() ErrorCode {
+	if x != nil {
+		return x.Code
+	}
+	return ErrorCode_ERROR_CODE_UNKNOWN
+}
+
+func (x *ErrorFormat) GetRetriable() bool {
+	if x != nil {
+		return x.Retriable
+	}
+	return false
+}
+
+func (x *ErrorFormat) GetLeader() string {
+	if x != nil {
+		return x.Leader
+	}
+	return ""
+}
+
 var File_api_proto_meta_proto protoreflect.FileDescriptor
 
 var file_api_proto_meta_proto_rawDesc = []byte{
 	0x0a, 0x14, 0x61, 0x70, 0x69, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x6d, 0x65, 0x74, 0x61,
 	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x08, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73,
-	0x22, 0x1a, 0x0a, 0x04, 0x50, 0x69, 0x6e, 0x67, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x69, 0x6e, 0x67,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x04, 0x70, 0x69, 0x6e, 0x67, 0x22, 0x1a, 0x0a, 0x04,
-	0x50, 0x6f, 0x6e, 0x67, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x6f, 0x6e, 0x67, 0x18, 0x01, 0x20, 0x01,
-	0x28, 0x08, 0x52, 0x04, 0x70, 0x6f, 0x6e, 0x67, 0x22, 0x27, 0x0a, 0x0b, 0x45, 0x72, 0x72, 0x6f,
-	0x72, 0x46, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x4d, 0x65, 0x73, 0x73, 0x61,
-	0x67, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
-	0x65, 0x42, 0x19, 0x5a, 0x17, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61,
-	0x74, 0x65, 0x64, 0x2f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x62, 0x06, 0x70, 0x72,
-	0x6f, 0x74, 0x6f, 0x33,
+	0x22, 0xb2, 0x01, 0x0a, 0x04, 0x50, 0x69, 0x6e, 0x67, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x69, 0x6e,
+	0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x04, 0x70, 0x69, 0x6e, 0x67, 0x12, 0x18, 0x0a,
+	0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07,
+	0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x1e, 0x0a, 0x0a, 0x6d, 0x69, 0x6e, 0x56, 0x65,
+	0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0a, 0x6d, 0x69, 0x6e,
+	0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x1a, 0x0a, 0x08, 0x63, 0x6c, 0x69, 0x65, 0x6e,
+	0x74, 0x49, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x63, 0x6c, 0x69, 0x65, 0x6e,
+	0x74, 0x49, 0x64, 0x12, 0x24, 0x0a, 0x0d, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x56, 0x65, 0x72,
+	0x73, 0x69, 0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x63, 0x6c, 0x69, 0x65,
+	0x6e, 0x74, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x1a, 0x0a, 0x08, 0x66, 0x65, 0x61,
+	0x74, 0x75, 0x72, 0x65, 0x73, 0x18, 0x06, 0x20, 0x03, 0x28, 0x09, 0x52, 0x08, 0x66, 0x65, 0x61,
+	0x74, 0x75, 0x72, 0x65, 0x73, 0x22, 0xb4, 0x01, 0x0a, 0x04, 0x50, 0x6f, 0x6e, 0x67, 0x12, 0x12,
+	0x0a, 0x04, 0x70, 0x6f, 0x6e, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x04, 0x70, 0x6f,
+	0x6e, 0x67, 0x12, 0x18, 0x0a, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x24, 0x0a, 0x0d,
+	0x62, 0x72, 0x6f, 0x6b, 0x65, 0x72, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0d, 0x62, 0x72, 0x6f, 0x6b, 0x65, 0x72, 0x56, 0x65, 0x72, 0x73, 0x69,
+	0x6f, 0x6e, 0x12, 0x1a, 0x0a, 0x08, 0x66, 0x65, 0x61, 0x74, 0x75, 0x72, 0x65, 0x73, 0x18, 0x04,
+	0x20, 0x03, 0x28, 0x09, 0x52, 0x08, 0x66, 0x65, 0x61, 0x74, 0x75, 0x72, 0x65, 0x73, 0x12, 0x2f,
+	0x0a, 0x07, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x15, 0x2e, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x2e, 0x45, 0x72, 0x72, 0x6f, 0x72,
+	0x46, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x52, 0x07, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x4a,
+	0x04, 0x08, 0x05, 0x10, 0x06, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x22, 0x86, 0x01, 0x0a,
+	0x0b, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x46, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x12, 0x18, 0x0a, 0x07,
+	0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x4d,
+	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x27, 0x0a, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x0e, 0x32, 0x13, 0x2e, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x2e,
+	0x45, 0x72, 0x72, 0x6f, 0x72, 0x43, 0x6f, 0x64, 0x65, 0x52, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x12,
+	0x1c, 0x0a, 0x09, 0x72, 0x65, 0x74, 0x72, 0x69, 0x61, 0x62, 0x6c, 0x65, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x08, 0x52, 0x09, 0x72, 0x65, 0x74, 0x72, 0x69, 0x61, 0x62, 0x6c, 0x65, 0x12, 0x16, 0x0a,
+	0x06, 0x6c, 0x65, 0x61, 0x64, 0x65, 0x72, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x6c,
+	0x65, 0x61, 0x64, 0x65, 0x72, 0x2a, 0x8d, 0x03, 0x0a, 0x09, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x43,
+	0x6f, 0x64, 0x65, 0x12, 0x16, 0x0a, 0x12, 0x45, 0x52, 0x52, 0x4f, 0x52, 0x5f, 0x43, 0x4f, 0x44,
+	0x45, 0x5f, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x1e, 0x0a, 0x1a, 0x45,
+	0x52, 0x52, 0x4f, 0x52, 0x5f, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x54, 0x4f, 0x50, 0x49, 0x43, 0x5f,
+	0x4e, 0x4f, 0x54, 0x5f, 0x46, 0x4f, 0x55, 0x4e, 0x44, 0x10, 0x01, 0x12, 0x1b, 0x0a, 0x17, 0x45,
+	0x52, 0x52, 0x4f, 0x52, 0x5f, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x55, 0x4e, 0x41, 0x55, 0x54, 0x48,
+	0x4f, 0x52, 0x49, 0x5a, 0x45, 0x44, 0x10, 0x02, 0x12, 0x20, 0x0a, 0x1c, 0x45, 0x52, 0x52, 0x4f,
+	0x52, 0x5f, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x4d, 0x45, 0x53, 0x53, 0x41, 0x47, 0x45, 0x5f, 0x54,
+	0x4f, 0x4f, 0x5f, 0x4c, 0x41, 0x52, 0x47, 0x45, 0x10, 0x03, 0x12, 0x19, 0x0a, 0x15, 0x45, 0x52,
+	0x52, 0x4f, 0x52, 0x5f, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x4e, 0x4f, 0x54, 0x5f, 0x4c, 0x45, 0x41,
+	0x44, 0x45, 0x52, 0x10, 0x04, 0x12, 0x18, 0x0a, 0x14, 0x45, 0x52, 0x52, 0x4f, 0x52, 0x5f, 0x43,
+	0x4f, 0x44, 0x45, 0x5f, 0x54, 0x48, 0x52, 0x4f, 0x54, 0x54, 0x4c, 0x45, 0x44, 0x10, 0x05, 0x12,
+	0x1e, 0x0a, 0x1a, 0x45, 0x52, 0x52, 0x4f, 0x52, 0x5f, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x49, 0x4e,
+	0x56, 0x41, 0x4c, 0x49, 0x44, 0x5f, 0x52, 0x45, 0x51, 0x55, 0x45, 0x53, 0x54, 0x10, 0x06, 0x12,
+	0x1c, 0x0a, 0x18, 0x45, 0x52, 0x52, 0x4f, 0x52, 0x5f, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x54, 0x58,
+	0x4e, 0x5f, 0x4e, 0x4f, 0x54, 0x5f, 0x46, 0x4f, 0x55, 0x4e, 0x44, 0x10, 0x07, 0x12, 0x1b, 0x0a,
+	0x17, 0x45, 0x52, 0x52, 0x4f, 0x52, 0x5f, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x49, 0x4e, 0x43, 0x4f,
+	0x4d, 0x50, 0x41, 0x54, 0x49, 0x42, 0x4c, 0x45, 0x10, 0x08, 0x12, 0x19, 0x0a, 0x15, 0x45, 0x52,
+	0x52, 0x4f, 0x52, 0x5f, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x47, 0x4f, 0x49, 0x4e, 0x47, 0x5f, 0x41,
+	0x57, 0x41, 0x59, 0x10, 0x09, 0x12, 0x21, 0x0a, 0x1d, 0x45, 0x52, 0x52, 0x4f, 0x52, 0x5f, 0x43,
+	0x4f, 0x44, 0x45, 0x5f, 0x52, 0x45, 0x50, 0x4c, 0x49, 0x43, 0x41, 0x54, 0x49, 0x4f, 0x4e, 0x5f,
+	0x46, 0x41, 0x49, 0x4c, 0x45, 0x44, 0x10, 0x0a, 0x12, 0x1b, 0x0a, 0x17, 0x45, 0x52, 0x52, 0x4f,
+	0x52, 0x5f, 0x43, 0x4f, 0x44, 0x45, 0x5f, 0x54, 0x4f, 0x50, 0x49, 0x43, 0x5f, 0x45, 0x58, 0x49,
+	0x53, 0x54, 0x53, 0x10, 0x0b, 0x12, 0x1e, 0x0a, 0x1a, 0x45, 0x52, 0x52, 0x4f, 0x52, 0x5f, 0x43,
+	0x4f, 0x44, 0x45, 0x5f, 0x53, 0x43, 0x48, 0x45, 0x4d, 0x41, 0x5f, 0x52, 0x45, 0x4a, 0x45, 0x43,
+	0x54, 0x45, 0x44, 0x10, 0x0c, 0x42, 0x19, 0x5a, 0x17, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x67, 0x65,
+	0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x64, 0x2f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73,
+	0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -189,18 +426,22 @@ func file_api_proto_meta_proto_rawDescGZIP() []byte {
 	return file_api_proto_meta_proto_rawDescData
 }
 
+var file_api_proto_meta_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
 var file_api_proto_meta_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
 var file_api_proto_meta_proto_goTypes = []interface{}{
-	(*Ping)(nil),        // 0: messages.Ping
-	(*Pong)(nil),        // 1: messages.Pong
-	(*ErrorFormat)(nil), // 2: messages.ErrorFormat
+	(ErrorCode)(0),      // 0: messages.ErrorCode
+	(*Ping)(nil),        // 1: messages.Ping
+	(*Pong)(nil),        // 2: messages.Pong
+	(*ErrorFormat)(nil), // 3: messages.ErrorFormat
 }
 var file_api_proto_meta_proto_depIdxs = []int32{
-	0, // [0:0] is the sub-list for method output_type
-	0, // [0:0] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	3, // 0: messages.Pong.failure:type_name -> messages.ErrorFormat
+	0, // 1: messages.ErrorFormat.code:type_name -> messages.ErrorCode
+	2, // [2:2] is the sub-list for method output_type
+	2, // [2:2] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
 }
 
 func init() { file_api_proto_meta_proto_init() }
@@ -251,13 +492,14 @@ func file_api_proto_meta_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_api_proto_meta_proto_rawDesc,
-			NumEnums:      0,
+			NumEnums:      1,
 			NumMessages:   3,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
 		GoTypes:           file_api_proto_meta_proto_goTypes,
 		DependencyIndexes: file_api_proto_meta_proto_depIdxs,
+		EnumInfos:         file_api_proto_meta_proto_enumTypes,
 		MessageInfos:      file_api_proto_meta_proto_msgTypes,
 	}.Build()
 	File_api_proto_meta_proto = out.File
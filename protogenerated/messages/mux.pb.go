@@ -0,0 +1,898 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.27.1
+// 	protoc        v3.17.3
+// source: api/proto/mux.proto
+
+package messages
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// AdminOp is an admin request served over the multiplexed connection.
+type AdminOp int32
+
+const (
+	AdminOp_ADMIN_OP_NONE         AdminOp = 0
+	AdminOp_ADMIN_OP_TOPICS       AdminOp = 1
+	AdminOp_ADMIN_OP_CREATE_TOPIC AdminOp = 2
+	AdminOp_ADMIN_OP_DELETE_TOPIC AdminOp = 3
+)
+
+// Enum value maps for AdminOp.
+var (
+	AdminOp_name = map[int32]string{
+		0: "ADMIN_OP_NONE",
+		1: "ADMIN_OP_TOPICS",
+		2: "ADMIN_OP_CREATE_TOPIC",
+		3: "ADMIN_OP_DELETE_TOPIC",
+	}
+	AdminOp_value = map[string]int32{
+		"ADMIN_OP_NONE":         0,
+		"ADMIN_OP_TOPICS":       1,
+		"ADMIN_OP_CREATE_TOPIC": 2,
+		"ADMIN_OP_DELETE_TOPIC": 3,
+	}
+)
+
+func (x AdminOp) Enum() *AdminOp {
+	p := new(AdminOp)
+	*p = x
+	return p
+}
+
+func (x AdminOp) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (AdminOp) Descriptor() protoreflect.EnumDescriptor {
+	return file_api_proto_mux_proto_enumTypes[0].Descriptor()
+}
+
+func (AdminOp) Type() protoreflect.EnumType {
+	return &file_api_proto_mux_proto_enumTypes[0]
+}
+
+func (x AdminOp) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use AdminOp.Descriptor instead.
+func (AdminOp) EnumDescriptor() ([]byte, []int) {
+	return file_api_proto_mux_proto_rawDescGZIP(), []int{0}
+}
+
+// MuxRequest is a request of a multiplexed connection, the requests are served
+// concurrently and answered by the MuxResponse of the same id in any order.
+type MuxRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// id correlates the response, unique among the requests in flight.
+	Id uint64 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Types that are assignable to Body:
+	//	*MuxRequest_Produce
+	//	*MuxRequest_Subscribe
+	//	*MuxRequest_Fetch
+	//	*MuxRequest_Unsubscribe
+	//	*MuxRequest_Admin
+	//	*MuxRequest_Heartbeat
+	//	*MuxRequest_Release
+	Body isMuxRequest_Body `protobuf_oneof:"body"`
+}
+
+func (x *MuxRequest) Reset() {
+	*x = MuxRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_proto_mux_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *MuxRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MuxRequest) ProtoMessage() {}
+
+func (x *MuxRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_mux_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MuxRequest.ProtoReflect.Descriptor instead.
+func (*MuxRequest) Descriptor() ([]byte, []int) {
+	return file_api_proto_mux_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *MuxRequest) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (m *MuxRequest) GetBody() isMuxRequest_Body {
+	if m != nil {
+		return m.Body
+	}
+	return nil
+}
+
+func (x *MuxRequest) GetProduce() *ProducerPayload {
+	if x, ok := x.GetBody().(*MuxRequest_Produce); ok {
+		return x.Produce
+	}
+	return nil
+}
+
+func (x *MuxRequest) GetSubscribe() *ConsumerPayload {
+	if x, ok := x.GetBody().(*MuxRequest_Subscribe); ok {
+		return x.Subscribe
+	}
+	return nil
+}
+
+func (x *MuxRequest) GetFetch() *Fetch {
+	if x, ok := x.GetBody().(*MuxRequest_Fetch); ok {
+		return x.Fetch
+	}
+	return nil
+}
+
+func (x *MuxRequest) GetUnsubscribe() uint64 {
+	if x, ok := x.GetBody().(*MuxRequest_Unsubscribe); ok {
+		return x.Unsubscribe
+	}
+	return 0
+}
+
+func (x *MuxRequest) GetAdmin() *Admin {
+	if x, ok := x.GetBody().(*MuxRequest_Admin); ok {
+		return x.Admin
+	}
+	return nil
+}
+
+func (x *MuxRequest) GetHeartbeat() bool {
+	if x, ok := x.GetBody().(*MuxRequest_Heartbeat); ok {
+		return x.Heartbeat
+	}
+	return false
+}
+
+func (x *MuxRequest) GetRelease() *Release {
+	if x, ok := x.GetBody().(*MuxRequest_Release); ok {
+		return x.Release
+	}
+	return nil
+}
+
+type isMuxRequest_Body interface {
+	isMuxRequest_Body()
+}
+
+type MuxRequest_Produce struct {
+	// produce writes the message, it is answered unless acks is ACKS_NONE.
+	Produce *ProducerPayload `protobuf:"bytes,2,opt,name=produce,proto3,oneof"`
+}
+
+type MuxRequest_Subscribe struct {
+	// subscribe opens the subscription identified by the request id.
+	Subscribe *ConsumerPayload `protobuf:"bytes,3,opt,name=subscribe,proto3,oneof"`
+}
+
+type MuxRequest_Fetch struct {
+	Fetch *Fetch `protobuf:"bytes,4,opt,name=fetch,proto3,oneof"`
+}
+
+type MuxRequest_Unsubscribe struct {
+	// unsubscribe closes the subscription of the id.
+	Unsubscribe uint64 `protobuf:"varint,5,opt,name=unsubscribe,proto3,oneof"`
+}
+
+type MuxRequest_Admin struct {
+	Admin *Admin `protobuf:"bytes,6,opt,name=admin,proto3,oneof"`
+}
+
+type MuxRequest_Heartbeat struct {
+	// heartbeat is answered with an empty response, the clients check the connection by it.
+	Heartbeat bool `protobuf:"varint,7,opt,name=heartbeat,proto3,oneof"`
+}
+
+type MuxRequest_Release struct {
+	// release closes the subscription as unsubscribe and moves its group back
+	// to the fetched messages the client did not deliver.
+	Release *Release `protobuf:"bytes,8,opt,name=release,proto3,oneof"`
+}
+
+func (*MuxRequest_Produce) isMuxRequest_Body() {}
+
+func (*MuxRequest_Subscribe) isMuxRequest_Body() {}
+
+func (*MuxRequest_Fetch) isMuxRequest_Body() {}
+
+func (*MuxRequest_Unsubscribe) isMuxRequest_Body() {}
+
+func (*MuxRequest_Admin) isMuxRequest_Body() {}
+
+func (*MuxRequest_Heartbeat) isMuxRequest_Body() {}
+
+func (*MuxRequest_Release) isMuxRequest_Body() {}
+
+type Release struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Subscription uint64      `protobuf:"varint,1,opt,name=subscription,proto3" json:"subscription,omitempty"`
+	Undelivered  []*Position `protobuf:"bytes,2,rep,name=undelivered,proto3" json:"undelivered,omitempty"`
+}
+
+func (x *Release) Reset() {
+	*x = Release{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_proto_mux_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Release) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Release) ProtoMessage() {}
+
+func (x *Release) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_mux_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Release.ProtoReflect.Descriptor instead.
+func (*Release) Descriptor() ([]byte, []int) {
+	return file_api_proto_mux_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Release) GetSubscription() uint64 {
+	if x != nil {
+		return x.Subscription
+	}
+	return 0
+}
+
+func (x *Release) GetUndelivered() []*Position {
+	if x != nil {
+		return x.Undelivered
+	}
+	return nil
+}
+
+// Position is a message of a topic by its offset.
+type Position struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Topic  string `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
+	Offset int64  `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
+}
+
+func (x *Position) Reset() {
+	*x = Position{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_proto_mux_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Position) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Position) ProtoMessage() {}
+
+func (x *Position) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_mux_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Position.ProtoReflect.Descriptor instead.
+func (*Position) Descriptor() ([]byte, []int) {
+	return file_api_proto_mux_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Position) GetTopic() string {
+	if x != nil {
+		return x.Topic
+	}
+	return ""
+}
+
+func (x *Position) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+// Fetch reads the next messages of a subscription.
+type Fetch struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Subscription uint64 `protobuf:"varint,1,opt,name=subscription,proto3" json:"subscription,omitempty"`
+	// max is the most messages answered, at least one.
+	Max int32 `protobuf:"varint,2,opt,name=max,proto3" json:"max,omitempty"`
+}
+
+func (x *Fetch) Reset() {
+	*x = Fetch{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_proto_mux_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Fetch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Fetch) ProtoMessage() {}
+
+func (x *Fetch) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_mux_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Fetch.ProtoReflect.Descriptor instead.
+func (*Fetch) Descriptor() ([]byte, []int) {
+	return file_api_proto_mux_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Fetch) GetSubscription() uint64 {
+	if x != nil {
+		return x.Subscription
+	}
+	return 0
+}
+
+func (x *Fetch) GetMax() int32 {
+	if x != nil {
+		return x.Max
+	}
+	return 0
+}
+
+type Admin struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Op    AdminOp `protobuf:"varint,1,opt,name=op,proto3,enum=messages.AdminOp" json:"op,omitempty"`
+	Topic string  `protobuf:"bytes,2,opt,name=topic,proto3" json:"topic,omitempty"`
+	// config is the json topic config of ADMIN_OP_CREATE_TOPIC as of the admin endpoints.
+	Config []byte `protobuf:"bytes,3,opt,name=config,proto3" json:"config,omitempty"`
+}
+
+func (x *Admin) Reset() {
+	*x = Admin{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_proto_mux_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Admin) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Admin) ProtoMessage() {}
+
+func (x *Admin) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_mux_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Admin.ProtoReflect.Descriptor instead.
+func (*Admin) Descriptor() ([]byte, []int) {
+	return file_api_proto_mux_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Admin) GetOp() AdminOp {
+	if x != nil {
+		return x.Op
+	}
+	return AdminOp_ADMIN_OP_NONE
+}
+
+func (x *Admin) GetTopic() string {
+	if x != nil {
+		return x.Topic
+	}
+	return ""
+}
+
+func (x *Admin) GetConfig() []byte {
+	if x != nil {
+		return x.Config
+	}
+	return nil
+}
+
+type MuxResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id        uint64 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	GoingAway bool   `protobuf:"varint,2,opt,name=goingAway,proto3" json:"goingAway,omitempty"`
+	// error is set for a failed request, the connection stays open.
+	Error *ErrorFormat `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	// Types that are assignable to Body:
+	//	*MuxResponse_Ask
+	//	*MuxResponse_Fetched
+	//	*MuxResponse_Topics
+	Body isMuxResponse_Body `protobuf_oneof:"body"`
+}
+
+func (x *MuxResponse) Reset() {
+	*x = MuxResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_proto_mux_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *MuxResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MuxResponse) ProtoMessage() {}
+
+func (x *MuxResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_mux_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MuxResponse.ProtoReflect.Descriptor instead.
+func (*MuxResponse) Descriptor() ([]byte, []int) {
+	return file_api_proto_mux_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *MuxResponse) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *MuxResponse) GetGoingAway() bool {
+	if x != nil {
+		return x.GoingAway
+	}
+	return false
+}
+
+func (x *MuxResponse) GetError() *ErrorFormat {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+func (m *MuxResponse) GetBody() isMuxResponse_Body {
+	if m != nil {
+		return m.Body
+	}
+	return nil
+}
+
+func (x *MuxResponse) GetAsk() *ProducerAsk {
+	if x, ok := x.GetBody().(*MuxResponse_Ask); ok {
+		return x.Ask
+	}
+	return nil
+}
+
+func (x *MuxResponse) GetFetched() *Fetched {
+	if x, ok := x.GetBody().(*MuxResponse_Fetched); ok {
+		return x.Fetched
+	}
+	return nil
+}
+
+func (x *MuxResponse) GetTopics() []byte {
+	if x, ok := x.GetBody().(*MuxResponse_Topics); ok {
+		return x.Topics
+	}
+	return nil
+}
+
+type isMuxResponse_Body interface {
+	isMuxResponse_Body()
+}
+
+type MuxResponse_Ask struct {
+	Ask *ProducerAsk `protobuf:"bytes,4,opt,name=ask,proto3,oneof"`
+}
+
+type MuxResponse_Fetched struct {
+	Fetched *Fetched `protobuf:"bytes,5,opt,name=fetched,proto3,oneof"`
+}
+
+type MuxResponse_Topics struct {
+	// topics is the json topic stats of ADMIN_OP_TOPICS as of the admin endpoints.
+	Topics []byte `protobuf:"bytes,6,opt,name=topics,proto3,oneof"`
+}
+
+func (*MuxResponse_Ask) isMuxResponse_Body() {}
+
+func (*MuxResponse_Fetched) isMuxResponse_Body() {}
+
+func (*MuxResponse_Topics) isMuxResponse_Body() {}
+
+// Fetched are the messages of a fetch, empty when the subscription is drained.
+type Fetched struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Messages []*ConsumerResponse `protobuf:"bytes,1,rep,name=messages,proto3" json:"messages,omitempty"`
+}
+
+func (x *Fetched) Reset() {
+	*x = Fetched{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_proto_mux_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Fetched) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Fetched) ProtoMessage() {}
+
+func (x *Fetched) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_mux_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Fetched.ProtoReflect.Descriptor instead.
+func (*Fetched) Descriptor() ([]byte, []int) {
+	return file_api_proto_mux_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Fetched) GetMessages() []*ConsumerResponse {
+	if x != nil {
+		return x.Messages
+	}
+	return nil
+}
+
+var File_api_proto_mux_proto protoreflect.FileDescriptor
+
+var file_api_proto_mux_proto_rawDesc = []byte{
+	0x0a, 0x13, 0x61, 0x70, 0x69, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x6d, 0x75, 0x78, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x08, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x1a,
+	0x14, 0x61, 0x70, 0x69, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x6d, 0x65, 0x74, 0x61, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x18, 0x61, 0x70, 0x69, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x2f, 0x70, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x65, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a,
+	0x18, 0x61, 0x70, 0x69, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x63, 0x6f, 0x6e, 0x73, 0x75,
+	0x6d, 0x65, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xd3, 0x02, 0x0a, 0x0a, 0x4d, 0x75,
+	0x78, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x04, 0x52, 0x02, 0x69, 0x64, 0x12, 0x2c, 0x0a, 0x07, 0x70, 0x72, 0x6f, 0x64,
+	0x75, 0x63, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x50, 0x72, 0x6f, 0x64,
+	0x75, 0x63, 0x65, 0x72, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x48, 0x00, 0x52, 0x07, 0x70,
+	0x72, 0x6f, 0x64, 0x75, 0x63, 0x65, 0x12, 0x3a, 0x0a, 0x09, 0x73, 0x75, 0x62, 0x73, 0x63, 0x72,
+	0x69, 0x62, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x65, 0x6e, 0x65,
+	0x72, 0x61, 0x74, 0x65, 0x64, 0x2e, 0x43, 0x6f, 0x6e, 0x73, 0x75, 0x6d, 0x65, 0x72, 0x50, 0x61,
+	0x79, 0x6c, 0x6f, 0x61, 0x64, 0x48, 0x00, 0x52, 0x09, 0x73, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69,
+	0x62, 0x65, 0x12, 0x27, 0x0a, 0x05, 0x66, 0x65, 0x74, 0x63, 0x68, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x0f, 0x2e, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x2e, 0x46, 0x65, 0x74,
+	0x63, 0x68, 0x48, 0x00, 0x52, 0x05, 0x66, 0x65, 0x74, 0x63, 0x68, 0x12, 0x22, 0x0a, 0x0b, 0x75,
+	0x6e, 0x73, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x04,
+	0x48, 0x00, 0x52, 0x0b, 0x75, 0x6e, 0x73, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x12,
+	0x27, 0x0a, 0x05, 0x61, 0x64, 0x6d, 0x69, 0x6e, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0f,
+	0x2e, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x2e, 0x41, 0x64, 0x6d, 0x69, 0x6e, 0x48,
+	0x00, 0x52, 0x05, 0x61, 0x64, 0x6d, 0x69, 0x6e, 0x12, 0x1e, 0x0a, 0x09, 0x68, 0x65, 0x61, 0x72,
+	0x74, 0x62, 0x65, 0x61, 0x74, 0x18, 0x07, 0x20, 0x01, 0x28, 0x08, 0x48, 0x00, 0x52, 0x09, 0x68,
+	0x65, 0x61, 0x72, 0x74, 0x62, 0x65, 0x61, 0x74, 0x12, 0x2d, 0x0a, 0x07, 0x72, 0x65, 0x6c, 0x65,
+	0x61, 0x73, 0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x6d, 0x65, 0x73, 0x73,
+	0x61, 0x67, 0x65, 0x73, 0x2e, 0x52, 0x65, 0x6c, 0x65, 0x61, 0x73, 0x65, 0x48, 0x00, 0x52, 0x07,
+	0x72, 0x65, 0x6c, 0x65, 0x61, 0x73, 0x65, 0x42, 0x06, 0x0a, 0x04, 0x62, 0x6f, 0x64, 0x79, 0x22,
+	0x63, 0x0a, 0x07, 0x52, 0x65, 0x6c, 0x65, 0x61, 0x73, 0x65, 0x12, 0x22, 0x0a, 0x0c, 0x73, 0x75,
+	0x62, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04,
+	0x52, 0x0c, 0x73, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x34,
+	0x0a, 0x0b, 0x75, 0x6e, 0x64, 0x65, 0x6c, 0x69, 0x76, 0x65, 0x72, 0x65, 0x64, 0x18, 0x02, 0x20,
+	0x03, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x2e, 0x50,
+	0x6f, 0x73, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x0b, 0x75, 0x6e, 0x64, 0x65, 0x6c, 0x69, 0x76,
+	0x65, 0x72, 0x65, 0x64, 0x22, 0x38, 0x0a, 0x08, 0x50, 0x6f, 0x73, 0x69, 0x74, 0x69, 0x6f, 0x6e,
+	0x12, 0x14, 0x0a, 0x05, 0x74, 0x6f, 0x70, 0x69, 0x63, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x05, 0x74, 0x6f, 0x70, 0x69, 0x63, 0x12, 0x16, 0x0a, 0x06, 0x6f, 0x66, 0x66, 0x73, 0x65, 0x74,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x06, 0x6f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x22, 0x3d,
+	0x0a, 0x05, 0x46, 0x65, 0x74, 0x63, 0x68, 0x12, 0x22, 0x0a, 0x0c, 0x73, 0x75, 0x62, 0x73, 0x63,
+	0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0c, 0x73,
+	0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x10, 0x0a, 0x03, 0x6d,
+	0x61, 0x78, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x03, 0x6d, 0x61, 0x78, 0x22, 0x58, 0x0a,
+	0x05, 0x41, 0x64, 0x6d, 0x69, 0x6e, 0x12, 0x21, 0x0a, 0x02, 0x6f, 0x70, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x0e, 0x32, 0x11, 0x2e, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x2e, 0x41, 0x64,
+	0x6d, 0x69, 0x6e, 0x4f, 0x70, 0x52, 0x02, 0x6f, 0x70, 0x12, 0x14, 0x0a, 0x05, 0x74, 0x6f, 0x70,
+	0x69, 0x63, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x74, 0x6f, 0x70, 0x69, 0x63, 0x12,
+	0x16, 0x0a, 0x06, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52,
+	0x06, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x22, 0xdb, 0x01, 0x0a, 0x0b, 0x4d, 0x75, 0x78, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x04, 0x52, 0x02, 0x69, 0x64, 0x12, 0x1c, 0x0a, 0x09, 0x67, 0x6f, 0x69, 0x6e, 0x67,
+	0x41, 0x77, 0x61, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x67, 0x6f, 0x69, 0x6e,
+	0x67, 0x41, 0x77, 0x61, 0x79, 0x12, 0x2b, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x2e,
+	0x45, 0x72, 0x72, 0x6f, 0x72, 0x46, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x52, 0x05, 0x65, 0x72, 0x72,
+	0x6f, 0x72, 0x12, 0x20, 0x0a, 0x03, 0x61, 0x73, 0x6b, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x0c, 0x2e, 0x50, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x65, 0x72, 0x41, 0x73, 0x6b, 0x48, 0x00, 0x52,
+	0x03, 0x61, 0x73, 0x6b, 0x12, 0x2d, 0x0a, 0x07, 0x66, 0x65, 0x74, 0x63, 0x68, 0x65, 0x64, 0x18,
+	0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73,
+	0x2e, 0x46, 0x65, 0x74, 0x63, 0x68, 0x65, 0x64, 0x48, 0x00, 0x52, 0x07, 0x66, 0x65, 0x74, 0x63,
+	0x68, 0x65, 0x64, 0x12, 0x18, 0x0a, 0x06, 0x74, 0x6f, 0x70, 0x69, 0x63, 0x73, 0x18, 0x06, 0x20,
+	0x01, 0x28, 0x0c, 0x48, 0x00, 0x52, 0x06, 0x74, 0x6f, 0x70, 0x69, 0x63, 0x73, 0x42, 0x06, 0x0a,
+	0x04, 0x62, 0x6f, 0x64, 0x79, 0x22, 0x42, 0x0a, 0x07, 0x46, 0x65, 0x74, 0x63, 0x68, 0x65, 0x64,
+	0x12, 0x37, 0x0a, 0x08, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03,
+	0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x64, 0x2e, 0x43,
+	0x6f, 0x6e, 0x73, 0x75, 0x6d, 0x65, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52,
+	0x08, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x2a, 0x67, 0x0a, 0x07, 0x41, 0x64, 0x6d,
+	0x69, 0x6e, 0x4f, 0x70, 0x12, 0x11, 0x0a, 0x0d, 0x41, 0x44, 0x4d, 0x49, 0x4e, 0x5f, 0x4f, 0x50,
+	0x5f, 0x4e, 0x4f, 0x4e, 0x45, 0x10, 0x00, 0x12, 0x13, 0x0a, 0x0f, 0x41, 0x44, 0x4d, 0x49, 0x4e,
+	0x5f, 0x4f, 0x50, 0x5f, 0x54, 0x4f, 0x50, 0x49, 0x43, 0x53, 0x10, 0x01, 0x12, 0x19, 0x0a, 0x15,
+	0x41, 0x44, 0x4d, 0x49, 0x4e, 0x5f, 0x4f, 0x50, 0x5f, 0x43, 0x52, 0x45, 0x41, 0x54, 0x45, 0x5f,
+	0x54, 0x4f, 0x50, 0x49, 0x43, 0x10, 0x02, 0x12, 0x19, 0x0a, 0x15, 0x41, 0x44, 0x4d, 0x49, 0x4e,
+	0x5f, 0x4f, 0x50, 0x5f, 0x44, 0x45, 0x4c, 0x45, 0x54, 0x45, 0x5f, 0x54, 0x4f, 0x50, 0x49, 0x43,
+	0x10, 0x03, 0x42, 0x19, 0x5a, 0x17, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x67, 0x65, 0x6e, 0x65, 0x72,
+	0x61, 0x74, 0x65, 0x64, 0x2f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x62, 0x06, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_api_proto_mux_proto_rawDescOnce sync.Once
+	file_api_proto_mux_proto_rawDescData = file_api_proto_mux_proto_rawDesc
+)
+
+func file_api_proto_mux_proto_rawDescGZIP() []byte {
+	file_api_proto_mux_proto_rawDescOnce.Do(func() {
+		file_api_proto_mux_proto_rawDescData = protoimpl.X.CompressGZIP(file_api_proto_mux_proto_rawDescData)
+	})
+	return file_api_proto_mux_proto_rawDescData
+}
+
+var file_api_proto_mux_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_api_proto_mux_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_api_proto_mux_proto_goTypes = []interface{}{
+	(AdminOp)(0),             // 0: messages.AdminOp
+	(*MuxRequest)(nil),       // 1: messages.MuxRequest
+	(*Release)(nil),          // 2: messages.Release
+	(*Position)(nil),         // 3: messages.Position
+	(*Fetch)(nil),            // 4: messages.Fetch
+	(*Admin)(nil),            // 5: messages.Admin
+	(*MuxResponse)(nil),      // 6: messages.MuxResponse
+	(*Fetched)(nil),          // 7: messages.Fetched
+	(*ProducerPayload)(nil),  // 8: ProducerPayload
+	(*ConsumerPayload)(nil),  // 9: generated.ConsumerPayload
+	(*ErrorFormat)(nil),      // 10: messages.ErrorFormat
+	(*ProducerAsk)(nil),      // 11: ProducerAsk
+	(*ConsumerResponse)(nil), // 12: generated.ConsumerResponse
+}
+var file_api_proto_mux_proto_depIdxs = []int32{
+	8,  // 0: messages.MuxRequest.produce:type_name -> ProducerPayload
+	9,  // 1: messages.MuxRequest.subscribe:type_name -> generated.ConsumerPayload
+	4,  // 2: messages.MuxRequest.fetch:type_name -> messages.Fetch
+	5,  // 3: messages.MuxRequest.admin:type_name -> messages.Admin
+	2,  // 4: messages.MuxRequest.release:type_name -> messages.Release
+	3,  // 5: messages.Release.undelivered:type_name -> messages.Position
+	0,  // 6: messages.Admin.op:type_name -> messages.AdminOp
+	10, // 7: messages.MuxResponse.error:type_name -> messages.ErrorFormat
+	11, // 8: messages.MuxResponse.ask:type_name -> ProducerAsk
+	7,  // 9: messages.MuxResponse.fetched:type_name -> messages.Fetched
+	12, // 10: messages.Fetched.messages:type_name -> generated.ConsumerResponse
+	11, // [11:11] is the sub-list for method output_type
+	11, // [11:11] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
+}
+
+func init() { file_api_proto_mux_proto_init() }
+func file_api_proto_mux_proto_init() {
+	if File_api_proto_mux_proto != nil {
+		return
+	}
+	file_api_proto_meta_proto_init()
+	file_api_proto_producer_proto_init()
+	file_api_proto_consumer_proto_init()
+	if !protoimpl.UnsafeEnabled {
+		file_api_proto_mux_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*MuxRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_proto_mux_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Release); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_proto_mux_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Position); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_proto_mux_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Fetch); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_proto_mux_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Admin); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_proto_mux_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*MuxResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_proto_mux_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Fetched); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_api_proto_mux_proto_msgTypes[0].OneofWrappers = []interface{}{
+		(*MuxRequest_Produce)(nil),
+		(*MuxRequest_Subscribe)(nil),
+		(*MuxRequest_Fetch)(nil),
+		(*MuxRequest_Unsubscribe)(nil),
+		(*MuxRequest_Admin)(nil),
+		(*MuxRequest_Heartbeat)(nil),
+		(*MuxRequest_Release)(nil),
+	}
+	file_api_proto_mux_proto_msgTypes[5].OneofWrappers = []interface{}{
+		(*MuxResponse_Ask)(nil),
+		(*MuxResponse_Fetched)(nil),
+		(*MuxResponse_Topics)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_api_proto_mux_proto_rawDesc,
+			NumEnums:      1,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_api_proto_mux_proto_goTypes,
+		DependencyIndexes: file_api_proto_mux_proto_depIdxs,
+		EnumInfos:         file_api_proto_mux_proto_enumTypes,
+		MessageInfos:      file_api_proto_mux_proto_msgTypes,
+	}.Build()
+	File_api_proto_mux_proto = out.File
+	file_api_proto_mux_proto_rawDesc = nil
+	file_api_proto_mux_proto_goTypes = nil
+	file_api_proto_mux_proto_depIdxs = nil
+}
@@ -20,13 +20,148 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// Acks is a level of the producer message acknowledgement.
+type Acks int32
+
+const (
+	// ACKS_ALL asks after the message is written and replicated.
+	Acks_ACKS_ALL Acks = 0
+	// ACKS_LEADER asks after the message is written, before replication.
+	Acks_ACKS_LEADER Acks = 1
+	// ACKS_NONE never asks.
+	Acks_ACKS_NONE Acks = 2
+)
+
+// Enum value maps for Acks.
+var (
+	Acks_name = map[int32]string{
+		0: "ACKS_ALL",
+		1: "ACKS_LEADER",
+		2: "ACKS_NONE",
+	}
+	Acks_value = map[string]int32{
+		"ACKS_ALL":    0,
+		"ACKS_LEADER": 1,
+		"ACKS_NONE":   2,
+	}
+)
+
+func (x Acks) Enum() *Acks {
+	p := new(Acks)
+	*p = x
+	return p
+}
+
+func (x Acks) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Acks) Descriptor() protoreflect.EnumDescriptor {
+	return file_api_proto_producer_proto_enumTypes[0].Descriptor()
+}
+
+func (Acks) Type() protoreflect.EnumType {
+	return &file_api_proto_producer_proto_enumTypes[0]
+}
+
+func (x Acks) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Acks.Descriptor instead.
+func (Acks) EnumDescriptor() ([]byte, []int) {
+	return file_api_proto_producer_proto_rawDescGZIP(), []int{0}
+}
+
+// TxnOp is a transaction control request, the payload carries no message.
+type TxnOp int32
+
+const (
+	TxnOp_TXN_OP_NONE TxnOp = 0
+	// TXN_OP_BEGIN begins a transaction, its id is returned in the ask.
+	TxnOp_TXN_OP_BEGIN  TxnOp = 1
+	TxnOp_TXN_OP_COMMIT TxnOp = 2
+	TxnOp_TXN_OP_ABORT  TxnOp = 3
+	// TXN_OP_OFFSET commits the offset of the group on the topic with the transaction.
+	TxnOp_TXN_OP_OFFSET TxnOp = 4
+)
+
+// Enum value maps for TxnOp.
+var (
+	TxnOp_name = map[int32]string{
+		0: "TXN_OP_NONE",
+		1: "TXN_OP_BEGIN",
+		2: "TXN_OP_COMMIT",
+		3: "TXN_OP_ABORT",
+		4: "TXN_OP_OFFSET",
+	}
+	TxnOp_value = map[string]int32{
+		"TXN_OP_NONE":   0,
+		"TXN_OP_BEGIN":  1,
+		"TXN_OP_COMMIT": 2,
+		"TXN_OP_ABORT":  3,
+		"TXN_OP_OFFSET": 4,
+	}
+)
+
+func (x TxnOp) Enum() *TxnOp {
+	p := new(TxnOp)
+	*p = x
+	return p
+}
+
+func (x TxnOp) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (TxnOp) Descriptor() protoreflect.EnumDescriptor {
+	return file_api_proto_producer_proto_enumTypes[1].Descriptor()
+}
+
+func (TxnOp) Type() protoreflect.EnumType {
+	return &file_api_proto_producer_proto_enumTypes[1]
+}
+
+func (x TxnOp) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use TxnOp.Descriptor instead.
+func (TxnOp) EnumDescriptor() ([]byte, []int) {
+	return file_api_proto_producer_proto_rawDescGZIP(), []int{1}
+}
+
 type ProducerPayload struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Topic   string `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
-	Message []byte `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Topic   string            `protobuf:"bytes,1,opt,name=topic,proto3" json:"topic,omitempty"`
+	Message []byte            `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Headers map[string]string `protobuf:"bytes,3,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Key     string            `protobuf:"bytes,4,opt,name=key,proto3" json:"key,omitempty"`
+	Acks    Acks              `protobuf:"varint,5,opt,name=acks,proto3,enum=Acks" json:"acks,omitempty"`
+	// deliverAt holds the message until the unix nano timestamp.
+	DeliverAt *int64 `protobuf:"varint,6,opt,name=deliverAt,proto3,oneof" json:"deliverAt,omitempty"`
+	// delay holds the message for the nanoseconds counted by the broker clock,
+	// it is used when deliverAt is not set.
+	Delay *int64 `protobuf:"varint,7,opt,name=delay,proto3,oneof" json:"delay,omitempty"`
+	// ttl is the nanoseconds the message lives after it becomes visible,
+	// zero is the topic default.
+	Ttl int64 `protobuf:"varint,8,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	// priority from 0 to 9 orders the delivery of a priority topic, higher first.
+	Priority int32 `protobuf:"varint,9,opt,name=priority,proto3" json:"priority,omitempty"`
+	// txn is the transaction the message is written in, zero is none.
+	Txn uint64 `protobuf:"varint,10,opt,name=txn,proto3" json:"txn,omitempty"`
+	// txnOp controls the txn transaction, a control request is always asked.
+	TxnOp TxnOp `protobuf:"varint,11,opt,name=txnOp,proto3,enum=TxnOp" json:"txnOp,omitempty"`
+	// txnTimeout is the nanoseconds a begun transaction is aborted after,
+	// zero is the broker default.
+	TxnTimeout int64 `protobuf:"varint,12,opt,name=txnTimeout,proto3" json:"txnTimeout,omitempty"`
+	// group and offset are the consumer group offset committed by TXN_OP_OFFSET,
+	// the offset is of the next message the group reads.
+	Group  string `protobuf:"bytes,13,opt,name=group,proto3" json:"group,omitempty"`
+	Offset int64  `protobuf:"varint,14,opt,name=offset,proto3" json:"offset,omitempty"`
 }
 
 func (x *ProducerPayload) Reset() {
@@ -75,12 +210,103 @@ func (x *ProducerPayload) GetMessage() []byte {
 	return nil
 }
 
+func (x *ProducerPayload) GetHeaders() map[string]string {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+func (x *ProducerPayload) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *ProducerPayload) GetAcks() Acks {
+	if x != nil {
+		return x.Acks
+	}
+	return Acks_ACKS_ALL
+}
+
+func (x *ProducerPayload) GetDeliverAt() int64 {
+	if x != nil && x.DeliverAt != nil {
+		return *x.DeliverAt
+	}
+	return 0
+}
+
+func (x *ProducerPayload) GetDelay() int64 {
+	if x != nil && x.Delay != nil {
+		return *x.Delay
+	}
+	return 0
+}
+
+func (x *ProducerPayload) GetTtl() int64 {
+	if x != nil {
+		return x.Ttl
+	}
+	return 0
+}
+
+func (x *ProducerPayload) GetPriority() int32 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+func (x *ProducerPayload) GetTxn() uint64 {
+	if x != nil {
+		return x.Txn
+	}
+	return 0
+}
+
+func (x *ProducerPayload) GetTxnOp() TxnOp {
+	if x != nil {
+		return x.TxnOp
+	}
+	return TxnOp_TXN_OP_NONE
+}
+
+func (x *ProducerPayload) GetTxnTimeout() int64 {
+	if x != nil {
+		return x.TxnTimeout
+	}
+	return 0
+}
+
+func (x *ProducerPayload) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *ProducerPayload) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
 type ProducerAsk struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Ask bool `protobuf:"varint,1,opt,name=ask,proto3" json:"ask,omitempty"`
+	Ask       bool `protobuf:"varint,1,opt,name=ask,proto3" json:"ask,omitempty"`
+	GoingAway bool `protobuf:"varint,2,opt,name=goingAway,proto3" json:"goingAway,omitempty"`
+	// error is the reason a transaction control request failed, ask is false.
+	Error string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	// txn is the id of the begun transaction.
+	Txn uint64 `protobuf:"varint,4,opt,name=txn,proto3" json:"txn,omitempty"`
+	// failure is the typed error of the not asked request.
+	Failure *ErrorFormat `protobuf:"bytes,5,opt,name=failure,proto3" json:"failure,omitempty"`
 }
 
 func (x *ProducerAsk) Reset() {
@@ -122,20 +348,92 @@ func (x *ProducerAsk) GetAsk() bool {
 	return false
 }
 
+func (x *ProducerAsk) GetGoingAway() bool {
+	if x != nil {
+		return x.GoingAway
+	}
+	return false
+}
+
+func (x *ProducerAsk) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *ProducerAsk) GetTxn() uint64 {
+	if x != nil {
+		return x.Txn
+	}
+	return 0
+}
+
+func (x *ProducerAsk) GetFailure() *ErrorFormat {
+	if x != nil {
+		return x.Failure
+	}
+	return nil
+}
+
 var File_api_proto_producer_proto protoreflect.FileDescriptor
 
 var file_api_proto_producer_proto_rawDesc = []byte{
 	0x0a, 0x18, 0x61, 0x70, 0x69, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x70, 0x72, 0x6f, 0x64,
-	0x75, 0x63, 0x65, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x41, 0x0a, 0x0f, 0x50, 0x72,
-	0x6f, 0x64, 0x75, 0x63, 0x65, 0x72, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x12, 0x14, 0x0a,
-	0x05, 0x74, 0x6f, 0x70, 0x69, 0x63, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x74, 0x6f,
-	0x70, 0x69, 0x63, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x02,
-	0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x22, 0x1f, 0x0a,
-	0x0b, 0x50, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x65, 0x72, 0x41, 0x73, 0x6b, 0x12, 0x10, 0x0a, 0x03,
-	0x61, 0x73, 0x6b, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x03, 0x61, 0x73, 0x6b, 0x42, 0x19,
-	0x5a, 0x17, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x64,
-	0x2f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x33,
+	0x75, 0x63, 0x65, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x14, 0x61, 0x70, 0x69, 0x2f,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x6d, 0x65, 0x74, 0x61, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x22, 0xe5, 0x03, 0x0a, 0x0f, 0x50, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x65, 0x72, 0x50, 0x61, 0x79,
+	0x6c, 0x6f, 0x61, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x74, 0x6f, 0x70, 0x69, 0x63, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x05, 0x74, 0x6f, 0x70, 0x69, 0x63, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x07, 0x6d, 0x65, 0x73,
+	0x73, 0x61, 0x67, 0x65, 0x12, 0x37, 0x0a, 0x07, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x18,
+	0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1d, 0x2e, 0x50, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x65, 0x72,
+	0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x2e, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x45,
+	0x6e, 0x74, 0x72, 0x79, 0x52, 0x07, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x12, 0x10, 0x0a,
+	0x03, 0x6b, 0x65, 0x79, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12,
+	0x19, 0x0a, 0x04, 0x61, 0x63, 0x6b, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x05, 0x2e,
+	0x41, 0x63, 0x6b, 0x73, 0x52, 0x04, 0x61, 0x63, 0x6b, 0x73, 0x12, 0x21, 0x0a, 0x09, 0x64, 0x65,
+	0x6c, 0x69, 0x76, 0x65, 0x72, 0x41, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28, 0x03, 0x48, 0x00, 0x52,
+	0x09, 0x64, 0x65, 0x6c, 0x69, 0x76, 0x65, 0x72, 0x41, 0x74, 0x88, 0x01, 0x01, 0x12, 0x19, 0x0a,
+	0x05, 0x64, 0x65, 0x6c, 0x61, 0x79, 0x18, 0x07, 0x20, 0x01, 0x28, 0x03, 0x48, 0x01, 0x52, 0x05,
+	0x64, 0x65, 0x6c, 0x61, 0x79, 0x88, 0x01, 0x01, 0x12, 0x10, 0x0a, 0x03, 0x74, 0x74, 0x6c, 0x18,
+	0x08, 0x20, 0x01, 0x28, 0x03, 0x52, 0x03, 0x74, 0x74, 0x6c, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x72,
+	0x69, 0x6f, 0x72, 0x69, 0x74, 0x79, 0x18, 0x09, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x70, 0x72,
+	0x69, 0x6f, 0x72, 0x69, 0x74, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x74, 0x78, 0x6e, 0x18, 0x0a, 0x20,
+	0x01, 0x28, 0x04, 0x52, 0x03, 0x74, 0x78, 0x6e, 0x12, 0x1c, 0x0a, 0x05, 0x74, 0x78, 0x6e, 0x4f,
+	0x70, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x06, 0x2e, 0x54, 0x78, 0x6e, 0x4f, 0x70, 0x52,
+	0x05, 0x74, 0x78, 0x6e, 0x4f, 0x70, 0x12, 0x1e, 0x0a, 0x0a, 0x74, 0x78, 0x6e, 0x54, 0x69, 0x6d,
+	0x65, 0x6f, 0x75, 0x74, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0a, 0x74, 0x78, 0x6e, 0x54,
+	0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x67, 0x72, 0x6f, 0x75, 0x70, 0x18,
+	0x0d, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x67, 0x72, 0x6f, 0x75, 0x70, 0x12, 0x16, 0x0a, 0x06,
+	0x6f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x03, 0x52, 0x06, 0x6f, 0x66,
+	0x66, 0x73, 0x65, 0x74, 0x1a, 0x3a, 0x0a, 0x0c, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x45,
+	0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01,
+	0x42, 0x0c, 0x0a, 0x0a, 0x5f, 0x64, 0x65, 0x6c, 0x69, 0x76, 0x65, 0x72, 0x41, 0x74, 0x42, 0x08,
+	0x0a, 0x06, 0x5f, 0x64, 0x65, 0x6c, 0x61, 0x79, 0x22, 0x96, 0x01, 0x0a, 0x0b, 0x50, 0x72, 0x6f,
+	0x64, 0x75, 0x63, 0x65, 0x72, 0x41, 0x73, 0x6b, 0x12, 0x10, 0x0a, 0x03, 0x61, 0x73, 0x6b, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x03, 0x61, 0x73, 0x6b, 0x12, 0x1c, 0x0a, 0x09, 0x67, 0x6f,
+	0x69, 0x6e, 0x67, 0x41, 0x77, 0x61, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x67,
+	0x6f, 0x69, 0x6e, 0x67, 0x41, 0x77, 0x61, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f,
+	0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x10,
+	0x0a, 0x03, 0x74, 0x78, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x04, 0x52, 0x03, 0x74, 0x78, 0x6e,
+	0x12, 0x2f, 0x0a, 0x07, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x15, 0x2e, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x2e, 0x45, 0x72, 0x72,
+	0x6f, 0x72, 0x46, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x52, 0x07, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72,
+	0x65, 0x2a, 0x34, 0x0a, 0x04, 0x41, 0x63, 0x6b, 0x73, 0x12, 0x0c, 0x0a, 0x08, 0x41, 0x43, 0x4b,
+	0x53, 0x5f, 0x41, 0x4c, 0x4c, 0x10, 0x00, 0x12, 0x0f, 0x0a, 0x0b, 0x41, 0x43, 0x4b, 0x53, 0x5f,
+	0x4c, 0x45, 0x41, 0x44, 0x45, 0x52, 0x10, 0x01, 0x12, 0x0d, 0x0a, 0x09, 0x41, 0x43, 0x4b, 0x53,
+	0x5f, 0x4e, 0x4f, 0x4e, 0x45, 0x10, 0x02, 0x2a, 0x62, 0x0a, 0x05, 0x54, 0x78, 0x6e, 0x4f, 0x70,
+	0x12, 0x0f, 0x0a, 0x0b, 0x54, 0x58, 0x4e, 0x5f, 0x4f, 0x50, 0x5f, 0x4e, 0x4f, 0x4e, 0x45, 0x10,
+	0x00, 0x12, 0x10, 0x0a, 0x0c, 0x54, 0x58, 0x4e, 0x5f, 0x4f, 0x50, 0x5f, 0x42, 0x45, 0x47, 0x49,
+	0x4e, 0x10, 0x01, 0x12, 0x11, 0x0a, 0x0d, 0x54, 0x58, 0x4e, 0x5f, 0x4f, 0x50, 0x5f, 0x43, 0x4f,
+	0x4d, 0x4d, 0x49, 0x54, 0x10, 0x02, 0x12, 0x10, 0x0a, 0x0c, 0x54, 0x58, 0x4e, 0x5f, 0x4f, 0x50,
+	0x5f, 0x41, 0x42, 0x4f, 0x52, 0x54, 0x10, 0x03, 0x12, 0x11, 0x0a, 0x0d, 0x54, 0x58, 0x4e, 0x5f,
+	0x4f, 0x50, 0x5f, 0x4f, 0x46, 0x46, 0x53, 0x45, 0x54, 0x10, 0x04, 0x42, 0x19, 0x5a, 0x17, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x65, 0x64, 0x2f, 0x6d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -150,17 +448,26 @@ func file_api_proto_producer_proto_rawDescGZIP() []byte {
 	return file_api_proto_producer_proto_rawDescData
 }
 
-var file_api_proto_producer_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_api_proto_producer_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_api_proto_producer_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
 var file_api_proto_producer_proto_goTypes = []interface{}{
-	(*ProducerPayload)(nil), // 0: ProducerPayload
-	(*ProducerAsk)(nil),     // 1: ProducerAsk
+	(Acks)(0),               // 0: Acks
+	(TxnOp)(0),              // 1: TxnOp
+	(*ProducerPayload)(nil), // 2: ProducerPayload
+	(*ProducerAsk)(nil),     // 3: ProducerAsk
+	nil,                     // 4: ProducerPayload.HeadersEntry
+	(*ErrorFormat)(nil),     // 5: messages.ErrorFormat
 }
 var file_api_proto_producer_proto_depIdxs = []int32{
-	0, // [0:0] is the sub-list for method output_type
-	0, // [0:0] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	4, // 0: ProducerPayload.headers:type_name -> ProducerPayload.HeadersEntry
+	0, // 1: ProducerPayload.acks:type_name -> Acks
+	1, // 2: ProducerPayload.txnOp:type_name -> TxnOp
+	5, // 3: ProducerAsk.failure:type_name -> messages.ErrorFormat
+	4, // [4:4] is the sub-list for method output_type
+	4, // [4:4] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
 }
 
 func init() { file_api_proto_producer_proto_init() }
@@ -168,6 +475,7 @@ func file_api_proto_producer_proto_init() {
 	if File_api_proto_producer_proto != nil {
 		return
 	}
+	file_api_proto_meta_proto_init()
 	if !protoimpl.UnsafeEnabled {
 		file_api_proto_producer_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*ProducerPayload); i {
@@ -194,18 +502,20 @@ func file_api_proto_producer_proto_init() {
 			}
 		}
 	}
+	file_api_proto_producer_proto_msgTypes[0].OneofWrappers = []interface{}{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_api_proto_producer_proto_rawDesc,
-			NumEnums:      0,
-			NumMessages:   2,
+			NumEnums:      2,
+			NumMessages:   3,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
 		GoTypes:           file_api_proto_producer_proto_goTypes,
 		DependencyIndexes: file_api_proto_producer_proto_depIdxs,
+		EnumInfos:         file_api_proto_producer_proto_enumTypes,
 		MessageInfos:      file_api_proto_producer_proto_msgTypes,
 	}.Build()
 	File_api_proto_producer_proto = out.File